@@ -18,8 +18,9 @@ interface LogEntry { ID: number; Timestamp: string; Type: string; TargetVM: stri
 interface Schedule { ID: number; CronString: string; VMList: string; Destination: string; Enabled: boolean; }
 interface Settings { BackupPath: string; ServerPort: string; ApiKey: string; Mode: string; Theme: string; RetentionCount: number; Archiver: string; CompressionLevel: number; S3Endpoint: string; S3Region: string; S3Bucket: string; S3AccessKey: string; S3SecretKey: string; S3Prefix: string; S3Enabled: boolean; S3RetentionCount: number; TelegramBotToken: string; TelegramChatID: string; TelegramEnabled: boolean; TelegramOnlyErrors: boolean; LogRetentionCount: number; SwaggerEnabled: boolean; [key: string]: any; }
 interface BackupFile { vmName: string; fileName: string; filePath: string; size: number; date: string; }
+interface UserPreferences { theme?: string; bgColor?: string; bgImage?: string; }
 interface RoleSectionPolicy { overview: boolean; statistics: boolean; storage: boolean; settings: boolean; security: boolean; }
-interface CentralConfig { pollIntervalSec: number; port: string; caddyDomain: string; licenseKey?: string; licenseServer?: string; licensePubKey?: string; licenseStatus?: string; licenseReason?: string; licenseExpires?: string; licenseChecked?: string; licenseGraceTo?: string; licenseLastErr?: string; theme: string; language: string; retentionDays: number; bgColor: string; bgImage: string; rolePolicies?: Record<string, UserHostPermission[]>; roleSections?: Record<string, RoleSectionPolicy>; }
+interface CentralConfig { pollIntervalSec: number; port: string; caddyDomain: string; licenseKey?: string; licenseServer?: string; licensePubKey?: string; licenseStatus?: string; licenseReason?: string; licenseExpires?: string; licenseChecked?: string; licenseGraceTo?: string; licenseLastErr?: string; theme: string; language: string; retentionDays: number; defaultAgentPort?: number; bgColor: string; bgImage: string; rolePolicies?: Record<string, UserHostPermission[]>; roleSections?: Record<string, RoleSectionPolicy>; }
 interface LicenseStatusResponse { status?: string; reason?: string; expiresAt?: string; checkedAt?: string; graceUntil?: string; lastError?: string; publicKey?: string; server?: string; configured?: boolean; writeEnabled?: boolean; }
 interface HostStat { agentId: string; name: string; status: string; cpu: number; ramPct: number; ramUsedGB: number; ramTotalGB: number; vmTotal: number; vmRunning: number; disks: { drive: string; totalGB: number; freeGB: number; usePct: number }[]; uptime: string; os: string; }
 interface AggStats { hosts: HostStat[]; totalHosts: number; onlineHosts: number; totalVMs: number; runningVMs: number; avgCpu: number; avgRam: number; totalRamGB: number; usedRamGB: number; totalDiskGB: number; usedDiskGB: number; }
@@ -238,6 +239,9 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
   const [showAddModal, setShowAddModal] = useState(false);
   const [addForm, setAddForm] = useState({ url: '', apiKey: '' });
   const [addError, setAddError] = useState('');
+  const [showPwModal, setShowPwModal] = useState(false);
+  const [pwForm, setPwForm] = useState({ current: '', next: '' });
+  const [pwError, setPwError] = useState('');
   const [vmSearch, setVmSearch] = useState('');
   const [vmFilter, setVmFilter] = useState<VMFilter>('all');
   const [actionLoading, setActionLoading] = useState<string | null>(null);
@@ -305,6 +309,7 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
   // Statistics & Central Config
   const [aggStats, setAggStats] = useState<AggStats | null>(null);
   const [centralCfg, setCentralCfg] = useState<CentralConfig | null>(null);
+  const [prefs, setPrefs] = useState<UserPreferences>({});
   const [cfgSaving, setCfgSaving] = useState(false);
   const [cfgImporting, setCfgImporting] = useState(false);
   const [caddyRecheckLoading, setCaddyRecheckLoading] = useState(false);
@@ -463,6 +468,7 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
     }) : prev);
   }, []);
   const fetchCentralCfg = useCallback(async () => { try { setCentralCfg(await fetchJSON<CentralConfig>(`${API}/config`)); } catch {} }, []);
+  const fetchPrefs = useCallback(async () => { try { setPrefs(await fetchJSON<UserPreferences>(`${API}/auth/preferences`)); } catch {} }, []);
   const fetchLicenseStatus = useCallback(async () => {
     try {
       const data = await fetchJSON<LicenseStatusResponse>(`${API}/license/status`);
@@ -718,11 +724,7 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
       if (r.ok) {
         toast('Фон удалён', 'success');
         fetchBgList();
-        if (centralCfg?.bgImage === name) {
-          const next = { ...centralCfg, bgImage: '' };
-          setCentralCfg(next);
-          await saveCentralCfg(next);
-        }
+        if (prefs.bgImage === name) await savePrefs({ ...prefs, bgImage: '' });
       }
     } catch { toast('Ошибка удаления', 'error'); }
   };
@@ -929,6 +931,17 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
     window.open(`${API}/agents/${davAgent}/proxy/api/v1/webdav/download?key=${encodeURIComponent(key)}`, '_blank');
   };
 
+  // Theme and background are per-user preferences, not part of the central config.
+  const savePrefs = async (next: UserPreferences): Promise<boolean> => {
+    setPrefs(next);
+    try {
+      const r = await authFetch(`${API}/auth/preferences`, { method: 'PUT', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(next) });
+      const d = await r.json().catch(() => ({}));
+      if (!r.ok) { toast(d.error || 'Ошибка сохранения оформления', 'error'); fetchPrefs(); return false; }
+      setPrefs(d);
+      return true;
+    } catch { toast('Ошибка сохранения оформления', 'error'); return false; }
+  };
   const saveCentralCfg = async (cfg: CentralConfig): Promise<boolean> => {
     setCfgSaving(true);
     let ok = false;
@@ -966,13 +979,15 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
     }
   };
   const restoreCentralConfigBackup = async (file: File) => {
+    const password = window.prompt('Восстановление перезапишет текущую конфигурацию. Введите ваш пароль для подтверждения:');
+    if (password === null) return;
     setCfgImporting(true);
     try {
       const text = await file.text();
       const parsed = JSON.parse(text);
       const r = await authFetch(`${API}/config/restore`, {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: { 'Content-Type': 'application/json', 'X-Confirm-Password': password },
         body: JSON.stringify(parsed),
       });
       const data = await r.json().catch(() => ({}));
@@ -1120,7 +1135,7 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
     setPolicyModalRole(null);
   };
 
-  useEffect(() => { fetchCentralCfg(); }, [fetchCentralCfg]);
+  useEffect(() => { fetchCentralCfg(); fetchPrefs(); }, [fetchCentralCfg, fetchPrefs]);
   useEffect(() => { fetchAgents(); fetchOverview(); const i = setInterval(() => { fetchAgents(); fetchOverview(); }, 10000); return () => clearInterval(i); }, [fetchAgents, fetchOverview]);
   useEffect(() => { if (selectedAgent) { setCpuHistory([]); setRamHistory([]); setHostHistory([]); fetchAgentData(selectedAgent); fetchHistory(selectedAgent); const i = setInterval(() => { fetchAgentData(selectedAgent); fetchHistory(selectedAgent); }, 15000); return () => clearInterval(i); } }, [selectedAgent, fetchAgentData, fetchHistory]);
   // Track CPU/RAM history
@@ -1161,6 +1176,19 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
     if (!addForm.url) { setAddError('URL обязателен'); return; }
     try { await fetchJSON<Agent>(`${API}/agents`, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(addForm) }); setShowAddModal(false); setAddForm({ url: '', apiKey: '' }); fetchAgents(); fetchOverview(); toast('Хост добавлен', 'success'); } catch (e: any) { setAddError(e.message); }
   };
+  // Changing the password revokes every other token; keep the fresh one the server returns.
+  const handleChangePassword = async () => {
+    setPwError('');
+    if (!pwForm.next) { setPwError('Введите новый пароль'); return; }
+    try {
+      const r = await authFetch(`${API}/auth/password`, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ currentPassword: pwForm.current, newPassword: pwForm.next }) });
+      const d = await r.json().catch(() => ({}));
+      if (!r.ok) { setPwError(d.error || 'Ошибка смены пароля'); return; }
+      localStorage.setItem(AUTH_KEY, JSON.stringify({ ...auth, token: d.token }));
+      setShowPwModal(false); setPwForm({ current: '', next: '' });
+      toast('Пароль изменён, остальные сеансы завершены', 'success');
+    } catch { setPwError('Ошибка сети'); }
+  };
   const confirmDeleteAgent = async () => {
     if (!deleteAgentId) return;
     try { await authFetch(`${API}/agents/${deleteAgentId}`, { method: 'DELETE' }); toast('Хост удалён', 'success'); fetchAgents(); fetchOverview(); if (selectedAgent === deleteAgentId) goOverview(); } catch { toast('Ошибка удаления хоста', 'error'); }
@@ -1707,7 +1735,7 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
 
   return (
     <div className="app">
-      <div className="app-bg" style={centralCfg?.bgImage ? { background: `url(${API}/backgrounds/${centralCfg.bgImage}) center/cover no-repeat` } : centralCfg?.bgColor ? { background: centralCfg.bgColor } : undefined}></div>
+      <div className="app-bg" style={prefs.bgImage ? { background: `url(${API}/backgrounds/${prefs.bgImage}) center/cover no-repeat` } : prefs.bgColor ? { background: prefs.bgColor } : undefined}></div>
       {/* Toast notifications */}
       <div className="toast-container">
         {toasts.map(t => (
@@ -1771,6 +1799,7 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
             <span className="sidebar-user-name">{auth.user.username}</span>
             <span className="sidebar-user-role">{auth.user.role}</span>
           </div>
+          <button className="sidebar-logout" onClick={() => { setPwError(''); setShowPwModal(true); }} title="Сменить пароль">🔑</button>
           <button className="sidebar-logout" onClick={onLogout} title="Выйти">⏻</button>
         </div>
       </aside>
@@ -2230,12 +2259,16 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
                     <label className="cfg-label">Хранить данные (дней)</label>
                     <input className="modal-input" type="number" min={1} value={centralCfg.retentionDays} onChange={e => setCentralCfg({...centralCfg, retentionDays: parseInt(e.target.value) || 30})} style={{width: 120}} />
                   </div>
+                  <div className="cfg-row">
+                    <label className="cfg-label">Порт агентов по умолчанию</label>
+                    <input className="modal-input" type="number" min={1} max={65535} value={centralCfg.defaultAgentPort || ''} onChange={e => setCentralCfg({...centralCfg, defaultAgentPort: parseInt(e.target.value) || 0})} placeholder="9000" style={{width: 120}} />
+                  </div>
                 </div>
                 <div className="cfg-section">
                   <h3>Интерфейс</h3>
                   <div className="cfg-row">
                     <label className="cfg-label">Тема</label>
-                    <select className="modal-input" value={centralCfg.theme} onChange={e => setCentralCfg({...centralCfg, theme: e.target.value})} style={{width: 180}}>
+                    <select className="modal-input" value={prefs.theme || 'light'} onChange={e => setPrefs({...prefs, theme: e.target.value})} style={{width: 180}}>
                       <option value="light">Светлая</option>
                       <option value="dark">Тёмная</option>
                     </select>
@@ -2280,8 +2313,8 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
                   <div className="cfg-row">
                     <label className="cfg-label">Цвет фона</label>
                     <div style={{display:'flex',alignItems:'center',gap:8}}>
-                      <input type="color" value={centralCfg.bgColor || '#2d6a4f'} onChange={e => setCentralCfg({...centralCfg, bgColor: e.target.value, bgImage: ''})} className="cfg-color-picker" />
-                      <span style={{fontSize:12,color:'var(--text-muted)'}}>{centralCfg.bgColor || 'по умолчанию'}</span>
+                      <input type="color" value={prefs.bgColor || '#2d6a4f'} onChange={e => setPrefs({...prefs, bgColor: e.target.value, bgImage: ''})} className="cfg-color-picker" />
+                      <span style={{fontSize:12,color:'var(--text-muted)'}}>{prefs.bgColor || 'по умолчанию'}</span>
                     </div>
                   </div>
                   <div className="cfg-row-col">
@@ -2293,21 +2326,13 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
                         if (file.size > 10 * 1024 * 1024) { toast('Макс. размер 10 МБ', 'error'); return; }
                         setBgUploading(true);
                         const name = await uploadBg(file);
-                        if (name) {
-                          const next = {...centralCfg, bgImage: name, bgColor: ''};
-                          setCentralCfg(next);
-                          await saveCentralCfg(next);
-                        }
+                        if (name) await savePrefs({...prefs, bgImage: name, bgColor: ''});
                         setBgUploading(false);
                         e.target.value = '';
                       }} />
                       <button className="btn-secondary" disabled={bgUploading} onClick={() => document.getElementById('bg-upload')?.click()}>{bgUploading ? 'Загрузка...' : 'Загрузить фон'}</button>
-                      {(centralCfg.bgImage || centralCfg.bgColor) && (
-                        <button className="btn-secondary" onClick={async () => {
-                          const next = {...centralCfg, bgColor: '', bgImage: ''};
-                          setCentralCfg(next);
-                          await saveCentralCfg(next);
-                        }}>Сбросить</button>
+                      {(prefs.bgImage || prefs.bgColor) && (
+                        <button className="btn-secondary" onClick={() => savePrefs({...prefs, bgColor: '', bgImage: ''})}>Сбросить</button>
                       )}
                     </div>
                   </div>
@@ -2316,14 +2341,10 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
                       <label className="cfg-label">Выбрать из загруженных</label>
                       <div className="bg-gallery">
                         {bgList.map(name => (
-                          <div key={name} className={`bg-gallery-item ${centralCfg.bgImage === name ? 'bg-selected' : ''}`}>
-                            <img src={`${API}/backgrounds/${name}`} alt={name} onClick={async () => {
-                              const next = {...centralCfg, bgImage: name, bgColor: ''};
-                              setCentralCfg(next);
-                              await saveCentralCfg(next);
-                            }} />
+                          <div key={name} className={`bg-gallery-item ${prefs.bgImage === name ? 'bg-selected' : ''}`}>
+                            <img src={`${API}/backgrounds/${name}`} alt={name} onClick={() => savePrefs({...prefs, bgImage: name, bgColor: ''})} />
                             <button className="bg-gallery-del" onClick={() => deleteBg(name)} title="Удалить">✕</button>
-                            {centralCfg.bgImage === name && <div className="bg-gallery-check">✓</div>}
+                            {prefs.bgImage === name && <div className="bg-gallery-check">✓</div>}
                           </div>
                         ))}
                       </div>
@@ -2332,7 +2353,7 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
                 </div>
                 <div className="cfg-actions">
                   <div className="cfg-actions-main">
-                    <button className="btn-primary" disabled={cfgSaving} onClick={() => saveCentralCfg(centralCfg)}>{cfgSaving ? 'Сохранение...' : 'Сохранить изменения'}</button>
+                    <button className="btn-primary" disabled={cfgSaving} onClick={async () => { if (await savePrefs(prefs)) await saveCentralCfg(centralCfg); }}>{cfgSaving ? 'Сохранение...' : 'Сохранить изменения'}</button>
                   </div>
                   <div className="cfg-actions-backup">
                     <div className="cfg-actions-caption">Backup конфигурации Central</div>
@@ -2677,7 +2698,7 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
                 {/* Health Check */}
                 {agentData.health && (
                   <div className="section">
-                    <h2>{agentData.health.overall === 'ok' ? '✅' : agentData.health.overall === 'warning' ? '⚠️' : '🔴'} Health Check</h2>
+                    <h2>{agentData.health.overall === 'ok' ? '✅' : agentData.health.overall === 'warning' ? '⚠️' : agentData.health.overall === 'unknown' ? '❔' : '🔴'} Health Check</h2>
                     <div className="health-grid">{(agentData.health.checks || []).map((c, i) => (
                       <div key={i} className={`health-item hi-${c.status}`}><span className="hi-icon">{c.status === 'ok' ? '✅' : c.status === 'warning' ? '⚠️' : '❌'}</span><div className="hi-info"><span className="hi-name">{c.name}</span><span className="hi-value">{c.value}</span>{c.message && c.status !== 'ok' && <span className="hi-msg">{c.message}</span>}</div></div>
                     ))}</div>
@@ -3093,6 +3114,16 @@ function MainApp({ auth, onLogout }: { auth: AuthState; onLogout: () => void })
         </div></div>
       )}
 
+      {showPwModal && (
+        <div className="modal-overlay" onClick={() => setShowPwModal(false)}><div className="modal" onClick={e => e.stopPropagation()}>
+          <h2>Сменить пароль</h2>
+          <div className="form-group"><label>Текущий пароль</label><input type="password" value={pwForm.current} onChange={e => setPwForm(f => ({ ...f, current: e.target.value }))} autoFocus /></div>
+          <div className="form-group"><label>Новый пароль</label><input type="password" value={pwForm.next} onChange={e => setPwForm(f => ({ ...f, next: e.target.value }))} /></div>
+          {pwError && <div className="form-error">{pwError}</div>}
+          <div className="modal-actions"><button className="btn btn-secondary" onClick={() => setShowPwModal(false)}>Отмена</button><button className="btn btn-primary" onClick={handleChangePassword}>Сменить</button></div>
+        </div></div>
+      )}
+
       {/* Delete agent confirmation modal */}
       {deleteAgentId && (
         <div className="modal-overlay" onClick={() => setDeleteAgentId(null)}><div className="modal" onClick={e => e.stopPropagation()}>
@@ -0,0 +1,175 @@
+// Package alerts evaluates host conditions and delivers alert notifications
+// to the webhook configured in CentralConfig.AlertWebhookURL.
+package alerts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"nodax-central/internal/models"
+	"strings"
+	"time"
+)
+
+// Severities reported for host conditions
+const (
+	SeverityOK       = "ok"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Event is the JSON body posted to the alert webhook
+type Event struct {
+	Key       string            `json:"key,omitempty"`    // stable identity of the alerted condition
+	Status    string            `json:"status,omitempty"` // firing / resolved
+	Type      string            `json:"type"`             // e.g. disk_critical
+	Severity  string            `json:"severity"`
+	AgentID   string            `json:"agentId"`
+	AgentName string            `json:"agentName"`
+	Message   string            `json:"message"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	StartsAt  time.Time         `json:"startsAt,omitempty"` // when the condition first fired
+	Time      time.Time         `json:"time"`
+}
+
+// Webhook payload formats
+const (
+	FormatPlain        = "plain"
+	FormatAlertmanager = "alertmanager"
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Send posts the event to url in the given format. An empty url is a no-op.
+func Send(url, format string, ev Event) error {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return nil
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	if ev.StartsAt.IsZero() {
+		ev.StartsAt = ev.Time
+	}
+	var payload any = ev
+	if format == FormatAlertmanager {
+		payload = alertmanagerPayload(ev)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// DiskSeverity returns the worst severity across disks, each checked against
+// its own thresholds from cfg, and the disk that produced it. Among disks of
+// equal severity the fullest wins. ok is returned with a zero DiskInfo when
+// there are no disks.
+func DiskSeverity(disks []models.DiskInfo, cfg *models.CentralConfig) (string, models.DiskInfo) {
+	rank := 0 // 0 ok, 1 warning, 2 critical
+	var worst models.DiskInfo
+	for _, d := range disks {
+		warn, crit := cfg.DiskThresholdsFor(d.Drive)
+		r := 0
+		switch {
+		case d.UsePct >= crit:
+			r = 2
+		case d.UsePct >= warn:
+			r = 1
+		}
+		if worst.Drive == "" || r > rank || (r == rank && d.UsePct > worst.UsePct) {
+			worst, rank = d, r
+		}
+	}
+	switch rank {
+	case 2:
+		return SeverityCritical, worst
+	case 1:
+		return SeverityWarning, worst
+	}
+	return SeverityOK, worst
+}
+
+type amAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// alertmanagerPayload renders ev in Alertmanager's webhook (version 4) shape so
+// receivers built for Alertmanager can route and silence central alerts.
+func alertmanagerPayload(ev Event) map[string]any {
+	labels := map[string]string{
+		"alertname": alertName(ev.Type),
+		"severity":  ev.Severity,
+		"source":    "nodax-central",
+	}
+	if ev.AgentID != "" {
+		labels["agent_id"] = ev.AgentID
+		labels["agent"] = ev.AgentName
+	}
+	for k, v := range ev.Labels {
+		labels[k] = v
+	}
+	status := ev.Status
+	if status == "" {
+		status = StatusFiring
+	}
+	a := amAlert{
+		Status:      status,
+		Labels:      labels,
+		Annotations: map[string]string{"summary": ev.Message},
+		StartsAt:    ev.StartsAt,
+		Fingerprint: fingerprint(ev.Key),
+	}
+	if status == StatusResolved {
+		a.EndsAt = ev.Time
+	}
+	commonLabels := map[string]string{"alertname": labels["alertname"]}
+	return map[string]any{
+		"version":           "4",
+		"groupKey":          ev.Key,
+		"status":            status,
+		"receiver":          "nodax-central",
+		"groupLabels":       commonLabels,
+		"commonLabels":      commonLabels,
+		"commonAnnotations": map[string]string{},
+		"externalURL":       "",
+		"alerts":            []amAlert{a},
+	}
+}
+
+// alertName maps event types to CamelCase alert names, e.g. disk_critical -> NodaxDiskCritical
+func alertName(eventType string) string {
+	var b strings.Builder
+	b.WriteString("Nodax")
+	for _, part := range strings.Split(eventType, "_") {
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func fingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
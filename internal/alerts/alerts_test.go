@@ -0,0 +1,33 @@
+package alerts
+
+import (
+	"testing"
+
+	"nodax-central/internal/models"
+)
+
+func TestDiskSeverityUsesPerDiskThresholds(t *testing.T) {
+	cfg := &models.CentralConfig{DiskLimits: map[string]models.DiskThreshold{
+		"d:":   {WarnPct: 50, CritPct: 60},
+		"/var": {CritPct: 99},
+	}}
+	disks := []models.DiskInfo{
+		{Drive: "C:", UsePct: 80},
+		{Drive: "D:", UsePct: 65},
+		{Drive: "/var", UsePct: 97},
+	}
+	sev, worst := DiskSeverity(disks, cfg)
+	if sev != SeverityCritical || worst.Drive != "D:" {
+		t.Fatalf("DiskSeverity = %s on %q, want critical on D:", sev, worst.Drive)
+	}
+
+	sev, worst = DiskSeverity(disks[2:], cfg)
+	if sev != SeverityWarning || worst.Drive != "/var" {
+		t.Fatalf("DiskSeverity(/var) = %s on %q, want warning", sev, worst.Drive)
+	}
+
+	sev, worst = DiskSeverity(disks[:1], nil)
+	if sev != SeverityOK || worst.Drive != "C:" {
+		t.Fatalf("DiskSeverity(C:) = %s on %q, want ok with global thresholds", sev, worst.Drive)
+	}
+}
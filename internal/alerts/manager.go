@@ -0,0 +1,159 @@
+package alerts
+
+import (
+	"nodax-central/internal/logx"
+	"nodax-central/internal/models"
+	"nodax-central/internal/store"
+	"sync"
+	"time"
+)
+
+// Event statuses sent to the webhook
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// DefaultResolveHold is how long a condition must stay clear before the
+// alert is resolved, so a flapping condition does not spam notifications.
+const DefaultResolveHold = 2 * time.Minute
+
+// Manager tracks active alerts by key and dispatches firing/resolved events
+// on transitions only. Active alerts are persisted so a restart does not
+// re-fire conditions that were already reported.
+type Manager struct {
+	store  *store.Store
+	hold   time.Duration
+	mu     sync.Mutex
+	active map[string]models.AlertState
+}
+
+// NewManager creates a manager and restores previously active alerts
+func NewManager(s *store.Store) *Manager {
+	active, err := s.GetAlertStates()
+	if err != nil || active == nil {
+		active = map[string]models.AlertState{}
+	}
+	return &Manager{store: s, hold: DefaultResolveHold, active: active}
+}
+
+// Fire reports that the condition identified by key is present. The first
+// call sends a firing event; later calls only resend when repeat > 0 and at
+// least repeat has elapsed since the last notification.
+func (m *Manager) Fire(key string, ev Event, repeat time.Duration) {
+	now := time.Now().UTC()
+	m.mu.Lock()
+	st, ok := m.active[key]
+	send, changed := false, false
+	if !ok {
+		st = models.AlertState{FiredAt: now, LastSent: now}
+		send, changed = true, true
+	} else {
+		if !st.ClearSince.IsZero() {
+			st.ClearSince = time.Time{}
+			changed = true
+		}
+		if repeat > 0 && now.Sub(st.LastSent) >= repeat {
+			st.LastSent = now
+			send, changed = true, true
+		}
+	}
+	st.Type = ev.Type
+	st.Severity = ev.Severity
+	st.AgentID = ev.AgentID
+	st.AgentName = ev.AgentName
+	st.Message = ev.Message
+	st.Labels = ev.Labels
+	m.active[key] = st
+	if changed {
+		m.persistLocked()
+	}
+	m.mu.Unlock()
+
+	if send {
+		ev.Status = StatusFiring
+		ev.Key = key
+		ev.StartsAt = st.FiredAt
+		ev.Time = now
+		m.dispatch(ev)
+	}
+}
+
+// Resolve reports that the condition identified by key is absent. The
+// resolved event is sent once the condition has stayed clear for the hold.
+func (m *Manager) Resolve(key string) {
+	now := time.Now().UTC()
+	m.mu.Lock()
+	st, ok := m.active[key]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	if st.ClearSince.IsZero() && m.hold > 0 {
+		st.ClearSince = now
+		m.active[key] = st
+		m.persistLocked()
+		m.mu.Unlock()
+		return
+	}
+	if now.Sub(st.ClearSince) < m.hold {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.active, key)
+	m.persistLocked()
+	m.mu.Unlock()
+
+	m.dispatch(Event{
+		Key:       key,
+		Status:    StatusResolved,
+		Type:      st.Type,
+		Severity:  st.Severity,
+		AgentID:   st.AgentID,
+		AgentName: st.AgentName,
+		Message:   st.Message,
+		Labels:    st.Labels,
+		StartsAt:  st.FiredAt,
+		Time:      now,
+	})
+}
+
+func (m *Manager) persistLocked() {
+	cp := make(map[string]models.AlertState, len(m.active))
+	for k, v := range m.active {
+		cp[k] = v
+	}
+	if err := m.store.SaveAlertStates(cp); err != nil {
+		logx.Error("alert state save failed", "err", err)
+	}
+}
+
+func (m *Manager) dispatch(ev Event) {
+	cfg, err := m.store.GetConfig()
+	if err != nil {
+		return
+	}
+	logx.Info("alert "+ev.Status, "key", ev.Key, "type", ev.Type, "agent_id", ev.AgentID, "message", ev.Message)
+	go func(url, format string) {
+		if err := Send(url, format, ev); err != nil {
+			logx.Error("alert webhook failed", "type", ev.Type, "agent_id", ev.AgentID, "err", err)
+		}
+	}(cfg.AlertWebhookURL, cfg.AlertFormat)
+}
+
+// ClearAgent drops all active alerts of an agent without notifying, e.g.
+// when the agent is disabled or deleted and its conditions stop being evaluated.
+func (m *Manager) ClearAgent(agentID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := false
+	for k, st := range m.active {
+		if st.AgentID == agentID {
+			delete(m.active, k)
+			changed = true
+		}
+	}
+	if changed {
+		m.persistLocked()
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"nodax-central/internal/logx"
 	"nodax-central/internal/models"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -148,6 +150,16 @@ func ensureRolePoliciesNotInUse(newPolicies map[string][]models.UserHostPermissi
 	return nil
 }
 
+// ensureAdminRemains refuses a resulting user set without any admin account
+func ensureAdminRemains(users []models.User) error {
+	for _, u := range users {
+		if normalizeRole(u.Role) == "admin" {
+			return nil
+		}
+	}
+	return fmt.Errorf("operation would leave no admin account")
+}
+
 func permissionsByRole(cfg *models.CentralConfig, role string) []models.UserHostPermission {
 	r := normalizeRole(role)
 	if r == "" {
@@ -223,6 +235,11 @@ type registerRequest struct {
 	Role     string `json:"role"`
 }
 
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
 type authResponse struct {
 	Token    string `json:"token"`
 	Username string `json:"username"`
@@ -298,11 +315,12 @@ func (h *Handler) currentUserFromRequest(r *http.Request) (*models.User, error)
 	return u, nil
 }
 
-func generateJWT(userID, username, role string) (string, error) {
+func generateJWT(user *models.User) (string, error) {
 	claims := jwt.MapClaims{
-		"sub":      userID,
-		"username": username,
-		"role":     role,
+		"sub":      user.ID,
+		"username": user.Username,
+		"role":     normalizeRole(user.Role),
+		"tv":       user.TokenVersion,
 		"exp":      time.Now().Add(72 * time.Hour).Unix(),
 		"iat":      time.Now().Unix(),
 	}
@@ -327,6 +345,12 @@ func parseJWT(tokenStr string) (jwt.MapClaims, error) {
 	return claims, nil
 }
 
+// tokenVersion returns the tv claim; tokens issued before it existed read as 0.
+func tokenVersion(claims jwt.MapClaims) int {
+	v, _ := claims["tv"].(float64)
+	return int(v)
+}
+
 func SetJWTSecret(secret string) {
 	if secret != "" {
 		jwtSecret = []byte(secret)
@@ -339,6 +363,17 @@ func GenerateRandomSecret() string {
 	return hex.EncodeToString(b)
 }
 
+// maintenanceExempt lists write endpoints that stay available in maintenance
+// mode: the config itself (to turn maintenance off) and license checks.
+var maintenanceExempt = map[string]bool{
+	"/api/config":          true,
+	"/api/license/recheck": true,
+}
+
+func isMutatingMethod(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
+
 // AuthMiddleware protects API routes requiring authentication
 func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -394,6 +429,12 @@ func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
 			http.Error(w, `{"error":"invalid token"}`, 401)
 			return
 		}
+		// A password change bumps the user's token version; tokens of
+		// deleted users or from before the change are refused.
+		if u, err := h.store.GetUserByID(fmt.Sprintf("%v", claims["sub"])); err != nil || tokenVersion(claims) != u.TokenVersion {
+			http.Error(w, `{"error":"token revoked"}`, 401)
+			return
+		}
 
 		cfg, _ := h.store.GetConfig()
 
@@ -420,6 +461,16 @@ func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if cfg != nil && cfg.Maintenance && isMutatingMethod(r.Method) && !maintenanceExempt[path] {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"error":   "maintenance",
+				"message": "central is in maintenance mode, changes are disabled",
+			})
+			return
+		}
+
 		if blocked, reason := h.isWriteBlockedByLicense(path, r.Method); blocked {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusForbidden)
@@ -457,10 +508,12 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 	user, err := h.store.GetUserByUsername(req.Username)
 	if err != nil || !h.store.CheckPassword(user, req.Password) {
+		logx.Warn("login failed", "username", req.Username, "remote", r.RemoteAddr)
 		http.Error(w, `{"error":"invalid credentials"}`, 401)
 		return
 	}
-	token, err := generateJWT(user.ID, user.Username, normalizeRole(user.Role))
+	logx.Info("login succeeded", "username", user.Username, "role", normalizeRole(user.Role), "remote", r.RemoteAddr)
+	token, err := generateJWT(user)
 	if err != nil {
 		http.Error(w, `{"error":"token error"}`, 500)
 		return
@@ -503,7 +556,50 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), 400)
 		return
 	}
-	token, _ := generateJWT(user.ID, user.Username, normalizeRole(user.Role))
+	logx.Info("user registered", "username", user.Username, "role", normalizeRole(user.Role))
+	token, _ := generateJWT(user)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(authResponse{Token: token, Username: user.Username, Role: normalizeRole(user.Role)})
+}
+
+// handleChangePassword sets a new password for the current user. Every other
+// token of the user stops working; the response carries a fresh token for
+// the caller.
+func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, `{"error":"method not allowed"}`, 405)
+		return
+	}
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid body"}`, 400)
+		return
+	}
+	if req.NewPassword == "" {
+		http.Error(w, `{"error":"new password required"}`, 400)
+		return
+	}
+	user, err := h.store.GetUserByID(r.Header.Get("X-User-ID"))
+	if err != nil {
+		http.Error(w, `{"error":"user not found"}`, 404)
+		return
+	}
+	if !h.store.CheckPassword(user, req.CurrentPassword) {
+		logx.Warn("password change rejected", "username", user.Username, "remote", r.RemoteAddr)
+		http.Error(w, `{"error":"invalid current password"}`, 403)
+		return
+	}
+	user, err = h.store.SetUserPassword(user.ID, req.NewPassword)
+	if err != nil {
+		http.Error(w, `{"error":"save failed"}`, 500)
+		return
+	}
+	logx.Info("password changed", "username", user.Username, "remote", r.RemoteAddr)
+	token, err := generateJWT(user)
+	if err != nil {
+		http.Error(w, `{"error":"token error"}`, 500)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(authResponse{Token: token, Username: user.Username, Role: normalizeRole(user.Role)})
 }
@@ -522,6 +618,99 @@ func (h *Handler) handleAuthMe(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// validThemes are the UI themes a user or the config may pick; empty falls
+// back to the default.
+var validThemes = map[string]bool{"light": true, "dark": true}
+
+// validBgColor reports whether v is a #rgb or #rrggbb color.
+func validBgColor(v string) bool {
+	if len(v) != 4 && len(v) != 7 || v[0] != '#' {
+		return false
+	}
+	for _, c := range v[1:] {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// effectivePreferences merges a user's own preferences over the global
+// appearance defaults from the central config.
+func effectivePreferences(cfg *models.CentralConfig, prefs *models.UserPreferences) models.UserPreferences {
+	out := models.UserPreferences{}
+	if cfg != nil {
+		out.Theme = cfg.Theme
+		out.BgColor = cfg.BgColor
+		out.BgImage = cfg.BgImage
+	}
+	if prefs == nil {
+		return out
+	}
+	if prefs.Theme != "" {
+		out.Theme = prefs.Theme
+	}
+	if prefs.BgColor != "" {
+		out.BgColor = prefs.BgColor
+	}
+	if prefs.BgImage != "" {
+		out.BgImage = prefs.BgImage
+	}
+	return out
+}
+
+func (h *Handler) handleAuthPreferences(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	userID := r.Header.Get("X-User-ID")
+
+	switch r.Method {
+	case http.MethodGet:
+		user, err := h.store.GetUserByID(userID)
+		if err != nil {
+			http.Error(w, `{"error":"user not found"}`, 404)
+			return
+		}
+		cfg, _ := h.store.GetConfig()
+		json.NewEncoder(w).Encode(effectivePreferences(cfg, user.Preferences))
+
+	case http.MethodPut:
+		var req models.UserPreferences
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"invalid body"}`, 400)
+			return
+		}
+		req.Theme = strings.TrimSpace(req.Theme)
+		req.BgColor = strings.TrimSpace(req.BgColor)
+		req.BgImage = strings.TrimSpace(req.BgImage)
+		if req.Theme != "" && !validThemes[req.Theme] {
+			http.Error(w, `{"error":"invalid theme"}`, 400)
+			return
+		}
+		if req.BgColor != "" && !validBgColor(req.BgColor) {
+			http.Error(w, `{"error":"invalid bgColor"}`, 400)
+			return
+		}
+		if req.BgImage != "" && filepath.Base(req.BgImage) != req.BgImage {
+			http.Error(w, `{"error":"invalid bgImage"}`, 400)
+			return
+		}
+		var prefs *models.UserPreferences
+		if req != (models.UserPreferences{}) {
+			prefs = &req
+		}
+		user, err := h.store.SaveUserPreferences(userID, prefs)
+		if err != nil {
+			http.Error(w, `{"error":"save failed"}`, 500)
+			return
+		}
+		cfg, _ := h.store.GetConfig()
+		json.NewEncoder(w).Encode(effectivePreferences(cfg, user.Preferences))
+
+	default:
+		http.Error(w, `{"error":"method not allowed"}`, 405)
+	}
+}
+
 func (h *Handler) handleUsers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -572,6 +761,20 @@ func (h *Handler) handleUsers(w http.ResponseWriter, r *http.Request) {
 				http.Error(w, `{"error":"group not found"}`, 400)
 				return
 			}
+			if normalizeRole(u.Role) == "admin" && nr != "admin" {
+				users, _ := h.store.GetAllUsers()
+				next := make([]models.User, 0, len(users))
+				for _, other := range users {
+					if other.ID == u.ID {
+						other.Role = nr
+					}
+					next = append(next, other)
+				}
+				if err := ensureAdminRemains(next); err != nil {
+					http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), 400)
+					return
+				}
+			}
 			u.Role = nr
 		}
 		u.HostPermissions = nil
@@ -601,6 +804,17 @@ func (h *Handler) handleUsers(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, `{"error":"cannot delete yourself"}`, 400)
 			return
 		}
+		users, _ := h.store.GetAllUsers()
+		remaining := make([]models.User, 0, len(users))
+		for _, u := range users {
+			if u.ID != id {
+				remaining = append(remaining, u)
+			}
+		}
+		if err := ensureAdminRemains(remaining); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), 400)
+			return
+		}
 		if err := h.store.DeleteUser(id); err != nil {
 			http.Error(w, `{"error":"delete failed"}`, 500)
 			return
@@ -674,6 +888,8 @@ func (h *Handler) RegisterAuthRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/auth/login", h.handleLogin)
 	mux.HandleFunc("/api/auth/register", h.handleRegister)
 	mux.HandleFunc("/api/auth/me", h.handleAuthMe)
+	mux.HandleFunc("/api/auth/password", h.handleChangePassword)
+	mux.HandleFunc("/api/auth/preferences", h.handleAuthPreferences)
 	mux.HandleFunc("/api/auth/users", h.handleUsers)
 	mux.HandleFunc("/api/auth/users/", h.handleUsers)
 	mux.HandleFunc("/api/auth/role-policies", h.handleRolePolicies)
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChangePasswordRevokesOldTokens(t *testing.T) {
+	h, adminID := newTestHandler(t)
+	admin, err := h.store.GetUserByID(adminID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := generateJWT(admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := h.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	call := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := call(oldToken); code != http.StatusNoContent {
+		t.Fatalf("token before change: status = %d, want 204", code)
+	}
+
+	change := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/password", strings.NewReader(body))
+		req.Header.Set("X-User-ID", adminID)
+		rec := httptest.NewRecorder()
+		h.handleChangePassword(rec, req)
+		return rec
+	}
+	if rec := change(`{"currentPassword":"wrong","newPassword":"new-password"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("wrong current password: status = %d, want 403", rec.Code)
+	}
+	rec := change(`{"currentPassword":"secret-password","newPassword":"new-password"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("change: status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	var resp authResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Token == "" {
+		t.Fatalf("change response = %s, want a token", rec.Body)
+	}
+
+	if code := call(oldToken); code != http.StatusUnauthorized {
+		t.Errorf("token from before the change: status = %d, want 401", code)
+	}
+	if code := call(resp.Token); code != http.StatusNoContent {
+		t.Errorf("token from the change: status = %d, want 204", code)
+	}
+}
+
+func TestAuthPreferencesValidation(t *testing.T) {
+	h, adminID := newTestHandler(t)
+	for body, want := range map[string]int{
+		`{"theme":"dark","bgColor":"#1e293b"}`: http.StatusOK,
+		`{"theme":"solarized"}`:                http.StatusBadRequest,
+		`{"bgColor":"red;background:url(x)"}`:  http.StatusBadRequest,
+		`{"bgColor":"#12345"}`:                 http.StatusBadRequest,
+		`{"bgImage":"../etc/passwd"}`:          http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodPut, "/api/auth/preferences", strings.NewReader(body))
+		req.Header.Set("X-User-ID", adminID)
+		rec := httptest.NewRecorder()
+		h.handleAuthPreferences(rec, req)
+		if rec.Code != want {
+			t.Errorf("PUT %s: status = %d, want %d", body, rec.Code, want)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	maxBackgroundBytes  = 10 << 20
+	maxBackgroundPixels = 25_000_000 // ~6K x 4K; decoding takes up to 4 bytes per pixel
+	maxBackgroundSide   = 16384
+	// Backgrounds larger than this are downscaled for display; the original is kept.
+	backgroundDisplaySide = 2560
+	backgroundDisplaySfx  = "_display"
+	// Uploaded backgrounds are named bg_<unix ms><ext>; other files in the
+	// data dir are never listed or cleaned up as backgrounds.
+	backgroundPrefix = "bg_"
+)
+
+var backgroundExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".webp": true, ".gif": true, ".bmp": true,
+}
+
+// isBackgroundVariant reports whether name is a generated display copy rather
+// than an uploaded original.
+func isBackgroundVariant(name string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(name, filepath.Ext(name)), backgroundDisplaySfx)
+}
+
+func backgroundDisplayName(name string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + backgroundDisplaySfx + ext
+}
+
+// validateBackgroundImage checks the image header and dimensions of an
+// upload: jpeg, png and gif through the stdlib decoders, webp and bmp by
+// reading their headers directly.
+func validateBackgroundImage(data []byte, ext string) error {
+	var w, h int
+	switch ext {
+	case ".webp":
+		var err error
+		if w, h, err = webpSize(data); err != nil {
+			return fmt.Errorf("invalid image: %w", err)
+		}
+	case ".bmp":
+		var err error
+		if w, h, err = bmpSize(data); err != nil {
+			return fmt.Errorf("invalid image: %w", err)
+		}
+	default:
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("invalid image: %w", err)
+		}
+		w, h = cfg.Width, cfg.Height
+	}
+	if w <= 0 || h <= 0 {
+		return fmt.Errorf("invalid image dimensions %dx%d", w, h)
+	}
+	if w > maxBackgroundSide || h > maxBackgroundSide || w*h > maxBackgroundPixels {
+		return fmt.Errorf("image too large: %dx%d", w, h)
+	}
+	return nil
+}
+
+// webpSize reads the canvas size from a RIFF WebP header (lossy VP8,
+// lossless VP8L or extended VP8X).
+func webpSize(data []byte) (w, h int, err error) {
+	if len(data) < 30 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, 0, fmt.Errorf("not a webp file")
+	}
+	switch string(data[12:16]) {
+	case "VP8 ":
+		if data[23] != 0x9d || data[24] != 0x01 || data[25] != 0x2a {
+			return 0, 0, fmt.Errorf("bad VP8 start code")
+		}
+		return int(binary.LittleEndian.Uint16(data[26:]) & 0x3fff), int(binary.LittleEndian.Uint16(data[28:]) & 0x3fff), nil
+	case "VP8L":
+		if data[20] != 0x2f {
+			return 0, 0, fmt.Errorf("bad VP8L signature")
+		}
+		bits := binary.LittleEndian.Uint32(data[21:])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, nil
+	case "VP8X":
+		w := int(data[24]) | int(data[25])<<8 | int(data[26])<<16
+		h := int(data[27]) | int(data[28])<<8 | int(data[29])<<16
+		return w + 1, h + 1, nil
+	}
+	return 0, 0, fmt.Errorf("unknown webp chunk %q", data[12:16])
+}
+
+// bmpSize reads the size from a BMP header. Top-down bitmaps store a
+// negative height.
+func bmpSize(data []byte) (w, h int, err error) {
+	if len(data) < 26 || string(data[0:2]) != "BM" {
+		return 0, 0, fmt.Errorf("not a bmp file")
+	}
+	if binary.LittleEndian.Uint32(data[14:]) == 12 {
+		// OS/2 BITMAPCOREHEADER with 16-bit dimensions.
+		return int(binary.LittleEndian.Uint16(data[18:])), int(binary.LittleEndian.Uint16(data[20:])), nil
+	}
+	w = int(int32(binary.LittleEndian.Uint32(data[18:])))
+	h = int(int32(binary.LittleEndian.Uint32(data[22:])))
+	if h < 0 {
+		h = -h
+	}
+	return w, h, nil
+}
+
+// writeBackgroundDisplay stores a downscaled copy of a jpeg/png background
+// next to the original when it exceeds backgroundDisplaySide. The size is
+// checked again before decoding, so a caller that skipped
+// validateBackgroundImage cannot make it allocate an oversized image.
+func writeBackgroundDisplay(dir, name string, data []byte) error {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		return nil
+	}
+	if err := validateBackgroundImage(data, ext); err != nil {
+		return err
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= backgroundDisplaySide && h <= backgroundDisplaySide {
+		return nil
+	}
+	if w >= h {
+		h = h * backgroundDisplaySide / w
+		w = backgroundDisplaySide
+	} else {
+		w = w * backgroundDisplaySide / h
+		h = backgroundDisplaySide
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := downscaleImage(src, w, h)
+
+	f, err := os.Create(filepath.Join(dir, backgroundDisplayName(name)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if ext == ".png" {
+		return png.Encode(f, dst)
+	}
+	return jpeg.Encode(f, dst, &jpeg.Options{Quality: 85})
+}
+
+// rgbaReader returns a premultiplied 8-bit RGBA accessor for src. The image
+// types the jpeg, png and gif decoders produce are read straight from their
+// buffers, avoiding the color allocation src.At makes for every pixel.
+func rgbaReader(src image.Image) func(x, y int) (r, g, b, a uint8) {
+	switch img := src.(type) {
+	case *image.YCbCr:
+		return func(x, y int) (uint8, uint8, uint8, uint8) {
+			yi, ci := img.YOffset(x, y), img.COffset(x, y)
+			r, g, b := color.YCbCrToRGB(img.Y[yi], img.Cb[ci], img.Cr[ci])
+			return r, g, b, 0xff
+		}
+	case *image.RGBA:
+		return func(x, y int) (uint8, uint8, uint8, uint8) {
+			i := img.PixOffset(x, y)
+			return img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]
+		}
+	case *image.NRGBA:
+		return func(x, y int) (uint8, uint8, uint8, uint8) {
+			i := img.PixOffset(x, y)
+			a := uint16(img.Pix[i+3])
+			return uint8(uint16(img.Pix[i]) * a / 0xff), uint8(uint16(img.Pix[i+1]) * a / 0xff), uint8(uint16(img.Pix[i+2]) * a / 0xff), uint8(a)
+		}
+	case *image.Gray:
+		return func(x, y int) (uint8, uint8, uint8, uint8) {
+			v := img.Pix[img.PixOffset(x, y)]
+			return v, v, v, 0xff
+		}
+	case *image.Paletted:
+		palette := make([]color.RGBA, len(img.Palette))
+		for i, c := range img.Palette {
+			palette[i] = color.RGBAModel.Convert(c).(color.RGBA)
+		}
+		return func(x, y int) (uint8, uint8, uint8, uint8) {
+			idx := int(img.Pix[img.PixOffset(x, y)])
+			if idx >= len(palette) {
+				return 0, 0, 0, 0
+			}
+			c := palette[idx]
+			return c.R, c.G, c.B, c.A
+		}
+	}
+	return func(x, y int) (uint8, uint8, uint8, uint8) {
+		r, g, b, a := src.At(x, y).RGBA()
+		return uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)
+	}
+}
+
+// downscaleImage resizes src to w x h by averaging each source box (area filter).
+func downscaleImage(src image.Image, w, h int) *image.RGBA {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	at := rgbaReader(src)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := sb.Min.Y + y*sh/h
+		y1 := sb.Min.Y + (y+1)*sh/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0 := sb.Min.X + x*sw/w
+			x1 := sb.Min.X + (x+1)*sw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := at(sx, sy)
+					r += uint64(cr)
+					g += uint64(cg)
+					bl += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+func fileExists(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && !st.IsDir()
+}
+
+// listBackgrounds returns uploaded background originals in h.dataDir.
+func (h *Handler) listBackgrounds() []string {
+	entries, _ := os.ReadDir(h.dataDir)
+	names := []string{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), backgroundPrefix) {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if backgroundExts[ext] && !isBackgroundVariant(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+// unusedBackgrounds filters names down to backgrounds that are neither the
+// global default nor selected in any user's preferences.
+func (h *Handler) unusedBackgrounds(names []string) []string {
+	// Without a reliable view of the selections nothing is considered unused.
+	cfg, err := h.store.GetConfig()
+	if err != nil {
+		return []string{}
+	}
+	users, err := h.store.GetAllUsers()
+	if err != nil {
+		return []string{}
+	}
+	inUse := map[string]bool{}
+	if cfg.BgImage != "" {
+		inUse[cfg.BgImage] = true
+	}
+	for _, u := range users {
+		if u.Preferences != nil && u.Preferences.BgImage != "" {
+			inUse[u.Preferences.BgImage] = true
+		}
+	}
+	out := []string{}
+	for _, name := range names {
+		if !inUse[name] {
+			out = append(out, name)
+		}
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestValidateBackgroundImageHeaders(t *testing.T) {
+	bmp := func(w, h int32) []byte {
+		b := make([]byte, 54)
+		copy(b, "BM")
+		binary.LittleEndian.PutUint32(b[14:], 40)
+		binary.LittleEndian.PutUint32(b[18:], uint32(w))
+		binary.LittleEndian.PutUint32(b[22:], uint32(h))
+		return b
+	}
+	webpX := func(w, h int) []byte {
+		b := make([]byte, 30)
+		copy(b, "RIFF")
+		copy(b[8:], "WEBPVP8X")
+		w, h = w-1, h-1
+		b[24], b[25], b[26] = byte(w), byte(w>>8), byte(w>>16)
+		b[27], b[28], b[29] = byte(h), byte(h>>8), byte(h>>16)
+		return b
+	}
+	webpL := func(w, h int) []byte {
+		b := make([]byte, 30)
+		copy(b, "RIFF")
+		copy(b[8:], "WEBPVP8L")
+		b[20] = 0x2f
+		binary.LittleEndian.PutUint32(b[21:], uint32(w-1)|uint32(h-1)<<14)
+		return b
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		ext     string
+		wantErr string
+	}{
+		{name: "bmp", data: bmp(1920, 1080), ext: ".bmp"},
+		{name: "top-down bmp", data: bmp(1920, -1080), ext: ".bmp"},
+		{name: "bmp over the pixel cap", data: bmp(16000, 16000), ext: ".bmp", wantErr: "too large"},
+		{name: "not a bmp", data: []byte("<svg/>"), ext: ".bmp", wantErr: "invalid image"},
+		{name: "webp extended", data: webpX(3840, 2160), ext: ".webp"},
+		{name: "webp lossless", data: webpL(1024, 768), ext: ".webp"},
+		{name: "webp over the side cap", data: webpX(20000, 100), ext: ".webp", wantErr: "too large"},
+		{name: "not a webp", data: []byte("RIFF0000WAVEfmt "), ext: ".webp", wantErr: "invalid image"},
+	}
+	for _, tt := range tests {
+		err := validateBackgroundImage(tt.data, tt.ext)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDownscaleImageMatchesAt(t *testing.T) {
+	src := image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio420)
+	for i := range src.Y {
+		src.Y[i] = uint8(i * 7)
+	}
+	for i := range src.Cb {
+		src.Cb[i], src.Cr[i] = uint8(i*3), uint8(255-i)
+	}
+	got := downscaleImage(src, 16, 12)
+	// Each destination pixel averages a 4x4 box; compare with the generic path.
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 16; x++ {
+			var r, g, b int
+			for sy := y * 4; sy < y*4+4; sy++ {
+				for sx := x * 4; sx < x*4+4; sx++ {
+					c := color.RGBAModel.Convert(src.At(sx, sy)).(color.RGBA)
+					r, g, b = r+int(c.R), g+int(c.G), b+int(c.B)
+				}
+			}
+			want := color.RGBA{uint8(r / 16), uint8(g / 16), uint8(b / 16), 0xff}
+			if c := got.RGBAAt(x, y); c != want {
+				t.Fatalf("pixel %d,%d = %v, want %v", x, y, c, want)
+			}
+		}
+	}
+}
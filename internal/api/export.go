@@ -0,0 +1,74 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// writeCSV sends rows as a UTF-8 CSV attachment (with BOM so Excel detects the encoding)
+func writeCSV(w http.ResponseWriter, filename string, headers []string, rows [][]string) {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xEF, 0xBB, 0xBF})
+	cw := csv.NewWriter(&buf)
+	_ = cw.Write(headers)
+	for _, r := range rows {
+		safe := make([]string, len(r))
+		for i, cell := range r {
+			safe[i] = csvSafe(cell)
+		}
+		_ = cw.Write(safe)
+	}
+	cw.Flush()
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+	_, _ = w.Write(buf.Bytes())
+}
+
+// csvSafe prefixes cells a spreadsheet would read as a formula with a quote,
+// so host names or error texts from agents cannot inject formulas.
+func csvSafe(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// writeSpreadsheetML sends rows as an Excel 2003 XML (SpreadsheetML)
+// attachment. It is plain XML, not an .xls or .xlsx workbook, so it is
+// named .xml; Excel and LibreOffice open it directly.
+func writeSpreadsheetML(w http.ResponseWriter, filename, sheet string, headers []string, rows [][]string) {
+	var buf bytes.Buffer
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	buf.WriteString(`<?mso-application progid="Excel.Sheet"?>` + "\n")
+	buf.WriteString(`<Workbook xmlns="urn:schemas-microsoft-com:office:spreadsheet" xmlns:ss="urn:schemas-microsoft-com:office:spreadsheet">` + "\n")
+	buf.WriteString(`<Styles><Style ss:ID="hdr"><Font ss:Bold="1"/></Style></Styles>`)
+	buf.WriteString(`<Worksheet ss:Name="` + xmlEsc(sheet) + `"><Table>` + "\n")
+	buf.WriteString("<Row>")
+	for _, h := range headers {
+		buf.WriteString(`<Cell ss:StyleID="hdr"><Data ss:Type="String">` + xmlEsc(h) + `</Data></Cell>`)
+	}
+	buf.WriteString("</Row>\n")
+	for _, row := range rows {
+		buf.WriteString("<Row>")
+		for _, cell := range row {
+			buf.WriteString(`<Cell><Data ss:Type="String">` + xmlEsc(cell) + `</Data></Cell>`)
+		}
+		buf.WriteString("</Row>\n")
+	}
+	buf.WriteString("</Table></Worksheet></Workbook>")
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.xml", filename))
+	_, _ = w.Write(buf.Bytes())
+}
+
+func xmlEsc(s string) string {
+	s = strings.ReplaceAll(s, "&", "&amp;")
+	s = strings.ReplaceAll(s, "<", "&lt;")
+	s = strings.ReplaceAll(s, ">", "&gt;")
+	s = strings.ReplaceAll(s, "'", "&apos;")
+	s = strings.ReplaceAll(s, "\"", "&quot;")
+	return s
+}
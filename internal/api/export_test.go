@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteCSVEscapesFormulas(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeCSV(rec, "stats", []string{"name", "value"}, [][]string{
+		{"=1+2", "+1"},
+		{"-2", "@SUM(A1)"},
+		{"plain", ""},
+	})
+	body := strings.TrimPrefix(rec.Body.String(), "\ufeff")
+	want := "name,value\n'=1+2,'+1\n'-2,'@SUM(A1)\nplain,\n"
+	if body != want {
+		t.Fatalf("csv = %q, want %q", body, want)
+	}
+}
+
+func TestWriteSpreadsheetMLIsNamedXML(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeSpreadsheetML(rec, "stats", "Sheet", []string{"a"}, [][]string{{"1"}})
+	if cd := rec.Header().Get("Content-Disposition"); !strings.HasSuffix(cd, "stats.xml") {
+		t.Fatalf("Content-Disposition = %q", cd)
+	}
+	if !strings.HasPrefix(rec.Body.String(), "<?xml") {
+		t.Fatalf("body is not XML: %.40q", rec.Body.String())
+	}
+}
@@ -1,34 +1,50 @@
 package api
 
 import (
-	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"nodax-central/internal/alerts"
+	"nodax-central/internal/logx"
+	"nodax-central/internal/mailer"
 	"nodax-central/internal/models"
 	"nodax-central/internal/netutil"
 	"nodax-central/internal/poller"
 	"nodax-central/internal/store"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 // Handler holds dependencies for HTTP handlers
 type Handler struct {
-	store      *store.Store
-	poller     *poller.Poller
-	proxy      *http.Client
-	dataDir    string
-	instanceID string
-	licenseMu  sync.Mutex
+	store  *store.Store
+	poller *poller.Poller
+	proxy  *http.Client
+	// streamProxy serves the agent and license-server proxies. It has no
+	// overall timeout; each request is bounded by proxyTimeout instead.
+	streamProxy *http.Client
+	dataDir     string
+	instanceID  string
+	licenseMu   sync.Mutex
+	pubKeys     licensePubKeyCache
+	// restoreLimit throttles config restore attempts per client IP
+	restoreLimit *ipRateLimiter
+	proxyStats   *proxyMetrics
+	// trustedProxies may set X-Forwarded-For (NODAX_TRUSTED_PROXIES).
+	trustedProxies []*net.IPNet
 }
 
 // handleConfigBackup exports full central config as JSON file
@@ -52,52 +68,141 @@ func (h *Handler) handleConfigBackup(w http.ResponseWriter, r *http.Request) {
 		httpErr(w, err, 500)
 		return
 	}
-	agents, err := h.store.GetAllAgents()
-	if err != nil {
-		httpErr(w, err, 500)
-		return
+	backup := map[string]any{
+		"version":    2,
+		"config":     cfg,
+		"exportedAt": time.Now().UTC().Format(time.RFC3339),
+	}
+
+	// ?agents=false exports config only; restoring it leaves agents untouched.
+	withAgents := true
+	if v, err := strconv.ParseBool(r.URL.Query().Get("agents")); err == nil {
+		withAgents = v
+	}
+	if withAgents {
+		agents, err := h.store.GetAllAgents()
+		if err != nil {
+			httpErr(w, err, 500)
+			return
+		}
+		backup["agents"] = agents
+
+		// ?includeData=true adds cached agent data and metric history for a full snapshot.
+		if include, _ := strconv.ParseBool(r.URL.Query().Get("includeData")); include {
+			data, err := h.store.GetAllAgentData()
+			if err != nil {
+				httpErr(w, err, 500)
+				return
+			}
+			metrics := make(map[string][]models.MetricPoint, len(agents))
+			for _, a := range agents {
+				if pts, err := h.store.GetMetricHistory(a.ID); err == nil && len(pts) > 0 {
+					metrics[a.ID] = pts
+				}
+			}
+			backup["agentData"] = data
+			backup["metrics"] = metrics
+		}
+	}
+
+	// ?includeUsers=true adds user accounts including bcrypt password hashes;
+	// such a file must be stored as carefully as the database itself.
+	if include, _ := strconv.ParseBool(r.URL.Query().Get("includeUsers")); include {
+		users, err := h.store.GetAllUsers()
+		if err != nil {
+			httpErr(w, err, 500)
+			return
+		}
+		backup["users"] = users
+		backup["sensitive"] = true
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=nodax-central-config-%s.json", time.Now().Format("20060102-150405")))
-	_ = json.NewEncoder(w).Encode(map[string]any{
-		"version":    2,
-		"config":     cfg,
-		"agents":     agents,
-		"exportedAt": time.Now().UTC().Format(time.RFC3339),
-	})
+	_ = json.NewEncoder(w).Encode(backup)
+}
+
+// maxConfigRestoreBytes caps the restore body; full snapshots with metric
+// history are the largest backups.
+const maxConfigRestoreBytes = 64 << 20
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.code = code
+	s.ResponseWriter.WriteHeader(code)
 }
 
-// handleConfigRestore imports full central config from JSON body
+// handleConfigRestore imports full central config from JSON body. Restore is
+// destructive, so it is rate limited per IP and requires the caller's
+// password in X-Confirm-Password; every attempt is logged.
 func (h *Handler) handleConfigRestore(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", 405)
 		return
 	}
+	ip := h.requestIP(r)
 	user, err := h.currentUserFromRequest(r)
 	if err != nil {
+		logx.Warn("config restore rejected", "remote", ip, "reason", "unauthorized")
 		httpErr(w, fmt.Errorf("unauthorized"), 401)
 		return
 	}
 	if normalizeRole(user.Role) != "admin" {
+		logx.Warn("config restore rejected", "user", user.Username, "remote", ip, "reason", "forbidden")
 		httpErr(w, fmt.Errorf("forbidden"), 403)
 		return
 	}
+	if !h.restoreLimit.allow(ip) {
+		logx.Warn("config restore rejected", "user", user.Username, "remote", ip, "reason", "rate_limited")
+		httpErr(w, fmt.Errorf("too many restore attempts, try again later"), 429)
+		return
+	}
+	if !h.store.CheckPassword(user, r.Header.Get("X-Confirm-Password")) {
+		logx.Warn("config restore rejected", "user", user.Username, "remote", ip, "reason", "confirmation_failed")
+		httpErr(w, fmt.Errorf("password confirmation required (X-Confirm-Password)"), 403)
+		return
+	}
+
+	rec := &statusRecorder{ResponseWriter: w, code: 200}
+	w = rec
+	var body []byte
+	defer func() {
+		logx.Info("config restore attempted", "user", user.Username, "remote", ip, "status", rec.code, "bytes", len(body))
+	}()
 
 	existing, _ := h.store.GetConfig()
-	body, err := io.ReadAll(r.Body)
+	body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigRestoreBytes))
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httpErr(w, fmt.Errorf("backup too large (limit %d MB)", maxConfigRestoreBytes>>20), 413)
+			return
+		}
 		httpErr(w, fmt.Errorf("invalid body: %w", err), 400)
 		return
 	}
 	var payload struct {
-		Config models.CentralConfig `json:"config"`
-		Agents *[]models.Agent      `json:"agents"`
+		Config    models.CentralConfig            `json:"config"`
+		Agents    *[]models.Agent                 `json:"agents"`
+		AgentData map[string]*models.AgentData    `json:"agentData"`
+		Metrics   map[string][]models.MetricPoint `json:"metrics"`
+		Users     *[]models.User                  `json:"users"`
 	}
 	var cfg models.CentralConfig
-	if err := json.Unmarshal(body, &payload); err == nil && (payload.Agents != nil || payload.Config.Port != "" || payload.Config.Theme != "" || payload.Config.Language != "" || payload.Config.PollIntervalSec != 0 || payload.Config.RetentionDays != 0 || payload.Config.CaddyDomain != "") {
+	rawConfig := body
+	if err := json.Unmarshal(body, &payload); err == nil && (payload.Agents != nil || payload.Users != nil || payload.Config.Port != "" || payload.Config.Theme != "" || payload.Config.Language != "" || payload.Config.PollIntervalSec != 0 || payload.Config.RetentionDays != 0 || payload.Config.CaddyDomain != "") {
 		cfg = payload.Config
+		var wrapped struct {
+			Config json.RawMessage `json:"config"`
+		}
+		_ = json.Unmarshal(body, &wrapped)
+		rawConfig = wrapped.Config
 	} else {
 		// Backward compatibility: old backups were plain CentralConfig JSON
 		if err := json.Unmarshal(body, &cfg); err != nil {
@@ -105,6 +210,27 @@ func (h *Handler) handleConfigRestore(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		payload.Agents = nil
+		payload.Users = nil
+	}
+
+	var restoreUsers []models.User
+	if payload.Users != nil {
+		restoreUsers, err = h.prepareUserRestore(*payload.Users)
+		if err != nil {
+			httpErr(w, err, 400)
+			return
+		}
+	}
+
+	// ?configMode=merge keeps current values for every field the backup leaves
+	// empty; the default (replace) overwrites the whole config as before.
+	if strings.EqualFold(strings.TrimSpace(r.URL.Query().Get("configMode")), "merge") && existing != nil {
+		merged, err := mergeConfigJSON(existing, rawConfig)
+		if err != nil {
+			httpErr(w, fmt.Errorf("invalid config: %w", err), 400)
+			return
+		}
+		cfg = merged
 	}
 
 	if cfg.PollIntervalSec < 5 {
@@ -126,6 +252,7 @@ func (h *Handler) handleConfigRestore(w http.ResponseWriter, r *http.Request) {
 		cfg.JWTSecret = existing.JWTSecret
 	}
 
+	netutil.SetDefaultAgentPort(cfg.AgentPort)
 	if payload.Agents != nil {
 		replaceMode := strings.EqualFold(strings.TrimSpace(r.URL.Query().Get("mode")), "replace")
 		if replaceMode {
@@ -136,6 +263,7 @@ func (h *Handler) handleConfigRestore(w http.ResponseWriter, r *http.Request) {
 			}
 			for _, a := range curAgents {
 				_ = h.store.DeleteAgent(a.ID)
+				h.proxyStats.forget(a.ID)
 			}
 		}
 		for i := range *payload.Agents {
@@ -149,6 +277,26 @@ func (h *Handler) handleConfigRestore(w http.ResponseWriter, r *http.Request) {
 			}
 			_ = h.store.SaveAgent(&a)
 		}
+
+		// Full snapshots also carry cached data and history; they are loaded
+		// into the poller on the next start and refreshed by regular polling.
+		for id, d := range payload.AgentData {
+			if d != nil {
+				_ = h.store.SaveAgentData(id, d)
+			}
+		}
+		// The snapshot's series replaces the stored one, so restoring twice
+		// does not duplicate points.
+		for id, pts := range payload.Metrics {
+			_ = h.store.ReplaceMetricHistory(id, pts)
+		}
+	}
+
+	for i := range restoreUsers {
+		if err := h.store.SaveUser(&restoreUsers[i]); err != nil {
+			httpErr(w, err, 500)
+			return
+		}
 	}
 
 	if err := h.store.SaveConfig(&cfg); err != nil {
@@ -163,6 +311,92 @@ func (h *Handler) handleConfigRestore(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// prepareUserRestore validates backed-up users for an upsert. A user whose
+// username already exists under another ID takes over that ID, so restoring
+// never creates duplicate logins. The resulting user set must keep an admin.
+func (h *Handler) prepareUserRestore(in []models.User) ([]models.User, error) {
+	current, err := h.store.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+	byID := map[string]int{}
+	byName := map[string]string{}
+	result := make([]models.User, 0, len(current)+len(in))
+	for _, u := range current {
+		byID[u.ID] = len(result)
+		byName[strings.ToLower(u.Username)] = u.ID
+		result = append(result, u)
+	}
+
+	out := make([]models.User, 0, len(in))
+	seen := map[string]bool{}
+	for _, u := range in {
+		u.Username = strings.TrimSpace(u.Username)
+		if u.Username == "" || u.Password == "" {
+			return nil, fmt.Errorf("invalid user in backup: username and password hash are required")
+		}
+		key := strings.ToLower(u.Username)
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate user in backup: %s", u.Username)
+		}
+		seen[key] = true
+		if id, ok := byName[key]; ok {
+			u.ID = id
+		}
+		if strings.TrimSpace(u.ID) == "" {
+			u.ID = fmt.Sprintf("user_%d", time.Now().UnixNano()+int64(len(out)))
+		}
+		u.Role = normalizeRole(u.Role)
+		if u.Role == "" {
+			u.Role = "user"
+		}
+		if u.CreatedAt.IsZero() {
+			u.CreatedAt = time.Now()
+		}
+		if i, ok := byID[u.ID]; ok {
+			// Restoring another password hash ends the user's sessions,
+			// like a password change.
+			u.TokenVersion = result[i].TokenVersion
+			if u.Password != result[i].Password {
+				u.TokenVersion++
+			}
+			result[i] = u
+		} else {
+			byID[u.ID] = len(result)
+			result = append(result, u)
+		}
+		out = append(out, u)
+	}
+	if err := ensureAdminRemains(result); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// mergeConfigJSON overlays the non-empty fields of raw onto a copy of base.
+// null, "", 0, false, [] and {} values in raw are treated as absent.
+func mergeConfigJSON(base *models.CentralConfig, raw []byte) (models.CentralConfig, error) {
+	merged := *base
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return merged, err
+	}
+	for k, v := range fields {
+		switch strings.TrimSpace(string(v)) {
+		case "null", `""`, "0", "false", "[]", "{}":
+			delete(fields, k)
+		}
+	}
+	filtered, err := json.Marshal(fields)
+	if err != nil {
+		return merged, err
+	}
+	if err := json.Unmarshal(filtered, &merged); err != nil {
+		return merged, err
+	}
+	return merged, nil
+}
+
 func (h *Handler) handleCaddyRecheck(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	if r.Method != http.MethodPost {
@@ -289,16 +523,26 @@ func NewHandler(s *store.Store, p *poller.Poller) *Handler {
 	}
 	os.MkdirAll(dataDir, 0755)
 	return &Handler{
-		store:      s,
-		poller:     p,
-		dataDir:    dataDir,
-		instanceID: instanceID,
+		store:          s,
+		poller:         p,
+		dataDir:        dataDir,
+		instanceID:     instanceID,
+		restoreLimit:   newIPRateLimiter(5, 10*time.Minute),
+		proxyStats:     newProxyMetrics(),
+		trustedProxies: trustedProxiesFromEnv(),
 		proxy: &http.Client{
 			Timeout: 30 * time.Second,
 			Transport: &http.Transport{
 				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 			},
 		},
+		streamProxy: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+				ResponseHeaderTimeout: 30 * time.Second,
+				IdleConnTimeout:       90 * time.Second,
+			},
+		},
 	}
 }
 
@@ -307,19 +551,30 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/agents", h.handleAgents)
 	mux.HandleFunc("/api/agents/", h.handleAgent)
 	mux.HandleFunc("/api/overview", h.handleOverview)
+	mux.HandleFunc("/api/info", h.handleInfo)
+	mux.HandleFunc("/api/poll", h.handlePollNow)
 	mux.HandleFunc("/api/config", h.handleConfig)
 	mux.HandleFunc("/api/config/backup", h.handleConfigBackup)
 	mux.HandleFunc("/api/config/restore", h.handleConfigRestore)
 	mux.HandleFunc("/api/caddy/recheck", h.handleCaddyRecheck)
 	mux.HandleFunc("/api/license/status", h.handleLicenseStatus)
 	mux.HandleFunc("/api/license/recheck", h.handleLicenseRecheck)
+	mux.HandleFunc("/api/license/ping", h.handleLicensePing)
+	mux.HandleFunc("/api/license/offline", h.handleLicenseOffline)
 	mux.HandleFunc("/api/license-server/", h.handleLicenseServerProxy)
 	mux.HandleFunc("/api/stats", h.handleStats)
+	mux.HandleFunc("/api/reports/send", h.handleReportSend)
+	mux.HandleFunc("/api/config/test-email", h.handleTestEmail)
 	mux.HandleFunc("/api/grafana/logs", h.handleGrafanaLogs)
 	mux.HandleFunc("/api/backgrounds", h.handleBackgrounds)
 	mux.HandleFunc("/api/backgrounds/", h.handleBackgroundFile)
 	mux.HandleFunc("/api/agents/{id}/data", h.handleAgentData)
 	mux.HandleFunc("/api/agents/{id}/history", h.handleAgentHistory)
+	mux.HandleFunc("/api/agents/{id}/rename", h.handleAgentRename)
+	mux.HandleFunc("/api/agents/{id}/logs", h.handleAgentLogs)
+	mux.HandleFunc("/api/agents/{id}/summary", h.handleAgentSummary)
+	mux.HandleFunc("/api/agents/{id}/enable", h.handleAgentEnable)
+	mux.HandleFunc("/api/agents/{id}/disable", h.handleAgentEnable)
 	mux.HandleFunc("/api/agents/{id}/proxy/", h.handleProxy)
 	mux.HandleFunc("/metrics", h.handlePrometheusMetrics)
 
@@ -341,8 +596,64 @@ func (h *Handler) filterAgentsByAccess(r *http.Request, agents []models.Agent) [
 	return out
 }
 
+// instanceName returns the configured display name, falling back to the hostname
+func (h *Handler) instanceName(cfg *models.CentralConfig) string {
+	if cfg != nil {
+		if name := strings.TrimSpace(cfg.InstanceName); name != "" {
+			return name
+		}
+	}
+	return h.instanceID
+}
+
+// handleInfo returns lightweight identity information about this instance
+func (h *Handler) handleInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	cfg, _ := h.store.GetConfig()
+	json.NewEncoder(w).Encode(map[string]any{
+		"instanceName": h.instanceName(cfg),
+		"instanceId":   h.instanceID,
+		"maintenance":  cfg != nil && cfg.Maintenance,
+	})
+}
+
 // --- Agent CRUD ---
 
+// findAgentByURL returns an existing agent whose normalized URL matches url
+func (h *Handler) findAgentByURL(url string) *models.Agent {
+	agents, err := h.store.GetAllAgents()
+	if err != nil {
+		return nil
+	}
+	for i := range agents {
+		if strings.EqualFold(netutil.NormalizeAgentBaseURL(agents[i].URL), url) {
+			return &agents[i]
+		}
+	}
+	return nil
+}
+
+// allowLoopbackAgents reports whether agent URLs may point at localhost.
+// They are allowed unless the config sets denyLoopbackAgents, since an
+// agent on the central host itself is a common setup.
+func (h *Handler) allowLoopbackAgents() bool {
+	cfg, err := h.store.GetConfig()
+	return err != nil || !cfg.DenyLoopback
+}
+
+const maxAgentNotesLen = 2000
+
+func validateAgentNotes(notes string) error {
+	if utf8.RuneCountInString(notes) > maxAgentNotesLen {
+		return fmt.Errorf("notes must be at most %d characters", maxAgentNotesLen)
+	}
+	return nil
+}
+
 func (h *Handler) handleAgents(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -381,15 +692,35 @@ func (h *Handler) handleAgents(w http.ResponseWriter, r *http.Request) {
 			httpErr(w, fmt.Errorf("invalid body: %w", err), 400)
 			return
 		}
-		if agent.URL == "" {
-			httpErr(w, fmt.Errorf("url is required"), 400)
+		agent.URL, err = netutil.ValidateAgentURL(agent.URL, h.allowLoopbackAgents())
+		if err != nil {
+			httpErr(w, err, 400)
+			return
+		}
+		if allow, _ := strconv.ParseBool(r.URL.Query().Get("allowDuplicate")); !allow {
+			if dup := h.findAgentByURL(agent.URL); dup != nil {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(map[string]string{
+					"error":   "agent with this url already exists",
+					"agentId": dup.ID,
+					"name":    dup.Name,
+				})
+				return
+			}
+		}
+		agent.Group = strings.TrimSpace(agent.Group)
+		agent.Notes = strings.TrimSpace(agent.Notes)
+		if err := validateAgentNotes(agent.Notes); err != nil {
+			httpErr(w, err, 400)
 			return
 		}
-		agent.URL = netutil.NormalizeAgentBaseURL(agent.URL)
 		if agent.ID == "" {
 			agent.ID = fmt.Sprintf("agent_%d", time.Now().UnixNano())
 		}
 		agent.Status = "pending"
+		if !agent.IsEnabled() {
+			agent.Status = "disabled"
+		}
 		agent.CreatedAt = time.Now()
 
 		// Auto-fetch hostname from agent /api/v1/status
@@ -418,7 +749,9 @@ func (h *Handler) handleAgents(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Immediately poll the new agent
-		go h.poller.PollAgent(agent)
+		if agent.IsEnabled() {
+			go h.poller.PollAgent(agent)
+		}
 
 		json.NewEncoder(w).Encode(agent)
 
@@ -465,7 +798,11 @@ func (h *Handler) handleAgent(w http.ResponseWriter, r *http.Request) {
 			httpErr(w, fmt.Errorf("forbidden"), 403)
 			return
 		}
-		var update models.Agent
+		var update struct {
+			models.Agent
+			Group *string `json:"group"` // nil keeps, "" clears
+			Notes *string `json:"notes"` // nil keeps, "" clears
+		}
 		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
 			httpErr(w, fmt.Errorf("invalid body: %w", err), 400)
 			return
@@ -479,11 +816,27 @@ func (h *Handler) handleAgent(w http.ResponseWriter, r *http.Request) {
 			existing.Name = update.Name
 		}
 		if update.URL != "" {
-			existing.URL = netutil.NormalizeAgentBaseURL(update.URL)
+			u, err := netutil.ValidateAgentURL(update.URL, h.allowLoopbackAgents())
+			if err != nil {
+				httpErr(w, err, 400)
+				return
+			}
+			existing.URL = u
 		}
 		if update.APIKey != "" {
 			existing.APIKey = update.APIKey
 		}
+		if update.Group != nil {
+			existing.Group = strings.TrimSpace(*update.Group)
+		}
+		if update.Notes != nil {
+			notes := strings.TrimSpace(*update.Notes)
+			if err := validateAgentNotes(notes); err != nil {
+				httpErr(w, err, 400)
+				return
+			}
+			existing.Notes = notes
+		}
 		if err := h.store.SaveAgent(existing); err != nil {
 			httpErr(w, err, 500)
 			return
@@ -504,6 +857,8 @@ func (h *Handler) handleAgent(w http.ResponseWriter, r *http.Request) {
 			httpErr(w, err, 500)
 			return
 		}
+		h.poller.Alerts().ClearAgent(id)
+		h.proxyStats.forget(id)
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 
 	default:
@@ -511,8 +866,145 @@ func (h *Handler) handleAgent(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleAgentRename updates only the display name of an agent
+func (h *Handler) handleAgentRename(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	user, err := h.currentUserFromRequest(r)
+	if err != nil {
+		httpErr(w, fmt.Errorf("unauthorized"), 401)
+		return
+	}
+	if normalizeRole(user.Role) != "admin" {
+		httpErr(w, fmt.Errorf("forbidden"), 403)
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpErr(w, fmt.Errorf("invalid body: %w", err), 400)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		httpErr(w, fmt.Errorf("name is required"), 400)
+		return
+	}
+	agent, err := h.store.GetAgent(r.PathValue("id"))
+	if err != nil {
+		httpErr(w, err, 404)
+		return
+	}
+	oldName := agent.Name
+	agent.Name = name
+	if err := h.store.SaveAgent(agent); err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	logx.Info("agent renamed", "agent_id", agent.ID, "from", oldName, "to", name, "by", user.Username)
+	json.NewEncoder(w).Encode(agent)
+}
+
+// handleAgentEnable enables or disables polling of an agent without deleting it.
+// Disabled agents keep their settings and permissions.
+func (h *Handler) handleAgentEnable(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	user, err := h.currentUserFromRequest(r)
+	if err != nil {
+		httpErr(w, fmt.Errorf("unauthorized"), 401)
+		return
+	}
+	if normalizeRole(user.Role) != "admin" {
+		httpErr(w, fmt.Errorf("forbidden"), 403)
+		return
+	}
+	agent, err := h.store.GetAgent(r.PathValue("id"))
+	if err != nil {
+		httpErr(w, err, 404)
+		return
+	}
+	enable := strings.HasSuffix(r.URL.Path, "/enable")
+	agent.Enabled = &enable
+	if enable {
+		agent.Status = "pending"
+	} else {
+		agent.Status = "disabled"
+	}
+	if err := h.store.SaveAgent(agent); err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	logx.Info("agent enabled state changed", "agent_id", agent.ID, "agent", agent.Name, "enabled", enable, "by", user.Username)
+	if enable {
+		go h.poller.PollAgent(*agent)
+	} else {
+		h.poller.Alerts().ClearAgent(agent.ID)
+	}
+	json.NewEncoder(w).Encode(agent)
+}
+
 // --- Data endpoints ---
 
+// handleAgentLogs returns centrally stored logs for a single agent
+func (h *Handler) handleAgentLogs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	id := r.PathValue("id")
+	user, err := h.currentUserFromRequest(r)
+	if err != nil {
+		httpErr(w, fmt.Errorf("unauthorized"), 401)
+		return
+	}
+	if !canViewAgent(user, id) {
+		httpErr(w, fmt.Errorf("forbidden"), 403)
+		return
+	}
+	if _, err := h.store.GetAgent(id); err != nil {
+		httpErr(w, err, 404)
+		return
+	}
+
+	q := r.URL.Query()
+	var fromTime, toTime time.Time
+	if v := strings.TrimSpace(q.Get("from")); v != "" {
+		if ts, ok := parseFlexibleTime(v); ok {
+			fromTime = ts
+		}
+	}
+	if v := strings.TrimSpace(q.Get("to")); v != "" {
+		if ts, ok := parseFlexibleTime(v); ok {
+			toTime = ts
+		}
+	}
+	limit := 200
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil {
+			limit = min(max(parsed, 1), 5000)
+		}
+	}
+
+	logs, err := h.store.QueryLogs(id, strings.TrimSpace(q.Get("type")), strings.TrimSpace(q.Get("status")), "", fromTime, toTime, limit)
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	if logs == nil {
+		logs = []models.CentralLog{}
+	}
+	json.NewEncoder(w).Encode(logs)
+}
+
 func (h *Handler) handleAgentData(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	id := r.PathValue("id")
@@ -577,6 +1069,81 @@ func (h *Handler) handleAgentHistory(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleAgentSummary returns the agent, its latest data, recent history and
+// health in a single response for the detail view
+func (h *Handler) handleAgentSummary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	id := r.PathValue("id")
+	user, err := h.currentUserFromRequest(r)
+	if err != nil {
+		httpErr(w, fmt.Errorf("unauthorized"), 401)
+		return
+	}
+	if !canViewAgent(user, id) {
+		httpErr(w, fmt.Errorf("forbidden"), 403)
+		return
+	}
+	agent, err := h.store.GetAgent(id)
+	if err != nil {
+		httpErr(w, err, 404)
+		return
+	}
+	agent.APIKey = ""
+
+	points := 120 // ~30 minutes at 15s interval
+	if v, err := strconv.Atoi(r.URL.Query().Get("points")); err == nil && v > 0 {
+		points = v
+	}
+	history := h.poller.GetHistory(id)
+	if len(history) > points {
+		history = history[len(history)-points:]
+	}
+
+	data := h.poller.GetAgentData(id)
+	var health *models.HealthReport
+	if data != nil {
+		health = data.Health
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"agent":   agent,
+		"data":    data,
+		"history": history,
+		"health":  health,
+	})
+}
+
+// handlePollNow triggers an immediate poll of all agents and waits for it
+func (h *Handler) handlePollNow(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	user, err := h.currentUserFromRequest(r)
+	if err != nil {
+		httpErr(w, fmt.Errorf("unauthorized"), 401)
+		return
+	}
+	if normalizeRole(user.Role) != "admin" {
+		httpErr(w, fmt.Errorf("forbidden"), 403)
+		return
+	}
+	started := time.Now()
+	polled, ok := h.poller.PollAll()
+	if !ok {
+		httpErr(w, fmt.Errorf("poll already in progress"), 409)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"polled":     polled,
+		"durationMs": time.Since(started).Milliseconds(),
+	})
+}
+
 func (h *Handler) handleOverview(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -588,11 +1155,31 @@ func (h *Handler) handleOverview(w http.ResponseWriter, r *http.Request) {
 		TotalAgents: len(agents),
 	}
 
-	for _, agent := range agents {
-		if agent.Status == "online" {
-			overview.OnlineAgents++
+	// Admins see the whole fleet, so the store can count statuses directly.
+	var counts map[string]int
+	if user, err := h.currentUserFromRequest(r); err == nil && normalizeRole(user.Role) == "admin" {
+		counts, _ = h.store.CountAgentsByStatus()
+	}
+	if counts == nil {
+		counts = map[string]int{}
+		for _, agent := range agents {
+			counts[agent.Status]++
 		}
+	}
+	overview.OnlineAgents = counts["online"]
+	overview.DegradedAgents = counts["degraded"]
+	overview.AuthErrorAgents = counts["auth_error"]
+
+	cfg, _ := h.store.GetConfig()
+	overview.Maintenance = cfg != nil && cfg.Maintenance
+	for _, agent := range agents {
 		if data, ok := allData[agent.ID]; ok && data.HostInfo != nil {
+			switch sev, _ := alerts.DiskSeverity(data.HostInfo.Disks, cfg); sev {
+			case alerts.SeverityCritical:
+				overview.DiskCritAgents++
+			case alerts.SeverityWarning:
+				overview.DiskWarnAgents++
+			}
 			overview.TotalVMs += data.HostInfo.VMCount
 			overview.RunningVMs += data.HostInfo.VMRunning
 			overview.TotalCPU += data.HostInfo.CPUUsage
@@ -640,43 +1227,132 @@ func (h *Handler) handleProxy(w http.ResponseWriter, r *http.Request) {
 		httpErr(w, err, 404)
 		return
 	}
+	rec := &statusRecorder{ResponseWriter: w, code: 200}
+	w = rec
+	start := time.Now()
+	defer func() { h.proxyStats.observe(id, rec.code, time.Since(start)) }()
 
 	// Extract the target path after /api/agents/{id}/proxy
 	proxyPath := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("/api/agents/%s/proxy", id))
+	if cfg, err := h.store.GetConfig(); err == nil && !proxyPathAllowed(proxyPath, cfg.ProxyPaths) {
+		logx.Warn("proxy path not allowed", "agent_id", id, "user", user.Username, "method", r.Method, "path", proxyPath)
+		httpErr(w, fmt.Errorf("proxy path not allowed: %s", proxyPath), 403)
+		return
+	}
 	baseURL := netutil.NormalizeAgentBaseURL(agent.URL)
 	targetURL := baseURL + proxyPath
 	if r.URL.RawQuery != "" {
 		targetURL += "?" + r.URL.RawQuery
 	}
 
-	// Create proxy request
-	var bodyReader io.Reader
-	if r.Body != nil {
-		bodyBytes, _ := io.ReadAll(r.Body)
-		bodyReader = bytes.NewReader(bodyBytes)
-	}
-
-	proxyReq, err := http.NewRequest(r.Method, targetURL, bodyReader)
+	// Stream the request body instead of buffering it; a client disconnect
+	// or proxyTimeout cancels the upstream request.
+	ctx, cancel := context.WithTimeout(r.Context(), proxyTimeout)
+	defer cancel()
+	proxyReq, err := newStreamingProxyRequest(ctx, r, targetURL)
 	if err != nil {
 		httpErr(w, err, 500)
 		return
 	}
-	proxyReq.Header.Set("Content-Type", r.Header.Get("Content-Type"))
 	if agent.APIKey != "" {
 		proxyReq.Header.Set("X-API-Key", agent.APIKey)
 	}
 
-	resp, err := h.proxy.Do(proxyReq)
+	resp, err := h.streamProxy.Do(proxyReq)
 	if err != nil {
 		httpErr(w, fmt.Errorf("agent unreachable: %w", err), 502)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Forward response
-	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	streamProxyResponse(w, resp)
+}
+
+// proxyPathAllowed reports whether p falls under one of the allowed prefixes.
+// Prefixes match whole path segments, so /api/v1/vm does not admit
+// /api/v1/vmadmin. An empty list allows every path.
+func proxyPathAllowed(p string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	p = path.Clean("/" + p)
+	for _, prefix := range prefixes {
+		prefix = strings.TrimRight(path.Clean("/"+strings.TrimSpace(prefix)), "/")
+		if prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyRequestHeaders are the client headers passed upstream. Authorization
+// and Cookie are deliberately absent so central's session never reaches agents.
+var proxyRequestHeaders = []string{
+	"Accept", "Accept-Language", "Content-Type", "Cache-Control",
+	"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since",
+}
+
+// proxyDroppedResponseHeaders are hop-by-hop headers plus those central owns
+// itself (cookies, CORS) and must not take from an upstream.
+var proxyDroppedResponseHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Set-Cookie":          true,
+}
+
+// proxyTimeout bounds a whole proxied exchange, body included, overridable via
+// NODAX_PROXY_TIMEOUT (Go duration). Slow first bytes are cut off sooner by
+// the stream client's 30s response header timeout.
+var proxyTimeout = func() time.Duration {
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("NODAX_PROXY_TIMEOUT"))); err == nil && d > 0 {
+		return d
+	}
+	return 10 * time.Minute
+}()
+
+// newStreamingProxyRequest builds an upstream request that reads r.Body as it
+// is sent, keeping the declared length and the allowlisted client headers.
+func newStreamingProxyRequest(ctx context.Context, r *http.Request, targetURL string) (*http.Request, error) {
+	proxyReq, err := http.NewRequestWithContext(ctx, r.Method, targetURL, r.Body)
+	if err != nil {
+		return nil, err
+	}
+	proxyReq.ContentLength = r.ContentLength
+	for _, k := range proxyRequestHeaders {
+		if vs := r.Header.Values(k); len(vs) > 0 {
+			proxyReq.Header[k] = append([]string(nil), vs...)
+		}
+	}
+	return proxyReq, nil
+}
+
+// streamProxyResponse copies an upstream response to w without buffering it,
+// passing through its headers except hop-by-hop and central-owned ones.
+func streamProxyResponse(w http.ResponseWriter, resp *http.Response) {
+	// Headers named in Connection are hop-by-hop too (RFC 9110 7.6.1).
+	dropped := map[string]bool{}
+	for _, v := range resp.Header.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			dropped[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
+	}
+	for k, vs := range resp.Header {
+		if proxyDroppedResponseHeaders[k] || dropped[k] || strings.HasPrefix(k, "Access-Control-") {
+			continue
+		}
+		w.Header()[k] = append([]string(nil), vs...)
+	}
 	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		logx.Warn("proxy response copy failed", "status", resp.StatusCode, "err", err)
+	}
 }
 
 // handleConfig GET/PUT central server config
@@ -691,6 +1367,7 @@ func (h *Handler) handleConfig(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		cfg, _ := h.store.GetConfig()
 		cfg.JWTSecret = "" // never expose to frontend
+		cfg.SMTPPass = ""
 		json.NewEncoder(w).Encode(cfg)
 	case http.MethodPut:
 		if normalizeRole(user.Role) != "admin" {
@@ -707,8 +1384,14 @@ func (h *Handler) handleConfig(w http.ResponseWriter, r *http.Request) {
 			httpErr(w, fmt.Errorf("invalid body: %w", err), 400)
 			return
 		}
-		if cfg.PollIntervalSec < 5 {
-			cfg.PollIntervalSec = 5
+		warnings, fieldErrs := validateConfigUpdate(&cfg)
+		if len(fieldErrs) > 0 {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error":  "invalid config",
+				"fields": fieldErrs,
+			})
+			return
 		}
 		cfg.JWTSecret = existing.JWTSecret // preserve secret
 		if strings.TrimSpace(cfg.LicenseKey) == "" {
@@ -726,12 +1409,14 @@ func (h *Handler) handleConfig(w http.ResponseWriter, r *http.Request) {
 		cfg.LicenseChecked = existing.LicenseChecked
 		cfg.LicenseGraceTo = existing.LicenseGraceTo
 		cfg.LicenseLastErr = existing.LicenseLastErr
+		cfg.LicenseSkewSec = existing.LicenseSkewSec
+		cfg.LicenseOffline = existing.LicenseOffline // managed by /api/license/offline
+		if cfg.SMTPPass == "" {
+			cfg.SMTPPass = existing.SMTPPass // write-only, empty keeps the stored one
+		}
+		cfg.ReportLastSent = existing.ReportLastSent
 
 		newPort := strings.TrimSpace(cfg.Port)
-		if newPort == "" {
-			newPort = "8080"
-			cfg.Port = newPort
-		}
 
 		newCaddyDomain := strings.TrimSpace(cfg.CaddyDomain)
 		caddyNeedsSync := newCaddyDomain != "" && (newPort != prevPort || newCaddyDomain != prevCaddyDomain)
@@ -746,26 +1431,170 @@ func (h *Handler) handleConfig(w http.ResponseWriter, r *http.Request) {
 			httpErr(w, err, 500)
 			return
 		}
+		netutil.SetDefaultAgentPort(cfg.AgentPort)
 		if strings.TrimSpace(cfg.LicenseKey) != prevLicenseKey || strings.TrimSpace(cfg.LicenseServer) != prevLicenseServer {
 			go h.refreshLicenseStatus()
 		}
 		cfg.JWTSecret = ""
-		json.NewEncoder(w).Encode(cfg)
+		cfg.SMTPPass = ""
+		json.NewEncoder(w).Encode(struct {
+			*models.CentralConfig
+			Warnings []string `json:"warnings"`
+		}{&cfg, warnings})
 	default:
 		http.Error(w, "Method not allowed", 405)
 	}
 }
 
+// validateConfigUpdate applies the default coercions to a config submitted via
+// PUT and reports each one as a warning. Values that cannot be sensibly
+// coerced are returned as field errors keyed by JSON field name.
+func validateConfigUpdate(cfg *models.CentralConfig) ([]string, map[string]string) {
+	warnings := []string{}
+	fieldErrs := map[string]string{}
+
+	if cfg.PollIntervalSec < 5 {
+		warnings = append(warnings, fmt.Sprintf("pollIntervalSec %d is below the minimum, using 5", cfg.PollIntervalSec))
+		cfg.PollIntervalSec = 5
+	}
+
+	cfg.InstanceName = strings.TrimSpace(cfg.InstanceName)
+	if len(cfg.InstanceName) > 128 {
+		fieldErrs["instanceName"] = "must be at most 128 characters"
+	}
+
+	cfg.Port = strings.TrimSpace(cfg.Port)
+	if cfg.Port == "" {
+		warnings = append(warnings, "port is empty, using 8080")
+		cfg.Port = "8080"
+	} else if n, err := strconv.Atoi(cfg.Port); err != nil {
+		fieldErrs["port"] = "must be numeric"
+	} else if n < 1 || n > 65535 {
+		fieldErrs["port"] = "must be between 1 and 65535"
+	}
+
+	if cfg.AgentPort < 0 || cfg.AgentPort > 65535 {
+		fieldErrs["defaultAgentPort"] = "must be between 1 and 65535 (0 uses 9000)"
+	}
+
+	for i, p := range cfg.ProxyPaths {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "/") {
+			fieldErrs["proxyAllowedPaths"] = fmt.Sprintf("entry %d must start with /", i+1)
+			break
+		}
+		cfg.ProxyPaths[i] = p
+	}
+
+	if cfg.RetentionDays < 0 {
+		fieldErrs["retentionDays"] = "must not be negative"
+	}
+
+	cfg.Theme = strings.TrimSpace(cfg.Theme)
+	if cfg.Theme != "" && !validThemes[cfg.Theme] {
+		fieldErrs["theme"] = "must be light or dark"
+	}
+	cfg.BgColor = strings.TrimSpace(cfg.BgColor)
+	if cfg.BgColor != "" && !validBgColor(cfg.BgColor) {
+		fieldErrs["bgColor"] = "must be #rgb or #rrggbb"
+	}
+
+	if cfg.DiskWarnPct < 0 || cfg.DiskWarnPct > 100 {
+		fieldErrs["diskWarnPct"] = "must be between 0 and 100"
+	}
+	if cfg.DiskCritPct < 0 || cfg.DiskCritPct > 100 {
+		fieldErrs["diskCritPct"] = "must be between 0 and 100"
+	}
+	if warn, crit := cfg.DiskThresholds(); warn >= crit {
+		fieldErrs["diskWarnPct"] = "must be lower than diskCritPct"
+	}
+	for drive, t := range cfg.DiskLimits {
+		key := "diskThresholds." + drive
+		switch warn, crit := cfg.DiskThresholdsFor(drive); {
+		case strings.TrimSpace(drive) == "":
+			fieldErrs["diskThresholds"] = "drive or mount must not be empty"
+		case t.WarnPct < 0 || t.WarnPct > 100 || t.CritPct < 0 || t.CritPct > 100:
+			fieldErrs[key] = "must be between 0 and 100"
+		case warn >= crit:
+			fieldErrs[key] = "warnPct must be lower than critPct"
+		}
+	}
+	if cfg.CPUAlertPct < 0 || cfg.CPUAlertPct > 100 {
+		fieldErrs["cpuAlertPct"] = "must be between 0 and 100"
+	}
+	if cfg.RAMAlertPct < 0 || cfg.RAMAlertPct > 100 {
+		fieldErrs["ramAlertPct"] = "must be between 0 and 100"
+	}
+	if cfg.AlertSustainMin < 0 {
+		fieldErrs["alertSustainMin"] = "must not be negative"
+	}
+	if cfg.AlertRepeatMin < 0 {
+		fieldErrs["alertRepeatMin"] = "must not be negative"
+	}
+	if cfg.DegradedAfter < 0 {
+		fieldErrs["degradedAfterPolls"] = "must not be negative"
+	}
+	if cfg.OfflineAfter < 0 {
+		fieldErrs["offlineAfterPolls"] = "must not be negative"
+	}
+	switch cfg.AlertFormat = strings.ToLower(strings.TrimSpace(cfg.AlertFormat)); cfg.AlertFormat {
+	case "", alerts.FormatPlain, alerts.FormatAlertmanager:
+	default:
+		fieldErrs["alertFormat"] = "must be plain or alertmanager"
+	}
+	if cfg.SMTPPort < 0 || cfg.SMTPPort > 65535 {
+		fieldErrs["smtpPort"] = "must be between 1 and 65535"
+	}
+	if cfg.ReportEveryH < 0 {
+		fieldErrs["reportEveryHours"] = "must not be negative"
+	}
+	recipients := make([]string, 0, len(cfg.ReportTo))
+	for _, addr := range cfg.ReportTo {
+		if addr = strings.TrimSpace(addr); addr == "" {
+			continue
+		}
+		if err := mailer.ValidateAddress(addr); err != nil {
+			fieldErrs["reportRecipients"] = err.Error()
+		}
+		recipients = append(recipients, addr)
+	}
+	cfg.ReportTo = recipients
+	cfg.AlertWebhookURL = strings.TrimSpace(cfg.AlertWebhookURL)
+	if cfg.AlertWebhookURL != "" && !strings.HasPrefix(cfg.AlertWebhookURL, "http://") && !strings.HasPrefix(cfg.AlertWebhookURL, "https://") {
+		fieldErrs["alertWebhookUrl"] = "must be an http(s) URL"
+	}
+
+	return warnings, fieldErrs
+}
+
 // handleStats returns aggregated statistics from all hosts
 func (h *Handler) handleStats(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
 	agents, _ := h.store.GetAllAgents()
 	agents = h.filterAgentsByAccess(r, agents)
+	stats := h.buildStats(agents)
+
+	switch strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format"))) {
+	case "csv":
+		headers, rows := statsTable(stats)
+		writeCSV(w, "stats", headers, rows)
+	case "xml":
+		headers, rows := statsTable(stats)
+		writeSpreadsheetML(w, "stats", "Статистика", headers, rows)
+	case "xlsx", "xls":
+		httpErr(w, fmt.Errorf("format %s is not supported; use xml (Excel 2003 XML) or csv", r.URL.Query().Get("format")), 400)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+	}
+}
+
+// buildStats aggregates cached poller data for the given agents
+func (h *Handler) buildStats(agents []models.Agent) models.AggregatedStats {
 	allData := h.poller.GetAllData()
 
 	stats := models.AggregatedStats{}
 	stats.TotalHosts = len(agents)
+	cfg, _ := h.store.GetConfig()
 
 	for _, agent := range agents {
 		hs := models.HostStats{
@@ -773,8 +1602,13 @@ func (h *Handler) handleStats(w http.ResponseWriter, r *http.Request) {
 			Name:    agent.Name,
 			Status:  agent.Status,
 		}
-		if agent.Status == "online" {
+		switch agent.Status {
+		case "online":
 			stats.OnlineHosts++
+		case "degraded":
+			stats.DegradedHosts++
+		case "auth_error":
+			stats.AuthErrorHosts++
 		}
 		if data, ok := allData[agent.ID]; ok && data.HostInfo != nil {
 			hi := data.HostInfo
@@ -787,6 +1621,11 @@ func (h *Handler) handleStats(w http.ResponseWriter, r *http.Request) {
 			hs.Disks = hi.Disks
 			hs.Uptime = hi.Uptime
 			hs.OS = hi.OSName
+			if sev, worst := alerts.DiskSeverity(hi.Disks, cfg); worst.Drive != "" {
+				hs.DiskSeverity = sev
+				hs.DiskWorst = worst.Drive
+				hs.DiskWorstPct = worst.UsePct
+			}
 
 			stats.TotalVMs += hi.VMCount
 			stats.RunningVMs += hi.VMRunning
@@ -808,7 +1647,34 @@ func (h *Handler) handleStats(w http.ResponseWriter, r *http.Request) {
 		stats.AvgRAM /= float64(stats.OnlineHosts)
 	}
 
-	json.NewEncoder(w).Encode(stats)
+	return stats
+}
+
+// statsTable flattens stats into one row per host plus a totals row
+func statsTable(stats models.AggregatedStats) ([]string, [][]string) {
+	headers := []string{"ID", "Хост", "Статус", "CPU %", "RAM %", "RAM исп. ГБ", "RAM всего ГБ", "VM всего", "VM запущено", "Диск исп. ГБ", "Диск всего ГБ", "Диски", "Худший диск %", "Аптайм", "ОС"}
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 1, 64) }
+	rows := make([][]string, 0, len(stats.Hosts)+1)
+	for _, hs := range stats.Hosts {
+		var diskUsed, diskTotal float64
+		drives := make([]string, 0, len(hs.Disks))
+		for _, d := range hs.Disks {
+			diskTotal += d.TotalGB
+			diskUsed += d.TotalGB - d.FreeGB
+			drives = append(drives, fmt.Sprintf("%s %.0f%%", d.Drive, d.UsePct))
+		}
+		rows = append(rows, []string{
+			hs.AgentID, hs.Name, hs.Status, f(hs.CPU), f(hs.RAMPct), f(hs.RAMUsedGB), f(hs.RAMTotalGB),
+			strconv.Itoa(hs.VMTotal), strconv.Itoa(hs.VMRunning), f(diskUsed), f(diskTotal),
+			strings.Join(drives, "; "), f(hs.DiskWorstPct), hs.Uptime, hs.OS,
+		})
+	}
+	rows = append(rows, []string{
+		"", "Итого", fmt.Sprintf("%d/%d онлайн", stats.OnlineHosts, stats.TotalHosts), f(stats.AvgCPU), f(stats.AvgRAM),
+		f(stats.UsedRAMGB), f(stats.TotalRAMGB), strconv.Itoa(stats.TotalVMs), strconv.Itoa(stats.RunningVMs),
+		f(stats.UsedDiskGB), f(stats.TotalDiskGB), "", "", "", "",
+	})
+	return headers, rows
 }
 
 // handleBackgrounds GET=list, POST=upload
@@ -816,21 +1682,25 @@ func (h *Handler) handleBackgrounds(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	switch r.Method {
 	case http.MethodGet:
-		entries, _ := os.ReadDir(h.dataDir)
-		var names []string
-		for _, e := range entries {
-			if e.IsDir() {
+		names := h.listBackgrounds()
+		if r.URL.Query().Get("unused") != "" {
+			names = h.unusedBackgrounds(names)
+		}
+		json.NewEncoder(w).Encode(names)
+
+	case http.MethodDelete:
+		// Remove every uploaded background not referenced by the config or
+		// any user; other images in the data dir are left alone.
+		deleted := []string{}
+		for _, name := range h.unusedBackgrounds(h.listBackgrounds()) {
+			if err := os.Remove(filepath.Join(h.dataDir, name)); err != nil {
+				logx.Warn("background cleanup failed", "name", name, "err", err)
 				continue
 			}
-			ext := strings.ToLower(filepath.Ext(e.Name()))
-			if ext == ".jpg" || ext == ".jpeg" || ext == ".png" || ext == ".webp" || ext == ".gif" || ext == ".bmp" {
-				names = append(names, e.Name())
-			}
+			_ = os.Remove(filepath.Join(h.dataDir, backgroundDisplayName(name)))
+			deleted = append(deleted, name)
 		}
-		if names == nil {
-			names = []string{}
-		}
-		json.NewEncoder(w).Encode(names)
+		json.NewEncoder(w).Encode(map[string]any{"deleted": deleted})
 
 	case http.MethodPost:
 		r.ParseMultipartForm(10 << 20) // 10 MB max
@@ -842,19 +1712,33 @@ func (h *Handler) handleBackgrounds(w http.ResponseWriter, r *http.Request) {
 		defer file.Close()
 
 		ext := strings.ToLower(filepath.Ext(header.Filename))
-		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".webp" && ext != ".gif" && ext != ".bmp" {
+		if !backgroundExts[ext] {
 			httpErr(w, fmt.Errorf("unsupported format: %s", ext), 400)
 			return
 		}
 
-		name := fmt.Sprintf("bg_%d%s", time.Now().UnixMilli(), ext)
-		dst, err := os.Create(filepath.Join(h.dataDir, name))
+		data, err := io.ReadAll(io.LimitReader(file, maxBackgroundBytes+1))
 		if err != nil {
+			httpErr(w, fmt.Errorf("read failed: %w", err), 400)
+			return
+		}
+		if len(data) > maxBackgroundBytes {
+			httpErr(w, fmt.Errorf("file too large (max %d MB)", maxBackgroundBytes>>20), 400)
+			return
+		}
+		if err := validateBackgroundImage(data, ext); err != nil {
+			httpErr(w, err, 400)
+			return
+		}
+
+		name := fmt.Sprintf("%s%d%s", backgroundPrefix, time.Now().UnixMilli(), ext)
+		if err := os.WriteFile(filepath.Join(h.dataDir, name), data, 0644); err != nil {
 			httpErr(w, err, 500)
 			return
 		}
-		defer dst.Close()
-		io.Copy(dst, file)
+		if err := writeBackgroundDisplay(h.dataDir, name, data); err != nil {
+			logx.Warn("background display copy failed", "name", name, "err", err)
+		}
 
 		json.NewEncoder(w).Encode(map[string]string{"name": name})
 
@@ -874,12 +1758,19 @@ func (h *Handler) handleBackgroundFile(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
+		// Serve the downscaled copy when present unless the original is requested.
+		if r.URL.Query().Get("original") == "" {
+			if display := filepath.Join(h.dataDir, backgroundDisplayName(name)); fileExists(display) {
+				fpath = display
+			}
+		}
 		http.ServeFile(w, r, fpath)
 	case http.MethodDelete:
 		if err := os.Remove(fpath); err != nil {
 			httpErr(w, err, 500)
 			return
 		}
+		_ = os.Remove(filepath.Join(h.dataDir, backgroundDisplayName(name)))
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 	default:
@@ -930,19 +1821,18 @@ func (h *Handler) handleLicenseServerProxy(w http.ResponseWriter, r *http.Reques
 		targetURL += "?" + r.URL.RawQuery
 	}
 
-	// Create proxy request
-	var bodyReader io.Reader
-	if r.Body != nil {
-		bodyBytes, _ := io.ReadAll(r.Body)
-		bodyReader = bytes.NewReader(bodyBytes)
-	}
-
-	proxyReq, err := http.NewRequest(r.Method, targetURL, bodyReader)
+	// Stream the request body instead of buffering it; a client disconnect
+	// or proxyTimeout cancels the upstream request.
+	ctx, cancel := context.WithTimeout(r.Context(), proxyTimeout)
+	defer cancel()
+	proxyReq, err := newStreamingProxyRequest(ctx, r, targetURL)
 	if err != nil {
 		httpErr(w, fmt.Errorf("request build failed: %w", err), 500)
 		return
 	}
-	proxyReq.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+	requestID := requestIDFrom(r)
+	proxyReq.Header.Set(requestIDHeader, requestID)
+	w.Header().Set(requestIDHeader, requestID)
 
 	// Add admin token from config or env
 	adminToken := strings.TrimSpace(os.Getenv("NODAX_LICENSE_ADMIN_TOKEN"))
@@ -950,17 +1840,15 @@ func (h *Handler) handleLicenseServerProxy(w http.ResponseWriter, r *http.Reques
 		proxyReq.Header.Set("Authorization", "Bearer "+adminToken)
 	}
 
-	resp, err := h.proxy.Do(proxyReq)
+	resp, err := h.streamProxy.Do(proxyReq)
 	if err != nil {
+		logx.Error("license proxy request failed", "method", r.Method, "path", proxyPath, "err", err, "request_id", requestID)
 		httpErr(w, fmt.Errorf("license server unreachable: %w", err), 502)
 		return
 	}
 	defer resp.Body.Close()
 
-	// Forward response
-	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	streamProxyResponse(w, resp)
 }
 
 type grafanaLogEntry struct {
@@ -1031,7 +1919,8 @@ func (h *Handler) handleGrafanaLogs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Read from local store (centrally collected logs)
-	logs, err := h.store.QueryLogs(agentFilter, typeFilter, statusFilter, fromTime, toTime, limit)
+	groupFilter := strings.TrimSpace(r.URL.Query().Get("group"))
+	logs, err := h.store.QueryLogs(agentFilter, typeFilter, statusFilter, groupFilter, fromTime, toTime, limit)
 	if err != nil {
 		httpErr(w, err, http.StatusInternalServerError)
 		return
@@ -1075,14 +1964,35 @@ func (h *Handler) handlePrometheusMetrics(w http.ResponseWriter, r *http.Request
 
 	b.WriteString("# HELP nodax_central_agents_online Online agents\n")
 	b.WriteString("# TYPE nodax_central_agents_online gauge\n")
-	online := 0
+	online, degraded, authErr := 0, 0, 0
 	for _, a := range agents {
-		if a.Status == "online" {
+		switch a.Status {
+		case "online":
 			online++
+		case "degraded":
+			degraded++
+		case "auth_error":
+			authErr++
 		}
 	}
 	b.WriteString(fmt.Sprintf("nodax_central_agents_online %d\n", online))
 
+	b.WriteString("# HELP nodax_central_agents_degraded Agents reachable but with failing sub-requests\n")
+	b.WriteString("# TYPE nodax_central_agents_degraded gauge\n")
+	b.WriteString(fmt.Sprintf("nodax_central_agents_degraded %d\n", degraded))
+
+	maintenance := 0
+	if cfg, err := h.store.GetConfig(); err == nil && cfg.Maintenance {
+		maintenance = 1
+	}
+	b.WriteString("# HELP nodax_central_maintenance Whether maintenance mode freezes API writes\n")
+	b.WriteString("# TYPE nodax_central_maintenance gauge\n")
+	b.WriteString(fmt.Sprintf("nodax_central_maintenance %d\n", maintenance))
+
+	b.WriteString("# HELP nodax_central_agents_auth_error Agents rejecting the configured API key\n")
+	b.WriteString("# TYPE nodax_central_agents_auth_error gauge\n")
+	b.WriteString(fmt.Sprintf("nodax_central_agents_auth_error %d\n", authErr))
+
 	b.WriteString("# HELP nodax_host_cpu_usage_percent Host CPU usage percent\n")
 	b.WriteString("# TYPE nodax_host_cpu_usage_percent gauge\n")
 	b.WriteString("# HELP nodax_host_ram_usage_percent Host RAM usage percent\n")
@@ -1097,11 +2007,22 @@ func (h *Handler) handlePrometheusMetrics(w http.ResponseWriter, r *http.Request
 	b.WriteString("# TYPE nodax_host_up gauge\n")
 	b.WriteString("# HELP nodax_host_uptime_seconds Host uptime in seconds\n")
 	b.WriteString("# TYPE nodax_host_uptime_seconds gauge\n")
+	b.WriteString("# HELP nodax_host_disk_critical Disk usage at or above the critical threshold (1) or not (0)\n")
+	b.WriteString("# TYPE nodax_host_disk_critical gauge\n")
+
+	cfg, _ := h.store.GetConfig()
 
 	for _, a := range agents {
+		if !a.IsEnabled() {
+			continue
+		}
 		labels := fmt.Sprintf("agent_id=\"%s\",agent_name=\"%s\"", escapeLabel(a.ID), escapeLabel(a.Name))
 		if a.Status == "online" {
 			b.WriteString(fmt.Sprintf("nodax_host_up{%s} 1\n", labels))
+		} else if a.Status == "degraded" {
+			b.WriteString(fmt.Sprintf("nodax_host_up{%s,state=\"degraded\"} 1\n", labels))
+		} else if a.Status == "auth_error" {
+			b.WriteString(fmt.Sprintf("nodax_host_up{%s,error=\"auth\"} 0\n", labels))
 		} else {
 			b.WriteString(fmt.Sprintf("nodax_host_up{%s} 0\n", labels))
 		}
@@ -1121,9 +2042,16 @@ func (h *Handler) handlePrometheusMetrics(w http.ResponseWriter, r *http.Request
 		for _, d := range hi.Disks {
 			diskLabels := labels + fmt.Sprintf(",drive=\"%s\"", escapeLabel(d.Drive))
 			b.WriteString(fmt.Sprintf("nodax_host_disk_usage_percent{%s} %.3f\n", diskLabels, d.UsePct))
+			critical := 0
+			if _, diskCrit := cfg.DiskThresholdsFor(d.Drive); d.UsePct >= diskCrit {
+				critical = 1
+			}
+			b.WriteString(fmt.Sprintf("nodax_host_disk_critical{%s} %d\n", diskLabels, critical))
 		}
 	}
 
+	h.proxyStats.writeTo(&b)
+
 	_, _ = w.Write([]byte(b.String()))
 }
 
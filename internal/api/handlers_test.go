@@ -0,0 +1,388 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nodax-central/internal/models"
+	"nodax-central/internal/store"
+)
+
+// newTestHandler returns a Handler over a fresh store in a temp dir and the
+// ID of an admin user to send as X-User-ID.
+func newTestHandler(t *testing.T) (*Handler, string) {
+	t.Helper()
+	t.Setenv("NODAX_DATA_DIR", t.TempDir())
+	s, err := store.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	admin, err := s.CreateUser("admin", "secret-password", "admin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Handler{store: s}, admin.ID
+}
+
+func TestValidateConfigUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       models.CentralConfig
+		wantWarns int
+		wantField string // field expected in the errors, "" for none
+		check     func(t *testing.T, cfg models.CentralConfig)
+	}{
+		{
+			name:      "poll interval below minimum is coerced",
+			cfg:       models.CentralConfig{PollIntervalSec: 1, Port: "8080"},
+			wantWarns: 1,
+			check: func(t *testing.T, cfg models.CentralConfig) {
+				if cfg.PollIntervalSec != 5 {
+					t.Errorf("PollIntervalSec = %d, want 5", cfg.PollIntervalSec)
+				}
+			},
+		},
+		{
+			name:      "empty port is coerced",
+			cfg:       models.CentralConfig{PollIntervalSec: 30, Port: "  "},
+			wantWarns: 1,
+			check: func(t *testing.T, cfg models.CentralConfig) {
+				if cfg.Port != "8080" {
+					t.Errorf("Port = %q, want 8080", cfg.Port)
+				}
+			},
+		},
+		{
+			name:      "both coercions are reported",
+			cfg:       models.CentralConfig{},
+			wantWarns: 2,
+		},
+		{
+			name: "valid config passes unchanged",
+			cfg:  models.CentralConfig{PollIntervalSec: 30, Port: " 9090 "},
+			check: func(t *testing.T, cfg models.CentralConfig) {
+				if cfg.Port != "9090" {
+					t.Errorf("Port = %q, want trimmed 9090", cfg.Port)
+				}
+			},
+		},
+		{
+			name:      "non-numeric port is rejected",
+			cfg:       models.CentralConfig{PollIntervalSec: 30, Port: "http"},
+			wantField: "port",
+		},
+		{
+			name:      "out of range port is rejected",
+			cfg:       models.CentralConfig{PollIntervalSec: 30, Port: "70000"},
+			wantField: "port",
+		},
+		{
+			name:      "negative retention is rejected",
+			cfg:       models.CentralConfig{PollIntervalSec: 30, Port: "8080", RetentionDays: -1},
+			wantField: "retentionDays",
+		},
+		{
+			name:      "unknown theme is rejected",
+			cfg:       models.CentralConfig{PollIntervalSec: 30, Port: "8080", Theme: "solarized"},
+			wantField: "theme",
+		},
+		{
+			name:      "background color must be hex",
+			cfg:       models.CentralConfig{PollIntervalSec: 30, Port: "8080", BgColor: "url(x)"},
+			wantField: "bgColor",
+		},
+		{
+			name:      "disk warn equal to crit is rejected",
+			cfg:       models.CentralConfig{PollIntervalSec: 30, Port: "8080", DiskWarnPct: 90, DiskCritPct: 90},
+			wantField: "diskWarnPct",
+		},
+		{
+			name:      "disk warn above default crit is rejected",
+			cfg:       models.CentralConfig{PollIntervalSec: 30, Port: "8080", DiskWarnPct: 97},
+			wantField: "diskWarnPct",
+		},
+		{
+			name: "per-disk warn above its crit is rejected",
+			cfg: models.CentralConfig{PollIntervalSec: 30, Port: "8080", DiskLimits: map[string]models.DiskThreshold{
+				"D:": {WarnPct: 99},
+			}},
+			wantField: "diskThresholds.D:",
+		},
+		{
+			name:      "negative degraded threshold is rejected",
+			cfg:       models.CentralConfig{PollIntervalSec: 30, Port: "8080", DegradedAfter: -1},
+			wantField: "degradedAfterPolls",
+		},
+		{
+			name:      "negative offline threshold is rejected",
+			cfg:       models.CentralConfig{PollIntervalSec: 30, Port: "8080", OfflineAfter: -1},
+			wantField: "offlineAfterPolls",
+		},
+		{
+			name:      "unknown alert format is rejected",
+			cfg:       models.CentralConfig{PollIntervalSec: 30, Port: "8080", AlertFormat: "slack"},
+			wantField: "alertFormat",
+		},
+		{
+			name: "alert format is normalized",
+			cfg:  models.CentralConfig{PollIntervalSec: 30, Port: "8080", AlertFormat: " Alertmanager "},
+			check: func(t *testing.T, cfg models.CentralConfig) {
+				if cfg.AlertFormat != "alertmanager" {
+					t.Errorf("AlertFormat = %q, want alertmanager", cfg.AlertFormat)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			warns, errs := validateConfigUpdate(&cfg)
+			if len(warns) != tt.wantWarns {
+				t.Errorf("warnings = %q, want %d", warns, tt.wantWarns)
+			}
+			if tt.wantField == "" {
+				if len(errs) != 0 {
+					t.Errorf("unexpected field errors %v", errs)
+				}
+			} else if _, ok := errs[tt.wantField]; !ok || len(errs) != 1 {
+				t.Errorf("field errors = %v, want only %s", errs, tt.wantField)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
+
+func TestCreateAgentRejectsDuplicateURL(t *testing.T) {
+	h, adminID := newTestHandler(t)
+	if err := h.store.SaveAgent(&models.Agent{ID: "agent_1", Name: "hv-01", URL: "http://host:9000"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, url := range []string{"host", "http://host:9000/", "HTTP://HOST:9000"} {
+		t.Run(url, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]string{"url": url})
+			req := httptest.NewRequest(http.MethodPost, "/api/agents", strings.NewReader(string(body)))
+			req.Header.Set("X-User-ID", adminID)
+			rec := httptest.NewRecorder()
+			h.handleAgents(rec, req)
+			if rec.Code != http.StatusConflict {
+				t.Fatalf("status = %d, want 409; body %s", rec.Code, rec.Body)
+			}
+			var resp map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp["agentId"] != "agent_1" {
+				t.Errorf("response = %s, want agentId agent_1", rec.Body)
+			}
+		})
+	}
+}
+
+func TestCreateAgentLoopbackURL(t *testing.T) {
+	h, adminID := newTestHandler(t)
+	create := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/api/agents", strings.NewReader(`{"name":"local","url":"http://127.0.0.1:9000","enabled":false}`))
+		req.Header.Set("X-User-ID", adminID)
+		rec := httptest.NewRecorder()
+		h.handleAgents(rec, req)
+		return rec.Code
+	}
+	if code := create(); code != http.StatusOK && code != http.StatusCreated {
+		t.Fatalf("loopback agent by default: status = %d, want it created", code)
+	}
+
+	cfg, err := h.store.GetConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DenyLoopback = true
+	if err := h.store.SaveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if code := create(); code != http.StatusBadRequest {
+		t.Errorf("loopback agent with denyLoopbackAgents: status = %d, want 400", code)
+	}
+}
+
+func TestUpdateAgentGroup(t *testing.T) {
+	h, adminID := newTestHandler(t)
+	if err := h.store.SaveAgent(&models.Agent{ID: "agent_1", Name: "hv-01", URL: "http://host:9000", Group: "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	update := func(body string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, "/api/agents/agent_1", strings.NewReader(body))
+		req.Header.Set("X-User-ID", adminID)
+		rec := httptest.NewRecorder()
+		h.handleAgent(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PUT %s: status = %d; body %s", body, rec.Code, rec.Body)
+		}
+		agent, err := h.store.GetAgent("agent_1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return agent.Group
+	}
+	if got := update(`{"name":"hv-01a"}`); got != "prod" {
+		t.Errorf("group after update without group = %q, want prod", got)
+	}
+	if got := update(`{"group":" branch-1 "}`); got != "branch-1" {
+		t.Errorf("group = %q, want branch-1", got)
+	}
+	if got := update(`{"group":""}`); got != "" {
+		t.Errorf("group after clearing = %q, want empty", got)
+	}
+}
+
+func TestConfigRestoreReplacesMetricHistory(t *testing.T) {
+	for _, readSQLite := range []string{"false", "true"} {
+		t.Run("sqlite="+readSQLite, func(t *testing.T) {
+			t.Setenv("NODAX_DB_READ_SQLITE", readSQLite)
+			h, adminID := newTestHandler(t)
+			h.restoreLimit = newIPRateLimiter(5, time.Minute)
+			base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			pts := []models.MetricPoint{{Timestamp: base, CPU: 10}, {Timestamp: base.Add(time.Minute), CPU: 20}}
+			// A point newer than the snapshot must not survive the restore.
+			if err := h.store.AppendMetricPoint("agent_1", models.MetricPoint{Timestamp: base.Add(time.Hour), CPU: 99}, 100); err != nil {
+				t.Fatal(err)
+			}
+			body, _ := json.Marshal(map[string]any{
+				"config":  models.CentralConfig{PollIntervalSec: 30, Port: "8080"},
+				"agents":  []models.Agent{{ID: "agent_1", Name: "hv-01", URL: "http://host:9000"}},
+				"metrics": map[string][]models.MetricPoint{"agent_1": pts},
+			})
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/api/config/restore", strings.NewReader(string(body)))
+				req.Header.Set("X-User-ID", adminID)
+				req.Header.Set("X-Confirm-Password", "secret-password")
+				rec := httptest.NewRecorder()
+				h.handleConfigRestore(rec, req)
+				if rec.Code != http.StatusOK {
+					t.Fatalf("restore %d: status = %d; body %s", i+1, rec.Code, rec.Body)
+				}
+			}
+			got, err := h.store.GetMetricHistory("agent_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(pts) || got[0].CPU != 10 || got[1].CPU != 20 {
+				t.Errorf("history = %+v, want exactly the restored points", got)
+			}
+		})
+	}
+}
+
+func TestStreamingProxyHeaders(t *testing.T) {
+	var upstreamReq *http.Request
+	var upstreamBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamReq = r
+		b, _ := io.ReadAll(r.Body)
+		upstreamBody = string(b)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", "5")
+		w.Header().Set("Content-Range", "bytes 0-4/10")
+		w.Header().Set("Set-Cookie", "agent=1")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Connection", "X-Agent-Hop")
+		w.Header().Set("X-Agent-Hop", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.WriteHeader(http.StatusPartialContent)
+		io.WriteString(w, "hello")
+	}))
+	defer upstream.Close()
+
+	in := httptest.NewRequest(http.MethodPut, "/api/proxy/agent_1/api/v1/upload", strings.NewReader(`{"a":1}`))
+	in.Header.Set("Range", "bytes=0-4")
+	in.Header.Set("Content-Type", "application/json")
+	in.Header.Set("Authorization", "Bearer central-token")
+	in.Header.Set("Cookie", "session=central")
+	in.Header.Set("Connection", "keep-alive")
+	in.Header.Set("Proxy-Authorization", "Basic x")
+
+	proxyReq, err := newStreamingProxyRequest(context.Background(), in, upstream.URL+"/api/v1/upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := upstream.Client().Do(proxyReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got := upstreamReq.Header.Get("Range"); got != "bytes=0-4" {
+		t.Errorf("upstream Range = %q", got)
+	}
+	if got := upstreamReq.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("upstream Content-Type = %q", got)
+	}
+	if upstreamReq.ContentLength != int64(len(`{"a":1}`)) || upstreamBody != `{"a":1}` {
+		t.Errorf("upstream body = %q (length %d)", upstreamBody, upstreamReq.ContentLength)
+	}
+	for _, k := range []string{"Authorization", "Cookie", "Proxy-Authorization"} {
+		if v := upstreamReq.Header.Get(k); v != "" {
+			t.Errorf("upstream got %s = %q, want it dropped", k, v)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	streamProxyResponse(rec, resp)
+	if rec.Code != http.StatusPartialContent {
+		t.Errorf("status = %d, want 206", rec.Code)
+	}
+	if rec.Body.String() != "hello" {
+		t.Errorf("body = %q", rec.Body)
+	}
+	for k, want := range map[string]string{
+		"Content-Type":   "application/octet-stream",
+		"Content-Length": "5",
+		"Content-Range":  "bytes 0-4/10",
+	} {
+		if got := rec.Header().Get(k); got != want {
+			t.Errorf("response %s = %q, want %q", k, got, want)
+		}
+	}
+	for _, k := range []string{"Set-Cookie", "Access-Control-Allow-Origin", "Connection", "X-Agent-Hop", "Keep-Alive"} {
+		if v := rec.Header().Get(k); v != "" {
+			t.Errorf("response %s = %q, want it dropped", k, v)
+		}
+	}
+}
+
+func TestBackgroundsCleanupOnlyTouchesUploads(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.dataDir = t.TempDir()
+	files := []string{"bg_1.png", "bg_1_display.png", "logo.png", "report.jpg"}
+	for _, name := range files {
+		if err := os.WriteFile(filepath.Join(h.dataDir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.handleBackgrounds(rec, httptest.NewRequest(http.MethodDelete, "/api/backgrounds", nil))
+	var resp struct {
+		Deleted []string `json:"deleted"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Deleted) != 1 || resp.Deleted[0] != "bg_1.png" {
+		t.Errorf("deleted = %v, want [bg_1.png]", resp.Deleted)
+	}
+	for _, name := range files {
+		want := !strings.HasPrefix(name, "bg_")
+		if got := fileExists(filepath.Join(h.dataDir, name)); got != want {
+			t.Errorf("%s exists = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -2,37 +2,55 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"nodax-central/internal/logx"
 	"nodax-central/internal/models"
 )
 
 type licenseValidatePayload struct {
-	Status    string `json:"status"`
-	Valid     bool   `json:"valid"`
-	Reason    string `json:"reason"`
-	ExpiresAt string `json:"expiresAt"`
-	GraceDays int    `json:"graceDays"`
+	Status     string `json:"status"`
+	Valid      bool   `json:"valid"`
+	Reason     string `json:"reason"`
+	ExpiresAt  string `json:"expiresAt"`
+	GraceDays  int    `json:"graceDays"`
+	ServerTime string `json:"serverTime"`
+	Nonce      string `json:"nonce"`
+	IssuedAt   string `json:"issuedAt"`
+	ValidUntil string `json:"validUntil"`
+	LicenseKey string `json:"licenseKey"`
+	InstanceID string `json:"instanceId"`
+	Offline    bool   `json:"offline"`
+	MaxAgents  int    `json:"maxAgents"`
 }
 
 type licenseValidateResponse struct {
 	Payload   json.RawMessage `json:"payload"`
-	Signature string `json:"signature"`
-	Algorithm string `json:"algorithm"`
+	Signature string          `json:"signature"`
+	Algorithm string          `json:"algorithm"`
 }
 
 var licenseWriteExempt = map[string]bool{
-	"/api/license/status":  true,
-	"/api/license/recheck": true,
-	"/api/config":          true,
+	"/api/license/status":    true,
+	"/api/license/recheck":   true,
+	"/api/license/offline":   true,
+	"/api/config":            true,
+	"/api/auth/preferences":  true,
+	"/api/poll":              true,
+	"/api/config/test-email": true,
 }
 
 func (h *Handler) StartLicenseLoop(stop <-chan struct{}) {
@@ -62,6 +80,7 @@ func (h *Handler) handleLicenseStatus(w http.ResponseWriter, r *http.Request) {
 		httpErr(w, err, 500)
 		return
 	}
+	cachedFingerprint, cachedAt := h.pubKeys.fingerprint()
 	json.NewEncoder(w).Encode(map[string]any{
 		"status":       strings.TrimSpace(cfg.LicenseStatus),
 		"reason":       strings.TrimSpace(cfg.LicenseReason),
@@ -71,8 +90,15 @@ func (h *Handler) handleLicenseStatus(w http.ResponseWriter, r *http.Request) {
 		"lastError":    strings.TrimSpace(cfg.LicenseLastErr),
 		"publicKey":    strings.TrimSpace(cfg.LicensePubKey),
 		"server":       strings.TrimSpace(cfg.LicenseServer),
-		"configured":   strings.TrimSpace(cfg.LicenseKey) != "" && strings.TrimSpace(cfg.LicenseServer) != "",
+		"configured":   strings.TrimSpace(cfg.LicenseKey) != "" && strings.TrimSpace(cfg.LicenseServer) != "" || strings.TrimSpace(cfg.LicenseOffline) != "",
+		"offline":      strings.TrimSpace(cfg.LicenseOffline) != "",
 		"writeEnabled": isWriteAllowedByLicense(cfg),
+		"clockSkewSec": cfg.LicenseSkewSec,
+		"maintenance":  cfg.Maintenance,
+		"publicKeyCache": map[string]any{
+			"fingerprint": cachedFingerprint,
+			"fetchedAt":   cachedAt,
+		},
 	})
 }
 
@@ -112,6 +138,69 @@ func (h *Handler) handleLicenseRecheck(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleLicensePing checks live reachability of the configured license server
+// via its /healthz endpoint without running a full validation.
+func (h *Handler) handleLicensePing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	user, err := h.currentUserFromRequest(r)
+	if err != nil {
+		httpErr(w, fmt.Errorf("unauthorized"), 401)
+		return
+	}
+	if normalizeRole(user.Role) != "admin" {
+		httpErr(w, fmt.Errorf("forbidden"), 403)
+		return
+	}
+	cfg, err := h.store.GetConfig()
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	server := strings.TrimSpace(cfg.LicenseServer)
+	if server == "" {
+		server = strings.TrimSpace(os.Getenv("NODAX_LICENSE_SERVER"))
+	}
+	if server == "" {
+		httpErr(w, fmt.Errorf("license server not configured"), 400)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(server, "/")+"/healthz", nil)
+	if err != nil {
+		httpErr(w, fmt.Errorf("request build failed: %w", err), 400)
+		return
+	}
+	req.Header.Set(requestIDHeader, requestIDFrom(r))
+
+	started := time.Now()
+	resp, err := h.proxy.Do(req)
+	latency := time.Since(started)
+	result := map[string]any{
+		"server":    server,
+		"checkedAt": started.UTC().Format(time.RFC3339),
+		"latencyMs": latency.Milliseconds(),
+	}
+	if err != nil {
+		result["reachable"] = false
+		result["error"] = err.Error()
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+	defer resp.Body.Close()
+	result["reachable"] = resp.StatusCode < 300
+	result["httpCode"] = resp.StatusCode
+	if resp.StatusCode >= 300 {
+		result["error"] = fmt.Sprintf("status %d", resp.StatusCode)
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
 func (h *Handler) isWriteBlockedByLicense(path, method string) (bool, string) {
 	if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
 		return false, ""
@@ -147,10 +236,80 @@ func isWriteAllowedByLicense(cfg *models.CentralConfig) bool {
 	return isWriteAllowedByLicenseAt(cfg, time.Now().UTC())
 }
 
+// maxLicenseSkewCorrection bounds how far the signed server time may move
+// the clock used for expiry checks.
+const maxLicenseSkewCorrection = 48 * time.Hour
+
+// licenseClock returns the time used for license expiry checks. With
+// NODAX_LICENSE_USE_SERVER_TIME=true and a measured skew above
+// NODAX_LICENSE_SKEW_TOLERANCE (default 5m), local time is shifted by the
+// skew observed against the license server's signed serverTime.
+func licenseClock(cfg *models.CentralConfig, now time.Time) time.Time {
+	if cfg == nil || cfg.LicenseSkewSec == 0 {
+		return now
+	}
+	if on, _ := strconv.ParseBool(os.Getenv("NODAX_LICENSE_USE_SERVER_TIME")); !on {
+		return now
+	}
+	tolerance := licenseSkewTolerance()
+	skew := time.Duration(cfg.LicenseSkewSec) * time.Second
+	if skew.Abs() <= tolerance {
+		return now
+	}
+	if skew > maxLicenseSkewCorrection {
+		skew = maxLicenseSkewCorrection
+	} else if skew < -maxLicenseSkewCorrection {
+		skew = -maxLicenseSkewCorrection
+	}
+	return now.Add(skew)
+}
+
+// licenseSkewTolerance is NODAX_LICENSE_SKEW_TOLERANCE, 5m by default.
+func licenseSkewTolerance() time.Duration {
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("NODAX_LICENSE_SKEW_TOLERANCE"))); err == nil && d >= 0 {
+		return d
+	}
+	return 5 * time.Minute
+}
+
+// checkLicenseResponseFresh rejects a signed validate payload that was not
+// issued for this request: the nonce must be the one sent, and unless the
+// server clock is trusted over ours (NODAX_LICENSE_USE_SERVER_TIME), local
+// time must not be past validUntil by more than the skew tolerance.
+func checkLicenseResponseFresh(p *licenseValidatePayload, nonce string, now time.Time) (reason string, err error) {
+	if p.Nonce != nonce {
+		return "license_response_nonce_mismatch", fmt.Errorf("license response nonce does not match the request; old license server or replayed response")
+	}
+	if on, _ := strconv.ParseBool(os.Getenv("NODAX_LICENSE_USE_SERVER_TIME")); on {
+		return "", nil
+	}
+	validUntil, err := time.Parse(time.RFC3339, strings.TrimSpace(p.ValidUntil))
+	if err != nil {
+		return "stale_license_response", fmt.Errorf("license response has no valid validUntil")
+	}
+	if now.Sub(validUntil) > licenseSkewTolerance() {
+		return "stale_license_response", fmt.Errorf("license response expired at %s; check the clock", validUntil.Format(time.RFC3339))
+	}
+	return "", nil
+}
+
+// fallBackToGrace records a check that produced no usable answer. The status
+// becomes grace while LicenseGraceTo is still ahead, invalid otherwise.
+func fallBackToGrace(cfg *models.CentralConfig, reason string, err error, now time.Time) {
+	cfg.LicenseReason = reason
+	cfg.LicenseLastErr = err.Error()
+	if grace, gErr := time.Parse(time.RFC3339, strings.TrimSpace(cfg.LicenseGraceTo)); gErr == nil && grace.After(licenseClock(cfg, now)) {
+		cfg.LicenseStatus = "grace"
+	} else {
+		cfg.LicenseStatus = "invalid"
+	}
+}
+
 func isWriteAllowedByLicenseAt(cfg *models.CentralConfig, now time.Time) bool {
 	if cfg == nil {
 		return false
 	}
+	now = licenseClock(cfg, now)
 	status := strings.ToLower(strings.TrimSpace(cfg.LicenseStatus))
 	switch status {
 	case "active":
@@ -205,9 +364,26 @@ func (h *Handler) refreshLicenseStatus() error {
 		return err
 	}
 
+	requestID := newRequestID()
+	prevStatus := cfg.LicenseStatus
+	defer func() {
+		if cfg.LicenseLastErr != "" {
+			logx.Warn("license validate failed", "status", cfg.LicenseStatus, "reason", cfg.LicenseReason, "err", cfg.LicenseLastErr, "request_id", requestID)
+		}
+		if cfg.LicenseStatus != prevStatus {
+			logx.Info("license status changed", "from", prevStatus, "to", cfg.LicenseStatus, "reason", cfg.LicenseReason, "request_id", requestID)
+		}
+	}()
+
 	now := time.Now().UTC()
 	cfg.LicenseChecked = now.Format(time.RFC3339)
 
+	// Air-gapped installs run on a signed offline token instead.
+	if strings.TrimSpace(cfg.LicenseOffline) != "" {
+		h.applyOfflineLicense(cfg, now)
+		return h.store.SaveConfig(cfg)
+	}
+
 	server := strings.TrimSpace(cfg.LicenseServer)
 	if server == "" {
 		server = strings.TrimSpace(os.Getenv("NODAX_LICENSE_SERVER"))
@@ -217,7 +393,7 @@ func (h *Handler) refreshLicenseStatus() error {
 	}
 
 	if server != "" && strings.TrimSpace(cfg.LicensePubKey) == "" {
-		if fetched, pubErr := fetchLicenseServerPublicKey(server); pubErr == nil && fetched != "" {
+		if fetched, pubErr := h.pubKeys.get(server); pubErr == nil && fetched != "" {
 			cfg.LicensePubKey = fetched
 		}
 	}
@@ -234,12 +410,16 @@ func (h *Handler) refreshLicenseStatus() error {
 		agentCount = len(agents)
 	}
 
+	nonceRaw := make([]byte, 16)
+	_, _ = rand.Read(nonceRaw)
+	nonce := hex.EncodeToString(nonceRaw)
 	body, _ := json.Marshal(map[string]any{
 		"licenseKey": cfg.LicenseKey,
 		"instanceId": h.instanceID,
-		"hostname":   h.instanceID,
+		"hostname":   h.instanceName(cfg),
 		"version":    "nodax-central",
 		"agentCount": agentCount,
+		"nonce":      nonce,
 	})
 	endpoint := strings.TrimRight(server, "/") + "/api/v1/license/validate"
 	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
@@ -250,16 +430,13 @@ func (h *Handler) refreshLicenseStatus() error {
 		return h.store.SaveConfig(cfg)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(requestIDHeader, requestID)
 
-	resp, err := (&http.Client{Timeout: 15 * time.Second}).Do(req)
+	ctx, cancel := context.WithTimeout(context.Background(), licenseValidateTotalTimeout)
+	defer cancel()
+	resp, err := doLicenseRequestWithRetry(req.WithContext(ctx))
 	if err != nil {
-		cfg.LicenseLastErr = err.Error()
-		cfg.LicenseReason = "license_server_unreachable"
-		if grace, gErr := time.Parse(time.RFC3339, strings.TrimSpace(cfg.LicenseGraceTo)); gErr == nil && grace.After(now) {
-			cfg.LicenseStatus = "grace"
-		} else {
-			cfg.LicenseStatus = "invalid"
-		}
+		fallBackToGrace(cfg, "license_server_unreachable", err, now)
 		return h.store.SaveConfig(cfg)
 	}
 	defer resp.Body.Close()
@@ -310,8 +487,10 @@ func (h *Handler) refreshLicenseStatus() error {
 		return h.store.SaveConfig(cfg)
 	}
 	if !ed25519.Verify(pubKey, parsed.Payload, sig) {
-		// Public key could be rotated on license server. Try refresh once and re-verify.
-		if fetched, ferr := fetchLicenseServerPublicKey(server); ferr == nil && fetched != "" {
+		// Public key could be rotated on license server. Drop the cached copy,
+		// refetch once and re-verify.
+		h.pubKeys.invalidate()
+		if fetched, ferr := h.pubKeys.get(server); ferr == nil && fetched != "" {
 			if fetched != strings.TrimSpace(cfg.LicensePubKey) {
 				cfg.LicensePubKey = fetched
 			}
@@ -338,10 +517,20 @@ func (h *Handler) refreshLicenseStatus() error {
 		cfg.LicenseLastErr = "invalid payload: " + err.Error()
 		return h.store.SaveConfig(cfg)
 	}
+	// A replayed or stale answer says nothing about the license, so like an
+	// unreachable server it keeps a running grace period rather than ending it.
+	if reason, err := checkLicenseResponseFresh(&payload, nonce, time.Now().UTC()); err != nil {
+		fallBackToGrace(cfg, reason, err, now)
+		return h.store.SaveConfig(cfg)
+	}
 
 	cfg.LicenseExpires = strings.TrimSpace(payload.ExpiresAt)
 	cfg.LicenseReason = strings.TrimSpace(payload.Reason)
 	cfg.LicenseLastErr = ""
+	cfg.LicenseSkewSec = 0
+	if serverTime, err := time.Parse(time.RFC3339, strings.TrimSpace(payload.ServerTime)); err == nil {
+		cfg.LicenseSkewSec = int64(serverTime.Sub(time.Now().UTC()) / time.Second)
+	}
 
 	status := strings.ToLower(strings.TrimSpace(payload.Status))
 	if payload.Valid && status == "active" {
@@ -350,7 +539,7 @@ func (h *Handler) refreshLicenseStatus() error {
 		if graceDays < 0 {
 			graceDays = 0
 		}
-		cfg.LicenseGraceTo = now.AddDate(0, 0, graceDays).Format(time.RFC3339)
+		cfg.LicenseGraceTo = licenseClock(cfg, now).AddDate(0, 0, graceDays).Format(time.RFC3339)
 	} else {
 		if status == "" {
 			status = "invalid"
@@ -363,6 +552,70 @@ func (h *Handler) refreshLicenseStatus() error {
 	return h.store.SaveConfig(cfg)
 }
 
+const requestIDHeader = "X-Request-ID"
+
+// newRequestID returns a random correlation id sent to the license server.
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDFrom returns the caller-supplied correlation id or a new one.
+func requestIDFrom(r *http.Request) string {
+	id := strings.TrimSpace(r.Header.Get(requestIDHeader))
+	if id == "" || len(id) > 64 || strings.ContainsAny(id, " \t\r\n") {
+		return newRequestID()
+	}
+	return id
+}
+
+const licenseValidateTotalTimeout = 45 * time.Second
+
+// licenseValidateBackoff lists the pauses between validate attempts; its
+// length is the number of retries after the first attempt.
+var licenseValidateBackoff = []time.Duration{1 * time.Second, 3 * time.Second}
+
+// doLicenseRequestWithRetry sends req, retrying transport errors and
+// 502/503/504 answers with a short backoff so a momentary network blip does
+// not flip the license into grace/invalid. The request must have a replayable
+// body (GetBody) and its context bounds the whole operation.
+func doLicenseRequestWithRetry(req *http.Request) (*http.Response, error) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		resp, err := client.Do(req)
+		last := attempt >= len(licenseValidateBackoff)
+		if err == nil {
+			switch resp.StatusCode {
+			case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				if last {
+					return resp, nil
+				}
+				resp.Body.Close()
+			default:
+				return resp, nil
+			}
+		} else if last {
+			return nil, err
+		}
+		select {
+		case <-time.After(licenseValidateBackoff[attempt]):
+		case <-req.Context().Done():
+			if err == nil {
+				err = req.Context().Err()
+			}
+			return nil, err
+		}
+	}
+}
+
 func decodeLicensePublicKey(raw string) (ed25519.PublicKey, error) {
 	key := strings.TrimSpace(raw)
 	key = strings.TrimPrefix(key, "0x")
@@ -420,6 +673,61 @@ func isHexKey(s string) bool {
 	return true
 }
 
+const licensePubKeyTTL = 10 * time.Minute
+
+// licensePubKeyCache keeps the last public key fetched from the license
+// server so that rapid rechecks do not hit /api/v1/public-key every time.
+type licensePubKeyCache struct {
+	mu        sync.Mutex
+	server    string
+	key       string
+	fetchedAt time.Time
+}
+
+func (c *licensePubKeyCache) get(server string) (string, error) {
+	server = strings.TrimRight(strings.TrimSpace(server), "/")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.key != "" && c.server == server && time.Since(c.fetchedAt) < licensePubKeyTTL {
+		return c.key, nil
+	}
+	key, err := fetchLicenseServerPublicKey(server)
+	if err != nil {
+		return "", err
+	}
+	c.server = server
+	c.key = key
+	c.fetchedAt = time.Now().UTC()
+	return key, nil
+}
+
+func (c *licensePubKeyCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.key = ""
+	c.fetchedAt = time.Time{}
+}
+
+// fingerprint returns the SHA-256 fingerprint of the cached key and the time
+// it was fetched, or empty strings when nothing is cached.
+func (c *licensePubKeyCache) fingerprint() (string, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.key == "" {
+		return "", ""
+	}
+	return publicKeyFingerprint(c.key), c.fetchedAt.Format(time.RFC3339)
+}
+
+func publicKeyFingerprint(raw string) string {
+	key, err := decodeLicensePublicKey(raw)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(key)
+	return "SHA256:" + hex.EncodeToString(sum[:])
+}
+
 func fetchLicenseServerPublicKey(server string) (string, error) {
 	pubEndpoint := strings.TrimRight(server, "/") + "/api/v1/public-key"
 	pubResp, pubErr := (&http.Client{Timeout: 10 * time.Second}).Get(pubEndpoint)
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signedValidateServer answers validate with payload signed by a fresh key,
+// after letting edit adjust it for the request's nonce.
+func signedValidateServer(t *testing.T, edit func(p *licenseValidatePayload, nonce string)) (*httptest.Server, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Nonce string `json:"nonce"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		now := time.Now().UTC()
+		p := licenseValidatePayload{
+			Status:     "active",
+			Valid:      true,
+			GraceDays:  7,
+			Nonce:      req.Nonce,
+			IssuedAt:   now.Format(time.RFC3339),
+			ValidUntil: now.Add(5 * time.Minute).Format(time.RFC3339),
+		}
+		edit(&p, req.Nonce)
+		raw, _ := json.Marshal(p)
+		json.NewEncoder(w).Encode(licenseValidateResponse{
+			Payload:   raw,
+			Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, raw)),
+			Algorithm: "ed25519",
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, hex.EncodeToString(pub)
+}
+
+func TestRefreshLicenseStatusUnfreshResponseKeepsGrace(t *testing.T) {
+	tests := []struct {
+		name       string
+		edit       func(p *licenseValidatePayload, nonce string)
+		graceTo    time.Duration // relative to now
+		wantStatus string
+		wantReason string
+	}{
+		{
+			name:       "nonce mismatch within grace",
+			edit:       func(p *licenseValidatePayload, _ string) { p.Nonce = "replayed" },
+			graceTo:    24 * time.Hour,
+			wantStatus: "grace",
+			wantReason: "license_response_nonce_mismatch",
+		},
+		{
+			name: "stale response within grace",
+			edit: func(p *licenseValidatePayload, _ string) {
+				p.ValidUntil = time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+			},
+			graceTo:    24 * time.Hour,
+			wantStatus: "grace",
+			wantReason: "stale_license_response",
+		},
+		{
+			name:       "nonce mismatch after grace",
+			edit:       func(p *licenseValidatePayload, _ string) { p.Nonce = "replayed" },
+			graceTo:    -time.Hour,
+			wantStatus: "invalid",
+			wantReason: "license_response_nonce_mismatch",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t)
+			srv, pubHex := signedValidateServer(t, tt.edit)
+			cfg, err := h.store.GetConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			graceTo := time.Now().UTC().Add(tt.graceTo).Format(time.RFC3339)
+			cfg.LicenseKey = "NDX-TEST"
+			cfg.LicenseServer = srv.URL
+			cfg.LicensePubKey = pubHex
+			cfg.LicenseStatus = "active"
+			cfg.LicenseGraceTo = graceTo
+			if err := h.store.SaveConfig(cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := h.refreshLicenseStatus(); err != nil {
+				t.Fatal(err)
+			}
+			cfg, _ = h.store.GetConfig()
+			if cfg.LicenseStatus != tt.wantStatus || cfg.LicenseReason != tt.wantReason {
+				t.Errorf("status/reason = %s/%s, want %s/%s", cfg.LicenseStatus, cfg.LicenseReason, tt.wantStatus, tt.wantReason)
+			}
+			if cfg.LicenseLastErr == "" {
+				t.Error("LicenseLastErr is empty")
+			}
+			if cfg.LicenseGraceTo != graceTo {
+				t.Errorf("LicenseGraceTo = %q, want unchanged %q", cfg.LicenseGraceTo, graceTo)
+			}
+		})
+	}
+}
+
+func TestRefreshLicenseStatusFreshResponseActivates(t *testing.T) {
+	h, _ := newTestHandler(t)
+	srv, pubHex := signedValidateServer(t, func(*licenseValidatePayload, string) {})
+	cfg, _ := h.store.GetConfig()
+	cfg.LicenseKey = "NDX-TEST"
+	cfg.LicenseServer = srv.URL
+	cfg.LicensePubKey = pubHex
+	if err := h.store.SaveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.refreshLicenseStatus(); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _ = h.store.GetConfig()
+	if cfg.LicenseStatus != "active" || cfg.LicenseLastErr != "" {
+		t.Errorf("status = %s, lastErr = %q; want active without error", cfg.LicenseStatus, cfg.LicenseLastErr)
+	}
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"nodax-central/internal/logx"
+	"nodax-central/internal/models"
+)
+
+// decodeOfflineLicenseToken verifies a token issued by the license server's
+// /api/v1/licenses/{id}/offline-token against the configured public key and
+// returns its payload. Whitespace from copy-pasting is ignored.
+func decodeOfflineLicenseToken(token, pubKeyRaw string) (*licenseValidatePayload, string, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(token), ""))
+	if err != nil {
+		return nil, "invalid_offline_token", fmt.Errorf("offline token is not base64: %w", err)
+	}
+	var envelope licenseValidateResponse
+	if err := json.Unmarshal(raw, &envelope); err != nil || len(envelope.Payload) == 0 {
+		return nil, "invalid_offline_token", fmt.Errorf("offline token has no signed payload")
+	}
+	if strings.TrimSpace(pubKeyRaw) == "" {
+		return nil, "missing_public_key", fmt.Errorf("license server public key not configured")
+	}
+	pubKey, err := decodeLicensePublicKey(pubKeyRaw)
+	if err != nil {
+		return nil, "invalid_public_key", fmt.Errorf("failed to decode public key: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(envelope.Signature)
+	if err != nil {
+		return nil, "invalid_signature_format", fmt.Errorf("failed to decode signature: %w", err)
+	}
+	if !ed25519.Verify(pubKey, envelope.Payload, sig) {
+		return nil, "signature_verification_failed", fmt.Errorf("offline token signature mismatch")
+	}
+	var payload licenseValidatePayload
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+		return nil, "invalid_offline_token", fmt.Errorf("invalid payload: %w", err)
+	}
+	if !payload.Offline {
+		return nil, "invalid_offline_token", fmt.Errorf("payload is a live validate response, not an offline token")
+	}
+	return &payload, "", nil
+}
+
+// checkOfflineLicense rejects a verified offline token issued for another
+// license key or central instance, or whose validity window is over.
+func checkOfflineLicense(p *licenseValidatePayload, licenseKey, instanceID string, now time.Time) (reason string, err error) {
+	if key := strings.TrimSpace(licenseKey); key != "" && key != strings.TrimSpace(p.LicenseKey) {
+		return "offline_token_key_mismatch", fmt.Errorf("offline token is for license %s, not the configured key", p.LicenseKey)
+	}
+	if p.InstanceID != "" && p.InstanceID != instanceID {
+		return "offline_token_instance_mismatch", fmt.Errorf("offline token is bound to instance %s", p.InstanceID)
+	}
+	validUntil, err := time.Parse(time.RFC3339, strings.TrimSpace(p.ValidUntil))
+	if err != nil {
+		return "invalid_offline_token", fmt.Errorf("offline token has no valid validUntil")
+	}
+	if !validUntil.After(now) {
+		return "offline_token_expired", fmt.Errorf("offline token expired at %s; issue a new one", validUntil.Format(time.RFC3339))
+	}
+	return "", nil
+}
+
+// applyOfflineLicense sets the license state from cfg.LicenseOffline instead
+// of asking the license server. The license is treated as expiring at the
+// earlier of its expiry and the token's validUntil, without grace. More
+// agents than the token's maxAgents give "over_limit", as online validation
+// does.
+func (h *Handler) applyOfflineLicense(cfg *models.CentralConfig, now time.Time) {
+	cfg.LicenseSkewSec = 0
+	cfg.LicenseGraceTo = ""
+	payload, reason, err := decodeOfflineLicenseToken(cfg.LicenseOffline, cfg.LicensePubKey)
+	if err == nil {
+		reason, err = checkOfflineLicense(payload, cfg.LicenseKey, h.instanceID, now)
+	}
+	if err != nil {
+		cfg.LicenseStatus = "invalid"
+		if reason == "offline_token_expired" {
+			cfg.LicenseStatus = "expired"
+		}
+		cfg.LicenseReason = reason
+		cfg.LicenseLastErr = err.Error()
+		return
+	}
+	if strings.TrimSpace(cfg.LicenseKey) == "" {
+		cfg.LicenseKey = payload.LicenseKey
+	}
+	cfg.LicenseExpires = strings.TrimSpace(payload.ValidUntil)
+	if exp, err := time.Parse(time.RFC3339, strings.TrimSpace(payload.ExpiresAt)); err == nil {
+		if until, _ := time.Parse(time.RFC3339, cfg.LicenseExpires); exp.Before(until) {
+			cfg.LicenseExpires = payload.ExpiresAt
+		}
+	}
+	cfg.LicenseLastErr = ""
+	if payload.MaxAgents > 0 {
+		if agents, err := h.store.GetAllAgents(); err == nil && len(agents) > payload.MaxAgents {
+			cfg.LicenseStatus = "over_limit"
+			cfg.LicenseReason = "agent_limit"
+			return
+		}
+	}
+	cfg.LicenseStatus = "active"
+	cfg.LicenseReason = "offline"
+}
+
+// handleLicenseOffline loads (POST {"token": ...}) or removes (DELETE) the
+// offline license token. A token is verified before it is stored, so a typo
+// never replaces a working license.
+func (h *Handler) handleLicenseOffline(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	user, err := h.currentUserFromRequest(r)
+	if err != nil {
+		httpErr(w, fmt.Errorf("unauthorized"), 401)
+		return
+	}
+	if normalizeRole(user.Role) != "admin" {
+		httpErr(w, fmt.Errorf("forbidden"), 403)
+		return
+	}
+
+	token := ""
+	if r.Method == http.MethodPost {
+		var req struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Token) == "" {
+			httpErr(w, fmt.Errorf("token is required"), 400)
+			return
+		}
+		token = strings.Join(strings.Fields(req.Token), "")
+	}
+
+	h.licenseMu.Lock()
+	cfg, err := h.store.GetConfig()
+	if err != nil {
+		h.licenseMu.Unlock()
+		httpErr(w, err, 500)
+		return
+	}
+	if token != "" {
+		payload, reason, err := decodeOfflineLicenseToken(token, cfg.LicensePubKey)
+		if err == nil {
+			reason, err = checkOfflineLicense(payload, cfg.LicenseKey, h.instanceID, time.Now().UTC())
+		}
+		if err != nil {
+			h.licenseMu.Unlock()
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error(), "reason": reason})
+			return
+		}
+	}
+	cfg.LicenseOffline = token
+	err = h.store.SaveConfig(cfg)
+	h.licenseMu.Unlock()
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	logx.Info("license offline token changed", "loaded", token != "", "user", user.Username)
+
+	if err := h.refreshLicenseStatus(); err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	if cfg, err = h.store.GetConfig(); err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{
+		"offline":    strings.TrimSpace(cfg.LicenseOffline) != "",
+		"status":     strings.TrimSpace(cfg.LicenseStatus),
+		"reason":     strings.TrimSpace(cfg.LicenseReason),
+		"expiresAt":  strings.TrimSpace(cfg.LicenseExpires),
+		"checkedAt":  strings.TrimSpace(cfg.LicenseChecked),
+		"graceUntil": strings.TrimSpace(cfg.LicenseGraceTo),
+		"lastError":  strings.TrimSpace(cfg.LicenseLastErr),
+	})
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"nodax-central/internal/models"
+)
+
+func TestApplyOfflineLicenseAgentLimit(t *testing.T) {
+	h, _ := newTestHandler(t)
+	for i := range 3 {
+		if err := h.store.SaveAgent(&models.Agent{ID: fmt.Sprintf("a%d", i), Name: "hv"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	token := func(maxAgents int) string {
+		raw, _ := json.Marshal(licenseValidatePayload{
+			Status:     "active",
+			Valid:      true,
+			ExpiresAt:  now.AddDate(1, 0, 0).Format(time.RFC3339),
+			ValidUntil: now.AddDate(0, 6, 0).Format(time.RFC3339),
+			LicenseKey: "NDX-OFF",
+			Offline:    true,
+			MaxAgents:  maxAgents,
+		})
+		env, _ := json.Marshal(licenseValidateResponse{
+			Payload:   raw,
+			Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, raw)),
+			Algorithm: "ed25519",
+		})
+		return base64.StdEncoding.EncodeToString(env)
+	}
+
+	for _, tc := range []struct {
+		maxAgents  int
+		wantStatus string
+		wantReason string
+	}{
+		{maxAgents: 2, wantStatus: "over_limit", wantReason: "agent_limit"},
+		{maxAgents: 3, wantStatus: "active", wantReason: "offline"},
+		{maxAgents: 0, wantStatus: "active", wantReason: "offline"},
+	} {
+		cfg := &models.CentralConfig{LicenseOffline: token(tc.maxAgents), LicensePubKey: hex.EncodeToString(pub)}
+		h.applyOfflineLicense(cfg, now)
+		if cfg.LicenseStatus != tc.wantStatus || cfg.LicenseReason != tc.wantReason {
+			t.Errorf("maxAgents %d: status %q reason %q, want %q %q", tc.maxAgents, cfg.LicenseStatus, cfg.LicenseReason, tc.wantStatus, tc.wantReason)
+		}
+	}
+}
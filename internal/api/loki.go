@@ -30,7 +30,7 @@ func (h *Handler) handleLokiLabels(w http.ResponseWriter, r *http.Request) {
 w.Header().Set("Content-Type", "application/json")
 json.NewEncoder(w).Encode(map[string]interface{}{
 "status": "success",
-"data":   []string{"agent", "agentId", "type", "status", "vm"},
+"data":   []string{"agent", "agentId", "type", "status", "vm", "group"},
 })
 }
 
@@ -83,9 +83,9 @@ to = time.Now()
 }
 
 // Parse LogQL-like selector: {agent="xxx", type="Backup"}
-agentFilter, typeFilter, statusFilter, vmFilter := parseLokiSelector(query)
+agentFilter, typeFilter, statusFilter, vmFilter, groupFilter := parseLokiSelector(query)
 
-logs, err := h.store.QueryLogs(agentFilter, typeFilter, statusFilter, from, to, limit)
+logs, err := h.store.QueryLogs(agentFilter, typeFilter, statusFilter, groupFilter, from, to, limit)
 if err != nil {
 json.NewEncoder(w).Encode(map[string]interface{}{
 "status": "error",
@@ -110,10 +110,11 @@ type streamKey struct {
 agentID   string
 agentName string
 logType   string
+group     string
 }
 streams := make(map[streamKey][][2]string)
 for _, log := range logs {
-sk := streamKey{agentID: log.AgentID, agentName: log.AgentName, logType: log.Type}
+sk := streamKey{agentID: log.AgentID, agentName: log.AgentName, logType: log.Type, group: log.Group}
 ts := fmt.Sprintf("%d", log.Timestamp.UnixNano())
 line := log.Message
 if log.TargetVM != "" {
@@ -127,12 +128,16 @@ streams[sk] = append(streams[sk], [2]string{ts, line})
 // Build Loki response
 var resultStreams []map[string]interface{}
 for sk, values := range streams {
-resultStreams = append(resultStreams, map[string]interface{}{
-"stream": map[string]string{
+labels := map[string]string{
 "agent":   sk.agentName,
 "agentId": sk.agentID,
 "type":    sk.logType,
-},
+}
+if sk.group != "" {
+labels["group"] = sk.group
+}
+resultStreams = append(resultStreams, map[string]interface{}{
+"stream": labels,
 "values": values,
 })
 }
@@ -150,7 +155,7 @@ json.NewEncoder(w).Encode(map[string]interface{}{
 }
 
 // parseLokiSelector parses a simple LogQL selector like {agent="name", type="Backup"}
-func parseLokiSelector(query string) (agentID, logType, status, vm string) {
+func parseLokiSelector(query string) (agentID, logType, status, vm, group string) {
 query = strings.TrimSpace(query)
 query = strings.Trim(query, "{}")
 if query == "" {
@@ -174,6 +179,8 @@ case "status":
 status = val
 case "vm":
 vm = val
+case "group":
+group = val
 }
 }
 return
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// proxyLatencyBuckets are the upper bounds (seconds) of the proxy latency
+// histogram.
+var proxyLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+type proxyAgentStats struct {
+	codes   map[int]uint64
+	buckets []uint64 // cumulative counts per proxyLatencyBuckets entry
+	sum     float64
+	count   uint64
+}
+
+// proxyMetrics counts agent proxy requests per agent and status code. Paths
+// are not recorded so label cardinality stays bounded by the agent count.
+type proxyMetrics struct {
+	mu     sync.Mutex
+	agents map[string]*proxyAgentStats
+}
+
+func newProxyMetrics() *proxyMetrics {
+	return &proxyMetrics{agents: map[string]*proxyAgentStats{}}
+}
+
+func (m *proxyMetrics) observe(agentID string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := m.agents[agentID]
+	if st == nil {
+		st = &proxyAgentStats{codes: map[int]uint64{}, buckets: make([]uint64, len(proxyLatencyBuckets))}
+		m.agents[agentID] = st
+	}
+	st.codes[code]++
+	sec := d.Seconds()
+	for i, le := range proxyLatencyBuckets {
+		if sec <= le {
+			st.buckets[i]++
+		}
+	}
+	st.sum += sec
+	st.count++
+}
+
+// forget drops the series of a deleted agent.
+func (m *proxyMetrics) forget(agentID string) {
+	m.mu.Lock()
+	delete(m.agents, agentID)
+	m.mu.Unlock()
+}
+
+// writeTo appends the proxy series in Prometheus text format.
+func (m *proxyMetrics) writeTo(b *strings.Builder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]string, 0, len(m.agents))
+	for id := range m.agents {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	b.WriteString("# HELP nodax_central_proxy_requests_total Requests proxied to agents by response code\n")
+	b.WriteString("# TYPE nodax_central_proxy_requests_total counter\n")
+	for _, id := range ids {
+		st := m.agents[id]
+		codes := make([]int, 0, len(st.codes))
+		for c := range st.codes {
+			codes = append(codes, c)
+		}
+		sort.Ints(codes)
+		for _, c := range codes {
+			b.WriteString(fmt.Sprintf("nodax_central_proxy_requests_total{agent_id=\"%s\",code=\"%d\"} %d\n", escapeLabel(id), c, st.codes[c]))
+		}
+	}
+
+	b.WriteString("# HELP nodax_central_proxy_request_duration_seconds Latency of requests proxied to agents\n")
+	b.WriteString("# TYPE nodax_central_proxy_request_duration_seconds histogram\n")
+	for _, id := range ids {
+		st := m.agents[id]
+		label := escapeLabel(id)
+		for i, le := range proxyLatencyBuckets {
+			b.WriteString(fmt.Sprintf("nodax_central_proxy_request_duration_seconds_bucket{agent_id=\"%s\",le=\"%g\"} %d\n", label, le, st.buckets[i]))
+		}
+		b.WriteString(fmt.Sprintf("nodax_central_proxy_request_duration_seconds_bucket{agent_id=\"%s\",le=\"+Inf\"} %d\n", label, st.count))
+		b.WriteString(fmt.Sprintf("nodax_central_proxy_request_duration_seconds_sum{agent_id=\"%s\"} %.6f\n", label, st.sum))
+		b.WriteString(fmt.Sprintf("nodax_central_proxy_request_duration_seconds_count{agent_id=\"%s\"} %d\n", label, st.count))
+	}
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"nodax-central/internal/logx"
+)
+
+// ipRateLimiter allows at most limit requests per client IP within window.
+type ipRateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string][]time.Time
+}
+
+func newIPRateLimiter(limit int, window time.Duration) *ipRateLimiter {
+	return &ipRateLimiter{limit: limit, window: window, hits: map[string][]time.Time{}}
+}
+
+// allow records a request from ip and reports whether it is within the limit.
+func (l *ipRateLimiter) allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	cutoff := now.Add(-l.window)
+	recent := l.hits[ip][:0]
+	for _, t := range l.hits[ip] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= l.limit {
+		l.hits[ip] = recent
+		return false
+	}
+	l.hits[ip] = append(recent, now)
+	// Drop idle entries so the map does not grow with every client ever seen.
+	for k, ts := range l.hits {
+		if len(ts) == 0 || !ts[len(ts)-1].After(cutoff) {
+			delete(l.hits, k)
+		}
+	}
+	return true
+}
+
+// defaultTrustedProxies matches a reverse proxy on the same machine.
+const defaultTrustedProxies = "127.0.0.0/8,::1/128"
+
+// parseTrustedProxies parses NODAX_TRUSTED_PROXIES: a comma-separated list of
+// IPs and CIDRs. "none" trusts no proxy.
+func parseTrustedProxies(spec string) ([]*net.IPNet, error) {
+	if strings.EqualFold(strings.TrimSpace(spec), "none") {
+		return nil, nil
+	}
+	var out []*net.IPNet
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", part)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", part)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// trustedProxiesFromEnv reads NODAX_TRUSTED_PROXIES, falling back to
+// defaultTrustedProxies when it is unset or invalid.
+func trustedProxiesFromEnv() []*net.IPNet {
+	spec := strings.TrimSpace(os.Getenv("NODAX_TRUSTED_PROXIES"))
+	if spec == "" {
+		spec = defaultTrustedProxies
+	}
+	nets, err := parseTrustedProxies(spec)
+	if err != nil {
+		logx.Warn("invalid NODAX_TRUSTED_PROXIES, using default", "err", err, "default", defaultTrustedProxies)
+		nets, _ = parseTrustedProxies(defaultTrustedProxies)
+	}
+	return nets
+}
+
+func (h *Handler) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return false
+	}
+	for _, n := range h.trustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestIP returns the client address. X-Forwarded-For is read right to
+// left and only through trusted proxies, so a client cannot pick its own
+// address to dodge per-IP limits.
+func (h *Handler) requestIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if !h.isTrustedProxy(ip) {
+		return ip
+	}
+	if xff := strings.TrimSpace(r.Header.Get("X-Forwarded-For")); xff != "" {
+		parts := strings.Split(xff, ",")
+		for i := len(parts) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(parts[i])
+			if hop == "" {
+				continue
+			}
+			ip = hop
+			if !h.isTrustedProxy(hop) {
+				break
+			}
+		}
+	}
+	return ip
+}
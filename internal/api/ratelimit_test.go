@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestIPTrustedProxies(t *testing.T) {
+	trusted, err := parseTrustedProxies(defaultTrustedProxies + ",10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{trustedProxies: trusted}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5000", "", "203.0.113.7"},
+		{"spoofed XFF from untrusted peer", "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"XFF from trusted proxy", "127.0.0.1:5000", "198.51.100.1", "198.51.100.1"},
+		{"client-supplied left entries are skipped", "127.0.0.1:5000", "1.1.1.1, 198.51.100.1", "198.51.100.1"},
+		{"chain of trusted proxies", "[::1]:5000", "198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"trusted proxy without XFF", "127.0.0.1:5000", "", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/config/restore", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := h.requestIP(r); got != tt.want {
+				t.Errorf("requestIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	none, err := parseTrustedProxies("none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h = &Handler{trustedProxies: none}
+	r := httptest.NewRequest("POST", "/api/config/restore", nil)
+	r.RemoteAddr = "127.0.0.1:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if got := h.requestIP(r); got != "127.0.0.1" {
+		t.Errorf("with none trusted: requestIP = %q, want 127.0.0.1", got)
+	}
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+	for _, spec := range []string{"not-an-ip", "10.0.0.0/33"} {
+		if _, err := parseTrustedProxies(spec); err == nil {
+			t.Errorf("parseTrustedProxies(%q) accepted invalid input", spec)
+		}
+	}
+}
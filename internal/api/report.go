@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"nodax-central/internal/logx"
+	"nodax-central/internal/mailer"
+	"nodax-central/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StartReportLoop periodically sends the fleet stats report when enabled in config
+func (h *Handler) StartReportLoop(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.maybeSendStatsReport(time.Now().UTC())
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func reportInterval(cfg *models.CentralConfig) time.Duration {
+	if cfg.ReportEveryH > 0 {
+		return time.Duration(cfg.ReportEveryH) * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+func (h *Handler) maybeSendStatsReport(now time.Time) {
+	cfg, err := h.store.GetConfig()
+	if err != nil || !cfg.ReportEnabled {
+		return
+	}
+	if last, err := time.Parse(time.RFC3339, cfg.ReportLastSent); err == nil && now.Sub(last) < reportInterval(cfg) {
+		return
+	}
+	sent, err := h.sendStatsReport(cfg)
+	if !sent {
+		logx.Error("stats report failed", "err", err)
+		return
+	}
+	// A channel that failed waits for the next interval: resending now would
+	// repeat the report on the channels that already got it.
+	if err != nil {
+		logx.Warn("stats report partly failed", "err", err)
+	}
+	// Re-read so concurrent config edits are not overwritten.
+	if fresh, err := h.store.GetConfig(); err == nil {
+		fresh.ReportLastSent = now.Format(time.RFC3339)
+		_ = h.store.SaveConfig(fresh)
+	}
+	logx.Info("stats report sent", "recipients", len(cfg.ReportTo), "webhook", cfg.ReportWebhook != "")
+}
+
+// sendStatsReport renders the current fleet stats and delivers them by email
+// and/or webhook, depending on what is configured. sent reports whether at
+// least one channel delivered; err joins the failures of the others.
+func (h *Handler) sendStatsReport(cfg *models.CentralConfig) (sent bool, err error) {
+	agents, err := h.store.GetAllAgents()
+	if err != nil {
+		return false, err
+	}
+	stats := h.buildStats(agents)
+	name := h.instanceName(cfg)
+	subject := fmt.Sprintf("NODAX Central — отчёт %s (%s)", name, time.Now().Format("02.01.2006"))
+	body := renderStatsReportHTML(name, stats)
+
+	var errs []string
+	if len(cfg.ReportTo) > 0 {
+		if err := mailer.Send(mailer.FromCentral(cfg), cfg.ReportTo, subject, body); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			sent = true
+		}
+	}
+	if url := strings.TrimSpace(cfg.ReportWebhook); url != "" {
+		payload, _ := json.Marshal(map[string]any{
+			"event":    "stats_report",
+			"instance": name,
+			"stats":    stats,
+			"html":     body,
+		})
+		resp, err := h.proxy.Post(url, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode >= 400 {
+				errs = append(errs, fmt.Sprintf("report webhook returned HTTP %d", resp.StatusCode))
+			} else {
+				sent = true
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return sent, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	if !sent {
+		return false, fmt.Errorf("no report recipients or webhook configured")
+	}
+	return true, nil
+}
+
+func renderStatsReportHTML(instance string, stats models.AggregatedStats) string {
+	headers, rows := statsTable(stats)
+	var b strings.Builder
+	b.WriteString(`<!doctype html><html lang="ru"><head><meta charset="UTF-8"/><title>NODAX Central</title>
+<style>
+body{margin:0;padding:24px;font-family:'Segoe UI',Arial,sans-serif;background:#f1f5f9;color:#0f172a}
+h1{font-size:20px;margin:0 0 8px;color:#0f766e}
+.info{font-size:12px;color:#64748b;margin-bottom:16px}
+.cards{margin-bottom:16px}
+.card{display:inline-block;background:#fff;border-radius:10px;padding:10px 16px;margin:0 8px 8px 0;box-shadow:0 2px 8px rgba(15,23,42,.08)}
+.card b{display:block;font-size:18px;color:#0f766e}
+table{width:100%;border-collapse:collapse;background:#fff}
+th{background:#0f766e;color:#fff;font-size:11px;padding:8px;text-align:left}
+td{padding:8px;font-size:12px;border-bottom:1px solid #f1f5f9}
+</style></head><body>
+`)
+	b.WriteString(`<h1>NODAX Central — ` + html.EscapeString(instance) + `</h1>`)
+	b.WriteString(`<div class="info">Отчёт: ` + time.Now().Format("02.01.2006 15:04") + `</div><div class="cards">`)
+	card := func(label, value string) {
+		b.WriteString(`<div class="card"><b>` + html.EscapeString(value) + `</b>` + html.EscapeString(label) + `</div>`)
+	}
+	card("Хосты онлайн", fmt.Sprintf("%d / %d", stats.OnlineHosts, stats.TotalHosts))
+	card("VM запущено", fmt.Sprintf("%d / %d", stats.RunningVMs, stats.TotalVMs))
+	card("CPU средн.", strconv.FormatFloat(stats.AvgCPU, 'f', 1, 64)+"%")
+	card("RAM", fmt.Sprintf("%.0f / %.0f ГБ", stats.UsedRAMGB, stats.TotalRAMGB))
+	card("Диски", fmt.Sprintf("%.0f / %.0f ГБ", stats.UsedDiskGB, stats.TotalDiskGB))
+	b.WriteString(`</div><table><thead><tr>`)
+	for _, h := range headers {
+		b.WriteString(`<th>` + html.EscapeString(h) + `</th>`)
+	}
+	b.WriteString(`</tr></thead><tbody>`)
+	for _, row := range rows {
+		b.WriteString(`<tr>`)
+		for _, cell := range row {
+			b.WriteString(`<td>` + html.EscapeString(cell) + `</td>`)
+		}
+		b.WriteString(`</tr>`)
+	}
+	b.WriteString(`</tbody></table></body></html>`)
+	return b.String()
+}
+
+// handleReportSend sends the stats report immediately (admin)
+func (h *Handler) handleReportSend(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	user, err := h.currentUserFromRequest(r)
+	if err != nil {
+		httpErr(w, fmt.Errorf("unauthorized"), 401)
+		return
+	}
+	if normalizeRole(user.Role) != "admin" {
+		httpErr(w, fmt.Errorf("forbidden"), 403)
+		return
+	}
+	cfg, err := h.store.GetConfig()
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	if _, err := h.sendStatsReport(cfg); err != nil {
+		httpErr(w, err, 502)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "sent"})
+}
+
+// handleTestEmail sends a test message to the given recipient using the
+// saved SMTP settings and reports the delivery error, if any (admin)
+func (h *Handler) handleTestEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	user, err := h.currentUserFromRequest(r)
+	if err != nil {
+		httpErr(w, fmt.Errorf("unauthorized"), 401)
+		return
+	}
+	if normalizeRole(user.Role) != "admin" {
+		httpErr(w, fmt.Errorf("forbidden"), 403)
+		return
+	}
+	var req struct {
+		To string `json:"to"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpErr(w, fmt.Errorf("invalid body"), 400)
+		return
+	}
+	to := strings.TrimSpace(req.To)
+	if err := mailer.ValidateAddress(to); err != nil {
+		httpErr(w, err, 400)
+		return
+	}
+	cfg, err := h.store.GetConfig()
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	mc := mailer.FromCentral(cfg)
+	if !mc.Configured() {
+		httpErr(w, fmt.Errorf("smtp is not configured: smtpHost and smtpFrom (or smtpUser) are required"), 400)
+		return
+	}
+	subject := fmt.Sprintf("NODAX Central: test message (%s)", h.instanceName(cfg))
+	body := fmt.Sprintf("<p>Test message from NODAX Central <b>%s</b>.</p><p>SMTP settings are working.</p><p style=\"color:#888\">%s</p>",
+		html.EscapeString(h.instanceName(cfg)), time.Now().Format("2006-01-02 15:04:05"))
+	if err := mailer.Send(mc, []string{to}, subject, body); err != nil {
+		logx.Warn("test email failed", "to", to, "err", err)
+		httpErr(w, err, 502)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "sent", "to": to})
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nodax-central/internal/poller"
+)
+
+func TestMaybeSendStatsReportPartialDelivery(t *testing.T) {
+	tests := []struct {
+		name        string
+		webhookCode int
+		wantMarked  bool
+	}{
+		{"webhook delivered, email failed", http.StatusOK, true},
+		{"every channel failed", http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newTestHandler(t)
+			h.poller = poller.New(h.store, time.Minute)
+			h.proxy = &http.Client{Timeout: 5 * time.Second}
+			hits := 0
+			hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits++
+				w.WriteHeader(tt.webhookCode)
+			}))
+			defer hook.Close()
+
+			cfg, err := h.store.GetConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.ReportEnabled = true
+			cfg.ReportTo = []string{"ops@example.com"} // SMTP is not configured, so email fails
+			cfg.ReportWebhook = hook.URL
+			if err := h.store.SaveConfig(cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			now := time.Now().UTC().Truncate(time.Second)
+			h.maybeSendStatsReport(now)
+			cfg, _ = h.store.GetConfig()
+			marked := cfg.ReportLastSent == now.Format(time.RFC3339)
+			if marked != tt.wantMarked {
+				t.Errorf("ReportLastSent = %q, want marked %v", cfg.ReportLastSent, tt.wantMarked)
+			}
+
+			// A marked report is not resent within the interval; an unmarked one is retried.
+			h.maybeSendStatsReport(now.Add(time.Minute))
+			wantHits := 2
+			if tt.wantMarked {
+				wantHits = 1
+			}
+			if hits != wantHits {
+				t.Errorf("webhook hit %d times, want %d", hits, wantHits)
+			}
+		})
+	}
+}
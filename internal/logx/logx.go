@@ -0,0 +1,41 @@
+// Package logx is a thin logging layer for the central server. By default it
+// writes human-readable lines through the standard log package; setting
+// NODAX_LOG_FORMAT=json switches all output, including plain log.Printf
+// calls, to JSON lines suitable for log aggregators.
+package logx
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+var jsonMode bool
+
+// Init configures the process-wide logger from NODAX_LOG_FORMAT.
+func Init() {
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("NODAX_LOG_FORMAT")), "json") {
+		jsonMode = true
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	}
+}
+
+// JSON reports whether structured JSON output is enabled.
+func JSON() bool {
+	return jsonMode
+}
+
+// Info logs an event with key/value attributes.
+func Info(msg string, args ...any) {
+	slog.Info(msg, args...)
+}
+
+// Warn logs a warning event with key/value attributes.
+func Warn(msg string, args ...any) {
+	slog.Warn(msg, args...)
+}
+
+// Error logs an error event with key/value attributes.
+func Error(msg string, args ...any) {
+	slog.Error(msg, args...)
+}
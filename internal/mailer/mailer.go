@@ -0,0 +1,135 @@
+// Package mailer sends HTML email through the SMTP server configured in
+// CentralConfig.
+package mailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"nodax-central/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds SMTP connection settings
+type Config struct {
+	Host string
+	Port int
+	User string
+	Pass string
+	From string
+}
+
+// FromCentral extracts SMTP settings from the central config
+func FromCentral(cfg *models.CentralConfig) Config {
+	c := Config{
+		Host: strings.TrimSpace(cfg.SMTPHost),
+		Port: cfg.SMTPPort,
+		User: strings.TrimSpace(cfg.SMTPUser),
+		Pass: cfg.SMTPPass,
+		From: strings.TrimSpace(cfg.SMTPFrom),
+	}
+	if c.Port == 0 {
+		c.Port = 587
+	}
+	if c.From == "" {
+		c.From = c.User
+	}
+	return c
+}
+
+// Configured reports whether enough settings are present to send mail
+func (c Config) Configured() bool {
+	return c.Host != "" && c.From != ""
+}
+
+// ValidateAddress checks that addr is a single plain email address
+func ValidateAddress(addr string) error {
+	a, err := mail.ParseAddress(addr)
+	if err != nil || a.Address != strings.TrimSpace(addr) {
+		return fmt.Errorf("invalid email address: %q", addr)
+	}
+	return nil
+}
+
+// dialTimeout bounds the TCP/TLS connect so a wrong host fails fast
+const dialTimeout = 15 * time.Second
+
+// Send delivers an HTML message to the recipients. Port 465 uses implicit
+// TLS; other ports use STARTTLS when the server offers it.
+func Send(c Config, to []string, subject, htmlBody string) error {
+	if !c.Configured() {
+		return fmt.Errorf("smtp is not configured")
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+	for _, addr := range to {
+		if err := ValidateAddress(addr); err != nil {
+			return err
+		}
+	}
+
+	var msg strings.Builder
+	msg.WriteString("From: " + c.From + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	msg.WriteString(htmlBody)
+
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	var err error
+	if c.Port == 465 {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: c.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp connect %s: %w", addr, err)
+	}
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer client.Close()
+	if c.Port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: c.Host}); err != nil {
+				return fmt.Errorf("smtp starttls: %w", err)
+			}
+		}
+	}
+	if c.User != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.User, c.Pass, c.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := client.Mail(c.From); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s: %w", rcpt, err)
+		}
+	}
+	wc, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err := wc.Write([]byte(msg.String())); err != nil {
+		return fmt.Errorf("smtp write: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("smtp send: %w", err)
+	}
+	return client.Quit()
+}
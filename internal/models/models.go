@@ -1,19 +1,30 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // Agent represents a registered Hyper-V host running nodax-server
 type Agent struct {
 	ID        string    `json:"id"`
-	Name      string    `json:"name"`     // Display name (e.g. "HV-SERVER-01")
-	URL       string    `json:"url"`      // Base URL (e.g. "http://192.168.1.10:9000")
-	APIKey    string    `json:"apiKey"`   // X-API-Key for authentication
-	Status    string    `json:"status"`   // online / offline / error
-	LastSeen  time.Time `json:"lastSeen"` // Last successful poll
+	Name      string    `json:"name"`              // Display name (e.g. "HV-SERVER-01")
+	URL       string    `json:"url"`               // Base URL (e.g. "http://192.168.1.10:9000")
+	APIKey    string    `json:"apiKey"`            // X-API-Key for authentication
+	Status    string    `json:"status"`            // online / degraded / offline / auth_error / disabled
+	Enabled   *bool     `json:"enabled,omitempty"` // nil means enabled (agents saved before the flag existed)
+	Group     string    `json:"group,omitempty"`   // Optional grouping label (e.g. "prod", "branch-1")
+	Notes     string    `json:"notes,omitempty"`   // Free-text operator notes
+	LastSeen  time.Time `json:"lastSeen"`          // Last successful poll
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+// IsEnabled reports whether the agent should be polled
+func (a Agent) IsEnabled() bool {
+	return a.Enabled == nil || *a.Enabled
+}
+
 // AgentData holds cached data from an agent
 type AgentData struct {
 	AgentID   string        `json:"agentId"`
@@ -83,6 +94,10 @@ type HealthStatus struct {
 type CentralConfig struct {
 	PollIntervalSec int                             `json:"pollIntervalSec"`
 	Port            string                          `json:"port"`
+	InstanceName    string                          `json:"instanceName,omitempty"`       // friendly name shown in the UI and sent to the license server
+	Maintenance     bool                            `json:"maintenance,omitempty"`        // freezes mutating API calls (503) while reads stay available
+	AgentPort       int                             `json:"defaultAgentPort,omitempty"`   // added to agent URLs without a port, default 9000
+	DenyLoopback    bool                            `json:"denyLoopbackAgents,omitempty"` // rejects localhost / 127.0.0.1 agent URLs
 	CaddyDomain     string                          `json:"caddyDomain"`
 	LicenseKey      string                          `json:"licenseKey,omitempty"`
 	LicenseServer   string                          `json:"licenseServer,omitempty"`
@@ -93,16 +108,122 @@ type CentralConfig struct {
 	LicenseChecked  string                          `json:"licenseChecked,omitempty"`
 	LicenseGraceTo  string                          `json:"licenseGraceTo,omitempty"`
 	LicenseLastErr  string                          `json:"licenseLastErr,omitempty"`
+	LicenseSkewSec  int64                           `json:"licenseSkewSec,omitempty"`      // license server clock minus local clock at last check
+	LicenseOffline  string                          `json:"licenseOfflineToken,omitempty"` // signed offline token; when set the license server is not contacted
 	Theme           string                          `json:"theme"`
 	Language        string                          `json:"language"`
 	RetentionDays   int                             `json:"retentionDays"`
+	DiskWarnPct     float64                         `json:"diskWarnPct,omitempty"`     // default 85
+	DiskCritPct     float64                         `json:"diskCritPct,omitempty"`     // default 95
+	DiskLimits      map[string]DiskThreshold        `json:"diskThresholds,omitempty"`  // per drive or mount ("C:", "/var") overrides of diskWarnPct/diskCritPct
+	AlertWebhookURL string                          `json:"alertWebhookUrl,omitempty"` // receives alert events as JSON POSTs
+	AlertFormat     string                          `json:"alertFormat,omitempty"`     // plain (default) / alertmanager
+	SMTPHost        string                          `json:"smtpHost,omitempty"`
+	SMTPPort        int                             `json:"smtpPort,omitempty"` // default 587; 465 uses implicit TLS
+	SMTPUser        string                          `json:"smtpUser,omitempty"`
+	SMTPPass        string                          `json:"smtpPass,omitempty"`
+	SMTPFrom        string                          `json:"smtpFrom,omitempty"`
+	ReportEnabled   bool                            `json:"reportEnabled,omitempty"`    // scheduled fleet report, off by default
+	ReportEveryH    int                             `json:"reportEveryHours,omitempty"` // default 168 (weekly)
+	ReportTo        []string                        `json:"reportRecipients,omitempty"`
+	ReportWebhook   string                          `json:"reportWebhookUrl,omitempty"`
+	ReportLastSent  string                          `json:"reportLastSent,omitempty"`
+	CPUAlertPct     float64                         `json:"cpuAlertPct,omitempty"`        // 0 disables sustained CPU alerts
+	RAMAlertPct     float64                         `json:"ramAlertPct,omitempty"`        // 0 disables sustained RAM alerts
+	AlertSustainMin int                             `json:"alertSustainMin,omitempty"`    // minutes above threshold before firing, default 5
+	AlertRepeatMin  int                             `json:"alertRepeatMin,omitempty"`     // minimum minutes between repeats, default 30
+	DegradedAfter   int                             `json:"degradedAfterPolls,omitempty"` // consecutive polls with failing sub-requests before "degraded", default 1
+	OfflineAfter    int                             `json:"offlineAfterPolls,omitempty"`  // consecutive failed status polls before "offline", default 1
 	BgColor         string                          `json:"bgColor"`
 	BgImage         string                          `json:"bgImage"`
 	RolePolicies    map[string][]UserHostPermission `json:"rolePolicies,omitempty"`
 	RoleSections    map[string]RoleSectionPolicy    `json:"roleSections,omitempty"`
+	ProxyPaths      []string                        `json:"proxyAllowedPaths,omitempty"` // path prefixes allowed through the agent proxy; empty allows all
 	JWTSecret       string                          `json:"jwtSecret,omitempty"`
 }
 
+// DiskThresholds returns the disk usage warning/critical percentages with defaults applied
+func (c *CentralConfig) DiskThresholds() (warn, crit float64) {
+	warn, crit = 85, 95
+	if c == nil {
+		return
+	}
+	if c.DiskWarnPct > 0 {
+		warn = c.DiskWarnPct
+	}
+	if c.DiskCritPct > 0 {
+		crit = c.DiskCritPct
+	}
+	return
+}
+
+// DiskThresholdsFor returns the warning/critical percentages for one drive or
+// mount: its own override where set, the global thresholds otherwise
+func (c *CentralConfig) DiskThresholdsFor(drive string) (warn, crit float64) {
+	warn, crit = c.DiskThresholds()
+	if c == nil {
+		return
+	}
+	t, ok := c.DiskLimits[drive]
+	if !ok {
+		for k, v := range c.DiskLimits {
+			if strings.EqualFold(k, drive) {
+				t, ok = v, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return
+	}
+	if t.WarnPct > 0 {
+		warn = t.WarnPct
+	}
+	if t.CritPct > 0 {
+		crit = t.CritPct
+	}
+	return
+}
+
+// DiskThreshold overrides the disk usage thresholds for a single drive or mount
+type DiskThreshold struct {
+	WarnPct float64 `json:"warnPct,omitempty"`
+	CritPct float64 `json:"critPct,omitempty"`
+}
+
+// SustainedAlertWindow returns how long CPU/RAM must stay above the threshold
+// and the minimum interval between repeated alerts, with defaults applied
+func (c *CentralConfig) SustainedAlertWindow() (sustain, cooldown time.Duration) {
+	sustain, cooldown = 5*time.Minute, 30*time.Minute
+	if c == nil {
+		return
+	}
+	if c.AlertSustainMin > 0 {
+		sustain = time.Duration(c.AlertSustainMin) * time.Minute
+	}
+	if c.AlertRepeatMin > 0 {
+		cooldown = time.Duration(c.AlertRepeatMin) * time.Minute
+	}
+	return
+}
+
+// StatusThresholds returns how many consecutive polls with failing
+// sub-requests mark an agent degraded and how many failed status polls mark
+// it offline, with defaults applied
+func (c *CentralConfig) StatusThresholds() (degraded, offline int) {
+	degraded, offline = 1, 1
+	if c == nil {
+		return
+	}
+	if c.DegradedAfter > 0 {
+		degraded = c.DegradedAfter
+	}
+	if c.OfflineAfter > 0 {
+		offline = c.OfflineAfter
+	}
+	return
+}
+
 type RoleSectionPolicy struct {
 	Overview   bool `json:"overview"`
 	Statistics bool `json:"statistics"`
@@ -113,33 +234,38 @@ type RoleSectionPolicy struct {
 
 // HostStats per-host statistics for the stats page
 type HostStats struct {
-	AgentID    string     `json:"agentId"`
-	Name       string     `json:"name"`
-	Status     string     `json:"status"`
-	CPU        float64    `json:"cpu"`
-	RAMPct     float64    `json:"ramPct"`
-	RAMUsedGB  float64    `json:"ramUsedGB"`
-	RAMTotalGB float64    `json:"ramTotalGB"`
-	VMTotal    int        `json:"vmTotal"`
-	VMRunning  int        `json:"vmRunning"`
-	Disks      []DiskInfo `json:"disks"`
-	Uptime     string     `json:"uptime"`
-	OS         string     `json:"os"`
+	AgentID      string     `json:"agentId"`
+	Name         string     `json:"name"`
+	Status       string     `json:"status"`
+	CPU          float64    `json:"cpu"`
+	RAMPct       float64    `json:"ramPct"`
+	RAMUsedGB    float64    `json:"ramUsedGB"`
+	RAMTotalGB   float64    `json:"ramTotalGB"`
+	VMTotal      int        `json:"vmTotal"`
+	VMRunning    int        `json:"vmRunning"`
+	Disks        []DiskInfo `json:"disks"`
+	Uptime       string     `json:"uptime"`
+	OS           string     `json:"os"`
+	DiskSeverity string     `json:"diskSeverity,omitempty"` // worst disk: ok / warning / critical
+	DiskWorst    string     `json:"diskWorst,omitempty"`
+	DiskWorstPct float64    `json:"diskWorstPct,omitempty"`
 }
 
 // AggregatedStats for the statistics page
 type AggregatedStats struct {
-	Hosts       []HostStats `json:"hosts"`
-	TotalHosts  int         `json:"totalHosts"`
-	OnlineHosts int         `json:"onlineHosts"`
-	TotalVMs    int         `json:"totalVMs"`
-	RunningVMs  int         `json:"runningVMs"`
-	AvgCPU      float64     `json:"avgCpu"`
-	AvgRAM      float64     `json:"avgRam"`
-	TotalRAMGB  float64     `json:"totalRamGB"`
-	UsedRAMGB   float64     `json:"usedRamGB"`
-	TotalDiskGB float64     `json:"totalDiskGB"`
-	UsedDiskGB  float64     `json:"usedDiskGB"`
+	Hosts          []HostStats `json:"hosts"`
+	TotalHosts     int         `json:"totalHosts"`
+	OnlineHosts    int         `json:"onlineHosts"`
+	AuthErrorHosts int         `json:"authErrorHosts"`
+	DegradedHosts  int         `json:"degradedHosts"`
+	TotalVMs       int         `json:"totalVMs"`
+	RunningVMs     int         `json:"runningVMs"`
+	AvgCPU         float64     `json:"avgCpu"`
+	AvgRAM         float64     `json:"avgRam"`
+	TotalRAMGB     float64     `json:"totalRamGB"`
+	UsedRAMGB      float64     `json:"usedRamGB"`
+	TotalDiskGB    float64     `json:"totalDiskGB"`
+	UsedDiskGB     float64     `json:"usedDiskGB"`
 }
 
 // MetricPoint is a single data point in the host metrics history
@@ -167,24 +293,52 @@ type User struct {
 	Password        string               `json:"password,omitempty"` // bcrypt hash, stripped in API responses
 	Role            string               `json:"role"`               // admin / engineer / user
 	HostPermissions []UserHostPermission `json:"hostPermissions,omitempty"`
+	Preferences     *UserPreferences     `json:"preferences,omitempty"`
+	TokenVersion    int                  `json:"tokenVersion,omitempty"` // bumped on password change; older JWTs are rejected
 	CreatedAt       time.Time            `json:"createdAt"`
 }
 
+// UserPreferences holds per-user presentation settings. Empty fields fall back
+// to the global defaults in CentralConfig.
+type UserPreferences struct {
+	Theme   string `json:"theme,omitempty"`
+	BgColor string `json:"bgColor,omitempty"`
+	BgImage string `json:"bgImage,omitempty"`
+}
+
 type UserHostPermission struct {
 	AgentID string `json:"agentId"`
 	View    bool   `json:"view"`
 	Control bool   `json:"control"`
 }
 
+// AlertState is an active alert tracked by the alert manager
+type AlertState struct {
+	Type       string            `json:"type"`
+	Severity   string            `json:"severity"`
+	AgentID    string            `json:"agentId,omitempty"`
+	AgentName  string            `json:"agentName,omitempty"`
+	Message    string            `json:"message"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	FiredAt    time.Time         `json:"firedAt"`
+	LastSent   time.Time         `json:"lastSent"`
+	ClearSince time.Time         `json:"clearSince,omitempty"` // condition cleared, waiting for the hold period
+}
+
 // DashboardOverview aggregated data for the overview page
 type DashboardOverview struct {
-	TotalAgents   int     `json:"totalAgents"`
-	OnlineAgents  int     `json:"onlineAgents"`
-	TotalVMs      int     `json:"totalVMs"`
-	RunningVMs    int     `json:"runningVMs"`
-	TotalCPU      float64 `json:"totalCpuAvg"`
-	TotalRAMBytes int64   `json:"totalRamBytes"`
-	UsedRAMBytes  int64   `json:"usedRamBytes"`
+	TotalAgents     int     `json:"totalAgents"`
+	OnlineAgents    int     `json:"onlineAgents"`
+	AuthErrorAgents int     `json:"authErrorAgents"`
+	DiskWarnAgents  int     `json:"diskWarnAgents"`
+	DiskCritAgents  int     `json:"diskCritAgents"`
+	DegradedAgents  int     `json:"degradedAgents"`
+	Maintenance     bool    `json:"maintenance"`
+	TotalVMs        int     `json:"totalVMs"`
+	RunningVMs      int     `json:"runningVMs"`
+	TotalCPU        float64 `json:"totalCpuAvg"`
+	TotalRAMBytes   int64   `json:"totalRamBytes"`
+	UsedRAMBytes    int64   `json:"usedRamBytes"`
 }
 
 // CentralLog represents a log entry collected from an agent and stored centrally
@@ -192,6 +346,7 @@ type CentralLog struct {
 	ID        string    `json:"id"`
 	AgentID   string    `json:"agentId"`
 	AgentName string    `json:"agentName"`
+	Group     string    `json:"group,omitempty"` // Agent group at ingestion time
 	Timestamp time.Time `json:"timestamp"`
 	Type      string    `json:"type"` // Backup, System, etc.
 	TargetVM  string    `json:"targetVm"`
@@ -1,13 +1,40 @@
 package netutil
 
 import (
+	"fmt"
 	"net"
 	neturl "net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
+// FallbackAgentPort is the nodax-server default port.
+const FallbackAgentPort = 9000
+
+var defaultAgentPort atomic.Int32
+
+func init() {
+	defaultAgentPort.Store(FallbackAgentPort)
+}
+
+// SetDefaultAgentPort sets the port added to agent URLs that have none.
+// Values outside 1-65535 (including 0) restore FallbackAgentPort.
+func SetDefaultAgentPort(port int) {
+	if port < 1 || port > 65535 {
+		port = FallbackAgentPort
+	}
+	defaultAgentPort.Store(int32(port))
+}
+
+// DefaultAgentPort returns the port used for agent URLs without one.
+func DefaultAgentPort() int {
+	return int(defaultAgentPort.Load())
+}
+
 // NormalizeAgentBaseURL ensures agent URL has scheme and port.
-// If port is missing, defaults to 9000 (nodax-server default).
+// If port is missing, defaults to DefaultAgentPort (9000 unless configured).
+// IPv6 literals may be given bracketed ("[::1]:9000") or bare ("::1").
 func NormalizeAgentBaseURL(raw string) string {
 	s := strings.TrimSpace(raw)
 	if s == "" {
@@ -16,6 +43,7 @@ func NormalizeAgentBaseURL(raw string) string {
 	if !strings.Contains(s, "://") {
 		s = "http://" + s
 	}
+	s = bracketBareIPv6(s)
 
 	u, err := neturl.Parse(s)
 	if err != nil || u.Host == "" {
@@ -25,7 +53,7 @@ func NormalizeAgentBaseURL(raw string) string {
 	host := u.Hostname()
 	port := u.Port()
 	if port == "" {
-		port = "9000"
+		port = strconv.Itoa(DefaultAgentPort())
 	}
 	u.Host = net.JoinHostPort(host, port)
 	u.Path = strings.TrimRight(u.Path, "/")
@@ -34,3 +62,89 @@ func NormalizeAgentBaseURL(raw string) string {
 	}
 	return u.String()
 }
+
+// bracketBareIPv6 wraps an unbracketed IPv6 literal host ("http://::1/x") in
+// brackets so url.Parse does not read its last group as a port. A bare IPv6
+// address is ambiguous with host:port, so it never carries a port here.
+func bracketBareIPv6(s string) string {
+	i := strings.Index(s, "://")
+	scheme, rest := s[:i+3], s[i+3:]
+	host, path := rest, ""
+	if j := strings.IndexAny(rest, "/?#"); j >= 0 {
+		host, path = rest[:j], rest[j:]
+	}
+	if strings.HasPrefix(host, "[") || strings.Count(host, ":") < 2 {
+		return s
+	}
+	// IPv4-mapped addresses (::ffff:a.b.c.d) are IPv6 literals here too:
+	// plain IPv4 never gets past the colon count above.
+	addr, zone, _ := strings.Cut(host, "%")
+	if net.ParseIP(addr) == nil {
+		return s
+	}
+	if zone != "" {
+		// Zones must be percent-encoded inside a URL host.
+		host = addr + "%25" + zone
+	}
+	return scheme + "[" + host + "]" + path
+}
+
+// ValidateAgentURL normalizes raw like NormalizeAgentBaseURL and rejects
+// URLs that cannot be polled: unsupported schemes, a missing or malformed
+// host, an invalid port, and loopback hosts unless allowLoopback is set.
+func ValidateAgentURL(raw string, allowLoopback bool) (string, error) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return "", fmt.Errorf("url is required")
+	}
+	normalized := NormalizeAgentBaseURL(s)
+	u, err := neturl.Parse(normalized)
+	if err != nil {
+		return "", fmt.Errorf("invalid url %q: %v", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q: use http or https", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return "", fmt.Errorf("url %q has no host", raw)
+	}
+	if addr, _, _ := strings.Cut(host, "%"); net.ParseIP(addr) == nil && !validHostname(host) {
+		return "", fmt.Errorf("invalid host %q", host)
+	}
+	if p, err := strconv.Atoi(u.Port()); err != nil || p < 1 || p > 65535 {
+		return "", fmt.Errorf("invalid port %q", u.Port())
+	}
+	if !allowLoopback && isLoopbackHost(host) {
+		return "", fmt.Errorf("loopback host %q points at the central server itself", host)
+	}
+	return normalized, nil
+}
+
+// validHostname checks RFC 1123 labels (letters, digits, hyphens), also
+// allowing underscores, which show up in internal DNS names.
+func validHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if len(host) == 0 || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,98 @@
+package netutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAgentURL(t *testing.T) {
+	tests := []struct {
+		raw           string
+		allowLoopback bool
+		want          string // normalized URL, "" when an error is expected
+		wantErr       string
+	}{
+		{raw: "hv-01.example.com", want: "http://hv-01.example.com:9000"},
+		{raw: "https://10.0.0.5:8443/", want: "https://10.0.0.5:8443"},
+		{raw: "", wantErr: "url is required"},
+		{raw: "ftp://hv-01.example.com", wantErr: "unsupported scheme"},
+		{raw: "http://:9000", wantErr: "no host"},
+		{raw: "http://hv-01:0", wantErr: "invalid port"},
+		{raw: "http://hv-01:70000", wantErr: "invalid port"},
+		{raw: "http://-hv-01.example.com", wantErr: "invalid host"},
+		{raw: "http://hv..example.com", wantErr: "invalid host"},
+		{raw: "http://hv!01", wantErr: "invalid"},
+		{raw: "localhost", wantErr: "loopback"},
+		{raw: "http://127.0.0.1:9000", wantErr: "loopback"},
+		{raw: "[::1]:9000", wantErr: "loopback"},
+		{raw: "localhost", allowLoopback: true, want: "http://localhost:9000"},
+		{raw: "http://127.0.0.1:9000", allowLoopback: true, want: "http://127.0.0.1:9000"},
+	}
+	for _, tt := range tests {
+		got, err := ValidateAgentURL(tt.raw, tt.allowLoopback)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateAgentURL(%q, %v) = %q, %v; want error containing %q", tt.raw, tt.allowLoopback, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ValidateAgentURL(%q, %v) = %q, %v; want %q", tt.raw, tt.allowLoopback, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeAgentBaseURLIPv6(t *testing.T) {
+	tests := []struct{ raw, want string }{
+		{"::1", "http://[::1]:9000"},
+		{"[::1]:9000", "http://[::1]:9000"},
+		{"[::1]", "http://[::1]:9000"},
+		{"fe80::1%eth0", "http://[fe80::1%25eth0]:9000"},
+		{"http://[fe80::1%25eth0]:9001", "http://[fe80::1%25eth0]:9001"},
+		{"http://2001:db8::1/path", "http://[2001:db8::1]:9000/path"},
+		{"https://[2001:db8::1]:8443/api/", "https://[2001:db8::1]:8443/api"},
+		{"::ffff:192.0.2.1", "http://[::ffff:192.0.2.1]:9000"},
+		{"[::ffff:192.0.2.1]:9000", "http://[::ffff:192.0.2.1]:9000"},
+		{"192.0.2.1", "http://192.0.2.1:9000"},
+		{"192.0.2.1:9100", "http://192.0.2.1:9100"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeAgentBaseURL(tt.raw); got != tt.want {
+			t.Errorf("NormalizeAgentBaseURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestValidateAgentURLIPv6(t *testing.T) {
+	if got, err := ValidateAgentURL("fe80::1%eth0", false); err != nil || got != "http://[fe80::1%25eth0]:9000" {
+		t.Errorf("zoned link-local: %q, %v", got, err)
+	}
+	if got, err := ValidateAgentURL("::ffff:192.0.2.1", false); err != nil || got != "http://[::ffff:192.0.2.1]:9000" {
+		t.Errorf("IPv4-mapped: %q, %v", got, err)
+	}
+	if _, err := ValidateAgentURL("::ffff:127.0.0.1", false); err == nil || !strings.Contains(err.Error(), "loopback") {
+		t.Errorf("IPv4-mapped loopback: err = %v, want loopback error", err)
+	}
+}
+
+func TestSetDefaultAgentPort(t *testing.T) {
+	t.Cleanup(func() { SetDefaultAgentPort(FallbackAgentPort) })
+	tests := []struct {
+		port int
+		raw  string
+		want string
+	}{
+		{9100, "hv-01", "http://hv-01:9100"},
+		{9100, "https://[2001:db8::1]/", "https://[2001:db8::1]:9100"},
+		{9100, "hv-01:9200", "http://hv-01:9200"},
+		{0, "hv-01", "http://hv-01:9000"},
+		{-1, "hv-01", "http://hv-01:9000"},
+		{70000, "hv-01", "http://hv-01:9000"},
+	}
+	for _, tt := range tests {
+		SetDefaultAgentPort(tt.port)
+		if got := NormalizeAgentBaseURL(tt.raw); got != tt.want {
+			t.Errorf("port %d: NormalizeAgentBaseURL(%q) = %q, want %q", tt.port, tt.raw, got, tt.want)
+		}
+	}
+}
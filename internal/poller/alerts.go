@@ -0,0 +1,123 @@
+package poller
+
+import (
+	"fmt"
+	"nodax-central/internal/alerts"
+	"nodax-central/internal/models"
+	"strings"
+	"time"
+)
+
+// Alerts returns the alert manager shared by all poller evaluations
+func (p *Poller) Alerts() *alerts.Manager {
+	return p.alerts
+}
+
+// evaluateDiskAlerts fires disk_critical while a drive is at or above the
+// critical threshold and resolves it once the drive drops back below.
+func (p *Poller) evaluateDiskAlerts(agent models.Agent, hi *models.HostInfo) {
+	if hi == nil {
+		return
+	}
+	cfg, err := p.store.GetConfig()
+	if err != nil {
+		return
+	}
+	for _, d := range hi.Disks {
+		key := "disk_critical|" + agent.ID + "|" + d.Drive
+		if _, crit := cfg.DiskThresholdsFor(d.Drive); d.UsePct < crit {
+			p.alerts.Resolve(key)
+			continue
+		}
+		p.alerts.Fire(key, alerts.Event{
+			Type:      "disk_critical",
+			Severity:  alerts.SeverityCritical,
+			AgentID:   agent.ID,
+			AgentName: agent.Name,
+			Message:   fmt.Sprintf("%s: disk %s is %.1f%% full (%.1f GB free)", agent.Name, d.Drive, d.UsePct, d.FreeGB),
+			Labels:    map[string]string{"drive": d.Drive},
+		}, 0)
+	}
+}
+
+// evaluateSustainedAlerts fires cpu_sustained/ram_sustained alerts when every
+// history point within the sustain window is above the configured level. The
+// alert repeats at most once per repeat interval while the breach lasts.
+func (p *Poller) evaluateSustainedAlerts(agent models.Agent) {
+	cfg, err := p.store.GetConfig()
+	if err != nil {
+		return
+	}
+	sustain, repeat := cfg.SustainedAlertWindow()
+	pts := p.GetHistory(agent.ID)
+	now := time.Now()
+
+	checks := []struct {
+		metric string
+		level  float64
+		value  func(models.MetricPoint) float64
+	}{
+		{"cpu", cfg.CPUAlertPct, func(pt models.MetricPoint) float64 { return pt.CPU }},
+		{"ram", cfg.RAMAlertPct, func(pt models.MetricPoint) float64 { return pt.RAMPct }},
+	}
+	for _, c := range checks {
+		key := c.metric + "_sustained|" + agent.ID
+		breached, avg := false, 0.0
+		if c.level > 0 && len(pts) > 0 {
+			breached, avg = sustainedAbove(pts, now.Add(-sustain), c.level, c.value)
+		}
+		if !breached {
+			p.alerts.Resolve(key)
+			continue
+		}
+		p.alerts.Fire(key, alerts.Event{
+			Type:      c.metric + "_sustained",
+			Severity:  alerts.SeverityWarning,
+			AgentID:   agent.ID,
+			AgentName: agent.Name,
+			Message:   fmt.Sprintf("%s: %s above %.0f%% for %s (avg %.1f%%)", agent.Name, strings.ToUpper(c.metric), c.level, sustain, avg),
+			Labels:    map[string]string{"metric": c.metric},
+		}, repeat)
+	}
+}
+
+// evaluateStatusAlert fires agent_down while an agent is unreachable or
+// rejecting its API key, and resolves it once the agent answers again.
+func (p *Poller) evaluateStatusAlert(agent models.Agent, status, errMsg string) {
+	key := "agent_down|" + agent.ID
+	switch status {
+	case "offline", "auth_error":
+		p.alerts.Fire(key, alerts.Event{
+			Type:      "agent_down",
+			Severity:  alerts.SeverityCritical,
+			AgentID:   agent.ID,
+			AgentName: agent.Name,
+			Message:   fmt.Sprintf("%s is %s: %s", agent.Name, status, errMsg),
+			Labels:    map[string]string{"status": status},
+		}, 0)
+	default:
+		p.alerts.Resolve(key)
+	}
+}
+
+// sustainedAbove reports whether all points since `since` exceed level and
+// the history actually covers the whole window. It also returns their average.
+func sustainedAbove(pts []models.MetricPoint, since time.Time, level float64, value func(models.MetricPoint) float64) (bool, float64) {
+	if pts[0].Timestamp.After(since) {
+		return false, 0 // not enough history yet
+	}
+	var sum float64
+	n := 0
+	for i := len(pts) - 1; i >= 0 && !pts[i].Timestamp.Before(since); i-- {
+		v := value(pts[i])
+		if v <= level {
+			return false, 0
+		}
+		sum += v
+		n++
+	}
+	if n == 0 {
+		return false, 0
+	}
+	return true, sum / float64(n)
+}
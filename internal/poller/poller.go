@@ -3,13 +3,21 @@ package poller
 import (
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
+	"nodax-central/internal/alerts"
+	"nodax-central/internal/logx"
 	"nodax-central/internal/netutil"
 	"nodax-central/internal/models"
 	"nodax-central/internal/store"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,11 +32,16 @@ type Poller struct {
 	history  map[string][]models.MetricPoint // agentID -> metric history
 	interval time.Duration
 	stopCh   chan struct{}
+	runMu    sync.RWMutex // held for a full poll cycle; jittered polls hold it shared, one agent at a time
+	jitter   atomic.Bool  // spread scheduled polls across the interval window
+	alerts   *alerts.Manager
+	fails    map[string]int // agentID -> consecutive failed status polls
+	subFails map[string]int // agentID -> consecutive polls with failing sub-requests
 }
 
 // New creates a new Poller
 func New(s *store.Store, interval time.Duration) *Poller {
-	return &Poller{
+	p := &Poller{
 		store: s,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
@@ -40,7 +53,25 @@ func New(s *store.Store, interval time.Duration) *Poller {
 		history:  make(map[string][]models.MetricPoint),
 		interval: interval,
 		stopCh:   make(chan struct{}),
+		alerts:   alerts.NewManager(s),
+		fails:    make(map[string]int),
+		subFails: make(map[string]int),
 	}
+	p.jitter.Store(jitterFromEnv())
+	return p
+}
+
+// jitterFromEnv reads NODAX_POLL_JITTER; jitter is off unless it is set to
+// a true value.
+func jitterFromEnv() bool {
+	b, _ := strconv.ParseBool(os.Getenv("NODAX_POLL_JITTER"))
+	return b
+}
+
+// SetJitter enables or disables staggering of scheduled polls. It is safe to
+// call while the poller runs.
+func (p *Poller) SetJitter(enabled bool) {
+	p.jitter.Store(enabled)
 }
 
 func (p *Poller) loadHistoryFromStore() {
@@ -134,8 +165,19 @@ func (p *Poller) PollAgent(agent models.Agent) *models.AgentData {
 	// Poll status
 	var status models.StatusInfo
 	if err := p.fetchJSON(agent, "/api/v1/status", &status); err != nil {
+		agentStatus := "offline"
 		data.Error = fmt.Sprintf("status: %v", err)
-		_ = p.store.UpdateAgentStatus(agent.ID, "offline")
+		var se *statusError
+		if errors.As(err, &se) && (se.Code == http.StatusUnauthorized || se.Code == http.StatusForbidden) {
+			// The agent is reachable but rejects our key.
+			agentStatus = "auth_error"
+			data.Error = fmt.Sprintf("status: authentication failed (HTTP %d), check the agent API key", se.Code)
+		}
+		if agentStatus == "offline" && p.countFailure(p.fails, agent.ID) < p.offlineAfter() && (agent.Status == "online" || agent.Status == "degraded") {
+			// Below the offline threshold a reachable agent keeps its status.
+			agentStatus = agent.Status
+		}
+		p.setAgentStatus(agent, agentStatus, data.Error)
 		p.mu.Lock()
 		p.cache[agent.ID] = data
 		p.mu.Unlock()
@@ -143,26 +185,50 @@ func (p *Poller) PollAgent(agent models.Agent) *models.AgentData {
 		return data
 	}
 	data.Status = &status
-	_ = p.store.UpdateAgentStatus(agent.ID, "online")
+	p.resetFailures(p.fails, agent.ID)
+
+	// Any failed sub-fetch after a successful status marks the agent degraded.
+	var subErrs []string
 
 	// Poll host info
 	var hostInfo models.HostInfo
 	if err := p.fetchJSON(agent, "/api/v1/host/info", &hostInfo); err == nil {
 		data.HostInfo = &hostInfo
 	} else {
-		data.Error = fmt.Sprintf("host/info: %v", err)
+		subErrs = append(subErrs, fmt.Sprintf("host/info: %v", err))
 	}
 
 	// Poll VMs
 	var vms []models.VM
 	if err := p.fetchJSON(agent, "/api/v1/vms", &vms); err == nil {
 		data.VMs = vms
+	} else {
+		subErrs = append(subErrs, fmt.Sprintf("vms: %v", err))
 	}
 
 	// Poll health
 	var health models.HealthReport
+	var healthErr *statusError
 	if err := p.fetchJSON(agent, "/api/v1/health", &health); err == nil {
 		data.Health = &health
+	} else if errors.As(err, &healthErr) && healthErr.Code == http.StatusNotFound {
+		// Older agents have no health endpoint; their health is unknown,
+		// which is not a failure.
+		data.Health = &models.HealthReport{Overall: "unknown"}
+	} else {
+		subErrs = append(subErrs, fmt.Sprintf("health: %v", err))
+	}
+
+	if len(subErrs) > 0 {
+		data.Error = strings.Join(subErrs, "; ")
+		if p.countFailure(p.subFails, agent.ID) >= p.degradedAfter() {
+			p.setAgentStatus(agent, "degraded", data.Error)
+		} else {
+			p.setAgentStatus(agent, "online", "")
+		}
+	} else {
+		p.resetFailures(p.subFails, agent.ID)
+		p.setAgentStatus(agent, "online", "")
 	}
 
 	p.mu.Lock()
@@ -216,6 +282,7 @@ func (p *Poller) PollAgent(agent models.Agent) *models.AgentData {
 			centralLogs = append(centralLogs, models.CentralLog{
 				AgentID:   agent.ID,
 				AgentName: agent.Name,
+				Group:     agent.Group,
 				Timestamp: ts,
 				Type:      e.Type,
 				TargetVM:  e.TargetVM,
@@ -232,10 +299,53 @@ func (p *Poller) PollAgent(agent models.Agent) *models.AgentData {
 	if pointToPersist != nil {
 		_ = p.store.AppendMetricPoint(agent.ID, *pointToPersist, maxHistoryPoints)
 	}
+	p.evaluateDiskAlerts(agent, data.HostInfo)
+	p.evaluateSustainedAlerts(agent)
 
 	return data
 }
 
+// countFailure increments and returns the consecutive failure count of an agent
+func (p *Poller) countFailure(counts map[string]int, agentID string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	counts[agentID]++
+	return counts[agentID]
+}
+
+func (p *Poller) resetFailures(counts map[string]int, agentID string) {
+	p.mu.Lock()
+	delete(counts, agentID)
+	p.mu.Unlock()
+}
+
+// degradedAfter and offlineAfter read the status thresholds from settings
+func (p *Poller) degradedAfter() int {
+	cfg, _ := p.store.GetConfig()
+	n, _ := cfg.StatusThresholds()
+	return n
+}
+
+func (p *Poller) offlineAfter() int {
+	cfg, _ := p.store.GetConfig()
+	_, n := cfg.StatusThresholds()
+	return n
+}
+
+// setAgentStatus persists the agent status and logs transitions
+func (p *Poller) setAgentStatus(agent models.Agent, status, errMsg string) {
+	_ = p.store.UpdateAgentStatus(agent.ID, status)
+	p.evaluateStatusAlert(agent, status, errMsg)
+	if agent.Status == status {
+		return
+	}
+	if status == "online" {
+		logx.Info("agent status changed", "agent_id", agent.ID, "agent", agent.Name, "from", agent.Status, "to", status)
+	} else {
+		logx.Warn("agent status changed", "agent_id", agent.ID, "agent", agent.Name, "from", agent.Status, "to", status, "err", errMsg)
+	}
+}
+
 // GetHistory returns the metrics history for an agent
 func (p *Poller) GetHistory(agentID string) []models.MetricPoint {
 	p.mu.RLock()
@@ -249,12 +359,51 @@ func (p *Poller) GetHistory(agentID string) []models.MetricPoint {
 	return result
 }
 
-// pollAll polls all registered agents
+// PollAll runs a full poll cycle out of band and waits for it to finish.
+// It returns false without polling if another cycle is already running.
+func (p *Poller) PollAll() (int, bool) {
+	if !p.runMu.TryLock() {
+		return 0, false
+	}
+	defer p.runMu.Unlock()
+	return p.pollAgents(), true
+}
+
+// pollAll polls all registered agents, skipping the tick if a manual
+// cycle is still in progress
 func (p *Poller) pollAll() {
-	agents, err := p.store.GetAllAgents()
-	if err != nil || len(agents) == 0 {
+	if p.jitter.Load() {
+		p.pollAgentsJittered()
 		return
 	}
+	if !p.runMu.TryLock() {
+		return
+	}
+	defer p.runMu.Unlock()
+	p.pollAgents()
+}
+
+// enabledAgents returns the agents that should be polled.
+func (p *Poller) enabledAgents() []models.Agent {
+	all, err := p.store.GetAllAgents()
+	if err != nil {
+		return nil
+	}
+	agents := make([]models.Agent, 0, len(all))
+	for _, a := range all {
+		if a.IsEnabled() {
+			agents = append(agents, a)
+		}
+	}
+	return agents
+}
+
+// pollAgents polls every agent concurrently.
+func (p *Poller) pollAgents() int {
+	agents := p.enabledAgents()
+	if len(agents) == 0 {
+		return 0
+	}
 
 	var wg sync.WaitGroup
 	for _, agent := range agents {
@@ -266,6 +415,44 @@ func (p *Poller) pollAll() {
 	}
 	wg.Wait()
 
+	// Purge logs older than retention period (default 30 days)
+	p.store.PurgeLogs(30 * 24 * time.Hour)
+	return len(agents)
+}
+
+// pollAgentsJittered waits a random offset within most of the interval
+// before each agent's poll, so requests are staggered instead of hitting
+// the network at the same instant. The waits happen outside runMu; each
+// poll then holds it shared and is skipped while a manual cycle, which
+// polls that agent anyway, holds it.
+func (p *Poller) pollAgentsJittered() {
+	agents := p.enabledAgents()
+	if len(agents) == 0 {
+		return
+	}
+	window := p.interval * 8 / 10
+
+	var wg sync.WaitGroup
+	for _, agent := range agents {
+		wg.Add(1)
+		go func(a models.Agent) {
+			defer wg.Done()
+			if len(agents) > 1 && window > 0 {
+				select {
+				case <-time.After(rand.N(window)):
+				case <-p.stopCh:
+					return
+				}
+			}
+			if !p.runMu.TryRLock() {
+				return
+			}
+			defer p.runMu.RUnlock()
+			p.PollAgent(a)
+		}(agent)
+	}
+	wg.Wait()
+
 	// Purge logs older than retention period (default 30 days)
 	p.store.PurgeLogs(30 * 24 * time.Hour)
 }
@@ -291,12 +478,22 @@ func (p *Poller) fetchJSON(agent models.Agent, path string, result interface{})
 
 	if resp.StatusCode >= 400 {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(body))
+		return &statusError{Code: resp.StatusCode, Body: string(body)}
 	}
 
 	return json.NewDecoder(resp.Body).Decode(result)
 }
 
+// statusError is returned by fetchJSON when the agent answers with an HTTP error
+type statusError struct {
+	Code int
+	Body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.Code, e.Body)
+}
+
 func parseFlexTime(v string) (time.Time, bool) {
 	layouts := []string{
 		time.RFC3339Nano,
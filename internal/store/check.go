@@ -0,0 +1,113 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"nodax-central/internal/models"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// Check runs read-only integrity checks over bbolt and the SQLite mirror and
+// returns the problems found. An empty result means the store looks healthy.
+func (s *Store) Check() []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	boltAgents := map[string]bool{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		for err := range tx.Check() {
+			add("bbolt: %v", err)
+		}
+		for _, name := range []string{BucketAgents, BucketAgentData, BucketUsers, BucketLogs, BucketMetrics, BucketConfig} {
+			if tx.Bucket([]byte(name)) == nil {
+				add("bbolt: bucket %s missing", name)
+			}
+		}
+		if b := tx.Bucket([]byte(BucketConfig)); b != nil {
+			if raw := b.Get([]byte(KeyCentral)); raw != nil {
+				var cfg models.CentralConfig
+				if err := json.Unmarshal(raw, &cfg); err != nil {
+					add("config: cannot decode: %v", err)
+				}
+			}
+		}
+		if b := tx.Bucket([]byte(BucketAgents)); b != nil {
+			_ = b.ForEach(func(k, v []byte) error {
+				var a models.Agent
+				if err := json.Unmarshal(v, &a); err != nil {
+					add("agent %s: cannot decode: %v", k, err)
+					return nil
+				}
+				if a.ID != string(k) {
+					add("agent %s: stored under key with id %q", k, a.ID)
+				}
+				boltAgents[string(k)] = true
+				return nil
+			})
+		}
+		if b := tx.Bucket([]byte(BucketUsers)); b != nil {
+			names := map[string]string{}
+			_ = b.ForEach(func(k, v []byte) error {
+				var u models.User
+				if err := json.Unmarshal(v, &u); err != nil {
+					add("user %s: cannot decode: %v", k, err)
+					return nil
+				}
+				name := strings.ToLower(u.Username)
+				if other, ok := names[name]; ok {
+					add("user %s: username %q duplicates user %s", k, u.Username, other)
+				}
+				names[name] = string(k)
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		add("bbolt: %v", err)
+	}
+
+	if s.sqlDB == nil {
+		return problems
+	}
+	var result string
+	if err := s.sqlDB.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		add("sqlite: integrity_check: %v", err)
+	} else if result != "ok" {
+		add("sqlite: integrity_check: %s", result)
+	}
+	for _, table := range []string{"agents", "config", "users", "logs", "agent_data", "metrics"} {
+		var name string
+		if err := s.sqlDB.QueryRow(`SELECT name FROM sqlite_master WHERE type='table' AND name=?`, table).Scan(&name); err != nil {
+			add("sqlite: table %s missing", table)
+		}
+	}
+	rows, err := s.sqlDB.Query(`SELECT id FROM agents`)
+	if err != nil {
+		add("sqlite: agents: %v", err)
+		return problems
+	}
+	defer rows.Close()
+	sqlAgents := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if rows.Scan(&id) == nil {
+			sqlAgents[id] = true
+		}
+	}
+	for id := range boltAgents {
+		if !sqlAgents[id] {
+			add("sqlite: agent %s missing from mirror", id)
+		}
+	}
+	for id := range sqlAgents {
+		if !boltAgents[id] {
+			add("sqlite: agent %s not in bbolt", id)
+		}
+	}
+	return problems
+}
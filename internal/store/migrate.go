@@ -0,0 +1,105 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"nodax-central/internal/logx"
+	"nodax-central/internal/models"
+	"strconv"
+
+	"go.etcd.io/bbolt"
+)
+
+// KeySchemaVersion stores the last applied migration in the Config bucket
+const KeySchemaVersion = "schema_version"
+
+// migration is one ordered change to the stored data. apply must be
+// idempotent: a crash between apply and the version bump re-runs it.
+type migration struct {
+	version int
+	name    string
+	apply   func(s *Store) error
+}
+
+var migrations = []migration{
+	{1, "create buckets", func(s *Store) error {
+		return s.db.Update(func(tx *bbolt.Tx) error {
+			for _, name := range []string{BucketAgents, BucketAgentData, BucketUsers, BucketLogs, BucketMetrics, BucketConfig} {
+				if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}},
+	{2, "mark disabled agents", func(s *Store) error {
+		// Read bbolt directly and write through SaveAgent so the SQLite mirror follows.
+		var stale []models.Agent
+		err := s.db.View(func(tx *bbolt.Tx) error {
+			return tx.Bucket([]byte(BucketAgents)).ForEach(func(k, v []byte) error {
+				var a models.Agent
+				if json.Unmarshal(v, &a) == nil && !a.IsEnabled() && a.Status != "disabled" {
+					stale = append(stale, a)
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			return err
+		}
+		for i := range stale {
+			stale[i].Status = "disabled"
+			if err := s.SaveAgent(&stale[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+}
+
+// SchemaVersion returns the last applied migration version (0 for a fresh or
+// pre-migration database).
+func (s *Store) SchemaVersion() int {
+	v := 0
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		v = schemaVersion(tx)
+		return nil
+	})
+	return v
+}
+
+func schemaVersion(tx *bbolt.Tx) int {
+	b := tx.Bucket([]byte(BucketConfig))
+	if b == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(string(b.Get([]byte(KeySchemaVersion))))
+	return n
+}
+
+// LatestSchemaVersion is the version this binary migrates to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// Migrate applies pending migrations in order. It is called from New.
+func (s *Store) Migrate() error {
+	current := s.SchemaVersion()
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := m.apply(s); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		err := s.db.Update(func(tx *bbolt.Tx) error {
+			return tx.Bucket([]byte(BucketConfig)).Put([]byte(KeySchemaVersion), []byte(strconv.Itoa(m.version)))
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		current = m.version
+		logx.Info("store migration applied", "version", m.version, "name", m.name)
+	}
+	return nil
+}
@@ -32,7 +32,7 @@ type Store struct {
 	readFromSQLite bool
 }
 
-// New creates a new store instance
+// New creates a new store instance and applies pending migrations
 func New() (*Store, error) {
 	baseDir, err := resolveDataDir()
 	if err != nil {
@@ -89,14 +89,64 @@ func New() (*Store, error) {
 		}
 	}
 
-	return &Store{db: db, sqlDB: sqlDB, readFromSQLite: readFromSQLite}, nil
+	s := &Store{db: db, sqlDB: sqlDB, readFromSQLite: readFromSQLite}
+	if err := s.Migrate(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenReadOnly opens an existing store for inspection (used by --check). It
+// creates nothing: both database files must exist, bbolt is opened read-only
+// and neither buckets, SQLite tables nor migrations are touched.
+func OpenReadOnly() (*Store, error) {
+	baseDir, err := dataDir()
+	if err != nil {
+		return nil, err
+	}
+	dbPath := filepath.Join(baseDir, "nodax-central.db")
+	sqlitePath := filepath.Join(baseDir, "nodax-central.sqlite")
+	for _, p := range []string{dbPath, sqlitePath} {
+		if _, err := os.Stat(p); err != nil {
+			return nil, fmt.Errorf("store file: %w", err)
+		}
+	}
+
+	db, err := bbolt.Open(dbPath, 0600, &bbolt.Options{Timeout: 2 * time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open db: %w", err)
+	}
+	sqlDB, err := sql.Open("sqlite", "file:"+filepath.ToSlash(sqlitePath)+"?mode=ro")
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open sqlite: %w", err)
+	}
+	if _, err := sqlDB.Exec(`PRAGMA busy_timeout=5000;`); err != nil {
+		sqlDB.Close()
+		db.Close()
+		return nil, fmt.Errorf("failed to open sqlite: %w", err)
+	}
+	return &Store{db: db, sqlDB: sqlDB}, nil
 }
 
+// resolveDataDir returns the data directory, creating NODAX_DATA_DIR when it
+// is set and missing.
 func resolveDataDir() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create data dir %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// dataDir picks the data directory without creating it: NODAX_DATA_DIR,
+// else the working directory, else the executable's directory.
+func dataDir() (string, error) {
 	if v := strings.TrimSpace(os.Getenv("NODAX_DATA_DIR")); v != "" {
-		if err := os.MkdirAll(v, 0o755); err != nil {
-			return "", fmt.Errorf("failed to create data dir %s: %w", v, err)
-		}
 		return v, nil
 	}
 
@@ -223,6 +273,43 @@ func (s *Store) GetAllAgents() ([]models.Agent, error) {
 	return agents, err
 }
 
+// CountAgentsByStatus returns the number of agents per status. With SQLite
+// reads enabled the counting is done by the database; otherwise agents are
+// decoded from bbolt and counted in memory.
+func (s *Store) CountAgentsByStatus() (map[string]int, error) {
+	if s.readFromSQLite && s.sqlDB != nil {
+		rows, err := s.sqlDB.Query(`SELECT COALESCE(json_extract(data, '$.status'), ''), COUNT(*) FROM agents GROUP BY 1`)
+		if err == nil {
+			defer rows.Close()
+			counts := map[string]int{}
+			for rows.Next() {
+				var status string
+				var n int
+				if rows.Scan(&status, &n) != nil {
+					continue
+				}
+				counts[status] += n
+			}
+			if rows.Err() == nil {
+				return counts, nil
+			}
+		}
+	}
+	counts := map[string]int{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(BucketAgents)).ForEach(func(k, v []byte) error {
+			var agent struct {
+				Status string `json:"status"`
+			}
+			if json.Unmarshal(v, &agent) == nil {
+				counts[agent.Status]++
+			}
+			return nil
+		})
+	})
+	return counts, err
+}
+
 // DeleteAgent removes an agent by ID
 func (s *Store) DeleteAgent(id string) error {
 	err := s.db.Update(func(tx *bbolt.Tx) error {
@@ -397,6 +484,48 @@ func (s *Store) AppendMetricPoint(agentID string, pt models.MetricPoint, maxPoin
 	return nil
 }
 
+// ReplaceMetricHistory replaces the whole metric series of agent with pts.
+func (s *Store) ReplaceMetricHistory(agentID string, pts []models.MetricPoint) error {
+	if agentID == "" {
+		return nil
+	}
+	if pts == nil {
+		pts = []models.MetricPoint{}
+	}
+	data, err := json.Marshal(pts)
+	if err != nil {
+		return err
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(BucketMetrics))
+		if b == nil {
+			return nil
+		}
+		return b.Put([]byte(agentID), data)
+	})
+	if err != nil {
+		return err
+	}
+	if s.sqlDB != nil {
+		tx, err := s.sqlDB.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec(`DELETE FROM metrics WHERE agent_id = ?`, agentID); err != nil {
+			return err
+		}
+		for _, pt := range pts {
+			raw, _ := json.Marshal(pt)
+			if _, err := tx.Exec(`INSERT INTO metrics(agent_id, ts, data) VALUES(?, ?, ?) ON CONFLICT(agent_id, ts) DO UPDATE SET data=excluded.data`, agentID, pt.Timestamp.UTC().Format(time.RFC3339Nano), string(raw)); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}
+	return nil
+}
+
 // GetMetricHistory returns persisted metric history for agent.
 func (s *Store) GetMetricHistory(agentID string) ([]models.MetricPoint, error) {
 	if agentID == "" {
@@ -486,8 +615,12 @@ func (s *Store) UpdateAgentStatus(id, status string) error {
 	if err != nil {
 		return err
 	}
+	// A poll that was in flight when the agent got disabled must not revive it.
+	if !agent.IsEnabled() && status != "disabled" {
+		return nil
+	}
 	agent.Status = status
-	if status == "online" {
+	if status == "online" || status == "degraded" {
 		agent.LastSeen = time.Now()
 	}
 	return s.SaveAgent(agent)
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"encoding/json"
+	"nodax-central/internal/models"
+
+	"go.etcd.io/bbolt"
+)
+
+const KeyAlerts = "alerts"
+
+// GetAlertStates returns persisted active alerts keyed by alert key
+func (s *Store) GetAlertStates() (map[string]models.AlertState, error) {
+	states := map[string]models.AlertState{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket([]byte(BucketConfig)).Get([]byte(KeyAlerts))
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &states)
+	})
+	return states, err
+}
+
+// SaveAlertStates replaces the persisted active alerts
+func (s *Store) SaveAlertStates(states map[string]models.AlertState) error {
+	raw, err := json.Marshal(states)
+	if err != nil {
+		return err
+	}
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(BucketConfig)).Put([]byte(KeyAlerts), raw)
+	})
+	if err != nil {
+		return err
+	}
+	if s.sqlDB != nil {
+		_, _ = s.sqlDB.Exec(`INSERT INTO config(k, data) VALUES(?, ?) ON CONFLICT(k) DO UPDATE SET data=excluded.data`, KeyAlerts, string(raw))
+	}
+	return nil
+}
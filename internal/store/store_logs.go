@@ -73,8 +73,9 @@ func (s *Store) SaveLogs(logs []models.CentralLog) (int, error) {
 	return saved, nil
 }
 
-// QueryLogs returns logs matching filters, ordered by timestamp desc
-func (s *Store) QueryLogs(agentID, logType, status string, from, to time.Time, limit int) ([]models.CentralLog, error) {
+// QueryLogs returns logs matching filters, ordered by timestamp desc.
+// group matches the agent group recorded when the log was ingested.
+func (s *Store) QueryLogs(agentID, logType, status, group string, from, to time.Time, limit int) ([]models.CentralLog, error) {
 	var results []models.CentralLog
 	if limit <= 0 {
 		limit = 200
@@ -95,6 +96,10 @@ func (s *Store) QueryLogs(agentID, logType, status string, from, to time.Time, l
 			q += ` AND status = ?`
 			args = append(args, status)
 		}
+		if group != "" {
+			q += ` AND json_extract(data, '$.group') = ?`
+			args = append(args, group)
+		}
 		if !from.IsZero() {
 			q += ` AND ts >= ?`
 			args = append(args, from.UTC().Format(time.RFC3339Nano))
@@ -165,6 +170,9 @@ func (s *Store) QueryLogs(agentID, logType, status string, from, to time.Time, l
 			if status != "" && log.Status != status {
 				continue
 			}
+			if group != "" && log.Group != group {
+				continue
+			}
 			results = append(results, log)
 		}
 		return nil
@@ -238,6 +246,8 @@ func (s *Store) GetLogLabels(label string) ([]string, error) {
 			col = "status"
 		case "vm":
 			col = "target_vm"
+		case "group":
+			col = "json_extract(data, '$.group')"
 		}
 		if col != "" {
 			rows, err := s.sqlDB.Query(`SELECT DISTINCT ` + col + ` FROM logs WHERE ` + col + ` IS NOT NULL AND ` + col + ` != ''`)
@@ -283,6 +293,10 @@ func (s *Store) GetLogLabels(label string) ([]string, error) {
 				if log.TargetVM != "" {
 					seen[log.TargetVM] = true
 				}
+			case "group":
+				if log.Group != "" {
+					seen[log.Group] = true
+				}
 			}
 			return nil
 		})
@@ -28,6 +28,19 @@ func (s *Store) SaveUser(user *models.User) error {
 	return nil
 }
 
+// SaveUserPreferences replaces the presentation preferences of a single user.
+func (s *Store) SaveUserPreferences(id string, prefs *models.UserPreferences) (*models.User, error) {
+	u, err := s.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	u.Preferences = prefs
+	if err := s.SaveUser(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
 func (s *Store) GetUserByID(id string) (*models.User, error) {
 	if s.readFromSQLite && s.sqlDB != nil {
 		var raw string
@@ -159,6 +172,25 @@ func (s *Store) CreateUser(username, password, role string, hostPermissions []mo
 	return u, s.SaveUser(u)
 }
 
+// SetUserPassword replaces a user's password and bumps its token version,
+// so every JWT issued before the change stops working.
+func (s *Store) SetUserPassword(id, password string) (*models.User, error) {
+	u, err := s.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	u.Password = string(hash)
+	u.TokenVersion++
+	if err := s.SaveUser(u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
 func (s *Store) CheckPassword(user *models.User, password string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) == nil
 }
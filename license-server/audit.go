@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// bucketAuditByTime was the secondary time index of schema 4, built by
+// rebuildAuditIndex. Migration 5 drops it once the audit bucket itself is
+// keyed by time.
+const bucketAuditByTime = "audit_by_time"
+
+// auditKey orders events by time, like log keys in central: the zero-padded
+// nanoseconds sort lexicographically and the ID keeps same-instant events
+// apart.
+func auditKey(t time.Time, id string) []byte {
+	return []byte(fmt.Sprintf("%020d_%s", t.UnixNano(), id))
+}
+
+// auditEventTime is the key time for a stored event.
+func auditEventTime(ev *AuditEvent) time.Time {
+	t, _ := time.Parse(time.RFC3339, ev.CreatedAt)
+	return t
+}
+
+// rebuildAuditIndex recreates audit_by_time from the audit bucket, as
+// schema 4 had it: keys are auditKey(time, id), values the event ID.
+func rebuildAuditIndex(tx *bbolt.Tx) error {
+	if err := tx.DeleteBucket([]byte(bucketAuditByTime)); err != nil && err != bbolt.ErrBucketNotFound {
+		return err
+	}
+	idx, err := tx.CreateBucket([]byte(bucketAuditByTime))
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(bucketAudit)).ForEach(func(k, v []byte) error {
+		var ev AuditEvent
+		if err := json.Unmarshal(v, &ev); err != nil {
+			return nil
+		}
+		return idx.Put(auditKey(auditEventTime(&ev), string(k)), k)
+	})
+}
+
+// rekeyAudit moves every audit event to its auditKey and drops the old time
+// index. Events already under the right key stay put, so running it on its
+// own output changes nothing and it is safe on restored backups of any age.
+// All moved events are removed before any is written back, so an event
+// landing on a key another event still has to leave cannot be lost.
+func rekeyAudit(tx *bbolt.Tx) error {
+	if err := tx.DeleteBucket([]byte(bucketAuditByTime)); err != nil && err != bbolt.ErrBucketNotFound {
+		return err
+	}
+	b := tx.Bucket([]byte(bucketAudit))
+	type move struct{ from, to, value []byte }
+	var moves []move
+	err := b.ForEach(func(k, v []byte) error {
+		var ev AuditEvent
+		if err := json.Unmarshal(v, &ev); err != nil {
+			return nil
+		}
+		if key := auditKey(auditEventTime(&ev), ev.ID); !bytes.Equal(key, k) {
+			moves = append(moves, move{append([]byte(nil), k...), key, append([]byte(nil), v...)})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, m := range moves {
+		if err := b.Delete(m.from); err != nil {
+			return err
+		}
+	}
+	for _, m := range moves {
+		if err := b.Put(m.to, m.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AuditFilter narrows QueryAudit. Zero values match everything; Since and
+// Until bound CreatedAt inclusively.
+type AuditFilter struct {
+	LicenseID string
+	Action    string
+	Since     time.Time
+	Until     time.Time
+}
+
+// parseAuditFilter reads licenseId, action, since and until (RFC3339) from
+// a query string.
+func parseAuditFilter(q url.Values) (AuditFilter, error) {
+	f := AuditFilter{LicenseID: strings.TrimSpace(q.Get("licenseId")), Action: strings.TrimSpace(q.Get("action"))}
+	for name, dst := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := strings.TrimSpace(q.Get(name)); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("%s must be RFC3339", name)
+			}
+			*dst = t
+		}
+	}
+	return f, nil
+}
+
+func (f AuditFilter) match(ev *AuditEvent) bool {
+	return (f.LicenseID == "" || ev.LicenseID == f.LicenseID) && (f.Action == "" || ev.Action == f.Action)
+}
+
+// QueryAudit returns up to limit events matching f, newest first, after
+// skipping offset matches, together with the total number of matches. The
+// audit bucket is keyed by time, so the date range costs nothing and an
+// unfiltered page only decodes the events it returns.
+func (s *Store) QueryAudit(offset, limit int, f AuditFilter) ([]AuditEvent, int, error) {
+	out := make([]AuditEvent, 0)
+	total := 0
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var lower []byte
+		if !f.Since.IsZero() {
+			lower = []byte(fmt.Sprintf("%020d", f.Since.UnixNano()))
+		}
+		c := tx.Bucket([]byte(bucketAudit)).Cursor()
+		var k, v []byte
+		if f.Until.IsZero() {
+			k, v = c.Last()
+		} else {
+			// Seek to the first key after Until, then step back into range.
+			upper := []byte(fmt.Sprintf("%020d~", f.Until.UnixNano()))
+			if k, v = c.Seek(upper); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+		filtered := f.LicenseID != "" || f.Action != ""
+		for ; k != nil; k, v = c.Prev() {
+			if lower != nil && bytes.Compare(k, lower) < 0 {
+				break
+			}
+			inPage := total >= offset && len(out) < limit
+			if !filtered && !inPage {
+				total++
+				continue
+			}
+			var ev AuditEvent
+			if err := json.Unmarshal(v, &ev); err != nil || !f.match(&ev) {
+				continue
+			}
+			if inPage {
+				out = append(out, ev)
+			}
+			total++
+		}
+		return nil
+	})
+	return out, total, err
+}
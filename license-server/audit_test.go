@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// auditSnapshot returns the audit bucket as key -> value.
+func auditSnapshot(t *testing.T, st *Store) map[string]string {
+	t.Helper()
+	out := map[string]string{}
+	err := st.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketAudit)).ForEach(func(k, v []byte) error {
+			out[string(k)] = string(v)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestAuditMigrations(t *testing.T) {
+	st := newTestStore(t)
+	t1 := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	evA := AuditEvent{ID: "a", Action: "create", CreatedAt: t1.Format(time.RFC3339)}
+	evB := AuditEvent{ID: "b", Action: "edit", CreatedAt: t2.Format(time.RFC3339)}
+	evC := AuditEvent{ID: "c", Action: "revoke", CreatedAt: t2.Add(time.Hour).Format(time.RFC3339)}
+	put := func(b *bbolt.Bucket, key []byte, ev AuditEvent) error {
+		v, _ := json.Marshal(ev)
+		return b.Put(key, v)
+	}
+
+	// A is keyed by ID as in schema 3. B sits under a stale time key (its
+	// CreatedAt was corrected) and C on the key B moves to, so a rekey that
+	// writes before every delete is done loses one of them.
+	err := st.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket([]byte(bucketAudit)); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucket([]byte(bucketAudit))
+		if err != nil {
+			return err
+		}
+		if err := put(b, []byte("a"), evA); err != nil {
+			return err
+		}
+		if err := put(b, auditKey(t1, "b"), evB); err != nil {
+			return err
+		}
+		return put(b, auditKey(t2, "b"), evC)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = st.db.Update(func(tx *bbolt.Tx) error {
+		if err := rebuildAuditIndex(tx); err != nil {
+			return err
+		}
+		n := 0
+		_ = tx.Bucket([]byte(bucketAuditByTime)).ForEach(func(_, _ []byte) error { n++; return nil })
+		if n != 3 {
+			t.Errorf("migration 4 indexed %d events, want 3", n)
+		}
+		return rekeyAudit(tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := auditSnapshot(t, st)
+	for _, ev := range []AuditEvent{evA, evB, evC} {
+		if _, ok := first[string(auditKey(auditEventTime(&ev), ev.ID))]; !ok {
+			t.Errorf("event %s not under its time key; bucket %v", ev.ID, first)
+		}
+	}
+	if len(first) != 3 {
+		t.Errorf("bucket holds %d events after rekey, want 3", len(first))
+	}
+
+	err = st.db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket([]byte(bucketAuditByTime)) != nil {
+			t.Error("audit_by_time still present after migration 5")
+		}
+		return rekeyAudit(tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := auditSnapshot(t, st)
+	if len(second) != len(first) {
+		t.Fatalf("second rekey changed the bucket: %v -> %v", first, second)
+	}
+	for k, v := range first {
+		if second[k] != v {
+			t.Errorf("second rekey changed %s", k)
+		}
+	}
+
+	list, err := st.ListAudit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[2].ID != "a" {
+		t.Errorf("ListAudit = %+v, want 3 events ending with a", list)
+	}
+}
+
+func TestAuditVerifyReportsSignedContent(t *testing.T) {
+	st := newTestStore(t)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{store: st, signKey: priv, pubKey: pub}
+	for i := range 3 {
+		if err := st.AddAudit(AuditEvent{ID: fmt.Sprintf("ev%d", i), Action: "edit", Actor: "admin", CreatedAt: "2026-10-01T00:00:00Z"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rec := httptest.NewRecorder()
+	s.handleAuditExport(rec, httptest.NewRequest(http.MethodGet, "/api/v1/audit/export?format=csv&sign=1", nil))
+	var exp signedAuditExport
+	if err := json.Unmarshal(rec.Body.Bytes(), &exp); err != nil {
+		t.Fatal(err)
+	}
+	// The wrapper fields are not signed; a forger may change them freely.
+	exp.Format, exp.Events, exp.SignedAt = "json", 1000, "2020-01-01T00:00:00Z"
+	body, _ := json.Marshal(exp)
+
+	rec = httptest.NewRecorder()
+	s.handleAuditVerify(rec, httptest.NewRequest(http.MethodPost, "/api/v1/audit/verify", bytes.NewReader(body)))
+	var got map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["valid"] != true || got["format"] != "csv" || got["events"] != float64(3) {
+		t.Errorf("verify = %v, want valid csv with 3 events", got)
+	}
+	if _, ok := got["signedAt"]; ok {
+		t.Errorf("verify reports unsigned signedAt: %v", got)
+	}
+}
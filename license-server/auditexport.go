@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signedAuditExport wraps an audit export with an Ed25519 signature over the
+// exact exported bytes, which travel base64-encoded in Content. The other
+// fields are informational and not covered by the signature.
+type signedAuditExport struct {
+	Format         string `json:"format"`
+	Filename       string `json:"filename"`
+	Events         int    `json:"events"`
+	Content        string `json:"content"`
+	Algorithm      string `json:"algorithm"`
+	Signature      string `json:"signature"`
+	KeyFingerprint string `json:"keyFingerprint"`
+	PublicKey      string `json:"publicKey"`
+	SignedAt       string `json:"signedAt"`
+}
+
+// auditExportBytes renders events as JSON (an array, one event per line) or
+// CSV with a UTF-8 BOM like the license export.
+func auditExportBytes(format string, events []AuditEvent) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "csv":
+		buf.Write([]byte{0xEF, 0xBB, 0xBF})
+		cw := csv.NewWriter(&buf)
+		_ = cw.Write([]string{"ID", "Время", "Действие", "Лицензия", "Актор", "Детали"})
+		for _, ev := range events {
+			_ = cw.Write([]string{ev.ID, ev.CreatedAt, ev.Action, ev.LicenseID, ev.Actor, ev.Details})
+		}
+		cw.Flush()
+		return buf.Bytes(), cw.Error()
+	default:
+		buf.WriteString("[\n")
+		for i, ev := range events {
+			line, err := json.Marshal(ev)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(line)
+			if i < len(events)-1 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("]\n")
+		return buf.Bytes(), nil
+	}
+}
+
+// auditContentSummary reads the format and event count back from exported
+// bytes, so they come from the signed content rather than the wrapper.
+func auditContentSummary(content []byte) (format string, events int, ok bool) {
+	if csvBody, isCSV := bytes.CutPrefix(content, []byte{0xEF, 0xBB, 0xBF}); isCSV {
+		rows, err := csv.NewReader(bytes.NewReader(csvBody)).ReadAll()
+		if err != nil || len(rows) == 0 {
+			return "", 0, false
+		}
+		return "csv", len(rows) - 1, true
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(content, &list); err != nil {
+		return "", 0, false
+	}
+	return "json", len(list), true
+}
+
+// handleAuditExport downloads the audit log, oldest first, filtered like
+// /api/v1/audit. With sign=1 the file is wrapped in a signedAuditExport so a
+// recipient can check it was not altered.
+func (s *Server) handleAuditExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	q := r.URL.Query()
+	f, err := parseAuditFilter(q)
+	if err != nil {
+		httpErr(w, err, 400)
+		return
+	}
+	format := strings.ToLower(strings.TrimSpace(q.Get("format")))
+	switch format {
+	case "":
+		format = "json"
+	case "json", "csv":
+	default:
+		httpErr(w, fmt.Errorf("format must be json or csv"), 400)
+		return
+	}
+	sign, _ := strconv.ParseBool(strings.TrimSpace(q.Get("sign")))
+
+	events, _, err := s.store.QueryAudit(0, math.MaxInt, f)
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	body, err := auditExportBytes(format, events)
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	now := time.Now().UTC()
+	filename := "audit-" + now.Format("20060102-150405") + "." + format
+	_ = s.store.AddAudit(AuditEvent{
+		ID:        randomHex(16),
+		Action:    "audit_export",
+		Actor:     requestIdentity(r).label(),
+		Details:   fmt.Sprintf("format=%s events=%d signed=%v", format, len(events), sign),
+		CreatedAt: now.Format(time.RFC3339),
+	})
+
+	if !sign {
+		if format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+		_, _ = w.Write(body)
+		return
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename+".signed.json")
+	respondJSON(w, 200, signedAuditExport{
+		Format:         format,
+		Filename:       filename,
+		Events:         len(events),
+		Content:        base64.StdEncoding.EncodeToString(body),
+		Algorithm:      "ed25519",
+		Signature:      signBytes(s.signKey, body),
+		KeyFingerprint: s.keyFingerprint(),
+		PublicKey:      base64.StdEncoding.EncodeToString(s.pubKey),
+		SignedAt:       now.Format(time.RFC3339),
+	})
+}
+
+// handleAuditVerify checks a signed audit export against this server's
+// current key. The public key inside the export is ignored: anyone who
+// altered the content could have replaced it too. For the same reason the
+// reported format and event count are read from the verified content, not
+// from the unsigned wrapper fields.
+func (s *Server) handleAuditVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	var exp signedAuditExport
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRestoreBytes))
+	if err := dec.Decode(&exp); err != nil {
+		httpErr(w, fmt.Errorf("invalid body: %w", err), 400)
+		return
+	}
+	var content []byte
+	result := func(valid bool, reason string) {
+		resp := map[string]any{"valid": valid, "keyFingerprint": s.keyFingerprint()}
+		if reason != "" {
+			resp["reason"] = reason
+		}
+		if valid {
+			if format, events, ok := auditContentSummary(content); ok {
+				resp["format"], resp["events"] = format, events
+			}
+		}
+		respondJSON(w, 200, resp)
+	}
+	if !strings.EqualFold(exp.Algorithm, "ed25519") {
+		result(false, "unsupported_algorithm")
+		return
+	}
+	content, err := base64.StdEncoding.DecodeString(exp.Content)
+	if err != nil {
+		result(false, "invalid_content")
+		return
+	}
+	sig, err := base64.StdEncoding.DecodeString(exp.Signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		result(false, "invalid_signature_format")
+		return
+	}
+	if exp.KeyFingerprint != "" && exp.KeyFingerprint != s.keyFingerprint() {
+		result(false, "key_mismatch")
+		return
+	}
+	if !ed25519.Verify(s.pubKey, content, sig) {
+		result(false, "signature_mismatch")
+		return
+	}
+	result(true, "")
+}
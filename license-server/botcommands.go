@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// adminBotCommand is a bot command only the admin chat may run.
+type adminBotCommand struct {
+	usage string
+	help  string
+	run   func(s *Server, botToken, chat string, args []string)
+}
+
+// adminBotCommands are keyed by command name without the slash.
+var adminBotCommands = map[string]adminBotCommand{
+	"status": {usage: "/status <LICENSE_KEY>", help: "состояние лицензии", run: (*Server).botLicenseStatus},
+	"stats":  {usage: "/stats", help: "сводка по лицензиям", run: (*Server).botLicenseStats},
+}
+
+// adminBotHelp lists the admin commands for /help in the admin chat.
+func adminBotHelp() string {
+	names := make([]string, 0, len(adminBotCommands))
+	for name := range adminBotCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("\nКоманды админа:")
+	for _, name := range names {
+		cmd := adminBotCommands[name]
+		b.WriteString("\n" + html.EscapeString(cmd.usage) + " — " + cmd.help)
+	}
+	return b.String()
+}
+
+// isAdminChat reports whether chat is the admin chat bound with
+// /admin <ADMIN_TOKEN> (or set in the settings).
+func (s *Server) isAdminChat(chat string) bool {
+	admin := strings.TrimSpace(s.store.GetSetting("telegram_chat_id"))
+	return admin != "" && chat == admin
+}
+
+// handleAdminBotCommand runs text if it is an admin command and reports
+// whether it was one. Other chats are refused without running anything.
+func (s *Server) handleAdminBotCommand(botToken, chat, text string) bool {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return false
+	}
+	// In groups Telegram sends commands as /stats@BotName.
+	name, _, _ := strings.Cut(strings.ToLower(fields[0][1:]), "@")
+	cmd, ok := adminBotCommands[name]
+	if !ok {
+		return false
+	}
+	if !s.isAdminChat(chat) {
+		log.Printf("[WARN] telegram: команда /%s из чата %s без прав админа", name, chat)
+		_ = s.telegramSend(telegramKindBot, botToken, chat, "⛔ Эта команда доступна только админ-чату. Привязать его: /admin &lt;ADMIN_TOKEN&gt;")
+		return true
+	}
+	cmd.run(s, botToken, chat, fields[1:])
+	return true
+}
+
+func (s *Server) botLicenseStatus(botToken, chat string, args []string) {
+	if len(args) != 1 {
+		_ = s.telegramSend(telegramKindBot, botToken, chat, "Формат: /status &lt;LICENSE_KEY&gt;")
+		return
+	}
+	lic, err := s.store.GetLicenseByKey(strings.TrimSpace(args[0]))
+	if err != nil {
+		_ = s.telegramSend(telegramKindBot, botToken, chat, "❌ Лицензия не найдена.")
+		return
+	}
+	lastCheck := lic.LastCheckAt
+	if lastCheck == "" {
+		lastCheck = "—"
+	}
+	msg := fmt.Sprintf("🔑 %s\nКлиент: %s\nСтатус: %s\nТариф: %s, агентов до %d\nДо: %s\nПоследняя проверка: %s",
+		html.EscapeString(lic.LicenseKey),
+		html.EscapeString(lic.CustomerName),
+		effectiveLicenseStatus(lic, time.Now().UTC()),
+		html.EscapeString(lic.Plan),
+		lic.MaxAgents,
+		html.EscapeString(lic.ExpiresAt),
+		html.EscapeString(lastCheck),
+	)
+	if lic.LastHostname != "" {
+		msg += "\nХост: " + html.EscapeString(lic.LastHostname)
+	}
+	_ = s.telegramSend(telegramKindBot, botToken, chat, msg)
+}
+
+func (s *Server) botLicenseStats(botToken, chat string, _ []string) {
+	list, err := s.store.ListLicenses()
+	if err != nil {
+		_ = s.telegramSend(telegramKindBot, botToken, chat, "❌ Не удалось прочитать лицензии.")
+		return
+	}
+	st := licenseStats(list, time.Now().UTC())
+	by, _ := st["byStatus"].(map[string]int)
+	msg := fmt.Sprintf("📊 Лицензий: %d\nАктивных: %d\nПриостановлено: %d\nОтозвано: %d\nИстекло: %d\nИстекают за 30 дней: %v",
+		len(list), by["active"], by["suspended"], by["revoked"], by["expired"], st["expiringIn30Days"])
+	_ = s.telegramSend(telegramKindBot, botToken, chat, msg)
+}
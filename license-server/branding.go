@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Export branding settings for white-labeled HTML/XLSX exports.
+const (
+	settingExportBrandName   = "export_brand_name"
+	settingExportBrandFooter = "export_brand_footer"
+	settingExportAccentColor = "export_accent_color"
+
+	defaultExportBrandName   = "NODAX"
+	defaultExportBrandFooter = "NODAX License Server"
+	defaultExportAccentColor = "#0f766e"
+
+	maxExportBrandLen = 80
+)
+
+var hexColorRe = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// exportBranding is the name, footer and accent color used by exports.
+// Name and footer are plain text and still need xmlEsc on output; Accent is
+// always a valid #rgb or #rrggbb color.
+type exportBranding struct {
+	Name   string
+	Footer string
+	Accent string
+}
+
+// cleanBrandText drops control characters, collapses whitespace and caps the
+// length of a brand string.
+func cleanBrandText(v string) string {
+	v = strings.Join(strings.Fields(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, v)), " ")
+	if r := []rune(v); len(r) > maxExportBrandLen {
+		v = string(r[:maxExportBrandLen])
+	}
+	return v
+}
+
+// exportBrand reads the branding settings, falling back to NODAX defaults
+// for empty or invalid values.
+func (s *Server) exportBrand() exportBranding {
+	b := exportBranding{Name: defaultExportBrandName, Footer: defaultExportBrandFooter, Accent: defaultExportAccentColor}
+	if v := cleanBrandText(s.store.GetSetting(settingExportBrandName)); v != "" {
+		b.Name = v
+	}
+	if v := cleanBrandText(s.store.GetSetting(settingExportBrandFooter)); v != "" {
+		b.Footer = v
+	}
+	if v := strings.TrimSpace(s.store.GetSetting(settingExportAccentColor)); hexColorRe.MatchString(v) {
+		b.Accent = v
+	}
+	return b
+}
+
+// validateExportBrandSettings rejects an accent color that is not #rgb or
+// #rrggbb and normalizes the brand strings in req.
+func validateExportBrandSettings(req map[string]string) error {
+	if v, ok := req[settingExportAccentColor]; ok {
+		v = strings.TrimSpace(v)
+		if v != "" && !hexColorRe.MatchString(v) {
+			return fmt.Errorf("%s: expected #rgb or #rrggbb, got %q", settingExportAccentColor, v)
+		}
+		req[settingExportAccentColor] = v
+	}
+	for _, k := range []string{settingExportBrandName, settingExportBrandFooter} {
+		if v, ok := req[k]; ok {
+			req[k] = cleanBrandText(v)
+		}
+	}
+	return nil
+}
+
+// Page branding settings for the admin and client pages.
+const (
+	settingBrandName        = "brand_name"
+	settingBrandAccentColor = "brand_accent_color"
+
+	defaultBrandName = "NODAX"
+
+	// brandLogoFile holds an uploaded logo in the data directory; without it
+	// /assets/logo serves the bundled NODAX logo.
+	brandLogoFile   = "brand-logo"
+	maxBrandLogoLen = 512 << 10
+)
+
+// brandLogoTypes are the image types accepted for upload. SVG is left out
+// because it can carry script.
+var brandLogoTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// renderBrandedPage fills the {{BRAND_NAME}} and {{BRAND_STYLE}} markers of
+// an embedded page. The name is HTML-escaped; the accent color is only used
+// when it is a valid hex color, and accentCSS gets it as its only argument.
+func (s *Server) renderBrandedPage(page, accentCSS string) string {
+	name := cleanBrandText(s.store.GetSetting(settingBrandName))
+	if name == "" {
+		name = defaultBrandName
+	}
+	style := ""
+	if accent := strings.TrimSpace(s.store.GetSetting(settingBrandAccentColor)); hexColorRe.MatchString(accent) {
+		style = "<style>" + strings.ReplaceAll(accentCSS, "%ACCENT%", accent) + "</style>"
+	}
+	return strings.NewReplacer("{{BRAND_NAME}}", html.EscapeString(name), "{{BRAND_STYLE}}", style).Replace(page)
+}
+
+// validateBrandSettings checks the page accent color and normalizes the
+// brand name in req.
+func validateBrandSettings(req map[string]string) error {
+	if v, ok := req[settingBrandAccentColor]; ok {
+		v = strings.TrimSpace(v)
+		if v != "" && !hexColorRe.MatchString(v) {
+			return fmt.Errorf("%s: expected #rgb or #rrggbb, got %q", settingBrandAccentColor, v)
+		}
+		req[settingBrandAccentColor] = v
+	}
+	if v, ok := req[settingBrandName]; ok {
+		req[settingBrandName] = cleanBrandText(v)
+	}
+	return nil
+}
+
+// handleBrandLogo uploads (POST, raw image body) or removes (DELETE) the
+// custom logo served at /assets/logo.
+func (s *Server) handleBrandLogo(w http.ResponseWriter, r *http.Request) {
+	path := resolveDataFilePath(brandLogoFile)
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBrandLogoLen))
+		if err != nil {
+			httpErr(w, fmt.Errorf("logo must be at most %d KB", maxBrandLogoLen>>10), 413)
+			return
+		}
+		if ct := http.DetectContentType(data); !brandLogoTypes[ct] {
+			httpErr(w, fmt.Errorf("logo must be PNG, JPEG, GIF or WebP, got %s", ct), 400)
+			return
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			httpErr(w, err, 500)
+			return
+		}
+		_ = s.store.AddAudit(AuditEvent{ID: randomHex(16), Action: "brand_logo_upload", Actor: requestIdentity(r).label(), Details: fmt.Sprintf("bytes=%d", len(data)), CreatedAt: time.Now().UTC().Format(time.RFC3339)})
+		respondJSON(w, 200, map[string]any{"ok": true})
+	case http.MethodDelete:
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			httpErr(w, err, 500)
+			return
+		}
+		_ = s.store.AddAudit(AuditEvent{ID: randomHex(16), Action: "brand_logo_reset", Actor: requestIdentity(r).label(), CreatedAt: time.Now().UTC().Format(time.RFC3339)})
+		respondJSON(w, 200, map[string]any{"ok": true})
+	default:
+		http.Error(w, "Method not allowed", 405)
+	}
+}
+
+// serveBrandLogo writes the uploaded logo and reports whether there was one.
+func serveBrandLogo(w http.ResponseWriter, r *http.Request) bool {
+	data, err := os.ReadFile(resolveDataFilePath(brandLogoFile))
+	if err != nil {
+		return false
+	}
+	ct := http.DetectContentType(data)
+	if !brandLogoTypes[ct] {
+		return false
+	}
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write(data)
+	return true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go.etcd.io/bbolt"
+)
+
+// runCheck opens the database read-only without serving, prints integrity
+// problems and returns the process exit code.
+func runCheck(dbPath string) int {
+	store, err := openStoreReadOnly(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open store: %v\n", err)
+		return 1
+	}
+	defer store.Close()
+	if v, latest := store.SchemaVersion(), storeMigrations[len(storeMigrations)-1].version; v < latest {
+		fmt.Printf("schema version %d, migrations up to %d will run on next start\n", v, latest)
+		for _, m := range storeMigrations {
+			if m.version > v {
+				fmt.Printf("pending migration %d: %s\n", m.version, m.name)
+			}
+		}
+	}
+	problems := store.Check()
+	for _, p := range problems {
+		fmt.Println("PROBLEM:", p)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d problem(s) found\n", len(problems))
+		return 1
+	}
+	fmt.Println("store OK")
+	return 0
+}
+
+// bucketSince names buckets created by a later migration than the first one,
+// which creates the rest. On an older schema a missing bucket is a pending
+// migration, not a problem.
+var bucketSince = map[string]int{bucketDeployments: 6}
+
+// auditKeyedByTimeSince is the migration that rekeys audit events by time.
+const auditKeyedByTimeSince = 5
+
+// Check runs read-only integrity checks and returns the problems found.
+// Differences that pending migrations will fix are not reported.
+func (s *Store) Check() []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		for err := range tx.Check() {
+			add("bbolt: %v", err)
+		}
+		version := storeSchemaVersion(tx)
+		for _, name := range []string{bucketLicenses, bucketLicenseByKey, bucketAudit, bucketAdmin, bucketSessions, bucketAPIKeys, bucketSettings, bucketDeployments} {
+			since, ok := bucketSince[name]
+			if !ok {
+				since = 1
+			}
+			if tx.Bucket([]byte(name)) == nil && version >= since {
+				add("bucket %s missing", name)
+			}
+		}
+		if audit := tx.Bucket([]byte(bucketAudit)); audit != nil && version >= auditKeyedByTimeSince {
+			_ = audit.ForEach(func(k, v []byte) error {
+				var ev AuditEvent
+				if err := json.Unmarshal(v, &ev); err != nil {
+					add("audit %s: cannot decode: %v", k, err)
+				} else if key := auditKey(auditEventTime(&ev), ev.ID); string(key) != string(k) {
+					add("audit %s: expected key %s", k, key)
+				}
+				return nil
+			})
+		}
+		licenses, byKey := tx.Bucket([]byte(bucketLicenses)), tx.Bucket([]byte(bucketLicenseByKey))
+		if licenses == nil || byKey == nil {
+			return nil
+		}
+		keys := map[string]string{}
+		_ = licenses.ForEach(func(k, v []byte) error {
+			var lic License
+			if err := json.Unmarshal(v, &lic); err != nil {
+				add("license %s: cannot decode: %v", k, err)
+				return nil
+			}
+			if lic.ID != string(k) {
+				add("license %s: stored under key with id %q", k, lic.ID)
+			}
+			if other, ok := keys[lic.LicenseKey]; ok {
+				add("license %s: key %s duplicates license %s", k, lic.LicenseKey, other)
+			}
+			keys[lic.LicenseKey] = string(k)
+			if id := byKey.Get([]byte(lic.LicenseKey)); string(id) != string(k) {
+				add("license %s: license_by_key[%s] = %q", k, lic.LicenseKey, id)
+			}
+			return nil
+		})
+		_ = byKey.ForEach(func(k, v []byte) error {
+			if licenses.Get(v) == nil {
+				add("license_by_key %s: points to missing license %s", k, v)
+			}
+			return nil
+		})
+		return nil
+	})
+	if err != nil {
+		add("bbolt: %v", err)
+	}
+	return problems
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestCheckTreatsUnmigratedBucketAsPending(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "license-server.db")
+	st, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setVersion := func(v int) {
+		t.Helper()
+		err := st.db.Update(func(tx *bbolt.Tx) error {
+			if err := tx.DeleteBucket([]byte(bucketDeployments)); err != nil && err != bbolt.ErrBucketNotFound {
+				return err
+			}
+			return tx.Bucket([]byte(bucketMeta)).Put([]byte(schemaVersionKey), []byte(strconv.Itoa(v)))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func() []string {
+		t.Helper()
+		st.Close()
+		ro, err := openStoreReadOnly(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ro.Close()
+		return ro.Check()
+	}
+
+	setVersion(5)
+	if problems := check(); len(problems) != 0 {
+		t.Errorf("schema 5 without deployments: problems = %v, want none", problems)
+	}
+
+	if st, err = NewStore(path); err != nil {
+		t.Fatal(err)
+	}
+	setVersion(storeMigrations[len(storeMigrations)-1].version)
+	if problems := check(); len(problems) != 1 || !strings.Contains(problems[0], "bucket deployments missing") {
+		t.Errorf("migrated schema without deployments: problems = %v, want the missing bucket", problems)
+	}
+}
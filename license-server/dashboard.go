@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultDashboardAudit is how many recent audit events /api/v1/dashboard
+// returns unless ?audit=N asks for another amount.
+const defaultDashboardAudit = 500
+
+// secretSettingKeys are settings whose values are never returned in full by
+// the dashboard or GET /api/v1/settings.
+var secretSettingKeys = map[string]bool{
+	"telegram_bot_token":       true,
+	"webhook_secret":           true,
+	settingClientCaptchaSecret: true,
+}
+
+// maskSecret keeps the last four characters of a secret for recognition.
+func maskSecret(v string) string {
+	if v == "" {
+		return ""
+	}
+	if len(v) <= 8 {
+		return "••••"
+	}
+	return "••••" + v[len(v)-4:]
+}
+
+// isMaskedSecretEcho reports whether a settings update for key merely sends
+// back the masked value from the dashboard, which must not overwrite the
+// stored secret.
+func (s *Server) isMaskedSecretEcho(key, value string) bool {
+	if !secretSettingKeys[key] {
+		return false
+	}
+	stored := s.store.GetSetting(key)
+	return stored != "" && value == maskSecret(stored)
+}
+
+// maskedSettings returns all settings with secrets masked, or left out
+// entirely for readonly callers.
+func (s *Server) maskedSettings(readonly bool) map[string]string {
+	settings := s.store.GetAllSettings()
+	for k, v := range settings {
+		if !secretSettingKeys[k] {
+			continue
+		}
+		if readonly {
+			delete(settings, k)
+		} else {
+			settings[k] = maskSecret(v)
+		}
+	}
+	return settings
+}
+
+// handleDashboard returns what the admin page needs on load in one response:
+// license stats, recent audit, settings with secrets masked and API keys
+// without their values. Readonly API keys get neither secrets nor API keys.
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	readonly := requestIdentity(r).readonly()
+	limit := defaultDashboardAudit
+	if n, err := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get("audit"))); err == nil && n >= 0 {
+		limit = n
+	}
+
+	list, err := s.store.ListLicenses()
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	audit, _, err := s.store.QueryAudit(0, limit, AuditFilter{})
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+
+	settings := s.maskedSettings(readonly)
+
+	resp := map[string]any{
+		"stats":    licenseStats(list, time.Now().UTC()),
+		"audit":    audit,
+		"settings": settings,
+	}
+	if !readonly {
+		keys, err := s.store.ListAPIKeys()
+		if err != nil {
+			httpErr(w, err, 500)
+			return
+		}
+		for i := range keys {
+			keys[i].Key = maskSecret(keys[i].Key)
+		}
+		views, err := s.apiKeyViews(keys)
+		if err != nil {
+			httpErr(w, err, 500)
+			return
+		}
+		resp["apiKeys"] = views
+	}
+	respondJSON(w, 200, resp)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// settingDeploymentStaleDays is how many days a deployment may go without a
+// validate before it is pruned.
+const (
+	settingDeploymentStaleDays = "deployment_stale_days"
+
+	defaultDeploymentStaleDays = 30
+	maxDeploymentStaleDays     = 3650
+)
+
+func (s *Server) deploymentStaleDays() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(s.store.GetSetting(settingDeploymentStaleDays))); err == nil && n > 0 && n <= maxDeploymentStaleDays {
+		return n
+	}
+	return defaultDeploymentStaleDays
+}
+
+func validateDeploymentSettings(req map[string]string) error {
+	v, ok := req[settingDeploymentStaleDays]
+	if !ok {
+		return nil
+	}
+	v = strings.TrimSpace(v)
+	if v != "" {
+		if n, err := strconv.Atoi(v); err != nil || n < 1 || n > maxDeploymentStaleDays {
+			return fmt.Errorf("%s: expected 1-%d, got %q", settingDeploymentStaleDays, maxDeploymentStaleDays, req[settingDeploymentStaleDays])
+		}
+	}
+	req[settingDeploymentStaleDays] = v
+	return nil
+}
+
+// maxDeploymentsPerLicense caps the instances recorded per license. Anyone
+// holding the key can validate with a fresh instanceId, so past the cap the
+// least recently seen instance makes room for the new one.
+const maxDeploymentsPerLicense = 200
+
+// Length caps for the validate fields stored with a deployment. Centrals
+// send far shorter values, so longer ones are rejected rather than stored.
+const (
+	maxInstanceIDLen   = 128
+	maxHostnameLen     = 253
+	maxVersionLen      = 64
+	maxDeploymentIPLen = 64
+)
+
+// checkValidateFieldLengths rejects a validate body whose instanceId,
+// hostname or version exceeds its cap.
+func checkValidateFieldLengths(req *validateRequest) error {
+	for _, f := range []struct {
+		name, value string
+		max         int
+	}{
+		{"instanceId", req.InstanceID, maxInstanceIDLen},
+		{"hostname", req.Hostname, maxHostnameLen},
+		{"version", req.Version, maxVersionLen},
+	} {
+		if len(strings.TrimSpace(f.value)) > f.max {
+			return fmt.Errorf("%s is longer than %d characters", f.name, f.max)
+		}
+	}
+	return nil
+}
+
+// deploymentInstance names the instance a validate came from: its instance
+// ID, else the hostname, else the client IP for very old centrals.
+func deploymentInstance(instanceID, host, ip string) string {
+	switch {
+	case instanceID != "":
+		return instanceID
+	case host != "":
+		return "host:" + host
+	default:
+		return "ip:" + ip
+	}
+}
+
+// recordDeployment stores the outcome of a validate for the calling
+// instance. Like LastCheckAt it is only rewritten when something changed or
+// checkPersistInterval has passed. handleValidate has already capped the
+// body fields; the client IP may come from a forwarded header, so an
+// oversized one is not stored either.
+func (s *Server) recordDeployment(licenseID string, req *validateRequest, ip string, payload *signedValidatePayload) {
+	if err := checkValidateFieldLengths(req); err != nil {
+		log.Printf("[WARN] развёртывание лицензии %s не записано: %v", licenseID, err)
+		return
+	}
+	if len(ip) > maxDeploymentIPLen {
+		log.Printf("[WARN] развёртывание лицензии %s не записано: адрес клиента длиннее %d символов", licenseID, maxDeploymentIPLen)
+		return
+	}
+	now := time.Now().UTC()
+	instanceID, host := strings.TrimSpace(req.InstanceID), strings.TrimSpace(req.Hostname)
+	d := Deployment{
+		LicenseID:   licenseID,
+		Instance:    deploymentInstance(instanceID, host, ip),
+		InstanceID:  instanceID,
+		Hostname:    host,
+		IP:          ip,
+		Version:     strings.TrimSpace(req.Version),
+		AgentCount:  req.AgentCount,
+		Status:      payload.Status,
+		Reason:      payload.Reason,
+		FirstSeenAt: now.Format(time.RFC3339),
+		LastSeenAt:  now.Format(time.RFC3339),
+	}
+	prev, err := s.store.GetDeployment(licenseID, d.Instance)
+	if err != nil {
+		log.Printf("[WARN] чтение развёртывания %s/%s: %v", licenseID, d.Instance, err)
+	}
+	if prev != nil {
+		d.FirstSeenAt = prev.FirstSeenAt
+		last, err := time.Parse(time.RFC3339, prev.LastSeenAt)
+		unchanged := prev.Hostname == d.Hostname && prev.IP == d.IP && prev.Version == d.Version && prev.AgentCount == d.AgentCount && prev.Status == d.Status && prev.Reason == d.Reason
+		if unchanged && err == nil && now.Sub(last) < s.checkPersistInterval {
+			return
+		}
+	}
+	evicted, err := s.store.SaveDeployment(&d, maxDeploymentsPerLicense)
+	if err != nil {
+		log.Printf("[WARN] запись развёртывания %s/%s: %v", licenseID, d.Instance, err)
+		return
+	}
+	for _, old := range evicted {
+		log.Printf("[WARN] лицензия %s: больше %d развёртываний, вытеснено давно не виденное %s (последний раз %s)", licenseID, maxDeploymentsPerLicense, old.Instance, old.LastSeenAt)
+	}
+}
+
+// deploymentPruner drops deployments not seen for deployment_stale_days at
+// startup and then hourly.
+func (s *Server) deploymentPruner() {
+	for {
+		cutoff := time.Now().UTC().AddDate(0, 0, -s.deploymentStaleDays())
+		if n, err := s.store.PruneDeployments(cutoff); err != nil {
+			log.Printf("[WARN] очистка развёртываний: %v", err)
+		} else if n > 0 {
+			log.Printf("Удалено устаревших развёртываний: %d", n)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// handleLicenseDeployments lists every central instance that validated the
+// license within deployment_stale_days, with the result of its last
+// validate, so the owner sees the health of all installs at once.
+func (s *Server) handleLicenseDeployments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	lic, err := s.store.GetLicenseByID(strings.TrimSpace(r.PathValue("id")))
+	if err != nil {
+		if errors.Is(err, errLicenseNotFound) {
+			httpErr(w, err, 404)
+			return
+		}
+		httpErr(w, err, 500)
+		return
+	}
+	list, err := s.store.ListDeployments(lic.ID)
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	staleDays := s.deploymentStaleDays()
+	cutoff := time.Now().UTC().AddDate(0, 0, -staleDays)
+	items := make([]Deployment, 0, len(list))
+	byStatus := map[string]int{}
+	for _, d := range list {
+		if seen, err := time.Parse(time.RFC3339, d.LastSeenAt); err != nil || seen.Before(cutoff) {
+			continue
+		}
+		items = append(items, d)
+		byStatus[d.Status]++
+	}
+	respondJSON(w, 200, map[string]any{
+		"licenseId":      lic.ID,
+		"items":          items,
+		"total":          len(items),
+		"byStatus":       byStatus,
+		"staleAfterDays": staleDays,
+	})
+}
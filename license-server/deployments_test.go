@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateCapsDeploymentFields(t *testing.T) {
+	st := newTestStore(t)
+	if err := st.CreateLicense(&License{ID: "lic", LicenseKey: "NDX-CAPS", Status: "active", Plan: "pro"}); err != nil {
+		t.Fatal(err)
+	}
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, _ := parseTrustedProxies(defaultTrustedProxies)
+	s := &Server{store: st, signKey: priv, trustedProxies: trusted, checkPersistInterval: time.Minute}
+
+	validate := func(body map[string]any, xff string) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/license/validate", strings.NewReader(string(raw)))
+		req.RemoteAddr = "127.0.0.1:40000"
+		if xff != "" {
+			req.Header.Set("X-Forwarded-For", xff)
+		}
+		rec := httptest.NewRecorder()
+		s.handleValidate(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name  string
+		field string
+		value string
+	}{
+		{"instanceId", "instanceId", strings.Repeat("i", maxInstanceIDLen+1)},
+		{"hostname", "hostname", strings.Repeat("h", maxHostnameLen+1)},
+		{"version", "version", strings.Repeat("v", maxVersionLen+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := validate(map[string]any{"licenseKey": "NDX-CAPS", tt.field: tt.value}, "")
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.field) {
+				t.Errorf("status = %d, body %s; want 400 naming %s", rec.Code, rec.Body, tt.field)
+			}
+		})
+	}
+
+	if rec := validate(map[string]any{"licenseKey": "NDX-CAPS", "instanceId": "i1"}, strings.Repeat("x", maxDeploymentIPLen+1)); rec.Code != http.StatusOK {
+		t.Errorf("oversized forwarded IP: status = %d, want 200", rec.Code)
+	}
+	list, err := st.ListDeployments("lic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 0 {
+		t.Fatalf("deployments = %+v, want none stored", list)
+	}
+
+	if rec := validate(map[string]any{"licenseKey": "NDX-CAPS", "instanceId": "i1", "hostname": "h1"}, "198.51.100.7"); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if list, _ = st.ListDeployments("lic"); len(list) != 1 || list[0].IP != "198.51.100.7" {
+		t.Errorf("deployments = %+v, want one from 198.51.100.7", list)
+	}
+}
+
+func TestSaveDeploymentEvictsLeastRecentlySeen(t *testing.T) {
+	st := newTestStore(t)
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	save := func(instance string, seen time.Time) []Deployment {
+		t.Helper()
+		evicted, err := st.SaveDeployment(&Deployment{LicenseID: "lic", Instance: instance, LastSeenAt: seen.Format(time.RFC3339)}, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return evicted
+	}
+	save("b", base.Add(2*time.Hour))
+	save("a", base.Add(time.Hour))
+	save("c", base.Add(3*time.Hour))
+	if evicted := save("a", base.Add(4*time.Hour)); len(evicted) != 0 {
+		t.Fatalf("updating a known instance evicted %+v", evicted)
+	}
+	evicted := save("d", base.Add(5*time.Hour))
+	if len(evicted) != 1 || evicted[0].Instance != "b" {
+		t.Fatalf("evicted = %+v, want b", evicted)
+	}
+	list, err := st.ListDeployments("lic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range list {
+		got = append(got, d.Instance)
+	}
+	if strings.Join(got, ",") != "d,a,c" {
+		t.Errorf("deployments = %v, want d,a,c", got)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Finance settings: price_<plan> is the yearly price of a plan and
+// price_currency the ISO 4217 code they are in.
+const (
+	settingPricePrefix   = "price_"
+	settingPriceCurrency = "price_currency"
+
+	defaultPriceCurrency = "RUB"
+)
+
+// defaultPlanPrices apply to the stock plans until a price is set, matching
+// what the finance tab showed before prices moved to the server.
+var defaultPlanPrices = map[string]float64{"basic": 1000, "pro": 3000, "enterprise": 5000}
+
+var currencyRe = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// planPrice is the yearly price of plan: price_<plan>, else the plan table's
+// priceYearly, else the stock default.
+func (s *Server) planPrice(plan string) float64 {
+	plan = strings.ToLower(strings.TrimSpace(plan))
+	if key := settingPricePrefix + plan; key != settingPriceCurrency {
+		if v, err := strconv.ParseFloat(strings.TrimSpace(s.store.GetSetting(key)), 64); err == nil && v >= 0 {
+			return v
+		}
+	}
+	if p, ok := s.plans()[plan]; ok && p.PriceYearly > 0 {
+		return p.PriceYearly
+	}
+	return defaultPlanPrices[plan]
+}
+
+func (s *Server) priceCurrency() string {
+	if v := strings.ToUpper(strings.TrimSpace(s.store.GetSetting(settingPriceCurrency))); currencyRe.MatchString(v) {
+		return v
+	}
+	return defaultPriceCurrency
+}
+
+// pricesConfigured reports whether any plan price has been saved; the
+// currency alone does not count.
+func (s *Server) pricesConfigured() bool {
+	for k, v := range s.store.GetAllSettings() {
+		if strings.HasPrefix(k, settingPricePrefix) && k != settingPriceCurrency && strings.TrimSpace(v) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFinanceSettings checks prices and currency in a settings update.
+func validateFinanceSettings(req map[string]string) error {
+	for k, v := range req {
+		if !strings.HasPrefix(k, settingPricePrefix) {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if k == settingPriceCurrency {
+			v = strings.ToUpper(v)
+			if v != "" && !currencyRe.MatchString(v) {
+				return fmt.Errorf("%s: expected a 3-letter ISO 4217 code, got %q", k, req[k])
+			}
+		} else if v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+				return fmt.Errorf("%s: expected a non-negative number, got %q", k, req[k])
+			}
+		}
+		req[k] = v
+	}
+	return nil
+}
+
+// financePlan is the revenue of one plan in the finance summary.
+type financePlan struct {
+	Active      int     `json:"active"`
+	PriceYearly float64 `json:"priceYearly"`
+	ARR         float64 `json:"arr"`
+}
+
+// handleFinanceSummary computes what the finance tab shows from all licenses:
+// active licenses, recurring revenue from the plan prices and revenue per
+// active license.
+func (s *Server) handleFinanceSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	list, err := s.store.ListLicenses()
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	now := time.Now().UTC()
+	byPlan := map[string]*financePlan{}
+	prices := map[string]float64{}
+	for name := range s.plans() {
+		prices[name] = s.planPrice(name)
+		byPlan[name] = &financePlan{PriceYearly: prices[name]}
+	}
+	active := 0
+	arr := 0.0
+	for i := range list {
+		if effectiveLicenseStatus(&list[i], now) != "active" {
+			continue
+		}
+		plan := strings.ToLower(strings.TrimSpace(list[i].Plan))
+		fp := byPlan[plan]
+		if fp == nil {
+			fp = &financePlan{PriceYearly: s.planPrice(plan)}
+			byPlan[plan] = fp
+		}
+		fp.Active++
+		fp.ARR += fp.PriceYearly
+		active++
+		arr += fp.PriceYearly
+	}
+	arpl := 0.0
+	if active > 0 {
+		arpl = arr / float64(active)
+	}
+	respondJSON(w, 200, map[string]any{
+		"active":           active,
+		"arr":              arr,
+		"mrr":              arr / 12,
+		"arpl":             arpl,
+		"currency":         s.priceCurrency(),
+		"prices":           prices,
+		"pricesConfigured": s.pricesConfigured(),
+		"byPlan":           byPlan,
+		"generatedAt":      now.Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+type identityCtxKey struct{}
+
+// adminIdentity is who a request passed withAdmin as: an admin session, the
+// admin token or an API key.
+type adminIdentity struct {
+	Via    string  // session, token or apikey
+	APIKey *APIKey // set when Via is apikey
+}
+
+// label names the identity in audit Actor and License.CreatedBy:
+// "apikey:<id>" for an API key, "admin" for a session or the admin token.
+func (id adminIdentity) label() string {
+	if id.APIKey != nil {
+		return "apikey:" + id.APIKey.ID
+	}
+	return "admin"
+}
+
+// readonly reports whether the identity is a readonly API key.
+func (id adminIdentity) readonly() bool {
+	return id.APIKey != nil && id.APIKey.Role == "readonly"
+}
+
+// requireAdminCaller rejects requests made with an API key, for routes only
+// an admin session or the admin token may use; what names the action in the
+// error. It reports whether the request may go on.
+func requireAdminCaller(w http.ResponseWriter, r *http.Request, what string) bool {
+	if requestIdentity(r).APIKey != nil {
+		httpErr(w, fmt.Errorf("only an admin can %s", what), 403)
+		return false
+	}
+	return true
+}
+
+func withIdentity(r *http.Request, id adminIdentity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityCtxKey{}, id))
+}
+
+// requestIdentity returns the identity withAdmin stored on r, or the zero
+// identity (which reads as admin) for routes outside withAdmin.
+func requestIdentity(r *http.Request) adminIdentity {
+	id, _ := r.Context().Value(identityCtxKey{}).(adminIdentity)
+	return id
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportBytes bounds an import upload, like maxRestoreBytes for backups.
+const maxImportBytes = maxRestoreBytes
+
+// importRowResult is the outcome of one CSV data row: created (with the new
+// license ID), skipped (key already exists) or error.
+type importRowResult struct {
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// importRowError is one entry of the "errors" list, kept from the first
+// import API: every row that was not created, skipped ones included.
+type importRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// handleLicensesImport creates licenses from a CSV in the export layout. New
+// IDs are always generated; keys are kept, generated when blank, or all
+// regenerated with ?keys=regenerate. Rows are validated first and then
+// written in one transaction; rows whose key already exists are skipped and
+// invalid rows are reported by their CSV line number. A generated key that
+// collides is drawn again, as on create.
+func (s *Server) handleLicensesImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	regenerate := strings.EqualFold(strings.TrimSpace(r.URL.Query().Get("keys")), "regenerate")
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var src io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				httpErr(w, fmt.Errorf("csv too large (limit %d MB)", maxImportBytes>>20), 413)
+				return
+			}
+			httpErr(w, fmt.Errorf("file is required: %w", err), 400)
+			return
+		}
+		defer f.Close()
+		src = f
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httpErr(w, fmt.Errorf("csv too large (limit %d MB)", maxImportBytes>>20), 413)
+			return
+		}
+		httpErr(w, fmt.Errorf("invalid body: %w", err), 400)
+		return
+	}
+	data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		httpErr(w, fmt.Errorf("invalid csv: %w", err), 400)
+		return
+	}
+	if len(records) < 2 {
+		httpErr(w, fmt.Errorf("csv has no data rows"), 400)
+		return
+	}
+
+	col := map[string]int{}
+	for i, h := range records[0] {
+		col[strings.TrimSpace(h)] = i
+	}
+	for _, h := range []string{"Ключ", "Клиент", "Тариф", "Истекает"} {
+		if _, ok := col[h]; !ok {
+			httpErr(w, fmt.Errorf("csv: missing column %q (expected the export layout)", h), 400)
+			return
+		}
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	results := make([]importRowResult, len(records)-1)
+	var (
+		batch     []*License
+		idx       []int
+		generated = map[*License]bool{}
+		seen      = map[string]int{}
+	)
+	for i, rec := range records[1:] {
+		line := i + 2
+		results[i].Row = line
+		field := func(name string) string {
+			if idx, ok := col[name]; ok && idx < len(rec) {
+				return strings.TrimSpace(rec[idx])
+			}
+			return ""
+		}
+		lic, err := s.licenseFromImportRow(field, regenerate, now)
+		if err != nil {
+			results[i].Status, results[i].Error = "error", err.Error()
+			continue
+		}
+		if regenerate || field("Ключ") == "" {
+			generated[lic] = true
+			for attempt := 1; seen[lic.LicenseKey] != 0 && attempt < maxKeyGenerateAttempts; attempt++ {
+				lic.LicenseKey = s.newLicenseKey()
+			}
+		}
+		if prev, ok := seen[lic.LicenseKey]; ok {
+			results[i].Status, results[i].Error = "skipped", fmt.Sprintf("duplicate key of row %d", prev)
+			continue
+		}
+		seen[lic.LicenseKey] = line
+		batch = append(batch, lic)
+		idx = append(idx, i)
+	}
+
+	// Licenses imported with an API key count against its quota; active rows
+	// past the remaining quota are rejected.
+	id := requestIdentity(r)
+	ak, createdBy := id.APIKey, id.label()
+	for _, lic := range batch {
+		lic.CreatedBy = createdBy
+	}
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	left, err := s.apiKeyQuotaLeft(ak)
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	if ak != nil {
+		kept, keptIdx := batch[:0], idx[:0]
+		nowT := time.Now().UTC()
+		for j, lic := range batch {
+			lic.CreatedByKey = ak.ID
+			if left >= 0 && effectiveLicenseStatus(lic, nowT) == "active" {
+				if left == 0 {
+					results[idx[j]].Status, results[idx[j]].Error = "error", apiKeyQuotaError(ak).Error()
+					continue
+				}
+				left--
+			}
+			kept, keptIdx = append(kept, lic), append(keptIdx, idx[j])
+		}
+		batch, idx = kept, keptIdx
+	}
+
+	errs, err := s.store.ImportLicenses(batch)
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	// Generated keys that collide with stored ones are drawn again and
+	// written in a follow-up transaction.
+	for attempt := 1; attempt < maxKeyGenerateAttempts; attempt++ {
+		var retry []*License
+		var retryAt []int
+		for j, e := range errs {
+			if errors.Is(e, errLicenseKeyTaken) && generated[batch[j]] {
+				batch[j].LicenseKey = s.newLicenseKey()
+				retry, retryAt = append(retry, batch[j]), append(retryAt, j)
+			}
+		}
+		if len(retry) == 0 {
+			break
+		}
+		retryErrs, err := s.store.ImportLicenses(retry)
+		if err != nil {
+			httpErr(w, err, 500)
+			return
+		}
+		for k, j := range retryAt {
+			errs[j] = retryErrs[k]
+		}
+	}
+	for j, e := range errs {
+		res := &results[idx[j]]
+		switch {
+		case e == nil:
+			res.Status, res.ID = "created", batch[j].ID
+		case errors.Is(e, errLicenseKeyTaken) && generated[batch[j]]:
+			res.Status, res.Error = "error", "could not generate a unique license key, consider a longer key format"
+		case errors.Is(e, errLicenseKeyTaken):
+			res.Status, res.Error = "skipped", e.Error()
+		default:
+			res.Status, res.Error = "error", e.Error()
+		}
+	}
+	counts := map[string]int{}
+	rowErrs := []importRowError{}
+	for _, res := range results {
+		counts[res.Status]++
+		if res.Status != "created" {
+			rowErrs = append(rowErrs, importRowError{Row: res.Row, Error: res.Error})
+		}
+	}
+
+	_ = s.store.AddAudit(AuditEvent{
+		ID:        randomHex(16),
+		Action:    "bulk_import",
+		Actor:     requestIdentity(r).label(),
+		Details:   fmt.Sprintf("rows=%d created=%d skipped=%d failed=%d regenerateKeys=%v", len(results), counts["created"], counts["skipped"], counts["error"], regenerate) + createdByDetails(ak),
+		CreatedAt: now,
+	})
+	respondJSON(w, 200, map[string]any{
+		"ok":      true,
+		"created": counts["created"],
+		"skipped": counts["skipped"],
+		"failed":  counts["error"],
+		"results": results,
+		"errors":  rowErrs,
+	})
+}
+
+// licenseFromImportRow builds a license from one CSV row read through field.
+func (s *Server) licenseFromImportRow(field func(string) string, regenerate bool, now string) (*License, error) {
+	name := field("Клиент")
+	if name == "" {
+		return nil, fmt.Errorf("customer name is required")
+	}
+	plan := strings.ToLower(field("Тариф"))
+	if plan == "" {
+		plan = s.defaultPlan()
+	}
+	if !s.isKnownPlan(plan) {
+		return nil, fmt.Errorf("unknown plan %q", plan)
+	}
+	maxAgents := s.planMaxAgents(plan)
+	if v := field("Лимит"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid agent limit %q", v)
+		}
+		maxAgents = n
+	}
+	exp, err := time.Parse(time.RFC3339, field("Истекает"))
+	if err != nil {
+		return nil, fmt.Errorf("expiry must be RFC3339, got %q", field("Истекает"))
+	}
+	status := strings.ToLower(field("Статус"))
+	switch status {
+	case "", "expired":
+		// Expiry follows from the date; stored status stays active.
+		status = "active"
+	case "active", "revoked", "suspended":
+	default:
+		return nil, fmt.Errorf("unknown status %q", status)
+	}
+
+	key := field("Ключ")
+	if regenerate || key == "" {
+		key = s.newLicenseKey()
+	}
+	createdAt := now
+	if t, err := time.Parse(time.RFC3339, field("Создана")); err == nil {
+		createdAt = t.UTC().Format(time.RFC3339)
+	}
+	return &License{
+		ID:               randomHex(16),
+		LicenseKey:       key,
+		CustomerName:     name,
+		CustomerCompany:  field("Компания"),
+		CustomerEmail:    field("Email"),
+		CustomerTelegram: field("Telegram"),
+		CustomerPhone:    field("Телефон"),
+		Plan:             plan,
+		MaxAgents:        maxAgents,
+		ExpiresAt:        exp.UTC().Format(time.RFC3339),
+		Status:           status,
+		Notes:            field("Комментарий"),
+		CreatedAt:        createdAt,
+		UpdatedAt:        now,
+	}, nil
+}
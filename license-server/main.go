@@ -2,22 +2,30 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/ed25519"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,6 +35,31 @@ type Server struct {
 	graceDays  int
 	signKey    ed25519.PrivateKey
 	pubKey     ed25519.PublicKey
+	keyCreated time.Time
+	// restoreLimit throttles DB restore attempts per client IP.
+	restoreLimit *ipRateLimiter
+	// cookieSecure forces the Secure flag on or off; nil sets it only for
+	// HTTPS requests (direct TLS or X-Forwarded-Proto from a trusted proxy).
+	cookieSecure   *bool
+	cookieSameSite http.SameSite
+	// clientLoginLimit throttles client portal logins per client IP.
+	clientLoginLimit *ipRateLimiter
+	adminSessionTTL  time.Duration
+	clientSessionTTL time.Duration
+	// trustedProxies may set X-Forwarded-For/-Proto/-Host.
+	trustedProxies []*net.IPNet
+	ops            opStatus
+	// checkPersistInterval throttles LastCheckAt writes on validate.
+	checkPersistInterval time.Duration
+	// notifyInterval is how often expirationNotifier scans for expiring
+	// licenses.
+	notifyInterval time.Duration
+	// quotaMu serializes the API key quota check with the license writes it
+	// guards.
+	quotaMu sync.Mutex
+	// keyGen draws new license keys; nil uses generateLicenseKey. Tests
+	// replace it to force collisions.
+	keyGen func(licenseKeyFormat) string
 }
 
 type validateRequest struct {
@@ -35,6 +68,9 @@ type validateRequest struct {
 	Hostname   string `json:"hostname"`
 	Version    string `json:"version"`
 	AgentCount int    `json:"agentCount"`
+	// Nonce is echoed in the signed payload so a captured response cannot
+	// be replayed to a later request.
+	Nonce string `json:"nonce,omitempty"`
 }
 
 type signedValidatePayload struct {
@@ -50,13 +86,32 @@ type signedValidatePayload struct {
 	InstanceID   string `json:"instanceId,omitempty"`
 	LicenseKey   string `json:"licenseKey,omitempty"`
 	CustomerName string `json:"customerName,omitempty"`
+	Nonce        string `json:"nonce,omitempty"`
+	IssuedAt     string `json:"issuedAt"`
+	ValidUntil   string `json:"validUntil"`
+	// Offline marks a token from handleLicenseOfflineToken rather than a
+	// live validate response.
+	Offline bool `json:"offline,omitempty"`
 }
 
+// signedPayloadTTL is how long a signed validate response is meant to be
+// accepted after IssuedAt.
+const signedPayloadTTL = 5 * time.Minute
+
+// maxNonceLen bounds the nonce echoed into signed responses.
+const maxNonceLen = 128
+
 func main() {
+	check := flag.Bool("check", false, "check database integrity and exit without serving")
+	flag.Parse()
+
 	dbPath := strings.TrimSpace(os.Getenv("LICENSE_DB_PATH"))
 	if dbPath == "" {
 		dbPath = resolveDataFilePath("license-server.db")
 	}
+	if *check {
+		os.Exit(runCheck(dbPath))
+	}
 	adminToken := strings.TrimSpace(os.Getenv("LICENSE_ADMIN_TOKEN"))
 	if adminToken == "" {
 		adminToken = randomHex(24)
@@ -70,13 +125,62 @@ func main() {
 		}
 	}
 
+	var cookieSecure *bool
+	if v := strings.TrimSpace(os.Getenv("LICENSE_COOKIE_SECURE")); v != "" && !strings.EqualFold(v, "auto") {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cookieSecure = &b
+		} else {
+			log.Printf("[WARN] LICENSE_COOKIE_SECURE=%q не распознан, используется auto", v)
+		}
+	}
+	cookieSameSite := http.SameSiteLaxMode
+	switch v := strings.ToLower(strings.TrimSpace(os.Getenv("LICENSE_COOKIE_SAMESITE"))); v {
+	case "", "lax":
+	case "strict":
+		cookieSameSite = http.SameSiteStrictMode
+	case "none":
+		cookieSameSite = http.SameSiteNoneMode
+	default:
+		log.Printf("[WARN] LICENSE_COOKIE_SAMESITE=%q не распознан, используется lax", v)
+	}
+
+	trustedSpec, ok := os.LookupEnv("LICENSE_TRUSTED_PROXIES")
+	if !ok {
+		trustedSpec = defaultTrustedProxies
+	}
+	trustedProxies, err := parseTrustedProxies(trustedSpec)
+	if err != nil {
+		log.Fatalf("LICENSE_TRUSTED_PROXIES: %v", err)
+	}
+
+	checkPersistInterval := defaultCheckPersistInterval
+	if v := strings.TrimSpace(os.Getenv("LICENSE_CHECK_PERSIST_INTERVAL")); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			checkPersistInterval = d
+		} else {
+			log.Printf("[WARN] LICENSE_CHECK_PERSIST_INTERVAL=%q не распознан, используется %s", v, defaultCheckPersistInterval)
+		}
+	}
+
+	notifyInterval := defaultNotifyInterval
+	if v := strings.TrimSpace(os.Getenv("LICENSE_NOTIFY_INTERVAL")); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			notifyInterval = d
+		} else {
+			log.Printf("[WARN] LICENSE_NOTIFY_INTERVAL=%q не распознан, используется %s", v, defaultNotifyInterval)
+		}
+	}
+
+	adminSessionTTL := envSessionTTL("LICENSE_ADMIN_SESSION_TTL")
+	clientSessionTTL := envSessionTTL("LICENSE_CLIENT_SESSION_TTL")
+
 	store, err := NewStore(dbPath)
 	if err != nil {
 		log.Fatalf("init store: %v", err)
 	}
 	defer store.Close()
 
-	priv, pub, err := loadOrCreateSigningKey()
+	priv, pub, keyCreated, err := loadOrCreateSigningKey()
 	if err != nil {
 		log.Fatalf("init signing key: %v", err)
 	}
@@ -90,7 +194,7 @@ func main() {
 	}
 	log.Printf("Admin user: admin (default password если первый запуск: %s)", defaultPass)
 
-	srv := &Server{store: store, adminToken: adminToken, graceDays: graceDays, signKey: priv, pubKey: pub}
+	srv := &Server{store: store, adminToken: adminToken, graceDays: graceDays, signKey: priv, pubKey: pub, keyCreated: keyCreated, restoreLimit: newIPRateLimiter(5, 10*time.Minute), cookieSecure: cookieSecure, cookieSameSite: cookieSameSite, clientLoginLimit: newIPRateLimiter(20, 10*time.Minute), adminSessionTTL: adminSessionTTL, clientSessionTTL: clientSessionTTL, trustedProxies: trustedProxies, checkPersistInterval: checkPersistInterval, notifyInterval: notifyInterval}
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", srv.handleRoot)
 	mux.HandleFunc("/admin", srv.handleAdminPage)
@@ -105,28 +209,55 @@ func main() {
 	mux.HandleFunc("/api/v1/auth/me", srv.handleAuthMe)
 	mux.HandleFunc("/api/v1/auth/change-password", srv.withAdmin(srv.handleChangePassword))
 	mux.HandleFunc("/api/v1/client/auth/login", srv.handleClientLogin)
+	mux.HandleFunc("/api/v1/client/auth/token", srv.handleClientTokenLogin)
 	mux.HandleFunc("/api/v1/client/auth/logout", srv.handleClientLogout)
 	mux.HandleFunc("/api/v1/client/auth/me", srv.handleClientAuthMe)
 	mux.HandleFunc("/api/v1/client/license", srv.handleClientLicense)
 
 	mux.HandleFunc("/api/v1/licenses", srv.withAdmin(srv.handleLicenses))
 	mux.HandleFunc("/api/v1/licenses/export", srv.withAdmin(srv.handleLicensesExport))
+	mux.HandleFunc("/api/v1/licenses/import", srv.withAdmin(srv.handleLicensesImport))
+	mux.HandleFunc("/api/v1/licenses/stats", srv.withAdmin(srv.handleLicensesStats))
 	mux.HandleFunc("/api/v1/licenses/{id}", srv.withAdmin(srv.handleLicenseByID))
 	mux.HandleFunc("/api/v1/licenses/{id}/extend", srv.withAdmin(srv.handleLicenseExtend))
 	mux.HandleFunc("/api/v1/licenses/{id}/revoke", srv.withAdmin(srv.handleLicenseRevoke))
+	mux.HandleFunc("/api/v1/licenses/{id}/client-link", srv.withAdmin(srv.handleLicenseClientLink))
+	mux.HandleFunc("/api/v1/licenses/{id}/offline-token", srv.withAdmin(srv.handleLicenseOfflineToken))
+	mux.HandleFunc("/api/v1/licenses/{id}/audit", srv.withAdmin(srv.handleLicenseAudit))
+	mux.HandleFunc("/api/v1/licenses/{id}/deployments", srv.withAdmin(srv.handleLicenseDeployments))
 	mux.HandleFunc("/api/v1/licenses/{id}/restore", srv.withAdmin(srv.handleLicenseRestore))
+	mux.HandleFunc("/api/v1/licenses/{id}/suspend", srv.withAdmin(srv.handleLicenseSuspend))
+	mux.HandleFunc("/api/v1/licenses/{id}/unsuspend", srv.withAdmin(srv.handleLicenseUnsuspend))
+
+	mux.HandleFunc("/api/v1/plans", srv.withAdmin(srv.handlePlans))
+	mux.HandleFunc("/api/v1/finance/summary", srv.withAdmin(srv.handleFinanceSummary))
+	mux.HandleFunc("/api/v1/companies", srv.withAdmin(srv.handleCompanies))
+	mux.HandleFunc("/api/v1/companies/{name}/licenses", srv.withAdmin(srv.handleCompanyLicenses))
 
 	mux.HandleFunc("/api/v1/audit", srv.withAdmin(srv.handleAudit))
+	mux.HandleFunc("/api/v1/audit/export", srv.withAdmin(srv.handleAuditExport))
+	mux.HandleFunc("/api/v1/audit/verify", srv.withAdmin(srv.handleAuditVerify))
+	mux.HandleFunc("/api/v1/dashboard", srv.withAdmin(srv.handleDashboard))
+	mux.HandleFunc("/api/v1/whoami", srv.withAdmin(srv.handleWhoami))
 	mux.HandleFunc("/api/v1/settings", srv.withAdmin(srv.handleSettings))
 	mux.HandleFunc("/api/v1/api-keys", srv.withAdmin(srv.handleAPIKeys))
-	mux.HandleFunc("/api/v1/api-keys/{id}", srv.withAdmin(srv.handleAPIKeyDelete))
+	mux.HandleFunc("/api/v1/api-keys/{id}", srv.withAdmin(srv.handleAPIKeyByID))
+	mux.HandleFunc("/api/v1/sessions", srv.withAdmin(srv.handleSessions))
+	mux.HandleFunc("/api/v1/sessions/{id}", srv.withAdmin(srv.handleSessionRevoke))
 	mux.HandleFunc("/api/v1/backup", srv.withAdmin(srv.handleBackup))
 	mux.HandleFunc("/api/v1/restore", srv.withAdmin(srv.handleRestore))
 	mux.HandleFunc("/api/v1/test-telegram", srv.withAdmin(srv.handleTestTelegram))
 	mux.HandleFunc("/api/v1/broadcast-clients", srv.withAdmin(srv.handleBroadcastClients))
 	mux.HandleFunc("/api/v1/test-webhook", srv.withAdmin(srv.handleTestWebhook))
+	mux.HandleFunc("/api/v1/system/status", srv.withAdmin(srv.handleSystemStatus))
+	mux.HandleFunc("/metrics", srv.withAdmin(srv.handleMetrics))
+	mux.HandleFunc("/api/v1/notifications/preview", srv.withAdmin(srv.handleNotificationsPreview))
+	mux.HandleFunc("/api/v1/branding/logo", srv.withAdmin(srv.handleBrandLogo))
+	mux.HandleFunc("/api/v1/notify/preview", srv.withAdmin(srv.handleNotifyPreview))
 
 	go srv.expirationNotifier()
+	go srv.sessionPurger()
+	go srv.deploymentPruner()
 	go srv.telegramBindingLoop()
 
 	port := strings.TrimSpace(os.Getenv("LICENSE_SERVER_PORT"))
@@ -135,7 +266,7 @@ func main() {
 	}
 	log.Printf("License Server запущен на :%s", port)
 	log.Printf("Public key (base64): %s", base64.StdEncoding.EncodeToString(pub))
-	if err := http.ListenAndServe(":"+port, cors(mux)); err != nil {
+	if err := http.ListenAndServe(":"+port, cors(withRequestID(mux))); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -154,7 +285,7 @@ func (s *Server) handleAdminPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	_, _ = w.Write([]byte(adminPageHTML))
+	_, _ = w.Write([]byte(s.renderBrandedPage(adminPageHTML, adminAccentCSS)))
 }
 
 func (s *Server) handleClientPage(w http.ResponseWriter, r *http.Request) {
@@ -163,21 +294,36 @@ func (s *Server) handleClientPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	_, _ = w.Write([]byte(clientPageHTML))
+	_, _ = w.Write([]byte(s.renderBrandedPage(clientPageHTML, clientAccentCSS)))
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, 200, map[string]any{"status": "ok", "time": time.Now().UTC().Format(time.RFC3339)})
 }
 
+// keyFingerprint is the hex SHA-256 of the signing public key, as shown by
+// /api/v1/public-key.
+func (s *Server) keyFingerprint() string {
+	sum := sha256.Sum256(s.pubKey)
+	return hex.EncodeToString(sum[:])
+}
+
 func (s *Server) handlePublicKey(w http.ResponseWriter, r *http.Request) {
-	respondJSON(w, 200, map[string]string{
-		"algorithm": "ed25519",
-		"publicKey": base64.StdEncoding.EncodeToString(s.pubKey),
-	})
+	resp := map[string]string{
+		"algorithm":   "ed25519",
+		"publicKey":   base64.StdEncoding.EncodeToString(s.pubKey),
+		"fingerprint": s.keyFingerprint(),
+	}
+	if !s.keyCreated.IsZero() {
+		resp["createdAt"] = s.keyCreated.UTC().Format(time.RFC3339)
+	}
+	respondJSON(w, 200, resp)
 }
 
 func (s *Server) handleLogo(w http.ResponseWriter, r *http.Request) {
+	if serveBrandLogo(w, r) {
+		return
+	}
 	ex, err := os.Executable()
 	if err != nil {
 		http.Error(w, "logo not found", 404)
@@ -199,12 +345,18 @@ func (s *Server) handleLogo(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "logo not found", 404)
 }
 
+// adminAccentCSS and clientAccentCSS apply brand_accent_color to the pages.
+const (
+	adminAccentCSS  = `:root{--primary:%ACCENT%;--primary-hover:%ACCENT%}`
+	clientAccentCSS = `.btn{background:%ACCENT%}.msg{color:%ACCENT%}`
+)
+
 const adminPageHTML = `<!doctype html>
 <html lang="ru">
 <head>
 <meta charset="UTF-8"/>
 <meta name="viewport" content="width=device-width,initial-scale=1.0"/>
-<title>NODAX License Server</title>
+<title>{{BRAND_NAME}} License Server</title>
 <style>
 @import url('https://fonts.googleapis.com/css2?family=Inter:wght@400;500;600;700;800&family=JetBrains+Mono:wght@400;500&display=swap');
 :root{
@@ -260,6 +412,7 @@ tbody tr:hover{background:#f0f7ff}
 .status{font-size:10px;font-weight:700;padding:2px 8px;border-radius:6px;display:inline-block}
 .s-active{background:#dcfce7;color:var(--success)}
 .s-revoked{background:#fee2e2;color:var(--danger)}
+.s-suspended{background:#e0e7ff;color:#3730a3}
 .s-expired{background:#fef3c7;color:var(--warning)}
 .tabs{display:flex;gap:0;margin-bottom:14px;border-bottom:2px solid var(--border-main)}
 .tab{padding:10px 18px;font-weight:600;font-size:13px;cursor:pointer;border-bottom:3px solid transparent;margin-bottom:-2px;color:var(--text-muted);transition:color .15s,border-color .15s;white-space:nowrap}
@@ -318,6 +471,7 @@ tbody tr:hover{background:#f0f7ff}
 @media(max-width:1024px){.sidebar{width:220px}.create-grid{grid-template-columns:1fr 1fr}.finance-grid,.price-grid{grid-template-columns:1fr 1fr}.settings-grid,.chart-row{grid-template-columns:1fr}}
 @media(max-width:760px){.sidebar{display:none}.create-grid{grid-template-columns:1fr}.finance-grid,.price-grid{grid-template-columns:1fr}}
 </style>
+{{BRAND_STYLE}}
 </head>
 <body>
 <div class="app-bg"></div>
@@ -326,7 +480,7 @@ tbody tr:hover{background:#f0f7ff}
 <div id="loginView" style="display:none;width:100%;height:100%">
 <div class="login-wrap">
 <div class="login-card">
-<h2>NODAX License Server</h2>
+<h2>{{BRAND_NAME}} License Server</h2>
 <div class="field"><label>Логин</label><input id="loginUser" value="admin"/></div>
 <div class="field"><label>Пароль</label><input id="loginPass" type="password" placeholder="Пароль"/></div>
 <button id="btnLogin" type="button" class="btn">Войти</button>
@@ -339,7 +493,7 @@ tbody tr:hover{background:#f0f7ff}
 <!-- Sidebar -->
 <div class="sidebar">
 <div class="sidebar-header">
-<img class="sidebar-logo" src="/assets/logo" alt="NODAX"/>
+<img class="sidebar-logo" src="/assets/logo" alt="{{BRAND_NAME}}"/>
 </div>
 <div class="sidebar-nav">
 <div class="nav-section">License Server</div>
@@ -385,13 +539,16 @@ tbody tr:hover{background:#f0f7ff}
 <a data-fmt="csv"><span>📄</span>CSV</a>
 <a data-fmt="xlsx"><span>📊</span>Excel</a>
 <a data-fmt="html"><span>🌐</span>HTML</a>
+<a data-fmt="pdf"><span>🖨</span>PDF</a>
+<a data-fmt="json"><span>🧾</span>JSON</a>
 </div></div>
+<button id="btnImport" type="button" class="btn-ghost btn-sm" title="CSV в формате экспорта">Импорт CSV</button><input id="importFile" type="file" accept=".csv,text/csv" style="display:none"/>
 <button id="btnRefresh" type="button" class="btn-ghost btn-sm">Обновить</button>
 </div>
 </div>
 <div class="filter-bar">
 <input id="searchInput" placeholder="Поиск по клиенту / ключу..." style="flex:1;min-width:200px"/>
-<select id="filterStatus"><option value="">Все статусы</option><option value="active">active</option><option value="revoked">revoked</option><option value="expired">expired</option></select>
+<select id="filterStatus"><option value="">Все статусы</option><option value="active">active</option><option value="suspended">suspended</option><option value="revoked">revoked</option><option value="expired">expired</option></select>
 <select id="filterPlan"><option value="">Все тарифы</option><option value="basic">basic</option><option value="pro">pro</option><option value="enterprise">enterprise</option></select>
 </div>
 <table><thead><tr><th>Клиент / Компания</th><th>Email</th><th>Telegram</th><th>Телефон</th><th>Ключ</th><th>План</th><th>Статус</th><th>Истекает</th><th>Хост</th><th>Действия</th></tr></thead>
@@ -426,7 +583,12 @@ tbody tr:hover{background:#f0f7ff}
 <!-- Audit Tab -->
 <div id="tab-audit" class="tab-content">
 <div class="card">
-<div class="row" style="justify-content:space-between;margin-bottom:8px"><h2 style="margin:0">Журнал аудита</h2><button id="btnRefreshAudit" type="button" class="btn-ghost btn-sm">Обновить</button></div>
+<div class="row" style="justify-content:space-between;margin-bottom:8px"><h2 style="margin:0">Журнал аудита</h2><div class="row">
+<select id="auditFmt" title="Формат экспорта"><option value="csv">CSV</option><option value="json">JSON</option></select>
+<select id="auditSign" title="Подпись Ed25519 ключом сервера"><option value="1">С подписью</option><option value="0">Без подписи</option></select>
+<button id="btnAuditExport" type="button" class="btn-ghost btn-sm">Экспорт</button>
+<button id="btnAuditVerify" type="button" class="btn-ghost btn-sm">Проверить подпись</button><input id="auditVerifyFile" type="file" accept=".json,application/json" style="display:none"/>
+<button id="btnRefreshAudit" type="button" class="btn-ghost btn-sm">Обновить</button></div></div>
 <table><thead><tr><th>Время</th><th>Действие</th><th>License ID</th><th>Актор</th><th>Детали</th></tr></thead>
 <tbody id="auditBody"></tbody></table>
 <div class="pager"><button id="auditPrev" type="button" class="btn-ghost btn-sm">Назад</button><span id="auditInfo">-</span><button id="auditNext" type="button" class="btn-ghost btn-sm">Вперед</button></div>
@@ -443,16 +605,39 @@ tbody tr:hover{background:#f0f7ff}
 </div>
 <div class="card"><h2 style="margin-top:0">Telegram</h2>
 <div class="field"><label>Bot Token</label><input id="tgToken" placeholder="123456:ABC..."/></div>
-<div class="field"><label>Chat ID (авто из бота)</label><input id="tgChat" placeholder="-100123..."/></div>
+<div class="field"><label>Chat ID (команда /admin &lt;ADMIN_TOKEN&gt; в боте)</label><input id="tgChat" placeholder="-100123..."/></div>
+<div class="field"><label>Авто-привязка Chat ID первого написавшего боту</label><select id="tgAutocapture"><option value="false">Выключена (только /admin)</option><option value="true">Включена</option></select></div>
 <div class="field"><label>Уведомлять за (дней)</label><input id="tgDays" type="number" min="1" value="7"/></div>
+<div class="field"><label>Тихие часы (HH:MM-HH:MM, пусто — выключены)</label><input id="tgQuiet" placeholder="22:00-08:00"/></div>
+<div class="field"><label>Часовой пояс тихих часов</label><input id="tgTz" placeholder="UTC, например Europe/Moscow"/></div>
+<div class="field"><label>Язык уведомлений</label><select id="tgLang"><option value="ru">Русский</option><option value="en">English</option></select></div>
 <div class="field"><label>Webhook URL</label><input id="whUrl" placeholder="https://example.com/webhook"/></div>
+<div class="field"><label>Webhook secret (подпись X-Nodax-Signature)</label><div class="row"><input id="whSecret" placeholder="пусто — без подписи" style="flex:1"/><button id="btnGenWhSecret" type="button" class="btn-ghost btn-sm">Сгенерировать</button></div></div>
+<div class="field"><label>Повторы webhook при сбое (0–5, паузы 1с, 4с, 16с…)</label><input id="whRetries" type="number" min="0" max="5" value="3"/></div>
 <div class="field"><label>Общее сообщение клиентам</label><textarea id="tgBroadcastMsg" rows="3" placeholder="Введите текст рассылки клиентам..."></textarea></div>
-<div class="row"><button id="btnSaveTg" type="button" class="btn-ghost btn-sm">Сохранить</button><button id="btnTestTg" type="button" class="btn-ghost btn-sm">Тест</button></div>
+<div class="row"><button id="btnSaveTg" type="button" class="btn-ghost btn-sm">Сохранить</button><button id="btnTestTg" type="button" class="btn-ghost btn-sm">Тест</button><button id="btnTestWh" type="button" class="btn-ghost btn-sm">Тест webhook</button></div>
 <div class="row"><button id="btnBroadcastClients" type="button" class="btn-ghost btn-sm">Отправить всем клиентам</button></div>
 </div>
+<div class="card"><h2 style="margin-top:0">Брендинг страниц</h2>
+<div class="field"><label>Название продукта</label><input id="brName" placeholder="NODAX" maxlength="80"/></div>
+<div class="field"><label>Цвет акцента (пусто — стандартный)</label><div class="row"><input id="brAccent" type="color" value="#16a2a7"/><button id="btnResetAccent" type="button" class="btn-ghost btn-sm">Стандартный</button></div></div>
+<div class="field"><label>Логотип (PNG, JPEG, GIF или WebP до 512 КБ)</label><input id="brLogo" type="file" accept="image/png,image/jpeg,image/gif,image/webp"/></div>
+<div class="row"><button id="btnSaveBrand" type="button" class="btn-ghost btn-sm">Сохранить</button><button id="btnResetLogo" type="button" class="btn-ghost btn-sm">Вернуть логотип</button></div>
+</div>
+<div class="card"><h2 style="margin-top:0">Оформление экспорта</h2>
+<div class="field"><label>Название</label><input id="exBrand" placeholder="NODAX" maxlength="80"/></div>
+<div class="field"><label>Подпись внизу</label><input id="exFooter" placeholder="NODAX License Server" maxlength="80"/></div>
+<div class="field"><label>Цвет акцента</label><input id="exAccent" type="color" value="#0f766e"/></div>
+<div class="row"><button id="btnSaveExport" type="button" class="btn-ghost btn-sm">Сохранить</button></div>
+</div>
+<div class="card"><h2 style="margin-top:0">Тарифы</h2>
+<div class="field"><label>JSON: тариф → maxAgents (0 — без лимита), graceDays (пусто — LICENSE_GRACE_DAYS), priceYearly</label><textarea id="plansJson" rows="8" spellcheck="false" style="font-family:monospace"></textarea></div>
+<div class="row"><button id="btnSavePlans" type="button" class="btn-ghost btn-sm">Сохранить</button><button id="btnResetPlans" type="button" class="btn-ghost btn-sm">По умолчанию</button></div>
+</div>
 <div class="card"><h2 style="margin-top:0">API-ключи</h2>
 <div class="row" style="margin-bottom:8px">
 <input id="akName" placeholder="Название" style="flex:1"/><select id="akRole"><option value="readonly">readonly</option><option value="full">full</option></select>
+<input id="akMax" type="number" min="0" placeholder="Лимит лицензий (0 — без лимита)" title="Сколько активных лицензий может создать ключ" style="width:210px"/>
 <button id="btnCreateAK" type="button" class="btn btn-sm">Создать</button>
 </div>
 <div id="apiKeysList"></div>
@@ -493,6 +678,11 @@ tbody tr:hover{background:#f0f7ff}
 <div class="field"><label>Лимит</label><input id="edMaxAgents" type="number" min="0"/></div>
 <div class="field"><label>Комментарий</label><input id="edNotes"/></div>
 </div>
+<h3 style="margin:12px 0 6px;font-size:13px">История</h3>
+<div id="edHistory" class="muted" style="max-height:180px;overflow:auto;font-size:12px"></div>
+<h3 style="margin:12px 0 6px;font-size:13px">Развёртывания</h3>
+<div id="edDeployments" class="muted" style="max-height:180px;overflow:auto;font-size:12px"></div>
+<div id="edCreatedBy" class="muted" style="margin-top:8px;font-size:12px"></div>
 <div class="row" style="justify-content:flex-end;margin-top:12px">
 <button id="btnEdCancel" type="button" class="btn-ghost">Отмена</button>
 <button id="btnEdSave" type="button" class="btn">Сохранить</button>
@@ -501,7 +691,7 @@ tbody tr:hover{background:#f0f7ff}
 </div>
 <script>
 const $=id=>document.getElementById(id);const msg=$('msg');const loginMsg=$('loginMsg');
-let allItems=[],lastItems=[],curPage=0,pageSize=20,auditItems=[],auditPage=0;
+let allItems=[],lastItems=[],curPage=0,pageSize=20,auditItems=[],auditPage=0,auditTotal=0;
 
 function showMsg(t,e){if(msg){msg.textContent=t||'';msg.style.color=e?'#b91c1c':'#0f766e';}}
 function showLoginMsg(t,e){if(loginMsg){loginMsg.textContent=t||'';loginMsg.style.color=e?'#b91c1c':'#0f766e';}}
@@ -541,17 +731,30 @@ async function doChangePassword(){
   const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Ошибка');showMsg('Пароль изменен',false);$('oldPass').value='';$('newPass').value='';$('newPass2').value='';}catch(e){showMsg(e.message,true);}
 }
 
-function planLim(p){p=String(p||'').toLowerCase();return p==='pro'?30:p==='enterprise'?0:10;}
+let plansCfg={basic:{maxAgents:10},pro:{maxAgents:30},enterprise:{maxAgents:0}};
+function planLim(p){const c=plansCfg[String(p||'').toLowerCase()];return c?Number(c.maxAgents||0):0;}
+function planOptions(names){return names.map(n=>'<option value="'+esc(n)+'">'+esc(n)+'</option>').join('');}
+async function loadPlans(){
+  try{const r=await fetch('/api/v1/plans');const d=await r.json().catch(()=>({}));if(!r.ok)return;
+  plansCfg=d.plans||plansCfg;const names=Object.keys(plansCfg).sort();
+  if($('plan')){$('plan').innerHTML=planOptions(names);$('plan').value=d.defaultPlan||names[0]||'';applyPlanDef();}
+  if($('edPlan'))$('edPlan').innerHTML=planOptions(names);
+  if($('filterPlan')){const v=$('filterPlan').value;$('filterPlan').innerHTML='<option value="">Все тарифы</option>'+planOptions(names);$('filterPlan').value=names.includes(v)?v:'';}
+  if($('plansJson'))$('plansJson').value=JSON.stringify(plansCfg,null,2);}catch(_){}
+}
 function applyPlanDef(){const pi=$('plan'),ma=$('maxAgents');if(pi&&ma)ma.value=String(planLim(pi.value));
   const tr=$('isTrial');if(tr&&tr.value==='1'){$('validDays').value='14';}}
 function fmtExp(v){if(!v)return'';const t=Date.parse(v);if(!Number.isFinite(t))return esc(v);const d=Math.ceil((t-Date.now())/864e5);
   if(d>0)return esc(v.slice(0,10))+' <span class="muted">('+d+'д)</span>';if(d===0)return esc(v.slice(0,10))+' <span class="muted">(сегодня)</span>';
   return esc(v.slice(0,10))+' <span style="color:#dc2626">('+Math.abs(d)+'д назад)</span>';}
 
+// effStatus mirrors effectiveLicenseStatus on the server: an active license
+// past expiresAt counts as expired everywhere (filter, finance, charts).
+function effStatus(x){let st=String(x?.status||'').toLowerCase()||'active';if(st==='active'){const exp=Date.parse(x?.expiresAt||'');if(exp&&exp<Date.now())st='expired';}return st;}
 function getFiltered(){
   const q=($('searchInput')?.value||'').toLowerCase(),st=$('filterStatus')?.value||'',pl=$('filterPlan')?.value||'';
   return allItems.filter(x=>{
-    if(st&&String(x.status||'').toLowerCase()!==st)return false;
+    if(st&&effStatus(x)!==st)return false;
     if(pl&&String(x.plan||'').toLowerCase()!==pl)return false;
     if(q&&!(x.customerName||'').toLowerCase().includes(q)&&!(x.licenseKey||'').toLowerCase().includes(q)&&!(x.notes||'').toLowerCase().includes(q))return false;
     return true;
@@ -564,21 +767,23 @@ function renderLicenses(){
   const start=curPage*pageSize,slice=filtered.slice(start,start+pageSize);
   const body=$('licensesBody');
   body.innerHTML=slice.map(x=>{
-    const sc='s-'+((x.status||'unknown').toLowerCase());const rev=String(x.status||'').toLowerCase()==='revoked';
+    const est=effStatus(x);const sc='s-'+est;const rev=String(x.status||'').toLowerCase()==='revoked';
     const hostName=x.lastHostname?esc(x.lastHostname):'-';
     const hostIP=x.lastIP?esc(x.lastIP):'';
     const host='<div class="host-meta"><span class="host-name">'+hostName+'</span>'+(hostIP?'<span class="host-ip">'+hostIP+'</span>':'')+'</div>';
-    const ab=rev?'<button type="button" class="icon-btn restore" title="Восстановить" data-action="restore" data-id="'+esc(x.id)+'">↺</button>'
-      :'<button type="button" class="icon-btn revoke" title="Отозвать" data-action="revoke" data-id="'+esc(x.id)+'">⛔</button>';
+    const susp=est==='suspended'?'<button type="button" class="icon-btn restore" title="Возобновить" data-action="unsuspend" data-id="'+esc(x.id)+'">▶</button>'
+      :String(x.status||'active').toLowerCase()==='active'?'<button type="button" class="icon-btn extend" title="Приостановить" data-action="suspend" data-id="'+esc(x.id)+'">⏸</button>':'';
+    const ab=susp+(rev?'<button type="button" class="icon-btn restore" title="Восстановить" data-action="restore" data-id="'+esc(x.id)+'">↺</button>'
+      :'<button type="button" class="icon-btn revoke" title="Отозвать" data-action="revoke" data-id="'+esc(x.id)+'">⛔</button>');
     const trial=x.isTrial?' <span class="tag">trial</span>':'';
     const cname=esc(x.customerName)+(x.customerCompany?' <span class="muted">('+esc(x.customerCompany)+')</span>':'');
     const email=x.customerEmail?esc(x.customerEmail):'<span class="muted">-</span>';
     const tg=x.customerTelegram?esc(x.customerTelegram):'<span class="muted">-</span>';
     const phone=x.customerPhone?esc(x.customerPhone):'<span class="muted">-</span>';
-    return '<tr><td>'+cname+trial+'</td><td>'+email+'</td><td>'+tg+'</td><td>'+phone+'</td><td><code>'+esc(x.licenseKey)+'</code></td><td>'+esc(x.plan)+'</td><td><span class="status '+sc+'">'+esc(x.status)+'</span></td><td>'+fmtExp(x.expiresAt)+'</td><td>'+host+'</td><td><div class="action-row"><button type="button" class="icon-btn edit" title="Редактировать" data-action="edit" data-id="'+esc(x.id)+'">✎</button><button type="button" class="icon-btn extend" title="Продлить на 30 дней" data-action="extend" data-id="'+esc(x.id)+'">⏱</button>'+ab+'<button type="button" class="icon-btn delete" title="Удалить" data-action="delete" data-id="'+esc(x.id)+'">🗑</button></div></td></tr>';
+    return '<tr><td>'+cname+trial+'</td><td>'+email+'</td><td>'+tg+'</td><td>'+phone+'</td><td><code>'+esc(x.licenseKey)+'</code></td><td>'+esc(x.plan)+'</td><td><span class="status '+sc+'">'+esc(est)+'</span></td><td>'+fmtExp(x.expiresAt)+'</td><td>'+host+'</td><td><div class="action-row"><button type="button" class="icon-btn edit" title="Редактировать" data-action="edit" data-id="'+esc(x.id)+'">✎</button><button type="button" class="icon-btn extend" title="Продлить на 30 дней" data-action="extend" data-id="'+esc(x.id)+'">⏱</button><button type="button" class="icon-btn edit" title="Ссылка для входа клиента" data-action="client-link" data-id="'+esc(x.id)+'">🔗</button><button type="button" class="icon-btn edit" title="Офлайн-токен для central без доступа к серверу" data-action="offline-token" data-id="'+esc(x.id)+'">📄</button>'+ab+'<button type="button" class="icon-btn delete" title="Удалить" data-action="delete" data-id="'+esc(x.id)+'">🗑</button></div></td></tr>';
   }).join('');
   $('pgInfo').textContent='Стр. '+(curPage+1)+'/'+pages+' ('+total+')';
-  recomputeFinance(allItems);
+  drawCharts(allItems);
 }
 
 async function loadLicenses(){
@@ -602,22 +807,48 @@ async function createLicense(){
 async function licAction(id,action){
   if(action==='revoke'){if(!await askConfirm('Отозвать лицензию','Лицензия будет деактивирована. Можно вернуть позже.','warn'))return;}
   if(action==='restore'){if(!await askConfirm('Вернуть лицензию','Лицензия снова станет активной.','info'))return;}
+  if(action==='suspend'){if(!await askConfirm('Приостановить лицензию','Проверка лицензии будет отвечать suspended, пока её не возобновят.','warn'))return;}
   if(action==='delete'){if(!await askConfirm('Удалить лицензию','Лицензия будет удалена безвозвратно. Это действие нельзя отменить.','danger'))return;
     try{const r=await fetch('/api/v1/licenses/'+encodeURIComponent(id),{method:'DELETE'});const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');showMsg('Удалена',false);await loadLicenses();}catch(e){showMsg(e.message,true);}return;}
   if(action==='edit'){openEditModal(id);return;}
+  if(action==='client-link'){try{const r=await fetch('/api/v1/licenses/'+encodeURIComponent(id)+'/client-link',{method:'POST'});const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'HTTP '+r.status);
+    window.prompt('Одноразовая ссылка для входа клиента (действует до '+new Date(d.expiresAt).toLocaleString('ru-RU')+')',d.url);}catch(e){showMsg(e.message,true);}return;}
+  if(action==='offline-token'){const days=window.prompt('Срок действия офлайн-токена, дней (не дольше срока лицензии)','365');if(days===null)return;
+    try{const r=await fetch('/api/v1/licenses/'+encodeURIComponent(id)+'/offline-token',{method:'POST',headers:{'Content-Type':'application/json'},body:JSON.stringify({validDays:parseInt(days,10)||0})});const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'HTTP '+r.status);
+    window.prompt('Офлайн-токен (действует до '+new Date(d.validUntil).toLocaleString('ru-RU')+')',d.token);}catch(e){showMsg(e.message,true);}return;}
   try{const opts={method:'POST',headers:{'Content-Type':'application/json'}};
   if(action==='extend')opts.body=JSON.stringify({days:30});
   const r=await fetch('/api/v1/licenses/'+encodeURIComponent(id)+'/'+action,opts);
   const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'HTTP '+r.status);
-  showMsg(action==='extend'?'Продлена':action==='revoke'?'Отозвана':'Возвращена',false);await loadLicenses();}catch(e){showMsg(e.message,true);}
+  showMsg(action==='extend'?'Продлена':action==='revoke'?'Отозвана':action==='suspend'?'Приостановлена':action==='unsuspend'?'Возобновлена':'Возвращена',false);await loadLicenses();}catch(e){showMsg(e.message,true);}
+}
+
+async function importLicenses(){
+  const f=$('importFile').files[0];if(!f)return;$('importFile').value='';
+  const fd=new FormData();fd.append('file',f);
+  try{const r=await fetch('/api/v1/licenses/import',{method:'POST',body:fd});const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'HTTP '+r.status);
+    const bad=(d.results||[]).filter(x=>x.status==='error').slice(0,3).map(x=>'строка '+x.row+': '+x.error).join('; ');
+    showMsg('Импорт: создано '+d.created+', пропущено '+d.skipped+', ошибок '+d.failed+(bad?' ('+bad+')':''),d.failed>0);await loadLicenses();}catch(e){showMsg(e.message,true);}
 }
 
 function openEditModal(id){
   const lic=allItems.find(x=>x.id===id);if(!lic)return;
   $('edId').value=id;$('edCustomer').value=lic.customerName||'';$('edCompany').value=lic.customerCompany||'';
   $('edEmail').value=lic.customerEmail||'';$('edTg').value=lic.customerTelegram||'';$('edPhone').value=lic.customerPhone||'';
+  if(lic.plan&&![...$('edPlan').options].some(o=>o.value===lic.plan))$('edPlan').insertAdjacentHTML('beforeend',planOptions([lic.plan]));
   $('edPlan').value=lic.plan||'basic';$('edMaxAgents').value=String(lic.maxAgents||0);$('edNotes').value=lic.notes||'';
-  $('editModal').classList.add('show');
+  const by=lic.createdBy||'';$('edCreatedBy').textContent='Создал: '+(by.startsWith('apikey:')?'API-ключ '+by.slice(7):by==='admin'?'администратор':'неизвестно');
+  $('editModal').classList.add('show');loadLicenseHistory(id);loadLicenseDeployments(id);
+}
+async function loadLicenseHistory(id){
+  const box=$('edHistory');if(!box)return;box.textContent='Загрузка...';
+  try{const r=await fetch('/api/v1/licenses/'+encodeURIComponent(id)+'/audit');const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');
+  const items=d.items||[];box.innerHTML=items.length?items.map(x=>'<div>'+esc((x.createdAt||'').slice(0,19).replace('T',' '))+' <b>'+esc(x.action)+'</b> '+esc(x.actor)+(x.details?' — '+esc(x.details):'')+'</div>').join(''):'Нет событий';}catch(e){box.textContent=e.message;}
+}
+async function loadLicenseDeployments(id){
+  const box=$('edDeployments');if(!box)return;box.textContent='Загрузка...';
+  try{const r=await fetch('/api/v1/licenses/'+encodeURIComponent(id)+'/deployments');const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');
+  const items=d.items||[];box.innerHTML=items.length?items.map(x=>'<div><span class="status s-'+(['active','suspended','expired'].includes(x.status)?x.status:'revoked')+'">'+esc(x.status)+'</span> <b>'+esc(x.hostname||x.instance)+'</b>'+(x.ip?' '+esc(x.ip):'')+(x.version?' v'+esc(x.version):'')+' · агентов: '+esc(x.agentCount)+(x.reason&&x.reason!==x.status?' · '+esc(x.reason):'')+' · '+esc((x.lastSeenAt||'').slice(0,19).replace('T',' '))+'</div>').join(''):'Нет проверок за '+esc(d.staleAfterDays)+' дн.';}catch(e){box.textContent=e.message;}
 }
 async function saveEdit(){
   const id=$('edId').value;if(!id)return;
@@ -630,29 +861,29 @@ async function saveEdit(){
 function finCfg(){const b=Number($('priceBasic')?.value||0),p=Number($('pricePro')?.value||0),e=Number($('priceEnterprise')?.value||0);
   const c=String($('priceCurrency')?.value||'RUB').trim().toUpperCase()||'RUB';
   return{basic:b>=0?b:0,pro:p>=0?p:0,enterprise:e>=0?e:0,currency:c};}
-function saveFin(){localStorage.setItem('license_finance_cfg',JSON.stringify(finCfg()));recomputeFinance(allItems);showMsg('Цены сохранены',false);}
-function loadFin(){const raw=localStorage.getItem('license_finance_cfg');if(!raw){if($('priceBasic'))$('priceBasic').value='1000';if($('pricePro'))$('pricePro').value='3000';if($('priceEnterprise'))$('priceEnterprise').value='5000';if($('priceCurrency'))$('priceCurrency').value='RUB';return;}try{const c=JSON.parse(raw);
-  if($('priceBasic'))$('priceBasic').value=String(c.basic??0);if($('pricePro'))$('pricePro').value=String(c.pro??0);
-  if($('priceEnterprise'))$('priceEnterprise').value=String(c.enterprise??0);
-  const cur=String(c.currency||'').trim().toUpperCase();const m=!cur||cur==='USD'||cur==='$'?'RUB':cur;
-  if($('priceCurrency'))$('priceCurrency').value=m;if(m!==cur){c.currency=m;localStorage.setItem('license_finance_cfg',JSON.stringify(c));}}catch(_){}}
+function finSettings(c){return{price_basic:String(c.basic??0),price_pro:String(c.pro??0),price_enterprise:String(c.enterprise??0),price_currency:String(c.currency||'RUB')};}
+async function saveFin(){if(await saveSettings(finSettings(finCfg()))){localStorage.removeItem('license_finance_cfg');loadFin();}}
+async function loadFin(){
+  try{const r=await fetch('/api/v1/finance/summary');const d=await r.json().catch(()=>({}));if(!r.ok)return;
+    const raw=localStorage.getItem('license_finance_cfg');
+    if(!d.pricesConfigured&&raw){try{const c=JSON.parse(raw);const cur=String(c.currency||'').trim().toUpperCase();c.currency=!cur||cur==='USD'||cur==='$'?'RUB':cur;
+      const m=await fetch('/api/v1/settings',{method:'POST',headers:{'Content-Type':'application/json'},body:JSON.stringify(finSettings(c))});
+      if(m.ok){localStorage.removeItem('license_finance_cfg');return loadFin();}}catch(_){}}
+    const pr=d.prices||{};
+    if($('priceBasic'))$('priceBasic').value=String(pr.basic??0);if($('pricePro'))$('pricePro').value=String(pr.pro??0);
+    if($('priceEnterprise'))$('priceEnterprise').value=String(pr.enterprise??0);if($('priceCurrency'))$('priceCurrency').value=d.currency||'RUB';
+    const c=d.currency||'RUB';
+    if($('kpiActive'))$('kpiActive').textContent=String(d.active||0);if($('kpiMRR'))$('kpiMRR').textContent=money(d.mrr||0,c);
+    if($('kpiARR'))$('kpiARR').textContent=money(d.arr||0,c);if($('kpiARPL'))$('kpiARPL').textContent=money(d.arpl||0,c);
+  }catch(_){}}
 function money(v,c){return new Intl.NumberFormat('ru-RU',{style:'currency',currency:c,maximumFractionDigits:0}).format(v);}
-function recomputeFinance(items){
-  const cfg=finCfg();const active=(items||[]).filter(x=>String(x?.status||'').toLowerCase()==='active');
-  let arr=0;for(const x of active){const p=String(x?.plan||'').toLowerCase();arr+=p==='pro'?cfg.pro:p==='enterprise'?cfg.enterprise:cfg.basic;}
-  const cnt=active.length,mrr=arr/12,arpl=cnt>0?(arr/cnt):0;
-  if($('kpiActive'))$('kpiActive').textContent=String(cnt);if($('kpiMRR'))$('kpiMRR').textContent=money(mrr,cfg.currency);
-  if($('kpiARR'))$('kpiARR').textContent=money(arr,cfg.currency);if($('kpiARPL'))$('kpiARPL').textContent=money(arpl,cfg.currency);
-  drawCharts(items);
-}
 
 function drawCharts(items){
-  const plans={basic:0,pro:0,enterprise:0};const statuses={active:0,revoked:0,expired:0};
+  const plans={basic:0,pro:0,enterprise:0};const statuses={active:0,suspended:0,revoked:0,expired:0};
   for(const x of(items||[])){const p=String(x.plan||'basic').toLowerCase();plans[p]=(plans[p]||0)+1;
-    let st=String(x.status||'').toLowerCase();if(st==='active'){const exp=Date.parse(x.expiresAt||'');if(exp&&exp<Date.now())st='expired';}
-    statuses[st]=(statuses[st]||0)+1;}
+    const st=effStatus(x);statuses[st]=(statuses[st]||0)+1;}
   drawDonut($('chartDonut'),plans,{basic:'#0891b2',pro:'#0f766e',enterprise:'#6366f1'});
-  drawDonut($('chartStatus'),statuses,{active:'#16a34a',revoked:'#dc2626',expired:'#d97706'});
+  drawDonut($('chartStatus'),statuses,{active:'#16a34a',suspended:'#6366f1',revoked:'#dc2626',expired:'#d97706'});
 }
 function drawDonut(canvas,data,colors){
   if(!canvas)return;const ctx=canvas.getContext('2d');const w=canvas.width,h=canvas.height;ctx.clearRect(0,0,w,h);
@@ -667,44 +898,66 @@ function drawDonut(canvas,data,colors){
 }
 
 async function loadAudit(){
-  try{const r=await fetch('/api/v1/audit');const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');
-  auditItems=d.items||[];renderAudit();}catch(e){showMsg(e.message,true);}
+  if(auditPage<0)auditPage=0;
+  try{const r=await fetch('/api/v1/audit?offset='+(auditPage*pageSize)+'&limit='+pageSize);const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');
+  auditItems=d.items||[];auditTotal=d.total||0;
+  if(auditPage>0&&!auditItems.length&&auditTotal){auditPage=Math.ceil(auditTotal/pageSize)-1;return loadAudit();}
+  renderAudit();}catch(e){showMsg(e.message,true);}
+}
+async function verifyAuditExport(){
+  const f=$('auditVerifyFile').files[0];if(!f)return;$('auditVerifyFile').value='';
+  try{const r=await fetch('/api/v1/audit/verify',{method:'POST',headers:{'Content-Type':'application/json'},body:await f.text()});const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'HTTP '+r.status);
+    showMsg(d.valid?'Подпись верна'+(d.events!=null?': '+d.events+' событий ('+String(d.format||'').toUpperCase()+')':''):'Подпись не прошла проверку ('+d.reason+')',!d.valid);}catch(e){showMsg(e.message,true);}
 }
 function renderAudit(){
-  const total=auditItems.length;const pages=Math.max(1,Math.ceil(total/pageSize));
-  if(auditPage>=pages)auditPage=pages-1;if(auditPage<0)auditPage=0;
-  const s=auditPage*pageSize,slice=auditItems.slice(s,s+pageSize);
+  const total=auditTotal;const pages=Math.max(1,Math.ceil(total/pageSize));
+  const slice=auditItems;
   $('auditBody').innerHTML=slice.map(x=>'<tr><td>'+esc((x.createdAt||'').slice(0,19).replace('T',' '))+'</td><td><b>'+esc(x.action)+'</b></td><td><code>'+esc((x.licenseId||'').slice(0,8))+'</code></td><td>'+esc(x.actor)+'</td><td class="muted">'+esc(x.details)+'</td></tr>').join('');
   $('auditInfo').textContent='Стр. '+(auditPage+1)+'/'+pages+' ('+total+')';
 }
 
 async function loadSettings(){
-  try{const r=await fetch('/api/v1/settings');const d=await r.json().catch(()=>({}));
-  if($('tgToken'))$('tgToken').value=d.telegram_bot_token||'';if($('tgChat'))$('tgChat').value=d.telegram_chat_id||'';
-  if($('tgDays'))$('tgDays').value=d.notify_days_before||'7';if($('whUrl'))$('whUrl').value=d.webhook_url||'';}catch(_){}
+  try{const r=await fetch('/api/v1/settings');const d=await r.json().catch(()=>({}));fillSettings(d);}catch(_){}
 }
 async function saveSettings(obj){
   try{const r=await fetch('/api/v1/settings',{method:'POST',headers:{'Content-Type':'application/json'},body:JSON.stringify(obj)});
-  const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');showMsg('Сохранено',false);}catch(e){showMsg(e.message,true);}
+  const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');showMsg('Сохранено',false);return true;}catch(e){showMsg(e.message,true);return false;}
 }
 async function loadAPIKeys(){
-  try{const r=await fetch('/api/v1/api-keys');const d=await r.json().catch(()=>({}));
-  const keys=d.items||[];$('apiKeysList').innerHTML=keys.length?keys.map(k=>
-    '<div class="row" style="margin-bottom:6px;font-size:12px"><b>'+esc(k.name)+'</b> <code>'+esc(k.key)+'</code> <span class="tag">'+esc(k.role)+'</span> <button type="button" class="btn-danger btn-xs" data-delkey="'+esc(k.id)+'">X</button></div>'
-  ).join(''):'<div class="muted">Нет API-ключей</div>';}catch(_){}
+  try{const r=await fetch('/api/v1/api-keys');const d=await r.json().catch(()=>({}));renderAPIKeys(d.items||[]);}catch(_){}
 }
 async function createAPIKey(){
-  const name=($('akName')?.value||'').trim(),role=$('akRole')?.value||'readonly';
+  const name=($('akName')?.value||'').trim(),role=$('akRole')?.value||'readonly',maxLicenses=parseInt($('akMax')?.value||'0',10)||0;
   if(!name){showMsg('Укажите имя ключа',true);return;}
-  try{const r=await fetch('/api/v1/api-keys',{method:'POST',headers:{'Content-Type':'application/json'},body:JSON.stringify({name,role})});
-  const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');showMsg('Ключ создан: '+d.key,false);$('akName').value='';loadAPIKeys();}catch(e){showMsg(e.message,true);}
+  try{const r=await fetch('/api/v1/api-keys',{method:'POST',headers:{'Content-Type':'application/json'},body:JSON.stringify({name,role,maxLicenses})});
+  const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');showMsg('Ключ создан: '+d.key,false);$('akName').value='';$('akMax').value='';loadAPIKeys();}catch(e){showMsg(e.message,true);}
+}
+async function editAPIKeyQuota(id,cur){
+  const v=window.prompt('Сколько активных лицензий может создать ключ (0 — без лимита)',String(cur||0));if(v===null)return;
+  try{const r=await fetch('/api/v1/api-keys/'+encodeURIComponent(id),{method:'PATCH',headers:{'Content-Type':'application/json'},body:JSON.stringify({maxLicenses:parseInt(v,10)||0})});
+  const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');showMsg('Сохранено',false);loadAPIKeys();}catch(e){showMsg(e.message,true);}
 }
 async function deleteAPIKey(id){
   if(!await askConfirm('Удалить API-ключ','Ключ будет удалён и перестанет работать.','danger'))return;
   try{await fetch('/api/v1/api-keys/'+encodeURIComponent(id),{method:'DELETE'});loadAPIKeys();}catch(_){}
 }
 
-function loadAll(){loadFin();loadLicenses();loadAudit();loadSettings();loadAPIKeys();}
+function fillSettings(d){
+  if($('tgToken'))$('tgToken').value=d.telegram_bot_token||'';if($('tgChat'))$('tgChat').value=d.telegram_chat_id||'';if($('tgAutocapture'))$('tgAutocapture').value=d.telegram_chat_autocapture==='true'?'true':'false';
+  if($('tgDays'))$('tgDays').value=d.notify_days_before||'7';if($('tgLang'))$('tgLang').value=d.notify_language||'ru';if($('tgQuiet'))$('tgQuiet').value=d.notify_quiet_hours||'';if($('tgTz'))$('tgTz').value=d.notify_timezone||'';if($('whUrl'))$('whUrl').value=d.webhook_url||'';if($('whSecret'))$('whSecret').value=d.webhook_secret||'';if($('whRetries'))$('whRetries').value=d.webhook_retries||'3';
+  if($('brName'))$('brName').value=d.brand_name||'';if($('brAccent')){$('brAccent').value=d.brand_accent_color||'#16a2a7';$('brAccent').dataset.set=d.brand_accent_color?'1':'';}
+  if($('exBrand'))$('exBrand').value=d.export_brand_name||'';if($('exFooter'))$('exFooter').value=d.export_brand_footer||'';if($('exAccent'))$('exAccent').value=d.export_accent_color||'#0f766e';
+}
+function renderAPIKeys(keys){
+  $('apiKeysList').innerHTML=keys.length?keys.map(k=>
+    '<div class="row" style="margin-bottom:6px;font-size:12px"><b>'+esc(k.name)+'</b> <code>'+esc(k.key)+'</code> <span class="tag">'+esc(k.role)+'</span> <span class="muted" title="Активные лицензии, созданные ключом">'+esc(k.activeLicenses||0)+' / '+(k.maxLicenses?esc(k.maxLicenses):'∞')+'</span> <button type="button" class="btn-ghost btn-xs" data-quotakey="'+esc(k.id)+'" data-quota="'+esc(k.maxLicenses||0)+'">Лимит</button> <button type="button" class="btn-danger btn-xs" data-delkey="'+esc(k.id)+'">X</button></div>'
+  ).join(''):'<div class="muted">Нет API-ключей</div>';
+}
+async function loadDashboard(){
+  try{const r=await fetch('/api/v1/dashboard');const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');
+  fillSettings(d.settings||{});renderAPIKeys(d.apiKeys||[]);}catch(e){showMsg(e.message,true);}
+}
+function loadAll(){loadPlans();loadLicenses();loadAudit();loadDashboard();loadFin();}
 
 // Event listeners
 document.querySelectorAll('.tab').forEach(tab=>tab.addEventListener('click',()=>{
@@ -725,12 +978,17 @@ $('loginPass')?.addEventListener('keydown',e=>{if(e.key==='Enter')doLogin();});
 $('btnLogout')?.addEventListener('click',doLogout);
 $('btnCreate')?.addEventListener('click',createLicense);
 $('btnRefresh')?.addEventListener('click',loadLicenses);
+$('btnImport')?.addEventListener('click',()=>$('importFile')?.click());
+$('importFile')?.addEventListener('change',importLicenses);
 $('btnExportToggle')?.addEventListener('click',e=>{e.stopPropagation();$('exportMenu').classList.toggle('show');});
 document.addEventListener('click',()=>$('exportMenu')?.classList.remove('show'));
-$('exportMenu')?.addEventListener('click',e=>{const a=e.target.closest('[data-fmt]');if(!a)return;const fmt=a.getAttribute('data-fmt');window.open('/api/v1/licenses/export?format='+fmt,'_blank');$('exportMenu').classList.remove('show');});
+$('exportMenu')?.addEventListener('click',e=>{const a=e.target.closest('[data-fmt]');if(!a)return;const fmt=a.getAttribute('data-fmt');const p=new URLSearchParams({format:fmt});const st=$('filterStatus')?.value||'',pl=$('filterPlan')?.value||'',q=($('searchInput')?.value||'').trim();if(st)p.set('status',st);if(pl)p.set('plan',pl);if(q)p.set('q',q);window.open('/api/v1/licenses/export?'+p,'_blank');$('exportMenu').classList.remove('show');});
 $('btnSaveFinance')?.addEventListener('click',saveFin);
 $('btnChangePass')?.addEventListener('click',doChangePassword);
 $('btnRefreshAudit')?.addEventListener('click',loadAudit);
+$('btnAuditExport')?.addEventListener('click',()=>window.open('/api/v1/audit/export?format='+$('auditFmt').value+'&sign='+$('auditSign').value,'_blank'));
+$('btnAuditVerify')?.addEventListener('click',()=>$('auditVerifyFile')?.click());
+$('auditVerifyFile')?.addEventListener('change',verifyAuditExport);
 $('plan')?.addEventListener('change',applyPlanDef);
 $('isTrial')?.addEventListener('change',applyPlanDef);
 $('searchInput')?.addEventListener('input',()=>{curPage=0;renderLicenses();});
@@ -738,8 +996,8 @@ $('filterStatus')?.addEventListener('change',()=>{curPage=0;renderLicenses();});
 $('filterPlan')?.addEventListener('change',()=>{curPage=0;renderLicenses();});
 $('pgPrev')?.addEventListener('click',()=>{curPage--;renderLicenses();});
 $('pgNext')?.addEventListener('click',()=>{curPage++;renderLicenses();});
-$('auditPrev')?.addEventListener('click',()=>{auditPage--;renderAudit();});
-$('auditNext')?.addEventListener('click',()=>{auditPage++;renderAudit();});
+$('auditPrev')?.addEventListener('click',()=>{if(auditPage>0){auditPage--;loadAudit();}});
+$('auditNext')?.addEventListener('click',()=>{if((auditPage+1)*pageSize<auditTotal){auditPage++;loadAudit();}});
 $('btnEdCancel')?.addEventListener('click',()=>$('editModal').classList.remove('show'));
 $('btnEdSave')?.addEventListener('click',saveEdit);
 $('editModal')?.addEventListener('click',e=>{if(e.target===$('editModal'))$('editModal').classList.remove('show');});
@@ -747,14 +1005,37 @@ $('confirmYes')?.addEventListener('click',()=>closeConfirm(true));
 $('confirmNo')?.addEventListener('click',()=>closeConfirm(false));
 $('confirmModal')?.addEventListener('click',e=>{if(e.target===$('confirmModal'))closeConfirm(false);});
 $('btnCreateAK')?.addEventListener('click',createAPIKey);
-$('apiKeysList')?.addEventListener('click',e=>{const btn=e.target.closest('[data-delkey]');if(btn)deleteAPIKey(btn.getAttribute('data-delkey'));});
+$('apiKeysList')?.addEventListener('click',e=>{const btn=e.target.closest('[data-delkey]');if(btn)deleteAPIKey(btn.getAttribute('data-delkey'));
+  const q=e.target.closest('[data-quotakey]');if(q)editAPIKeyQuota(q.getAttribute('data-quotakey'),q.getAttribute('data-quota'));});
 $('btnSaveTg')?.addEventListener('click',async()=>{
-  const payload={telegram_bot_token:$('tgToken').value.trim(),notify_days_before:$('tgDays').value.trim(),webhook_url:$('whUrl')?.value.trim()||''};
+  const payload={telegram_bot_token:$('tgToken').value.trim(),notify_days_before:$('tgDays').value.trim(),notify_language:$('tgLang')?.value||'ru',notify_quiet_hours:$('tgQuiet')?.value.trim()||'',notify_timezone:$('tgTz')?.value.trim()||'',telegram_chat_autocapture:$('tgAutocapture')?.value||'false',webhook_url:$('whUrl')?.value.trim()||'',webhook_secret:$('whSecret')?.value.trim()||'',webhook_retries:$('whRetries')?.value.trim()||''};
   const chat=($('tgChat')?.value||'').trim();
   if(chat)payload.telegram_chat_id=chat;
   await saveSettings(payload);
   await loadSettings();
 });
+$('brAccent')?.addEventListener('input',()=>{$('brAccent').dataset.set='1';});
+$('btnResetAccent')?.addEventListener('click',()=>{$('brAccent').value='#16a2a7';$('brAccent').dataset.set='';});
+$('btnSaveBrand')?.addEventListener('click',async()=>{
+  const f=$('brLogo')?.files?.[0];
+  if(f){try{const r=await fetch('/api/v1/branding/logo',{method:'POST',body:f});const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'HTTP '+r.status);$('brLogo').value='';}catch(e){showMsg(e.message,true);return;}}
+  if(await saveSettings({brand_name:$('brName').value.trim(),brand_accent_color:$('brAccent').dataset.set?$('brAccent').value:''}))location.reload();
+});
+$('btnResetLogo')?.addEventListener('click',async()=>{try{const r=await fetch('/api/v1/branding/logo',{method:'DELETE'});const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'HTTP '+r.status);location.reload();}catch(e){showMsg(e.message,true);}});
+$('btnSavePlans')?.addEventListener('click',async()=>{
+  let plans;try{plans=JSON.parse($('plansJson').value||'{}');}catch(e){showMsg('Некорректный JSON: '+e.message,true);return;}
+  try{const r=await fetch('/api/v1/plans',{method:'PUT',headers:{'Content-Type':'application/json'},body:JSON.stringify(plans)});const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');showMsg('Сохранено',false);loadPlans();}catch(e){showMsg(e.message,true);}
+});
+$('btnResetPlans')?.addEventListener('click',async()=>{
+  if(!await askConfirm('Тарифы по умолчанию','Таблица тарифов вернётся к basic/pro/enterprise.','danger'))return;
+  try{const r=await fetch('/api/v1/plans',{method:'DELETE'});const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');showMsg('Сохранено',false);loadPlans();}catch(e){showMsg(e.message,true);}
+});
+$('btnSaveExport')?.addEventListener('click',async()=>{
+  await saveSettings({export_brand_name:$('exBrand').value.trim(),export_brand_footer:$('exFooter').value.trim(),export_accent_color:$('exAccent').value});
+  await loadSettings();
+});
+$('btnGenWhSecret')?.addEventListener('click',()=>{const b=new Uint8Array(32);crypto.getRandomValues(b);$('whSecret').value=Array.from(b,x=>x.toString(16).padStart(2,'0')).join('');});
+$('btnTestWh')?.addEventListener('click',async()=>{try{const r=await fetch('/api/v1/test-webhook',{method:'POST'});const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');showMsg('Webhook OK',false);}catch(e){showMsg(e.message,true);}});
 $('btnTestTg')?.addEventListener('click',async()=>{try{const r=await fetch('/api/v1/test-telegram',{method:'POST'});const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');showMsg('Telegram OK',false);await loadSettings();}catch(e){showMsg(e.message,true);}});
 $('btnBroadcastClients')?.addEventListener('click',async()=>{
   const message=($('tgBroadcastMsg')?.value||'').trim();
@@ -771,7 +1052,8 @@ $('btnBackup')?.addEventListener('click',()=>{window.open('/api/v1/backup','_bla
 $('btnRestoreBtn')?.addEventListener('click',()=>$('restoreFile').click());
 $('restoreFile')?.addEventListener('change',async e=>{
   const f=e.target.files[0];if(!f)return;if(!await askConfirm('Восстановить БД','Все текущие данные будут перезаписаны из файла бэкапа. Продолжить?','danger'))return;
-  try{const body=await f.text();const r=await fetch('/api/v1/restore',{method:'POST',headers:{'Content-Type':'application/json'},body});
+  const pw=prompt('Введите пароль администратора для подтверждения');if(pw===null){$('restoreFile').value='';return;}
+  try{const body=await f.text();const r=await fetch('/api/v1/restore',{method:'POST',headers:{'Content-Type':'application/json','X-Confirm-Password':pw},body});
   const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||'Err');showMsg('БД восстановлена',false);loadAll();}catch(e2){showMsg(e2.message,true);}
   $('restoreFile').value='';
 });
@@ -791,7 +1073,7 @@ const clientPageHTML = `<!doctype html>
 <head>
 <meta charset="UTF-8"/>
 <meta name="viewport" content="width=device-width,initial-scale=1.0"/>
-<title>NODAX Client License</title>
+<title>{{BRAND_NAME}} Client License</title>
 <style>
 *{box-sizing:border-box}body{margin:0;font-family:Inter,Segoe UI,sans-serif;background:linear-gradient(135deg,#2d6a4f 0%,#52b69a 60%,#1a8a8a 100%);min-height:100vh}
 .wrap{max-width:920px;margin:28px auto;padding:0 14px}.card{background:#fff;border-radius:14px;padding:18px 20px;box-shadow:0 12px 28px rgba(15,23,42,.18);margin-bottom:14px}
@@ -802,15 +1084,16 @@ h1{margin:0 0 12px;color:#fff;font-size:24px;text-shadow:0 1px 6px rgba(0,0,0,.3
 label{font-size:12px;font-weight:600;color:#475569}input{border:1px solid #dbe1e8;border-radius:8px;padding:9px 10px;font-size:13px}
 button{border:none;border-radius:8px;padding:9px 13px;font-weight:600;cursor:pointer}.btn{background:#0f766e;color:#fff}.btn2{background:#e2e8f0;color:#334155}
 .kv{display:grid;grid-template-columns:200px 1fr;gap:8px;font-size:13px}.muted{color:#64748b}.status{display:inline-block;padding:3px 9px;border-radius:999px;font-size:11px;font-weight:700}
-.s-active{background:#dcfce7;color:#166534}.s-revoked{background:#fee2e2;color:#991b1b}.s-expired{background:#fef3c7;color:#92400e}.s-unknown{background:#e2e8f0;color:#334155}
+.s-active{background:#dcfce7;color:#166534}.s-revoked{background:#fee2e2;color:#991b1b}.s-suspended{background:#e0e7ff;color:#3730a3}.s-expired{background:#fef3c7;color:#92400e}.s-unknown{background:#e2e8f0;color:#334155}
 .msg{font-size:12px;margin-top:8px;color:#0f766e}.msg.err{color:#b91c1c}
 .tip{font-size:12px;color:#475569;background:#f8fafc;border:1px solid #e2e8f0;border-radius:8px;padding:10px 12px;margin-top:12px}
 .tip .row{margin-top:8px}
 </style>
+{{BRAND_STYLE}}
 </head>
 <body>
 <div class="wrap">
-<div class="brand"><img src="/assets/logo" alt="NODAX"/></div>
+<div class="brand"><img src="/assets/logo" alt="{{BRAND_NAME}}"/></div>
 <h1>Кабинет лицензии</h1>
 <div id="loginCard" class="card">
   <h2>Вход</h2>
@@ -818,6 +1101,7 @@ button{border:none;border-radius:8px;padding:9px 13px;font-weight:600;cursor:poi
     <div class="field"><label>License Key</label><input id="lk" placeholder="NDX-..."/></div>
     <div class="field"><label>Email</label><input id="em" placeholder="you@company.com"/></div>
   </div>
+  <div id="captchaBox" style="margin-top:10px"></div>
   <div class="row" style="margin-top:10px"><button id="btnLoginClient" class="btn">Войти</button></div>
   <div id="loginMsgClient" class="msg"></div>
 </div>
@@ -875,8 +1159,21 @@ function render(d){
 }
 function setAuth(a){$('loginCard').style.display=a?'none':'block';$('appCard').style.display=a?'block':'none';}
 async function api(u,o){const r=await fetch(u,o);const d=await r.json().catch(()=>({}));if(!r.ok)throw new Error(d.error||('HTTP '+r.status));return d;}
-async function check(){try{const d=await api('/api/v1/client/auth/me');if(d.authenticated){botUsername=d.botUsername||'';setAuth(true);render(d.license);}else setAuth(false);}catch(_){setAuth(false);}}
-$('btnLoginClient').addEventListener('click',async()=>{try{const d=await api('/api/v1/client/auth/login',{method:'POST',headers:{'Content-Type':'application/json'},body:JSON.stringify({licenseKey:$('lk').value.trim(),email:$('em').value.trim()})});botUsername=d.botUsername||'';setAuth(true);render(d.license);msg($('loginMsgClient'),'');}catch(e){msg($('loginMsgClient'),e.message,true);}});
+let captcha=null;
+function setupCaptcha(c){
+  if(!c||captcha)return;captcha=c;
+  const box=$('captchaBox');box.innerHTML='';
+  const el=document.createElement('div');el.className=c.provider==='hcaptcha'?'h-captcha':'cf-turnstile';el.setAttribute('data-sitekey',c.siteKey);box.appendChild(el);
+  const sc=document.createElement('script');sc.async=true;sc.src=c.provider==='hcaptcha'?'https://js.hcaptcha.com/1/api.js':'https://challenges.cloudflare.com/turnstile/v0/api.js';document.head.appendChild(sc);
+}
+function captchaToken(){const i=document.querySelector('[name="cf-turnstile-response"],[name="h-captcha-response"]');return i?i.value:'';}
+function resetCaptcha(){if(!captcha)return;try{if(captcha.provider==='hcaptcha'&&window.hcaptcha)hcaptcha.reset();else if(window.turnstile)turnstile.reset();}catch(_){}}
+async function check(){
+  const tok=new URLSearchParams(location.search).get('token');
+  if(tok){history.replaceState(null,'',location.pathname);
+    try{const d=await api('/api/v1/client/auth/token',{method:'POST',headers:{'Content-Type':'application/json'},body:JSON.stringify({token:tok})});botUsername=d.botUsername||'';setAuth(true);render(d.license);return;}catch(e){msg($('loginMsgClient'),e.message,true);}}
+  try{const d=await api('/api/v1/client/auth/me');if(d.authenticated){botUsername=d.botUsername||'';setAuth(true);render(d.license);}else{setupCaptcha(d.captcha);setAuth(false);}}catch(_){setAuth(false);}}
+$('btnLoginClient').addEventListener('click',async()=>{try{const d=await api('/api/v1/client/auth/login',{method:'POST',headers:{'Content-Type':'application/json'},body:JSON.stringify({licenseKey:$('lk').value.trim(),email:$('em').value.trim(),captchaToken:captchaToken()})});botUsername=d.botUsername||'';setAuth(true);render(d.license);msg($('loginMsgClient'),'');}catch(e){resetCaptcha();msg($('loginMsgClient'),e.message,true);}});
 $('btnLogoutClient').addEventListener('click',async()=>{await fetch('/api/v1/client/auth/logout',{method:'POST'}).catch(()=>{});setAuth(false);});
 $('btnSaveClient').addEventListener('click',async()=>{try{const d=await api('/api/v1/client/license',{method:'PATCH',headers:{'Content-Type':'application/json'},body:JSON.stringify({customerEmail:$('cEmail').value.trim(),customerTelegram:$('cTg').value.trim(),customerPhone:$('cPhone').value.trim()})});botUsername=d.botUsername||botUsername;render(d.license);msg($('appMsgClient'),'Сохранено');}catch(e){msg($('appMsgClient'),e.message,true);}});
 check();
@@ -884,15 +1181,51 @@ check();
 </body>
 </html>`
 
+// Page sizes for GET /api/v1/licenses. Without ?pageSize the whole list fits
+// on page 1, as before paging existed.
+const (
+	defaultLicensePageSize = 100000
+	maxLicensePageSize     = 1000
+)
+
+// licenseFilterFromQuery reads the status, plan and q filters shared by the
+// license list and export.
+func licenseFilterFromQuery(q url.Values) LicenseFilter {
+	return LicenseFilter{
+		Status:    strings.ToLower(strings.TrimSpace(q.Get("status"))),
+		Plan:      strings.ToLower(strings.TrimSpace(q.Get("plan"))),
+		Query:     strings.TrimSpace(q.Get("q")),
+		CreatedBy: strings.TrimSpace(q.Get("createdBy")),
+	}
+}
+
 func (s *Server) handleLicenses(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		list, err := s.store.ListLicenses()
+		q := r.URL.Query()
+		page, pageSize := 1, defaultLicensePageSize
+		if v := strings.TrimSpace(q.Get("page")); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				httpErr(w, fmt.Errorf("page must be a positive integer"), 400)
+				return
+			}
+			page = n
+		}
+		if v := strings.TrimSpace(q.Get("pageSize")); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxLicensePageSize {
+				httpErr(w, fmt.Errorf("pageSize must be between 1 and %d", maxLicensePageSize), 400)
+				return
+			}
+			pageSize = n
+		}
+		items, total, err := s.store.QueryLicenses(licenseFilterFromQuery(q), page, pageSize, time.Now().UTC())
 		if err != nil {
 			httpErr(w, err, 500)
 			return
 		}
-		respondJSON(w, 200, map[string]any{"items": list})
+		respondJSON(w, 200, map[string]any{"items": items, "total": total, "page": page, "pageSize": pageSize})
 	case http.MethodPost:
 		var req struct {
 			CustomerName     string `json:"customerName"`
@@ -905,6 +1238,7 @@ func (s *Server) handleLicenses(w http.ResponseWriter, r *http.Request) {
 			ValidDays        int    `json:"validDays"`
 			ExpiresAt        string `json:"expiresAt"`
 			Notes            string `json:"notes"`
+			Language         string `json:"language"`
 		}
 		if err := decodeJSON(r, &req); err != nil {
 			httpErr(w, fmt.Errorf("invalid body: %w", err), 400)
@@ -915,13 +1249,21 @@ func (s *Server) handleLicenses(w http.ResponseWriter, r *http.Request) {
 			httpErr(w, fmt.Errorf("customerName is required"), 400)
 			return
 		}
+		if strings.TrimSpace(req.Language) != "" && normalizeNotifyLanguage(req.Language) == "" {
+			httpErr(w, fmt.Errorf("language: unsupported %q", req.Language), 400)
+			return
+		}
 		if strings.TrimSpace(req.Plan) == "" {
-			req.Plan = "basic"
+			req.Plan = s.defaultPlan()
 		}
 		req.Plan = strings.ToLower(strings.TrimSpace(req.Plan))
-		req.MaxAgents = defaultMaxAgentsByPlan(req.Plan)
+		if !s.isKnownPlan(req.Plan) {
+			httpErr(w, fmt.Errorf("plan: unknown plan %q", req.Plan), 400)
+			return
+		}
+		req.MaxAgents = s.planMaxAgents(req.Plan)
 
-		expires := time.Now().UTC().AddDate(0, 0, 365)
+		expires := time.Now().UTC().AddDate(0, 0, s.defaultValidDays())
 		if req.ValidDays > 0 {
 			expires = time.Now().UTC().AddDate(0, 0, req.ValidDays)
 		}
@@ -937,7 +1279,7 @@ func (s *Server) handleLicenses(w http.ResponseWriter, r *http.Request) {
 		now := time.Now().UTC().Format(time.RFC3339)
 		lic := &License{
 			ID:               randomHex(16),
-			LicenseKey:       generateLicenseKey(),
+			LicenseKey:       s.newLicenseKey(),
 			CustomerName:     strings.TrimSpace(req.CustomerName),
 			CustomerEmail:    strings.TrimSpace(req.CustomerEmail),
 			CustomerTelegram: strings.TrimSpace(req.CustomerTelegram),
@@ -948,10 +1290,38 @@ func (s *Server) handleLicenses(w http.ResponseWriter, r *http.Request) {
 			ExpiresAt:        expires.Format(time.RFC3339),
 			Status:           "active",
 			Notes:            strings.TrimSpace(req.Notes),
+			Language:         normalizeNotifyLanguage(req.Language),
 			CreatedAt:        now,
 			UpdatedAt:        now,
+			CreatedBy:        requestIdentity(r).label(),
+		}
+		ak := requestIdentity(r).APIKey
+		if ak != nil {
+			lic.CreatedByKey = ak.ID
+		}
+		s.quotaMu.Lock()
+		left, err := s.apiKeyQuotaLeft(ak)
+		if err == nil && left == 0 {
+			err = apiKeyQuotaError(ak)
+		}
+		if err == nil {
+			// A generated key can collide with an existing one; draw a new key a few times.
+			err = s.store.CreateLicense(lic)
+			for attempt := 1; errors.Is(err, errLicenseKeyTaken) && attempt < maxKeyGenerateAttempts; attempt++ {
+				lic.LicenseKey = s.newLicenseKey()
+				err = s.store.CreateLicense(lic)
+			}
+		}
+		s.quotaMu.Unlock()
+		if errors.Is(err, errAPIKeyQuota) {
+			httpErr(w, err, 403)
+			return
 		}
-		if err := s.store.CreateLicense(lic); err != nil {
+		if errors.Is(err, errLicenseKeyTaken) {
+			httpErr(w, fmt.Errorf("could not generate a unique license key, consider a longer key format"), 409)
+			return
+		}
+		if err != nil {
 			httpErr(w, err, 500)
 			return
 		}
@@ -959,8 +1329,8 @@ func (s *Server) handleLicenses(w http.ResponseWriter, r *http.Request) {
 			ID:        randomHex(16),
 			LicenseID: lic.ID,
 			Action:    "create",
-			Actor:     "admin",
-			Details:   fmt.Sprintf("plan=%s maxAgents=%d", lic.Plan, lic.MaxAgents),
+			Actor:     requestIdentity(r).label(),
+			Details:   fmt.Sprintf("plan=%s maxAgents=%d", lic.Plan, lic.MaxAgents) + createdByDetails(ak),
 			CreatedAt: now,
 		})
 		respondJSON(w, 201, lic)
@@ -1016,9 +1386,14 @@ func (s *Server) handleLicenseExtend(w http.ResponseWriter, r *http.Request) {
 		base = base.AddDate(0, 0, req.Days)
 	}
 
+	prev := *lic
 	lic.ExpiresAt = base.Format(time.RFC3339)
 	lic.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
-	if err := s.store.UpdateLicense(lic); err != nil {
+	if err := s.updateLicenseWithinQuota(&prev, lic); err != nil {
+		if errors.Is(err, errAPIKeyQuota) {
+			httpErr(w, err, 403)
+			return
+		}
 		httpErr(w, err, 500)
 		return
 	}
@@ -1026,7 +1401,7 @@ func (s *Server) handleLicenseExtend(w http.ResponseWriter, r *http.Request) {
 		ID:        randomHex(16),
 		LicenseID: lic.ID,
 		Action:    "extend",
-		Actor:     "admin",
+		Actor:     requestIdentity(r).label(),
 		Details:   lic.ExpiresAt,
 		CreatedAt: time.Now().UTC().Format(time.RFC3339),
 	})
@@ -1052,9 +1427,14 @@ func (s *Server) handleLicenseRestore(w http.ResponseWriter, r *http.Request) {
 		httpErr(w, err, 500)
 		return
 	}
+	prev := *lic
 	lic.Status = "active"
 	lic.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
-	if err := s.store.UpdateLicense(lic); err != nil {
+	if err := s.updateLicenseWithinQuota(&prev, lic); err != nil {
+		if errors.Is(err, errAPIKeyQuota) {
+			httpErr(w, err, 403)
+			return
+		}
 		httpErr(w, err, 500)
 		return
 	}
@@ -1062,7 +1442,7 @@ func (s *Server) handleLicenseRestore(w http.ResponseWriter, r *http.Request) {
 		ID:        randomHex(16),
 		LicenseID: lic.ID,
 		Action:    "restore",
-		Actor:     "admin",
+		Actor:     requestIdentity(r).label(),
 		CreatedAt: time.Now().UTC().Format(time.RFC3339),
 	})
 	respondJSON(w, 200, lic)
@@ -1097,12 +1477,116 @@ func (s *Server) handleLicenseRevoke(w http.ResponseWriter, r *http.Request) {
 		ID:        randomHex(16),
 		LicenseID: lic.ID,
 		Action:    "revoke",
-		Actor:     "admin",
+		Actor:     requestIdentity(r).label(),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	respondJSON(w, 200, lic)
+}
+
+// handleLicenseSuspend pauses an active license, e.g. for non-payment.
+// Validation answers "suspended" until it is unsuspended; revoked licenses
+// stay revoked.
+func (s *Server) handleLicenseSuspend(w http.ResponseWriter, r *http.Request) {
+	s.switchLicenseStatus(w, r, "active", "suspended", "suspend")
+}
+
+// handleLicenseUnsuspend moves a suspended license back to active and
+// refuses any other status, so it can never undo a revoke.
+func (s *Server) handleLicenseUnsuspend(w http.ResponseWriter, r *http.Request) {
+	s.switchLicenseStatus(w, r, "suspended", "active", "unsuspend")
+}
+
+// switchLicenseStatus sets the license status to "to" if it is currently
+// "from", then audits and fires license.<action>. Other statuses get 409.
+func (s *Server) switchLicenseStatus(w http.ResponseWriter, r *http.Request, from, to, action string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	id := strings.TrimSpace(r.PathValue("id"))
+	if id == "" {
+		httpErr(w, fmt.Errorf("license id required"), 400)
+		return
+	}
+	lic, err := s.store.GetLicenseByID(id)
+	if err != nil {
+		if errors.Is(err, errLicenseNotFound) {
+			httpErr(w, err, 404)
+			return
+		}
+		httpErr(w, err, 500)
+		return
+	}
+	if status := strings.ToLower(strings.TrimSpace(lic.Status)); status != from {
+		httpErr(w, fmt.Errorf("license is %s, only %s licenses can be %sed", status, from, action), 409)
+		return
+	}
+	prev := *lic
+	lic.Status = to
+	lic.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := s.updateLicenseWithinQuota(&prev, lic); err != nil {
+		if errors.Is(err, errAPIKeyQuota) {
+			httpErr(w, err, 403)
+			return
+		}
+		httpErr(w, err, 500)
+		return
+	}
+	_ = s.store.AddAudit(AuditEvent{
+		ID:        randomHex(16),
+		LicenseID: lic.ID,
+		Action:    action,
+		Actor:     requestIdentity(r).label(),
 		CreatedAt: time.Now().UTC().Format(time.RFC3339),
 	})
+	s.fireWebhook("license."+action, lic.ID, lic)
 	respondJSON(w, 200, lic)
 }
 
+// clientLinkTTL is how long a one-time client portal link stays usable.
+const clientLinkTTL = time.Hour
+
+// handleLicenseClientLink issues a one-time client portal login link for the
+// license, for customers who cannot log in with the email on file.
+func (s *Server) handleLicenseClientLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	id := strings.TrimSpace(r.PathValue("id"))
+	if id == "" {
+		httpErr(w, fmt.Errorf("license id required"), 400)
+		return
+	}
+	lic, err := s.store.GetLicenseByID(id)
+	if err != nil {
+		if errors.Is(err, errLicenseNotFound) {
+			httpErr(w, err, 404)
+			return
+		}
+		httpErr(w, err, 500)
+		return
+	}
+	link, err := s.store.CreateClientLoginLink(lic.ID, clientLinkTTL)
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	_ = s.store.AddAudit(AuditEvent{
+		ID:        randomHex(16),
+		LicenseID: lic.ID,
+		Action:    "client_link_issue",
+		Actor:     requestIdentity(r).label(),
+		Details:   fmt.Sprintf("link=%s expiresAt=%s", SessionHandle(link.ID), link.ExpiresAt),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	respondJSON(w, 200, map[string]any{
+		"token":     link.ID,
+		"url":       s.requestBaseURL(r) + "/client?token=" + url.QueryEscape(link.ID),
+		"expiresAt": link.ExpiresAt,
+	})
+}
+
 func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", 405)
@@ -1117,14 +1601,30 @@ func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
 		httpErr(w, fmt.Errorf("licenseKey is required"), 400)
 		return
 	}
+	if len(req.Nonce) > maxNonceLen {
+		httpErr(w, fmt.Errorf("nonce is longer than %d characters", maxNonceLen), 400)
+		return
+	}
+	if err := checkValidateFieldLengths(&req); err != nil {
+		httpErr(w, err, 400)
+		return
+	}
 
+	issued := time.Now().UTC()
 	payload := signedValidatePayload{
 		Status:     "invalid",
 		Valid:      false,
 		GraceDays:  s.graceDays,
-		ServerTime: time.Now().UTC().Format(time.RFC3339),
+		ServerTime: issued.Format(time.RFC3339),
 		InstanceID: strings.TrimSpace(req.InstanceID),
+		Nonce:      req.Nonce,
+		IssuedAt:   issued.Format(time.RFC3339),
+		ValidUntil: issued.Add(signedPayloadTTL).Format(time.RFC3339),
 	}
+	defer func() {
+		s.ops.validateResult(payload.Reason)
+		log.Printf("validate request_id=%s instance=%s host=%s status=%s reason=%s", r.Header.Get(requestIDHeader), payload.InstanceID, strings.TrimSpace(req.Hostname), payload.Status, payload.Reason)
+	}()
 
 	lic, err := s.store.GetLicenseByKey(strings.TrimSpace(req.LicenseKey))
 	if err != nil {
@@ -1133,8 +1633,11 @@ func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	defer s.recordDeployment(lic.ID, &req, s.requestClientIP(r), &payload)
+
 	payload.LicenseID = lic.ID
 	payload.Plan = lic.Plan
+	payload.GraceDays = s.planGraceDays(lic.Plan)
 	payload.MaxAgents = lic.MaxAgents
 	payload.ExpiresAt = lic.ExpiresAt
 	payload.LicenseKey = lic.LicenseKey
@@ -1177,17 +1680,125 @@ func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	lic.LastInstanceID = strings.TrimSpace(req.InstanceID)
-	lic.LastHostname = strings.TrimSpace(req.Hostname)
-	lic.LastIP = requestClientIP(r)
-	lic.LastCheckAt = now.Format(time.RFC3339)
-	_ = s.store.UpdateLicense(lic)
+	firstActivation := false
+	if lic.FirstActivatedAt == "" && lic.LastCheckAt == "" {
+		var activatedAt string
+		if activatedAt, firstActivation, err = s.store.MarkLicenseActivated(lic.ID, now.Format(time.RFC3339)); err == nil {
+			lic.FirstActivatedAt = activatedAt
+		}
+	}
+	instance, host, ip := strings.TrimSpace(req.InstanceID), strings.TrimSpace(req.Hostname), s.requestClientIP(r)
+	if s.checkNeedsPersist(lic, instance, host, ip, now) {
+		lic.LastInstanceID, lic.LastHostname, lic.LastIP = instance, host, ip
+		lic.LastCheckAt = now.Format(time.RFC3339)
+		_ = s.store.UpdateLicense(lic)
+	}
+	if firstActivation {
+		s.notifyLicenseActivated(*lic)
+	}
 
 	payload.Status = "active"
 	payload.Valid = true
 	respondSignedPayload(w, payload, s.signKey)
 }
 
+// checkNeedsPersist reports whether a successful validation should be written
+// back: always when the instance, hostname or IP changed, otherwise only once
+// LastCheckAt is checkPersistInterval old, so frequent polling does not turn
+// into a write per request.
+func (s *Server) checkNeedsPersist(lic *License, instance, host, ip string, now time.Time) bool {
+	if lic.LastInstanceID != instance || lic.LastHostname != host || lic.LastIP != ip {
+		return true
+	}
+	last, err := time.Parse(time.RFC3339, lic.LastCheckAt)
+	return err != nil || now.Sub(last) >= s.checkPersistInterval
+}
+
+// notifyLicenseActivated reports the first successful validation of a
+// license to the admin chat and the configured webhook.
+func (s *Server) notifyLicenseActivated(lic License) {
+	_ = s.store.AddAudit(AuditEvent{
+		ID:        randomHex(16),
+		LicenseID: lic.ID,
+		Action:    "activate",
+		Actor:     "system",
+		Details:   fmt.Sprintf("host=%s ip=%s", lic.LastHostname, lic.LastIP),
+		CreatedAt: lic.FirstActivatedAt,
+	})
+	s.fireWebhook("license.activated", lic.ID, lic)
+
+	token := strings.TrimSpace(s.store.GetSetting("telegram_bot_token"))
+	chatID := strings.TrimSpace(s.store.GetSetting("telegram_chat_id"))
+	if token == "" || chatID == "" {
+		return
+	}
+	msg := fmt.Sprintf("🚀 Лицензия <b>%s</b> (%s) активирована\nХост: %s (%s)\nКлюч: <code>%s</code>", lic.CustomerName, lic.Plan, lic.LastHostname, lic.LastIP, lic.LicenseKey)
+	go func() { _ = s.telegramSend(telegramKindActivation, token, chatID, msg) }()
+}
+
+// defaultSessionTTL is the lifetime of admin and client sessions unless
+// LICENSE_ADMIN_SESSION_TTL / LICENSE_CLIENT_SESSION_TTL override it.
+const defaultSessionTTL = 24 * time.Hour
+
+// defaultCheckPersistInterval is how stale LastCheckAt may get before an
+// unchanged validation is written again.
+const defaultCheckPersistInterval = 5 * time.Minute
+
+// defaultNotifyInterval is how often expiring licenses are scanned unless
+// LICENSE_NOTIFY_INTERVAL overrides it.
+const defaultNotifyInterval = 6 * time.Hour
+
+// envSessionTTL reads a session lifetime (Go duration, at least a minute)
+// from the environment, falling back to defaultSessionTTL.
+func envSessionTTL(name string) time.Duration {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return defaultSessionTTL
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < time.Minute {
+		log.Printf("[WARN] %s=%q не распознан (нужна длительность не меньше 1m), используется %s", name, v, defaultSessionTTL)
+		return defaultSessionTTL
+	}
+	return d
+}
+
+// sessionMaxAge returns the cookie Max-Age matching the session's server-side
+// expiry, so the browser drops the cookie when the session stops validating.
+func sessionMaxAge(sess *Session) int {
+	exp, err := time.Parse(time.RFC3339, sess.ExpiresAt)
+	if err != nil {
+		return 0
+	}
+	if n := int(time.Until(exp) / time.Second); n > 0 {
+		return n
+	}
+	return -1
+}
+
+// setSessionCookie writes an admin or client session cookie (maxAge -1 clears
+// it) with the SameSite and Secure attributes from LICENSE_COOKIE_SAMESITE and
+// LICENSE_COOKIE_SECURE. Browsers reject SameSite=None without Secure, so
+// None always sets it.
+func (s *Server) setSessionCookie(w http.ResponseWriter, r *http.Request, name, value string, maxAge int) {
+	secure := s.requestIsHTTPS(r)
+	if s.cookieSecure != nil {
+		secure = *s.cookieSecure
+	}
+	if s.cookieSameSite == http.SameSiteNoneMode {
+		secure = true
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: s.cookieSameSite,
+		MaxAge:   maxAge,
+	})
+}
+
 func (s *Server) getSessionID(r *http.Request) string {
 	c, err := r.Cookie("session")
 	if err != nil {
@@ -1199,23 +1810,23 @@ func (s *Server) getSessionID(r *http.Request) string {
 func (s *Server) withAdmin(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if sid := s.getSessionID(r); sid != "" && s.store.ValidateSession(sid) {
-			next(w, r)
+			next(w, withIdentity(r, adminIdentity{Via: "session"}))
 			return
 		}
 		auth := strings.TrimSpace(r.Header.Get("Authorization"))
 		want := "Bearer " + s.adminToken
 		if auth == want {
-			next(w, r)
+			next(w, withIdentity(r, adminIdentity{Via: "token"}))
 			return
 		}
 		if strings.HasPrefix(auth, "Bearer ") {
 			apiKey := strings.TrimPrefix(auth, "Bearer ")
-			if role, ok := s.store.ValidateAPIKey(apiKey); ok && (role == "full" || role == "readonly") {
-				if role == "readonly" && r.Method != http.MethodGet {
+			if ak, ok := s.store.FindAPIKey(apiKey); ok && (ak.Role == "full" || ak.Role == "readonly") {
+				if ak.Role == "readonly" && r.Method != http.MethodGet {
 					httpErr(w, fmt.Errorf("readonly API key"), 403)
 					return
 				}
-				next(w, r)
+				next(w, withIdentity(r, adminIdentity{Via: "apikey", APIKey: ak}))
 				return
 			}
 		}
@@ -1223,6 +1834,29 @@ func (s *Server) withAdmin(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// handleWhoami describes the credentials of the caller: an admin session or
+// token, or an API key (without its secret value).
+func (s *Server) handleWhoami(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	id := requestIdentity(r)
+	if ak := id.APIKey; ak != nil {
+		respondJSON(w, 200, map[string]any{
+			"type":        "apiKey",
+			"id":          ak.ID,
+			"name":        ak.Name,
+			"role":        ak.Role,
+			"readOnly":    id.readonly(),
+			"createdAt":   ak.CreatedAt,
+			"maxLicenses": ak.MaxLicenses,
+		})
+		return
+	}
+	respondJSON(w, 200, map[string]any{"type": "admin", "via": id.Via})
+}
+
 func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", 405)
@@ -1240,19 +1874,12 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		httpErr(w, fmt.Errorf("неверный логин или пароль"), 401)
 		return
 	}
-	sess, err := s.store.CreateAdminSession()
+	sess, err := s.store.CreateAdminSession(s.adminSessionTTL)
 	if err != nil {
 		httpErr(w, err, 500)
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    sess.ID,
-		Path:     "/",
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   86400,
-	})
+	s.setSessionCookie(w, r, "session", sess.ID, sessionMaxAge(sess))
 	respondJSON(w, 200, map[string]any{"ok": true, "username": "admin"})
 }
 
@@ -1264,13 +1891,7 @@ func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 	if sid := s.getSessionID(r); sid != "" {
 		_ = s.store.DeleteSession(sid)
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   -1,
-	})
+	s.setSessionCookie(w, r, "session", "", -1)
 	respondJSON(w, 200, map[string]any{"ok": true})
 }
 
@@ -1286,12 +1907,40 @@ func (s *Server) handleAuthMe(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, 200, map[string]any{"authenticated": false})
 }
 
+// getClientSessionID reads the client session from the cookie set by the
+// bundled portal or, for integrations, from "Authorization: Bearer <token>"
+// with a token issued by a login with returnToken.
 func (s *Server) getClientSessionID(r *http.Request) string {
-	c, err := r.Cookie("client_session")
+	if c, err := r.Cookie("client_session"); err == nil && c.Value != "" {
+		return c.Value
+	}
+	if auth := strings.TrimSpace(r.Header.Get("Authorization")); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+// startClientSession creates a client session for lic and answers the login.
+// The bundled portal gets an HttpOnly cookie; with returnToken the session
+// token is returned in the body instead, for use as a bearer token.
+func (s *Server) startClientSession(w http.ResponseWriter, r *http.Request, lic *License, returnToken bool) {
+	sess, err := s.store.CreateClientSession(lic.ID, s.clientSessionTTL)
 	if err != nil {
-		return ""
+		httpErr(w, err, 500)
+		return
 	}
-	return c.Value
+	resp := map[string]any{
+		"ok":          true,
+		"license":     toClientLicenseView(lic),
+		"botUsername": strings.TrimSpace(s.store.GetSetting("telegram_bot_username")),
+	}
+	if returnToken {
+		resp["token"] = sess.ID
+		resp["expiresAt"] = sess.ExpiresAt
+	} else {
+		s.setSessionCookie(w, r, "client_session", sess.ID, sessionMaxAge(sess))
+	}
+	respondJSON(w, 200, resp)
 }
 
 type clientLicenseView struct {
@@ -1311,6 +1960,7 @@ type clientLicenseView struct {
 	ClientChatBound  bool   `json:"clientChatBound"`
 	LastCheckAt      string `json:"lastCheckAt,omitempty"`
 	IsTrial          bool   `json:"isTrial,omitempty"`
+	Language         string `json:"language,omitempty"`
 }
 
 func toClientLicenseView(lic *License) clientLicenseView {
@@ -1334,6 +1984,7 @@ func toClientLicenseView(lic *License) clientLicenseView {
 		ClientChatBound:  strings.TrimSpace(lic.ClientChatID) != "",
 		LastCheckAt:      lic.LastCheckAt,
 		IsTrial:          lic.IsTrial,
+		Language:         lic.Language,
 	}
 }
 
@@ -1355,9 +2006,16 @@ func (s *Server) handleClientLogin(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", 405)
 		return
 	}
+	ip := s.requestClientIP(r)
+	if !s.clientLoginLimit.allow(ip) {
+		httpErr(w, fmt.Errorf("слишком много попыток входа, попробуйте позже"), 429)
+		return
+	}
 	var req struct {
-		LicenseKey string `json:"licenseKey"`
-		Email      string `json:"email"`
+		LicenseKey   string `json:"licenseKey"`
+		Email        string `json:"email"`
+		CaptchaToken string `json:"captchaToken"`
+		ReturnToken  bool   `json:"returnToken"`
 	}
 	if err := decodeJSON(r, &req); err != nil {
 		httpErr(w, fmt.Errorf("invalid body"), 400)
@@ -1369,50 +2027,72 @@ func (s *Server) handleClientLogin(w http.ResponseWriter, r *http.Request) {
 		httpErr(w, fmt.Errorf("license key and email are required"), 400)
 		return
 	}
-	lic, err := s.store.GetLicenseByKey(key)
-	if err != nil {
-		httpErr(w, fmt.Errorf("license not found"), 401)
-		return
-	}
-	if strings.ToLower(strings.TrimSpace(lic.CustomerEmail)) != email {
-		httpErr(w, fmt.Errorf("email does not match license"), 401)
-		return
+	if provider, _, secret := s.clientCaptcha(); provider != "" {
+		if err := verifyCaptcha(provider, secret, req.CaptchaToken, ip); err != nil {
+			log.Printf("client login from %s: %v", ip, err)
+			httpErr(w, fmt.Errorf("проверка captcha не пройдена"), 403)
+			return
+		}
 	}
-	sess, err := s.store.CreateClientSession(lic.ID)
-	if err != nil {
-		httpErr(w, err, 500)
+	// One message for both cases so the portal does not reveal which keys exist.
+	lic, err := s.store.GetLicenseByKey(key)
+	if err != nil || strings.ToLower(strings.TrimSpace(lic.CustomerEmail)) != email {
+		httpErr(w, fmt.Errorf("invalid license key or email"), 401)
 		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     "client_session",
-		Value:    sess.ID,
-		Path:     "/",
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   86400,
-	})
-	respondJSON(w, 200, map[string]any{
-		"ok":          true,
-		"license":     toClientLicenseView(lic),
-		"botUsername": strings.TrimSpace(s.store.GetSetting("telegram_bot_username")),
-	})
+	s.startClientSession(w, r, lic, req.ReturnToken)
 }
 
-func (s *Server) handleClientLogout(w http.ResponseWriter, r *http.Request) {
+// handleClientTokenLogin redeems a one-time link from handleLicenseClientLink
+// for a regular client session.
+func (s *Server) handleClientTokenLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", 405)
 		return
 	}
-	if sid := s.getClientSessionID(r); sid != "" {
-		_ = s.store.DeleteSession(sid)
+	ip := s.requestClientIP(r)
+	if !s.clientLoginLimit.allow(ip) {
+		httpErr(w, fmt.Errorf("слишком много попыток входа, попробуйте позже"), 429)
+		return
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:     "client_session",
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   -1,
+	var req struct {
+		Token       string `json:"token"`
+		ReturnToken bool   `json:"returnToken"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		httpErr(w, fmt.Errorf("invalid body"), 400)
+		return
+	}
+	licenseID, ok := s.store.ConsumeClientLoginLink(strings.TrimSpace(req.Token))
+	if !ok {
+		httpErr(w, fmt.Errorf("ссылка для входа недействительна или уже использована"), 401)
+		return
+	}
+	lic, err := s.store.GetLicenseByID(licenseID)
+	if err != nil {
+		httpErr(w, fmt.Errorf("license not found"), 401)
+		return
+	}
+	_ = s.store.AddAudit(AuditEvent{
+		ID:        randomHex(16),
+		LicenseID: lic.ID,
+		Action:    "client_link_use",
+		Actor:     "client",
+		Details:   fmt.Sprintf("link=%s ip=%s", SessionHandle(strings.TrimSpace(req.Token)), ip),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
 	})
+	s.startClientSession(w, r, lic, req.ReturnToken)
+}
+
+func (s *Server) handleClientLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	if sid := s.getClientSessionID(r); sid != "" {
+		_ = s.store.DeleteSession(sid)
+	}
+	s.setSessionCookie(w, r, "client_session", "", -1)
 	respondJSON(w, 200, map[string]any{"ok": true})
 }
 
@@ -1423,7 +2103,11 @@ func (s *Server) handleClientAuthMe(w http.ResponseWriter, r *http.Request) {
 	}
 	lic, err := s.clientLicenseFromRequest(r)
 	if err != nil {
-		respondJSON(w, 200, map[string]any{"authenticated": false})
+		resp := map[string]any{"authenticated": false}
+		if provider, siteKey, _ := s.clientCaptcha(); provider != "" {
+			resp["captcha"] = map[string]string{"provider": provider, "siteKey": siteKey}
+		}
+		respondJSON(w, 200, resp)
 		return
 	}
 	respondJSON(w, 200, map[string]any{
@@ -1450,11 +2134,16 @@ func (s *Server) handleClientLicense(w http.ResponseWriter, r *http.Request) {
 			CustomerEmail    *string `json:"customerEmail"`
 			CustomerTelegram *string `json:"customerTelegram"`
 			CustomerPhone    *string `json:"customerPhone"`
+			Language         *string `json:"language"`
 		}
 		if err := decodeJSON(r, &req); err != nil {
 			httpErr(w, fmt.Errorf("invalid body"), 400)
 			return
 		}
+		if req.Language != nil && strings.TrimSpace(*req.Language) != "" && normalizeNotifyLanguage(*req.Language) == "" {
+			httpErr(w, fmt.Errorf("language: unsupported %q", *req.Language), 400)
+			return
+		}
 		if req.CustomerEmail != nil {
 			lic.CustomerEmail = strings.TrimSpace(*req.CustomerEmail)
 		}
@@ -1464,6 +2153,9 @@ func (s *Server) handleClientLicense(w http.ResponseWriter, r *http.Request) {
 		if req.CustomerPhone != nil {
 			lic.CustomerPhone = strings.TrimSpace(*req.CustomerPhone)
 		}
+		if req.Language != nil {
+			lic.Language = normalizeNotifyLanguage(*req.Language)
+		}
 		lic.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
 		if err := s.store.UpdateLicense(lic); err != nil {
 			httpErr(w, err, 500)
@@ -1510,7 +2202,20 @@ func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 		httpErr(w, err, 500)
 		return
 	}
-	respondJSON(w, 200, map[string]any{"ok": true})
+	// A password change after a compromise must cut off other logins; the
+	// caller's own session (if any) survives.
+	revoked, err := s.store.DeleteAdminSessionsExcept(s.getSessionID(r))
+	if err != nil {
+		log.Printf("change password: revoke sessions: %v", err)
+	}
+	_ = s.store.AddAudit(AuditEvent{
+		ID:        randomHex(16),
+		Action:    "password_change",
+		Actor:     requestIdentity(r).label(),
+		Details:   fmt.Sprintf("sessions_revoked=%d", revoked),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	respondJSON(w, 200, map[string]any{"ok": true, "sessionsRevoked": revoked})
 }
 
 func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
@@ -1518,7 +2223,53 @@ func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", 405)
 		return
 	}
-	items, err := s.store.ListAudit()
+	q := r.URL.Query()
+	offset, limit := 0, math.MaxInt
+	if v := strings.TrimSpace(q.Get("offset")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			httpErr(w, fmt.Errorf("offset must be a non-negative integer"), 400)
+			return
+		}
+		offset = n
+	}
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			httpErr(w, fmt.Errorf("limit must be a positive integer"), 400)
+			return
+		}
+		limit = n
+	}
+	f, err := parseAuditFilter(q)
+	if err != nil {
+		httpErr(w, err, 400)
+		return
+	}
+	items, total, err := s.store.QueryAudit(offset, limit, f)
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	respondJSON(w, 200, map[string]any{"items": items, "total": total, "offset": offset})
+}
+
+// handleLicenseAudit returns the history of one license, newest first.
+func (s *Server) handleLicenseAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	id := strings.TrimSpace(r.PathValue("id"))
+	if _, err := s.store.GetLicenseByID(id); err != nil {
+		if errors.Is(err, errLicenseNotFound) {
+			httpErr(w, err, 404)
+			return
+		}
+		httpErr(w, err, 500)
+		return
+	}
+	items, err := s.store.ListAuditByLicense(id)
 	if err != nil {
 		httpErr(w, err, 500)
 		return
@@ -1546,10 +2297,10 @@ func (s *Server) handleLicenseByID(w http.ResponseWriter, r *http.Request) {
 			ID:        randomHex(16),
 			LicenseID: id,
 			Action:    "delete",
-			Actor:     "admin",
+			Actor:     requestIdentity(r).label(),
 			CreatedAt: time.Now().UTC().Format(time.RFC3339),
 		})
-		s.fireWebhook("license.delete", map[string]string{"id": id})
+		s.fireWebhook("license.delete", id, map[string]string{"id": id})
 		respondJSON(w, 200, map[string]any{"ok": true})
 		return
 	}
@@ -1576,11 +2327,16 @@ func (s *Server) handleLicenseByID(w http.ResponseWriter, r *http.Request) {
 		Plan             *string `json:"plan"`
 		MaxAgents        *int    `json:"maxAgents"`
 		Notes            *string `json:"notes"`
+		Language         *string `json:"language"`
 	}
 	if err := decodeJSON(r, &req); err != nil {
 		httpErr(w, fmt.Errorf("invalid body: %w", err), 400)
 		return
 	}
+	if req.Language != nil && strings.TrimSpace(*req.Language) != "" && normalizeNotifyLanguage(*req.Language) == "" {
+		httpErr(w, fmt.Errorf("language: unsupported %q", *req.Language), 400)
+		return
+	}
 	changed := []string{}
 	if req.CustomerName != nil {
 		lic.CustomerName = strings.TrimSpace(*req.CustomerName)
@@ -1603,6 +2359,11 @@ func (s *Server) handleLicenseByID(w http.ResponseWriter, r *http.Request) {
 		changed = append(changed, "customerCompany")
 	}
 	if req.Plan != nil {
+		// A plan removed from the table may stay on licenses that have it.
+		if !s.isKnownPlan(*req.Plan) && !strings.EqualFold(strings.TrimSpace(*req.Plan), lic.Plan) {
+			httpErr(w, fmt.Errorf("plan: unknown plan %q", *req.Plan), 400)
+			return
+		}
 		lic.Plan = strings.ToLower(strings.TrimSpace(*req.Plan))
 		changed = append(changed, "plan")
 	}
@@ -1614,6 +2375,10 @@ func (s *Server) handleLicenseByID(w http.ResponseWriter, r *http.Request) {
 		lic.Notes = strings.TrimSpace(*req.Notes)
 		changed = append(changed, "notes")
 	}
+	if req.Language != nil {
+		lic.Language = normalizeNotifyLanguage(*req.Language)
+		changed = append(changed, "language")
+	}
 	lic.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
 	if err := s.store.UpdateLicense(lic); err != nil {
 		httpErr(w, err, 500)
@@ -1623,15 +2388,106 @@ func (s *Server) handleLicenseByID(w http.ResponseWriter, r *http.Request) {
 		ID:        randomHex(16),
 		LicenseID: lic.ID,
 		Action:    "edit",
-		Actor:     "admin",
+		Actor:     requestIdentity(r).label(),
 		Details:   strings.Join(changed, ","),
 		CreatedAt: time.Now().UTC().Format(time.RFC3339),
 	})
-	s.fireWebhook("license.edit", lic)
+	s.fireWebhook("license.edit", lic.ID, lic)
 	respondJSON(w, 200, lic)
 }
 
-func (s *Server) handleLicensesExport(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleLicensesStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	list, err := s.store.ListLicenses()
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	respondJSON(w, 200, licenseStats(list, time.Now().UTC()))
+}
+
+// licenseStats summarizes licenses by effective status and plan as of now.
+func licenseStats(list []License, now time.Time) map[string]any {
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	byStatus := map[string]int{"active": 0, "suspended": 0, "revoked": 0, "expired": 0}
+	byPlan := map[string]int{"basic": 0, "pro": 0, "enterprise": 0}
+	expiringSoon := 0
+	trial := 0
+	createdThisMonth := 0
+	for _, lic := range list {
+		status := effectiveLicenseStatus(&lic, now)
+		byStatus[status]++
+		plan := strings.ToLower(strings.TrimSpace(lic.Plan))
+		if plan == "" {
+			plan = "basic"
+		}
+		byPlan[plan]++
+		if lic.IsTrial {
+			trial++
+		}
+		if status == "active" {
+			if exp, err := time.Parse(time.RFC3339, lic.ExpiresAt); err == nil && exp.Sub(now) <= 30*24*time.Hour {
+				expiringSoon++
+			}
+		}
+		if created, err := time.Parse(time.RFC3339, lic.CreatedAt); err == nil && !created.Before(monthStart) {
+			createdThisMonth++
+		}
+	}
+
+	return map[string]any{
+		"total":            len(list),
+		"byStatus":         byStatus,
+		"byPlan":           byPlan,
+		"expiringIn30Days": expiringSoon,
+		"trial":            trial,
+		"createdThisMonth": createdThisMonth,
+		"generatedAt":      now.Format(time.RFC3339),
+	}
+}
+
+// effectiveLicenseStatus reports "expired" for active licenses past their
+// expiration date; other statuses are returned as stored. The admin page's
+// effStatus mirrors it for filters, finance and charts.
+func effectiveLicenseStatus(lic *License, now time.Time) string {
+	status := strings.ToLower(strings.TrimSpace(lic.Status))
+	if status == "" {
+		status = "active"
+	}
+	if status == "active" {
+		if exp, err := time.Parse(time.RFC3339, lic.ExpiresAt); err == nil && now.After(exp) {
+			return "expired"
+		}
+	}
+	return status
+}
+
+const noCompanyName = "(none)"
+
+// normalizeCompanyName folds company names for grouping: whitespace is
+// collapsed, case is ignored and empty names map to noCompanyName.
+func normalizeCompanyName(v string) string {
+	x := strings.ToLower(strings.Join(strings.Fields(v), " "))
+	if x == "" {
+		return noCompanyName
+	}
+	return x
+}
+
+type companySummary struct {
+	Name           string `json:"name"`
+	Key            string `json:"key"`
+	Licenses       int    `json:"licenses"`
+	Active         int    `json:"active"`
+	TotalAgents    int    `json:"totalAgents"`
+	Unlimited      bool   `json:"unlimited,omitempty"`
+	SoonestExpires string `json:"soonestExpiresAt,omitempty"`
+}
+
+func (s *Server) handleCompanies(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", 405)
 		return
@@ -1642,18 +2498,114 @@ func (s *Server) handleLicensesExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	headers := []string{"ID", "Ключ", "Клиент", "Компания", "Email", "Telegram", "Телефон", "Тариф", "Лимит", "Истекает", "Статус", "Комментарий", "Хост", "IP", "Последний чек", "Создана"}
+	now := time.Now().UTC()
+	groups := map[string]*companySummary{}
+	order := []string{}
+	for _, lic := range list {
+		key := normalizeCompanyName(lic.CustomerCompany)
+		g, ok := groups[key]
+		if !ok {
+			name := strings.Join(strings.Fields(lic.CustomerCompany), " ")
+			if name == "" {
+				name = noCompanyName
+			}
+			g = &companySummary{Name: name, Key: key}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.Licenses++
+		if effectiveLicenseStatus(&lic, now) != "active" {
+			continue
+		}
+		g.Active++
+		if lic.MaxAgents <= 0 {
+			g.Unlimited = true
+		} else {
+			g.TotalAgents += lic.MaxAgents
+		}
+		if exp, err := time.Parse(time.RFC3339, lic.ExpiresAt); err == nil {
+			if cur, err := time.Parse(time.RFC3339, g.SoonestExpires); err != nil || exp.Before(cur) {
+				g.SoonestExpires = exp.UTC().Format(time.RFC3339)
+			}
+		}
+	}
+
+	items := make([]companySummary, 0, len(order))
+	for _, key := range order {
+		items = append(items, *groups[key])
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Licenses != items[j].Licenses {
+			return items[i].Licenses > items[j].Licenses
+		}
+		return items[i].Key < items[j].Key
+	})
+	respondJSON(w, 200, map[string]any{"items": items})
+}
+
+func (s *Server) handleCompanyLicenses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	name := strings.TrimSpace(r.PathValue("name"))
+	if name == "" {
+		httpErr(w, fmt.Errorf("company name required"), 400)
+		return
+	}
+	list, err := s.store.ListLicenses()
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	key := normalizeCompanyName(name)
+	items := make([]License, 0)
+	for _, lic := range list {
+		if normalizeCompanyName(lic.CustomerCompany) == key {
+			items = append(items, lic)
+		}
+	}
+	respondJSON(w, 200, map[string]any{"company": key, "items": items})
+}
+
+// licenseExportHeaders are the export columns; handleLicensesImport reads the same layout.
+var licenseExportHeaders = []string{"ID", "Ключ", "Клиент", "Компания", "Email", "Telegram", "Телефон", "Тариф", "Лимит", "Истекает", "Статус", "Комментарий", "Хост", "IP", "Последний чек", "Создана", "Создал"}
+
+// handleLicensesExport downloads the licenses matching the list filters
+// (status, plan, q) as csv (default), xlsx, html, json or pdf.
+func (s *Server) handleLicensesExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	list, _, err := s.store.QueryLicenses(licenseFilterFromQuery(r.URL.Query()), 1, math.MaxInt, time.Now().UTC())
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", "attachment; filename=licenses.json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(list)
+		return
+	}
+
+	headers := licenseExportHeaders
 	rows := make([][]string, 0, len(list))
 	for _, l := range list {
-		rows = append(rows, []string{l.ID, l.LicenseKey, l.CustomerName, l.CustomerCompany, l.CustomerEmail, l.CustomerTelegram, l.CustomerPhone, l.Plan, strconv.Itoa(l.MaxAgents), l.ExpiresAt, l.Status, l.Notes, l.LastHostname, l.LastIP, l.LastCheckAt, l.CreatedAt})
+		rows = append(rows, []string{l.ID, l.LicenseKey, l.CustomerName, l.CustomerCompany, l.CustomerEmail, l.CustomerTelegram, l.CustomerPhone, l.Plan, strconv.Itoa(l.MaxAgents), l.ExpiresAt, l.Status, l.Notes, l.LastHostname, l.LastIP, l.LastCheckAt, l.CreatedAt, l.CreatedBy})
 	}
 
-	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
 	switch format {
 	case "xlsx":
 		s.exportXLSX(w, headers, rows)
 	case "html":
 		s.exportHTML(w, headers, rows)
+	case "pdf":
+		s.exportPDF(w, rows)
 	default:
 		s.exportCSV(w, headers, rows)
 	}
@@ -1683,12 +2635,14 @@ func xmlEsc(s string) string {
 }
 
 func (s *Server) exportXLSX(w http.ResponseWriter, headers []string, rows [][]string) {
+	brand := s.exportBrand()
 	var buf bytes.Buffer
 	buf.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
 	buf.WriteString(`<?mso-application progid="Excel.Sheet"?>` + "\n")
 	buf.WriteString(`<Workbook xmlns="urn:schemas-microsoft-com:office:spreadsheet" xmlns:ss="urn:schemas-microsoft-com:office:spreadsheet">` + "\n")
 	buf.WriteString(`<Styles>`)
-	buf.WriteString(`<Style ss:ID="hdr"><Font ss:Bold="1" ss:Size="11" ss:Color="#FFFFFF"/><Interior ss:Color="#0f766e" ss:Pattern="Solid"/><Alignment ss:Horizontal="Center" ss:Vertical="Center"/><Borders><Border ss:Position="Bottom" ss:LineStyle="Continuous" ss:Weight="1" ss:Color="#0d6660"/></Borders></Style>`)
+	buf.WriteString(`<Style ss:ID="hdr"><Font ss:Bold="1" ss:Size="11" ss:Color="#FFFFFF"/><Interior ss:Color="` + brand.Accent + `" ss:Pattern="Solid"/><Alignment ss:Horizontal="Center" ss:Vertical="Center"/><Borders><Border ss:Position="Bottom" ss:LineStyle="Continuous" ss:Weight="1" ss:Color="` + brand.Accent + `"/></Borders></Style>`)
+	buf.WriteString(`<Style ss:ID="foot"><Font ss:Size="9" ss:Color="#94a3b8"/></Style>`)
 	buf.WriteString(`<Style ss:ID="cell"><Font ss:Size="11"/><Alignment ss:Vertical="Center" ss:WrapText="1"/><Borders><Border ss:Position="Bottom" ss:LineStyle="Continuous" ss:Weight="1" ss:Color="#e2e8f0"/></Borders></Style>`)
 	buf.WriteString(`<Style ss:ID="alt"><Font ss:Size="11"/><Interior ss:Color="#f8fafc" ss:Pattern="Solid"/><Alignment ss:Vertical="Center" ss:WrapText="1"/><Borders><Border ss:Position="Bottom" ss:LineStyle="Continuous" ss:Weight="1" ss:Color="#e2e8f0"/></Borders></Style>`)
 	buf.WriteString(`</Styles>`)
@@ -1725,6 +2679,7 @@ func (s *Server) exportXLSX(w http.ResponseWriter, headers []string, rows [][]st
 		}
 		buf.WriteString("</Row>\n")
 	}
+	buf.WriteString(`<Row></Row><Row><Cell ss:StyleID="foot"><Data ss:Type="String">` + xmlEsc(brand.Footer) + `</Data></Cell></Row>`)
 	buf.WriteString("</Table></Worksheet></Workbook>")
 	w.Header().Set("Content-Type", "application/vnd.ms-excel; charset=utf-8")
 	w.Header().Set("Content-Disposition", "attachment; filename=licenses.xls")
@@ -1732,24 +2687,30 @@ func (s *Server) exportXLSX(w http.ResponseWriter, headers []string, rows [][]st
 }
 
 func (s *Server) exportHTML(w http.ResponseWriter, headers []string, rows [][]string) {
+	brand := s.exportBrand()
+	// The default keeps the original teal-to-cyan header; custom colors are solid.
+	thBackground := brand.Accent
+	if brand.Accent == defaultExportAccentColor {
+		thBackground = "linear-gradient(135deg,#0f766e,#0891b2)"
+	}
 	var buf bytes.Buffer
-	buf.WriteString(`<!doctype html><html lang="ru"><head><meta charset="UTF-8"/><title>NODAX Лицензии</title>
+	buf.WriteString(`<!doctype html><html lang="ru"><head><meta charset="UTF-8"/><title>` + xmlEsc(brand.Name) + ` Лицензии</title>
 <style>
 *{box-sizing:border-box}
 body{margin:0;padding:24px;font-family:'Segoe UI',Arial,sans-serif;background:#f1f5f9;color:#0f172a}
-h1{font-size:22px;margin:0 0 16px;color:#0f766e}
+h1{font-size:22px;margin:0 0 16px;color:` + brand.Accent + `}
 .info{font-size:12px;color:#64748b;margin-bottom:16px}
 table{width:100%;border-collapse:collapse;background:#fff;border-radius:12px;overflow:hidden;box-shadow:0 4px 24px rgba(15,23,42,.08)}
-th{background:linear-gradient(135deg,#0f766e,#0891b2);color:#fff;font-size:11px;text-transform:uppercase;letter-spacing:.5px;padding:12px 10px;text-align:left}
+th{background:` + thBackground + `;color:#fff;font-size:11px;text-transform:uppercase;letter-spacing:.5px;padding:12px 10px;text-align:left}
 td{padding:10px;font-size:12px;border-bottom:1px solid #f1f5f9}
 tr:nth-child(even) td{background:#f8fafc}
 tr:hover td{background:#f0f7ff}
-.s-active{color:#166534;font-weight:700}.s-revoked{color:#991b1b;font-weight:700}.s-expired{color:#92400e;font-weight:700}
+.s-active{color:#166534;font-weight:700}.s-revoked{color:#991b1b;font-weight:700}.s-suspended{color:#3730a3;font-weight:700}.s-expired{color:#92400e;font-weight:700}
 code{background:#f1f5f9;border:1px solid #e2e8f0;border-radius:4px;padding:1px 5px;font-size:11px;font-family:monospace}
 .footer{margin-top:16px;font-size:11px;color:#94a3b8;text-align:center}
 @media print{body{padding:8px}table{box-shadow:none}h1{font-size:16px}}
 </style></head><body>
-<h1>NODAX — Лицензии</h1>
+<h1>` + xmlEsc(brand.Name) + ` — Лицензии</h1>
 <div class="info">Экспорт: ` + time.Now().Format("02.01.2006 15:04") + ` | Всего: ` + strconv.Itoa(len(rows)) + `</div>
 <table><thead><tr>`)
 	for _, h := range headers {
@@ -1771,7 +2732,7 @@ code{background:#f1f5f9;border:1px solid #e2e8f0;border-radius:4px;padding:1px 5
 		buf.WriteString("</tr>\n")
 	}
 	buf.WriteString(`</tbody></table>
-<div class="footer">NODAX License Server</div>
+<div class="footer">` + xmlEsc(brand.Footer) + `</div>
 </body></html>`)
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Content-Disposition", "attachment; filename=licenses.html")
@@ -1781,18 +2742,109 @@ code{background:#f1f5f9;border:1px solid #e2e8f0;border-radius:4px;padding:1px 5
 func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		respondJSON(w, 200, s.store.GetAllSettings())
+		respondJSON(w, 200, s.maskedSettings(requestIdentity(r).readonly()))
 	case http.MethodPost, http.MethodPut:
 		var req map[string]string
 		if err := decodeJSON(r, &req); err != nil {
 			httpErr(w, fmt.Errorf("invalid body"), 400)
 			return
 		}
+		if v, ok := req["default_plan"]; ok && strings.TrimSpace(v) != "" {
+			if !s.isKnownPlan(v) {
+				httpErr(w, fmt.Errorf("default_plan: unknown plan %q", v), 400)
+				return
+			}
+			req["default_plan"] = strings.ToLower(strings.TrimSpace(v))
+		}
+		if v, ok := req[settingPlanConfig]; ok && strings.TrimSpace(v) != "" {
+			plans, err := parsePlanConfig(v)
+			if err != nil {
+				httpErr(w, err, 400)
+				return
+			}
+			raw, _ := json.Marshal(plans)
+			req[settingPlanConfig] = string(raw)
+		}
+		if v, ok := req["default_valid_days"]; ok && strings.TrimSpace(v) != "" {
+			if n, err := strconv.Atoi(strings.TrimSpace(v)); err != nil || n <= 0 {
+				httpErr(w, fmt.Errorf("default_valid_days must be a positive integer"), 400)
+				return
+			}
+		}
+		_, g := req["key_groups"]
+		_, l := req["key_group_len"]
+		_, c := req["key_charset"]
+		if g || l || c {
+			merged := func(k string) string {
+				if v, ok := req[k]; ok {
+					return v
+				}
+				return s.store.GetSetting(k)
+			}
+			if _, err := licenseKeyFormatFrom(merged); err != nil {
+				httpErr(w, err, 400)
+				return
+			}
+		}
+		if v, ok := req[settingTelegramChatAutocapture]; ok && strings.TrimSpace(v) != "" {
+			on, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				httpErr(w, fmt.Errorf("%s: expected true or false, got %q", settingTelegramChatAutocapture, v), 400)
+				return
+			}
+			req[settingTelegramChatAutocapture] = strconv.FormatBool(on)
+		}
+		if v, ok := req["notify_language"]; ok && strings.TrimSpace(v) != "" {
+			if normalizeNotifyLanguage(v) == "" {
+				httpErr(w, fmt.Errorf("notify_language: unsupported %q", v), 400)
+				return
+			}
+			req["notify_language"] = normalizeNotifyLanguage(v)
+		}
+		if err := validateCaptchaSettings(req, s.store.GetSetting); err != nil {
+			httpErr(w, err, 400)
+			return
+		}
+		if err := validateBrandSettings(req); err != nil {
+			httpErr(w, err, 400)
+			return
+		}
+		if err := validateExportBrandSettings(req); err != nil {
+			httpErr(w, err, 400)
+			return
+		}
+		if err := validateQuietHoursSettings(req); err != nil {
+			httpErr(w, err, 400)
+			return
+		}
+		if err := validateWebhookSettings(req); err != nil {
+			httpErr(w, err, 400)
+			return
+		}
+		if err := validateFinanceSettings(req); err != nil {
+			httpErr(w, err, 400)
+			return
+		}
+		if err := validateDeploymentSettings(req); err != nil {
+			httpErr(w, err, 400)
+			return
+		}
+		for k, v := range req {
+			if strings.HasPrefix(k, "notify_template_") {
+				if err := validateNotifyTemplateSetting(k, v); err != nil {
+					httpErr(w, err, 400)
+					return
+				}
+			}
+		}
 		for k, v := range req {
 			if k == "telegram_chat_id" && strings.TrimSpace(v) == "" && strings.TrimSpace(s.store.GetSetting("telegram_chat_id")) != "" {
 				// Do not wipe auto-captured chat ID with stale empty UI value.
 				continue
 			}
+			if s.isMaskedSecretEcho(k, v) {
+				continue
+			}
 			_ = s.store.SetSetting(k, v)
 		}
 		respondJSON(w, 200, map[string]any{"ok": true})
@@ -1809,11 +2861,27 @@ func (s *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
 			httpErr(w, err, 500)
 			return
 		}
-		respondJSON(w, 200, map[string]any{"items": keys})
+		// An API key must not read the other keys' values, or a key held to
+		// a quota could switch to an unlimited one.
+		if requestIdentity(r).APIKey != nil {
+			for i := range keys {
+				keys[i].Key = maskSecret(keys[i].Key)
+			}
+		}
+		items, err := s.apiKeyViews(keys)
+		if err != nil {
+			httpErr(w, err, 500)
+			return
+		}
+		respondJSON(w, 200, map[string]any{"items": items})
 	case http.MethodPost:
+		if !requireAdminCaller(w, r, "manage API keys") {
+			return
+		}
 		var req struct {
-			Name string `json:"name"`
-			Role string `json:"role"`
+			Name        string `json:"name"`
+			Role        string `json:"role"`
+			MaxLicenses int    `json:"maxLicenses"`
 		}
 		if err := decodeJSON(r, &req); err != nil {
 			httpErr(w, fmt.Errorf("invalid body"), 400)
@@ -1823,15 +2891,20 @@ func (s *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
 			httpErr(w, fmt.Errorf("name is required"), 400)
 			return
 		}
+		if req.MaxLicenses < 0 {
+			httpErr(w, fmt.Errorf("maxLicenses must not be negative"), 400)
+			return
+		}
 		if req.Role != "full" && req.Role != "readonly" {
 			req.Role = "readonly"
 		}
 		ak := &APIKey{
-			ID:        randomHex(16),
-			Name:      strings.TrimSpace(req.Name),
-			Key:       "ndxk_" + randomHex(20),
-			Role:      req.Role,
-			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+			ID:          randomHex(16),
+			Name:        strings.TrimSpace(req.Name),
+			Key:         "ndxk_" + randomHex(20),
+			Role:        req.Role,
+			CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+			MaxLicenses: req.MaxLicenses,
 		}
 		if err := s.store.CreateAPIKey(ak); err != nil {
 			httpErr(w, err, 500)
@@ -1840,8 +2913,8 @@ func (s *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
 		_ = s.store.AddAudit(AuditEvent{
 			ID:        randomHex(16),
 			Action:    "api_key_create",
-			Actor:     "admin",
-			Details:   ak.Name + " role=" + ak.Role,
+			Actor:     requestIdentity(r).label(),
+			Details:   fmt.Sprintf("%s role=%s maxLicenses=%d", ak.Name, ak.Role, ak.MaxLicenses),
 			CreatedAt: time.Now().UTC().Format(time.RFC3339),
 		})
 		respondJSON(w, 201, ak)
@@ -1850,25 +2923,113 @@ func (s *Server) handleAPIKeys(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) handleAPIKeyDelete(w http.ResponseWriter, r *http.Request) {
+// handleAPIKeyByID changes the license quota of an API key (PATCH
+// {"maxLicenses": n}, 0 for none) or deletes it.
+func (s *Server) handleAPIKeyByID(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(r.PathValue("id"))
+	if id == "" {
+		httpErr(w, fmt.Errorf("id required"), 400)
+		return
+	}
+	if !requireAdminCaller(w, r, "manage API keys") {
+		return
+	}
+	switch r.Method {
+	case http.MethodPatch:
+		s.updateAPIKeyQuota(w, r, id)
+		return
+	case http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	if err := s.store.DeleteAPIKey(id); err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	_ = s.store.AddAudit(AuditEvent{
+		ID:        randomHex(16),
+		Action:    "api_key_delete",
+		Actor:     requestIdentity(r).label(),
+		Details:   id,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	respondJSON(w, 200, map[string]any{"ok": true})
+}
+
+// sessionView is a session as listed to admins. The secret ID is replaced by
+// its handle plus a short prefix for recognition.
+type sessionView struct {
+	ID        string `json:"id"`
+	IDPrefix  string `json:"idPrefix"`
+	Kind      string `json:"kind"`
+	LicenseID string `json:"licenseId,omitempty"`
+	CreatedAt string `json:"createdAt"`
+	ExpiresAt string `json:"expiresAt"`
+	Current   bool   `json:"current,omitempty"`
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	if !requireAdminCaller(w, r, "list sessions") {
+		return
+	}
+	sessions, err := s.store.ListSessions()
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	current := s.getSessionID(r)
+	items := make([]sessionView, 0, len(sessions))
+	for _, sess := range sessions {
+		prefix := sess.ID
+		if len(prefix) > 6 {
+			prefix = prefix[:6] + "…"
+		}
+		items = append(items, sessionView{
+			ID:        SessionHandle(sess.ID),
+			IDPrefix:  prefix,
+			Kind:      sess.Kind,
+			LicenseID: sess.LicenseID,
+			CreatedAt: sess.CreatedAt,
+			ExpiresAt: sess.ExpiresAt,
+			Current:   current != "" && sess.ID == current,
+		})
+	}
+	respondJSON(w, 200, map[string]any{"items": items})
+}
+
+func (s *Server) handleSessionRevoke(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", 405)
 		return
 	}
+	if !requireAdminCaller(w, r, "revoke sessions") {
+		return
+	}
 	id := strings.TrimSpace(r.PathValue("id"))
 	if id == "" {
 		httpErr(w, fmt.Errorf("id required"), 400)
 		return
 	}
-	if err := s.store.DeleteAPIKey(id); err != nil {
+	sess, err := s.store.DeleteSessionByHandle(id)
+	if err != nil {
 		httpErr(w, err, 500)
 		return
 	}
+	if sess == nil {
+		httpErr(w, fmt.Errorf("session not found"), 404)
+		return
+	}
 	_ = s.store.AddAudit(AuditEvent{
 		ID:        randomHex(16),
-		Action:    "api_key_delete",
-		Actor:     "admin",
-		Details:   id,
+		LicenseID: sess.LicenseID,
+		Action:    "session_revoke",
+		Actor:     requestIdentity(r).label(),
+		Details:   fmt.Sprintf("session=%s kind=%s", id, sess.Kind),
 		CreatedAt: time.Now().UTC().Format(time.RFC3339),
 	})
 	respondJSON(w, 200, map[string]any{"ok": true})
@@ -1879,6 +3040,10 @@ func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", 405)
 		return
 	}
+	// The backup holds every API key's secret.
+	if !requireAdminCaller(w, r, "download backups") {
+		return
+	}
 	data, err := s.store.BackupDB()
 	if err != nil {
 		httpErr(w, err, 500)
@@ -1889,27 +3054,58 @@ func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(data)
 }
 
+const maxRestoreBytes = 50 << 20
+
+// handleRestore replaces the database with a backup. It is rate limited per
+// IP and, unless called with the admin token, requires the admin password in
+// X-Confirm-Password. Every attempt is audited.
 func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", 405)
 		return
 	}
-	body, err := io.ReadAll(io.LimitReader(r.Body, 50<<20))
+	if !requireAdminCaller(w, r, "restore backups") {
+		return
+	}
+	ip := s.requestClientIP(r)
+	audit := func(action, details string) {
+		_ = s.store.AddAudit(AuditEvent{
+			ID:        randomHex(16),
+			Action:    action,
+			Actor:     requestIdentity(r).label(),
+			Details:   details + " ip=" + ip,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		})
+	}
+	if !s.restoreLimit.allow(ip) {
+		audit("restore_rejected", "rate limited")
+		httpErr(w, fmt.Errorf("слишком много попыток восстановления, повторите позже"), 429)
+		return
+	}
+	viaToken := strings.TrimSpace(r.Header.Get("Authorization")) == "Bearer "+s.adminToken
+	if !viaToken && !s.store.CheckPassword(r.Header.Get("X-Confirm-Password")) {
+		audit("restore_rejected", "password confirmation failed")
+		httpErr(w, fmt.Errorf("требуется подтверждение паролем (X-Confirm-Password)"), 403)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRestoreBytes))
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			audit("restore_rejected", "body too large")
+			httpErr(w, fmt.Errorf("backup too large (limit %d MB)", maxRestoreBytes>>20), 413)
+			return
+		}
+		audit("restore_failed", err.Error())
 		httpErr(w, fmt.Errorf("read body: %w", err), 400)
 		return
 	}
 	if err := s.store.RestoreDB(body); err != nil {
+		audit("restore_failed", err.Error())
 		httpErr(w, err, 400)
 		return
 	}
-	_ = s.store.AddAudit(AuditEvent{
-		ID:        randomHex(16),
-		Action:    "restore",
-		Actor:     "admin",
-		Details:   fmt.Sprintf("%d bytes", len(body)),
-		CreatedAt: time.Now().UTC().Format(time.RFC3339),
-	})
+	audit("restore", fmt.Sprintf("%d bytes", len(body)))
 	respondJSON(w, 200, map[string]any{"ok": true})
 }
 
@@ -1924,7 +3120,7 @@ func (s *Server) handleTestTelegram(w http.ResponseWriter, r *http.Request) {
 		httpErr(w, fmt.Errorf("telegram_bot_token и telegram_chat_id не настроены"), 400)
 		return
 	}
-	err := sendTelegram(token, chatID, "✅ Тестовое сообщение от NODAX License Server")
+	err := s.telegramSend(telegramKindTest, token, chatID, "✅ Тестовое сообщение от NODAX License Server")
 	if err != nil {
 		httpErr(w, err, 500)
 		return
@@ -1954,17 +3150,22 @@ func (s *Server) handleBroadcastClients(w http.ResponseWriter, r *http.Request)
 		httpErr(w, fmt.Errorf("message is required"), 400)
 		return
 	}
+	if err := validateNotifyTemplate(msg); err != nil {
+		httpErr(w, err, 400)
+		return
+	}
 
 	list, err := s.store.ListLicenses()
 	if err != nil {
 		httpErr(w, err, 500)
 		return
 	}
-	targets := map[string]bool{}
+	// A chat bound to several licenses gets one message, rendered with the first.
+	targets := map[string]License{}
 	for _, lic := range list {
 		chat := strings.TrimSpace(lic.ClientChatID)
-		if chat != "" {
-			targets[chat] = true
+		if _, seen := targets[chat]; chat != "" && !seen {
+			targets[chat] = lic
 		}
 	}
 	if len(targets) == 0 {
@@ -1974,8 +3175,9 @@ func (s *Server) handleBroadcastClients(w http.ResponseWriter, r *http.Request)
 
 	sent := 0
 	failed := 0
-	for chat := range targets {
-		if err := sendTelegram(token, chat, msg); err != nil {
+	now := time.Now().UTC()
+	for chat, lic := range targets {
+		if err := s.telegramSend(telegramKindBroadcast, token, chat, renderNotifyTemplate(msg, lic, licenseDaysLeft(lic, now))); err != nil {
 			failed++
 			continue
 		}
@@ -1985,7 +3187,7 @@ func (s *Server) handleBroadcastClients(w http.ResponseWriter, r *http.Request)
 	_ = s.store.AddAudit(AuditEvent{
 		ID:        randomHex(16),
 		Action:    "broadcast_clients",
-		Actor:     "admin",
+		Actor:     requestIdentity(r).label(),
 		Details:   fmt.Sprintf("sent=%d failed=%d", sent, failed),
 		CreatedAt: time.Now().UTC().Format(time.RFC3339),
 	})
@@ -2002,7 +3204,7 @@ func (s *Server) handleTestWebhook(w http.ResponseWriter, r *http.Request) {
 		httpErr(w, fmt.Errorf("webhook_url не настроен"), 400)
 		return
 	}
-	err := sendWebhook(url, "test", map[string]any{"message": "test from NODAX License Server"})
+	err := sendWebhook(url, s.store.GetSetting("webhook_secret"), "test", map[string]any{"message": "test from NODAX License Server"})
 	if err != nil {
 		httpErr(w, err, 500)
 		return
@@ -2011,8 +3213,9 @@ func (s *Server) handleTestWebhook(w http.ResponseWriter, r *http.Request) {
 }
 
 type telegramUpdateResponse struct {
-	OK     bool `json:"ok"`
-	Result []struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Result      []struct {
 		UpdateID int64 `json:"update_id"`
 		Message  *struct {
 			Chat struct {
@@ -2048,6 +3251,7 @@ func (s *Server) telegramBindingLoop() {
 		u := fmt.Sprintf("https://api.telegram.org/bot%s/getUpdates?timeout=25&offset=%d", token, offset)
 		resp, err := (&http.Client{Timeout: 35 * time.Second}).Get(u)
 		if err != nil {
+			s.ops.telegramError(token, fmt.Errorf("getUpdates: %w", err))
 			time.Sleep(5 * time.Second)
 			continue
 		}
@@ -2055,6 +3259,7 @@ func (s *Server) telegramBindingLoop() {
 		_ = json.NewDecoder(resp.Body).Decode(&upd)
 		resp.Body.Close()
 		if !upd.OK {
+			s.ops.telegramError(token, fmt.Errorf("getUpdates: %d %s", resp.StatusCode, upd.Description))
 			time.Sleep(5 * time.Second)
 			continue
 		}
@@ -2149,10 +3354,20 @@ func (s *Server) tryAutoBindClientChat(botToken string, chatID int64, username s
 	if updated == 0 {
 		return true
 	}
-	_ = sendTelegram(botToken, chat, fmt.Sprintf("✅ Telegram автоматически привязан к %d лицензиям.", updated))
+	_ = s.telegramSend(telegramKindBind, botToken, chat, fmt.Sprintf("✅ Telegram автоматически привязан к %d лицензиям.", updated))
 	return true
 }
 
+// settingTelegramChatAutocapture lets the first chat that writes to the bot
+// become the admin notification target while telegram_chat_id is empty. Off
+// by default; /admin <ADMIN_TOKEN> is the secure way to bind the chat.
+const settingTelegramChatAutocapture = "telegram_chat_autocapture"
+
+func (s *Server) telegramChatAutocapture() bool {
+	on, _ := strconv.ParseBool(strings.TrimSpace(s.store.GetSetting(settingTelegramChatAutocapture)))
+	return on
+}
+
 func (s *Server) processTelegramCommand(botToken string, chatID int64, username, text string) {
 	if text == "" {
 		return
@@ -2176,30 +3391,50 @@ func (s *Server) processTelegramCommand(botToken string, chatID int64, username,
 						Details:   chat,
 						CreatedAt: time.Now().UTC().Format(time.RFC3339),
 					})
-					_ = sendTelegram(botToken, chat, "✅ Лицензия успешно привязана к вашему Telegram.")
+					_ = s.telegramSend(telegramKindBind, botToken, chat, "✅ Лицензия успешно привязана к вашему Telegram.")
 					return
 				}
 			}
 		}
 	}
 
-	// Auto-capture admin chat ID on first contact with the bot.
-	if strings.TrimSpace(s.store.GetSetting("telegram_chat_id")) == "" {
+	// Auto-capture admin chat ID on first contact with the bot, only when
+	// explicitly enabled: otherwise whoever writes first would get admin
+	// notifications.
+	if s.telegramChatAutocapture() && strings.TrimSpace(s.store.GetSetting("telegram_chat_id")) == "" {
 		_ = s.store.SetSetting("telegram_chat_id", chat)
-		_ = sendTelegram(botToken, chat, "✅ Chat ID автоматически привязан для админ-уведомлений.")
+		_ = s.store.AddAudit(AuditEvent{
+			ID:        randomHex(16),
+			Action:    "telegram_admin_autocapture",
+			Actor:     "bot",
+			Details:   chat,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		})
+		_ = s.telegramSend(telegramKindBind, botToken, chat, "✅ Chat ID автоматически привязан для админ-уведомлений.")
 	}
 
 	if strings.HasPrefix(lower, "/admin ") {
 		arg := strings.TrimSpace(text[len("/admin "):])
 		if arg == s.adminToken {
 			_ = s.store.SetSetting("telegram_chat_id", chat)
-			_ = sendTelegram(botToken, chat, "✅ Админ-уведомления подключены. Будут приходить события по всем лицензиям.")
+			_ = s.store.AddAudit(AuditEvent{
+				ID:        randomHex(16),
+				Action:    "telegram_admin_bind",
+				Actor:     "bot",
+				Details:   chat,
+				CreatedAt: time.Now().UTC().Format(time.RFC3339),
+			})
+			_ = s.telegramSend(telegramKindBind, botToken, chat, "✅ Админ-уведомления подключены. Будут приходить события по всем лицензиям.")
 		} else {
-			_ = sendTelegram(botToken, chat, "❌ Неверный admin token.")
+			_ = s.telegramSend(telegramKindBot, botToken, chat, "❌ Неверный admin token.")
 		}
 		return
 	}
 
+	if s.handleAdminBotCommand(botToken, chat, text) {
+		return
+	}
+
 	// Auto-bind client by Telegram username if uniquely matched in licenses.
 	_ = s.tryAutoBindClientChat(botToken, chatID, username)
 
@@ -2207,24 +3442,24 @@ func (s *Server) processTelegramCommand(botToken string, chatID int64, username,
 		payload := strings.TrimSpace(text[len("/link "):])
 		parts := strings.Fields(payload)
 		if len(parts) < 2 {
-			_ = sendTelegram(botToken, chat, "Формат: /link <LICENSE_KEY> <EMAIL>")
+			_ = s.telegramSend(telegramKindBot, botToken, chat, "Формат: /link &lt;LICENSE_KEY&gt; &lt;EMAIL&gt;")
 			return
 		}
 		key := strings.TrimSpace(parts[0])
 		email := strings.ToLower(strings.TrimSpace(parts[1]))
 		lic, err := s.store.GetLicenseByKey(key)
 		if err != nil {
-			_ = sendTelegram(botToken, chat, "❌ Лицензия не найдена.")
+			_ = s.telegramSend(telegramKindBot, botToken, chat, "❌ Лицензия не найдена.")
 			return
 		}
 		if strings.ToLower(strings.TrimSpace(lic.CustomerEmail)) != email {
-			_ = sendTelegram(botToken, chat, "❌ Email не совпадает с лицензией.")
+			_ = s.telegramSend(telegramKindBot, botToken, chat, "❌ Email не совпадает с лицензией.")
 			return
 		}
 		lic.ClientChatID = chat
 		lic.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
 		if err := s.store.UpdateLicense(lic); err != nil {
-			_ = sendTelegram(botToken, chat, "❌ Не удалось сохранить привязку.")
+			_ = s.telegramSend(telegramKindBot, botToken, chat, "❌ Не удалось сохранить привязку.")
 			return
 		}
 		_ = s.store.AddAudit(AuditEvent{
@@ -2235,13 +3470,16 @@ func (s *Server) processTelegramCommand(botToken string, chatID int64, username,
 			Details:   chat,
 			CreatedAt: time.Now().UTC().Format(time.RFC3339),
 		})
-		_ = sendTelegram(botToken, chat, "✅ Telegram привязан к лицензии "+lic.LicenseKey)
+		_ = s.telegramSend(telegramKindBind, botToken, chat, "✅ Telegram привязан к лицензии "+lic.LicenseKey)
 		return
 	}
 
 	if lower == "/start" || lower == "/help" {
-		help := "Команды:\n/admin <ADMIN_TOKEN> — привязать админ-уведомления\n/link <LICENSE_KEY> <EMAIL> — привязать лицензию клиента"
-		_ = sendTelegram(botToken, chat, help)
+		help := "Команды:\n/admin &lt;ADMIN_TOKEN&gt; — привязать админ-уведомления\n/link &lt;LICENSE_KEY&gt; &lt;EMAIL&gt; — привязать лицензию клиента"
+		if s.isAdminChat(chat) {
+			help += adminBotHelp()
+		}
+		_ = s.telegramSend(telegramKindBot, botToken, chat, help)
 	}
 }
 
@@ -2260,78 +3498,280 @@ func sendTelegram(botToken, chatID, text string) error {
 	return nil
 }
 
-func sendWebhook(url, event string, data any) error {
+// webhookSignatureHeader carries "sha256=" + hex HMAC-SHA256 of the raw
+// request body keyed with the webhook_secret setting.
+const webhookSignatureHeader = "X-Nodax-Signature"
+
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBody is the JSON posted for an event. It is built once per delivery
+// so retries carry the same bytes and signature.
+func webhookBody(event string, data any) []byte {
 	body, _ := json.Marshal(map[string]any{"event": event, "data": data, "time": time.Now().UTC().Format(time.RFC3339)})
+	return body
+}
+
+// webhookStatusError is a delivery the receiver answered with a non-2xx code.
+type webhookStatusError struct {
+	code int
+	body string
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("webhook: %d %s", e.code, e.body)
+}
+
+// postWebhook makes one delivery attempt; with a non-empty secret the body
+// is signed in webhookSignatureHeader.
+func postWebhook(ctx context.Context, url, secret string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(webhookSignatureHeader, webhookSignature(secret, body))
+	}
 	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		rb, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
-		return fmt.Errorf("webhook: %d %s", resp.StatusCode, string(rb))
+		return &webhookStatusError{code: resp.StatusCode, body: string(rb)}
 	}
 	return nil
 }
 
-func (s *Server) fireWebhook(event string, data any) {
-	url := s.store.GetSetting("webhook_url")
-	if url == "" {
-		return
+// sendWebhook posts the event once, without retries.
+func sendWebhook(url, secret, event string, data any) error {
+	return postWebhook(context.Background(), url, secret, webhookBody(event, data))
+}
+
+// sessionPurger drops expired sessions at startup and then hourly, so the
+// sessions bucket and backups do not grow forever.
+func (s *Server) sessionPurger() {
+	for {
+		if n, err := s.store.PurgeExpiredSessions(); err != nil {
+			log.Printf("[WARN] очистка сессий: %v", err)
+		} else if n > 0 {
+			log.Printf("Удалено просроченных сессий: %d", n)
+		}
+		time.Sleep(time.Hour)
 	}
-	go func() { _ = sendWebhook(url, event, data) }()
 }
 
+// Settings stamped by the expiration notifier so operators can see it run.
+const (
+	settingNotifierLastRun     = "notifier_last_run"
+	settingNotifierLastError   = "notifier_last_error"
+	settingNotifierLastErrorAt = "notifier_last_error_at"
+)
+
 func (s *Server) expirationNotifier() {
 	for {
-		time.Sleep(6 * time.Hour)
-		token := s.store.GetSetting("telegram_bot_token")
-		adminChatID := s.store.GetSetting("telegram_chat_id")
-		daysStr := s.store.GetSetting("notify_days_before")
-		if token == "" {
-			continue
+		time.Sleep(s.notifyInterval)
+		// A round due in the quiet hours is shifted to their end, not skipped.
+		if until := s.quietUntil(time.Now()); !until.IsZero() {
+			log.Printf("уведомления об истечении отложены до %s (тихие часы)", until.Format(time.RFC3339))
+			time.Sleep(time.Until(until))
 		}
-		daysBefore := 7
-		if n, err := strconv.Atoi(daysStr); err == nil && n > 0 {
-			daysBefore = n
+		now := time.Now().UTC().Format(time.RFC3339)
+		_ = s.store.SetSetting(settingNotifierLastRun, now)
+		if err := s.notifyExpiringLicenses(); err != nil {
+			msg := err.Error()
+			if token := s.store.GetSetting("telegram_bot_token"); token != "" {
+				msg = strings.ReplaceAll(msg, token, "***")
+			}
+			log.Printf("[WARN] уведомления об истечении: %s", msg)
+			_ = s.store.SetSetting(settingNotifierLastError, msg)
+			_ = s.store.SetSetting(settingNotifierLastErrorAt, now)
 		}
-		list, err := s.store.ListLicenses()
-		if err != nil {
-			continue
+	}
+}
+
+// notifyExpiringLicenses sends one round of expiration notices. A panic while
+// handling one license is recovered and reported, and the round goes on with
+// the next license.
+func (s *Server) notifyExpiringLicenses() (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
 		}
-		now := time.Now().UTC()
-		for _, lic := range list {
-			if strings.ToLower(lic.Status) != "active" {
-				continue
-			}
-			exp, err := time.Parse(time.RFC3339, lic.ExpiresAt)
-			if err != nil {
-				continue
-			}
-			daysLeft := int(exp.Sub(now).Hours() / 24)
-			if daysLeft >= 0 && daysLeft <= daysBefore {
-				adminMsg := fmt.Sprintf("⚠️ Лицензия <b>%s</b> (%s) истекает через <b>%d дн.</b>\nКлюч: <code>%s</code>", lic.CustomerName, lic.Plan, daysLeft, lic.LicenseKey)
-				if strings.TrimSpace(adminChatID) != "" {
-					_ = sendTelegram(token, adminChatID, adminMsg)
-				}
-				clientChat := strings.TrimSpace(lic.ClientChatID)
-				if clientChat != "" {
-					clientMsg := fmt.Sprintf("⚠️ Ваша лицензия (%s) истекает через <b>%d дн.</b>\nКлюч: <code>%s</code>", lic.Plan, daysLeft, lic.LicenseKey)
-					_ = sendTelegram(token, clientChat, clientMsg)
-				}
-				s.fireWebhook("license.expiring", map[string]any{"license": lic, "daysLeft": daysLeft})
-			}
+	}()
+	token := s.store.GetSetting("telegram_bot_token")
+	adminChatID := s.store.GetSetting("telegram_chat_id")
+	if token == "" {
+		return nil
+	}
+	daysBefore := s.notifyDaysBefore()
+	list, err := s.store.ListLicenses()
+	if err != nil {
+		return fmt.Errorf("list licenses: %w", err)
+	}
+	now := time.Now().UTC()
+	var errs []error
+	for _, lic := range list {
+		if lerr := s.notifyExpiringLicense(token, adminChatID, lic, now, daysBefore); lerr != nil {
+			errs = append(errs, fmt.Errorf("license %s: %w", lic.ID, lerr))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) notifyExpiringLicense(token, adminChatID string, lic License, now time.Time, daysBefore int) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	n, ok := s.expiringNotice(lic, now, daysBefore)
+	if !ok || n.AlreadySent {
+		return nil
+	}
+	// Each recipient is marked on its own: a failed Telegram send is retried
+	// next round for that chat only, while the webhook has its own retries
+	// and fires once per bucket whatever happens to Telegram.
+	bucket := expiryNoticeBucket(lic, n.DaysLeft)
+	var errs []error
+	var marks noticeMarks
+	if strings.TrimSpace(adminChatID) != "" && lic.NotifiedExpiry != bucket {
+		if err := s.telegramSend(telegramKindNotify, token, adminChatID, n.AdminMessage); err != nil {
+			errs = append(errs, err)
+		} else {
+			marks.Admin = true
+		}
+	}
+	if n.ClientChatID != "" && lic.ClientNotified != bucket {
+		if err := s.telegramSend(telegramKindNotify, token, n.ClientChatID, n.ClientMessage); err != nil {
+			errs = append(errs, err)
+		} else {
+			marks.Client = true
+		}
+	}
+	if lic.WebhookExpiry != bucket {
+		s.fireWebhook("license.expiring", lic.ID, map[string]any{"license": lic, "daysLeft": n.DaysLeft})
+		marks.Webhook = true
+	}
+	if marks != (noticeMarks{}) {
+		if err := s.store.MarkLicenseNotified(lic.ID, bucket, marks); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// expiryNoticeBucket identifies one expiration notice: the expiry date and
+// the day count. A license gets one notice per bucket; extending it starts
+// a new series.
+func expiryNoticeBucket(lic License, daysLeft int) string {
+	return lic.ExpiresAt + "/" + strconv.Itoa(daysLeft)
+}
+
+// notifyDaysBefore is the notify_days_before threshold, 7 by default.
+func (s *Server) notifyDaysBefore() int {
+	if n, err := strconv.Atoi(s.store.GetSetting("notify_days_before")); err == nil && n > 0 {
+		return n
+	}
+	return 7
+}
+
+// expiringNotice is what the notifier sends about one license.
+type expiringNotice struct {
+	LicenseID     string `json:"licenseId"`
+	LicenseKey    string `json:"licenseKey"`
+	CustomerName  string `json:"customerName"`
+	ExpiresAt     string `json:"expiresAt"`
+	DaysLeft      int    `json:"daysLeft"`
+	AdminMessage  string `json:"adminMessage"`
+	ClientChatID  string `json:"clientChatId,omitempty"`
+	ClientMessage string `json:"clientMessage,omitempty"`
+	// AlreadySent is set when this notice went out in earlier rounds to the
+	// webhook and to every configured Telegram chat.
+	AlreadySent bool `json:"alreadySent"`
+}
+
+// expiringNotice decides whether lic is due for an expiration notice at now
+// and renders the messages. The notifier and its preview share it.
+func (s *Server) expiringNotice(lic License, now time.Time, daysBefore int) (expiringNotice, bool) {
+	if strings.ToLower(lic.Status) != "active" {
+		return expiringNotice{}, false
+	}
+	exp, err := time.Parse(time.RFC3339, lic.ExpiresAt)
+	if err != nil {
+		return expiringNotice{}, false
+	}
+	daysLeft := int(exp.Sub(now).Hours() / 24)
+	if daysLeft < 0 || daysLeft > daysBefore {
+		return expiringNotice{}, false
+	}
+	bucket := expiryNoticeBucket(lic, daysLeft)
+	n := expiringNotice{
+		LicenseID:    lic.ID,
+		LicenseKey:   lic.LicenseKey,
+		CustomerName: lic.CustomerName,
+		ExpiresAt:    lic.ExpiresAt,
+		DaysLeft:     daysLeft,
+		AdminMessage: renderNotifyTemplate(s.notifyTemplate(notifyAdminExpiring, s.notifyLanguage()), lic, daysLeft),
+		ClientChatID: strings.TrimSpace(lic.ClientChatID),
+	}
+	adminDone := strings.TrimSpace(s.store.GetSetting("telegram_chat_id")) == "" || lic.NotifiedExpiry == bucket
+	clientDone := n.ClientChatID == "" || lic.ClientNotified == bucket
+	n.AlreadySent = adminDone && clientDone && lic.WebhookExpiry == bucket
+	if n.ClientChatID != "" {
+		n.ClientMessage = renderNotifyTemplate(s.notifyTemplate(notifyClientExpiring, s.clientNotifyLanguage(lic)), lic, daysLeft)
+	}
+	return n, true
+}
+
+// handleNotificationsPreview lists the expiration notices due right now,
+// without sending anything; alreadySent marks those the notifier will skip.
+func (s *Server) handleNotificationsPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	list, err := s.store.ListLicenses()
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	now := time.Now().UTC()
+	daysBefore := s.notifyDaysBefore()
+	items := make([]expiringNotice, 0)
+	for _, lic := range list {
+		if n, ok := s.expiringNotice(lic, now, daysBefore); ok {
+			items = append(items, n)
 		}
 	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DaysLeft < items[j].DaysLeft })
+	respondJSON(w, 200, map[string]any{
+		"items":               items,
+		"daysBefore":          daysBefore,
+		"quietHours":          s.store.GetSetting(settingNotifyQuietHours),
+		"quietUntil":          formatOptionalTime(s.quietUntil(time.Now())),
+		"telegramConfigured":  strings.TrimSpace(s.store.GetSetting("telegram_bot_token")) != "",
+		"adminChatConfigured": strings.TrimSpace(s.store.GetSetting("telegram_chat_id")) != "",
+	})
+}
+
+// signBytes signs body with the server key and returns the base64
+// signature, the form used by every signed response.
+func signBytes(priv ed25519.PrivateKey, body []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(priv, body))
 }
 
 func respondSignedPayload(w http.ResponseWriter, payload signedValidatePayload, priv ed25519.PrivateKey) {
 	body, _ := json.Marshal(payload)
-	sig := ed25519.Sign(priv, body)
 	respondJSON(w, 200, map[string]any{
 		"payload":   payload,
-		"signature": base64.StdEncoding.EncodeToString(sig),
+		"signature": signBytes(priv, body),
 		"algorithm": "ed25519",
 	})
 }
@@ -2366,78 +3806,164 @@ func randomHex(bytesLen int) string {
 	return hex.EncodeToString(b)
 }
 
-func requestClientIP(r *http.Request) string {
-	xff := strings.TrimSpace(r.Header.Get("X-Forwarded-For"))
-	if xff != "" {
-		parts := strings.Split(xff, ",")
-		if len(parts) > 0 {
-			ip := strings.TrimSpace(parts[0])
-			if ip != "" {
-				return ip
-			}
+// licenseKeyFormat describes generated keys: "NDX-" followed by Groups
+// dash-separated groups of GroupLen characters from Charset.
+type licenseKeyFormat struct {
+	Groups   int
+	GroupLen int
+	Charset  string // "hex" or "base32"
+}
+
+const (
+	minLicenseKeyBits      = 64
+	maxLicenseKeyLen       = 128
+	maxKeyGenerateAttempts = 5
+)
+
+var (
+	defaultLicenseKeyFormat = licenseKeyFormat{Groups: 4, GroupLen: 6, Charset: "hex"}
+	licenseKeyAlphabets     = map[string]string{
+		"hex":    "0123456789ABCDEF",
+		"base32": "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567",
+	}
+)
+
+// validate rejects formats that are malformed or whose keyspace is small
+// enough to make collisions likely.
+func (f licenseKeyFormat) validate() error {
+	alphabet, ok := licenseKeyAlphabets[f.Charset]
+	if !ok {
+		return fmt.Errorf("key_charset must be hex or base32")
+	}
+	if f.Groups < 1 || f.GroupLen < 1 {
+		return fmt.Errorf("key_groups and key_group_len must be positive")
+	}
+	if f.Groups*(f.GroupLen+1) > maxLicenseKeyLen {
+		return fmt.Errorf("license key longer than %d characters", maxLicenseKeyLen)
+	}
+	bitsPerChar := 4
+	if len(alphabet) == 32 {
+		bitsPerChar = 5
+	}
+	if bits := f.Groups * f.GroupLen * bitsPerChar; bits < minLicenseKeyBits {
+		return fmt.Errorf("license key format gives %d random bits, at least %d required", bits, minLicenseKeyBits)
+	}
+	return nil
+}
+
+// licenseKeyFormat reads key_groups, key_group_len and key_charset, falling
+// back to the default format when unset or invalid.
+func (s *Server) licenseKeyFormat() licenseKeyFormat {
+	f, err := licenseKeyFormatFrom(s.store.GetSetting)
+	if err != nil {
+		return defaultLicenseKeyFormat
+	}
+	return f
+}
+
+func licenseKeyFormatFrom(get func(string) string) (licenseKeyFormat, error) {
+	f := defaultLicenseKeyFormat
+	if v := strings.TrimSpace(get("key_groups")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return f, fmt.Errorf("key_groups must be an integer")
 		}
+		f.Groups = n
 	}
-	if xrip := strings.TrimSpace(r.Header.Get("X-Real-IP")); xrip != "" {
-		return xrip
+	if v := strings.TrimSpace(get("key_group_len")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return f, fmt.Errorf("key_group_len must be an integer")
+		}
+		f.GroupLen = n
 	}
-	remote := strings.TrimSpace(r.RemoteAddr)
-	if remote == "" {
-		return ""
+	if v := strings.ToLower(strings.TrimSpace(get("key_charset"))); v != "" {
+		f.Charset = v
 	}
-	host, _, err := net.SplitHostPort(remote)
-	if err == nil {
-		return host
+	return f, f.validate()
+}
+
+// newLicenseKey draws a license key in the configured format.
+func (s *Server) newLicenseKey() string {
+	gen := s.keyGen
+	if gen == nil {
+		gen = generateLicenseKey
 	}
-	return remote
+	return gen(s.licenseKeyFormat())
 }
 
-func generateLicenseKey() string {
-	parts := make([]string, 4)
-	for i := 0; i < len(parts); i++ {
-		chunk := strings.ToUpper(randomHex(3))
-		parts[i] = chunk
+func generateLicenseKey(f licenseKeyFormat) string {
+	alphabet := licenseKeyAlphabets[f.Charset]
+	// 16 and 32 divide 256, so masking a random byte keeps the distribution uniform.
+	mask := byte(len(alphabet) - 1)
+	buf := make([]byte, f.Groups*f.GroupLen)
+	_, _ = rand.Read(buf)
+	parts := make([]string, f.Groups)
+	for i := range parts {
+		chunk := make([]byte, f.GroupLen)
+		for j := range chunk {
+			chunk[j] = alphabet[buf[i*f.GroupLen+j]&mask]
+		}
+		parts[i] = string(chunk)
 	}
 	return "NDX-" + strings.Join(parts, "-")
 }
 
-func defaultMaxAgentsByPlan(plan string) int {
-	p := strings.ToLower(strings.TrimSpace(plan))
-	if p == "pro" {
-		return 30
+// defaultPlan returns the plan used when a create request omits one:
+// default_plan, else basic, else the first plan of the table.
+func (s *Server) defaultPlan() string {
+	if v := s.store.GetSetting("default_plan"); s.isKnownPlan(v) {
+		return strings.ToLower(strings.TrimSpace(v))
 	}
-	if p == "enterprise" {
-		return 0 // unlimited
+	plans := s.plans()
+	if _, ok := plans["basic"]; ok {
+		return "basic"
 	}
-	return 10
+	return sortedPlanNames(plans)[0]
 }
 
-func loadOrCreateSigningKey() (ed25519.PrivateKey, ed25519.PublicKey, error) {
+// defaultValidDays returns the validity period used when a create request
+// specifies neither validDays nor expiresAt.
+func (s *Server) defaultValidDays() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(s.store.GetSetting("default_valid_days"))); err == nil && n > 0 {
+		return n
+	}
+	return 365
+}
+
+// loadOrCreateSigningKey also returns the key file's modification time, which
+// serves as the key creation time.
+func loadOrCreateSigningKey() (ed25519.PrivateKey, ed25519.PublicKey, time.Time, error) {
 	path := strings.TrimSpace(os.Getenv("LICENSE_SIGN_KEY_PATH"))
 	if path == "" {
 		path = resolveDataFilePath("license-sign.key")
 	}
 
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-		return nil, nil, err
+		return nil, nil, time.Time{}, err
 	}
 
 	if raw, err := os.ReadFile(path); err == nil {
 		key := ed25519.PrivateKey(raw)
 		if len(key) != ed25519.PrivateKeySize {
-			return nil, nil, fmt.Errorf("invalid private key size")
+			return nil, nil, time.Time{}, fmt.Errorf("invalid private key size")
 		}
 		pub := key.Public().(ed25519.PublicKey)
-		return key, pub, nil
+		var created time.Time
+		if st, err := os.Stat(path); err == nil {
+			created = st.ModTime()
+		}
+		return key, pub, created, nil
 	}
 
 	pub, priv, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, time.Time{}, err
 	}
 	if err := os.WriteFile(path, priv, 0600); err != nil {
-		return nil, nil, err
+		return nil, nil, time.Time{}, err
 	}
-	return priv, pub, nil
+	return priv, pub, time.Now(), nil
 }
 
 func resolveDataFilePath(fileName string) string {
@@ -2451,10 +3977,42 @@ func resolveDataFilePath(fileName string) string {
 	return filepath.Join(filepath.Dir(ex), fileName)
 }
 
+const requestIDHeader = "X-Request-ID"
+
+// withRequestID makes sure every request carries a correlation id: the one
+// sent by the caller (e.g. central) is kept, otherwise a new one is generated.
+// The id is echoed back in the response headers.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := sanitizeRequestID(r.Header.Get(requestIDHeader))
+		if id == "" {
+			id = randomHex(8)
+		}
+		r.Header.Set(requestIDHeader, id)
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func sanitizeRequestID(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) > 64 {
+		v = v[:64]
+	}
+	for _, ch := range v {
+		if (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '-' || ch == '_' || ch == '.' {
+			continue
+		}
+		return ""
+	}
+	return v
+}
+
 func cors(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Request-ID, X-Confirm-Password")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, PUT, DELETE, OPTIONS")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
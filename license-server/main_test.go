@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestStore opens a fresh store in a temp dir.
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	st, err := NewStore(filepath.Join(t.TempDir(), "license-server.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+// seqKeyGen returns keys in order, repeating the last one, and counts calls.
+func seqKeyGen(calls *int, keys ...string) func(licenseKeyFormat) string {
+	return func(licenseKeyFormat) string {
+		i := min(*calls, len(keys)-1)
+		*calls++
+		return keys[i]
+	}
+}
+
+func TestCreateLicenseRetriesKeyCollision(t *testing.T) {
+	st := newTestStore(t)
+	if err := st.CreateLicense(&License{ID: "taken", LicenseKey: "NDX-TAKEN", Status: "active"}); err != nil {
+		t.Fatal(err)
+	}
+	create := func(s *Server) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/licenses", strings.NewReader(`{"customerName":"A","validDays":30}`))
+		rec := httptest.NewRecorder()
+		s.handleLicenses(rec, req)
+		return rec
+	}
+
+	t.Run("retry draws a fresh key", func(t *testing.T) {
+		calls := 0
+		s := &Server{store: st, keyGen: seqKeyGen(&calls, "NDX-TAKEN", "NDX-TAKEN", "NDX-FRESH")}
+		rec := create(s)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("status = %d, want 201; body %s", rec.Code, rec.Body)
+		}
+		if !strings.Contains(rec.Body.String(), `"licenseKey":"NDX-FRESH"`) {
+			t.Errorf("body = %s, want licenseKey NDX-FRESH", rec.Body)
+		}
+		if calls != 3 {
+			t.Errorf("generator called %d times, want 3", calls)
+		}
+	})
+
+	t.Run("exhausted attempts return 409", func(t *testing.T) {
+		calls := 0
+		s := &Server{store: st, keyGen: seqKeyGen(&calls, "NDX-TAKEN")}
+		rec := create(s)
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("status = %d, want 409; body %s", rec.Code, rec.Body)
+		}
+		if !strings.Contains(rec.Body.String(), "could not generate a unique license key") {
+			t.Errorf("body = %s", rec.Body)
+		}
+		if calls != maxKeyGenerateAttempts {
+			t.Errorf("generator called %d times, want %d", calls, maxKeyGenerateAttempts)
+		}
+	})
+}
+
+func TestChangePasswordRevokesOtherAdminSessions(t *testing.T) {
+	st := newTestStore(t)
+	if err := st.EnsureAdmin("old-pass"); err != nil {
+		t.Fatal(err)
+	}
+	current, err := st.CreateAdminSession(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := st.CreateAdminSession(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := st.CreateClientSession("lic-1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{store: st}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/change-password", strings.NewReader(`{"oldPassword":"old-pass","newPassword":"new-pass"}`))
+	req.AddCookie(&http.Cookie{Name: "session", Value: current.ID})
+	rec := httptest.NewRecorder()
+	s.handleChangePassword(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `"sessionsRevoked":1`) {
+		t.Errorf("body = %s, want sessionsRevoked 1", rec.Body)
+	}
+	if st.ValidateSession(other.ID) {
+		t.Error("other admin session still validates after password change")
+	}
+	if !st.ValidateSession(current.ID) {
+		t.Error("caller's own session was revoked")
+	}
+	if _, ok := st.ValidateClientSession(client.ID); !ok {
+		t.Error("client portal session was revoked")
+	}
+	if !st.CheckPassword("new-pass") {
+		t.Error("new password not stored")
+	}
+}
+
+func TestSessionRoutesAreAdminOnly(t *testing.T) {
+	st := newTestStore(t)
+	sess, err := st.CreateAdminSession(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{store: st}
+	key := adminIdentity{Via: "apikey", APIKey: &APIKey{ID: "k", Name: "k", Role: "full"}}
+
+	rec := httptest.NewRecorder()
+	s.handleSessions(rec, withIdentity(httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil), key))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("list with API key: status = %d, want 403", rec.Code)
+	}
+
+	req := withIdentity(httptest.NewRequest(http.MethodDelete, "/api/v1/sessions/x", nil), key)
+	req.SetPathValue("id", SessionHandle(sess.ID))
+	rec = httptest.NewRecorder()
+	s.handleSessionRevoke(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("revoke with API key: status = %d, want 403", rec.Code)
+	}
+	if sessions, _ := st.ListSessions(); len(sessions) != 1 {
+		t.Errorf("%d sessions left, want 1", len(sessions))
+	}
+}
+
+func TestSettingsMasksSecrets(t *testing.T) {
+	st := newTestStore(t)
+	if err := st.SetSetting("webhook_secret", "whsec-0123456789"); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{store: st}
+
+	get := func(id adminIdentity) map[string]string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleSettings(rec, withIdentity(httptest.NewRequest(http.MethodGet, "/api/v1/settings", nil), id))
+		var out map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	if got := get(adminIdentity{Via: "session"})["webhook_secret"]; got != "••••6789" {
+		t.Errorf("admin sees webhook_secret %q, want ••••6789", got)
+	}
+	if _, ok := get(adminIdentity{Via: "apikey", APIKey: &APIKey{Role: "readonly"}})["webhook_secret"]; ok {
+		t.Error("readonly key sees webhook_secret")
+	}
+
+	// Saving the form sends the masked value back; it must keep the secret.
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/settings", strings.NewReader(`{"webhook_secret":"••••6789"}`))
+	s.handleSettings(httptest.NewRecorder(), req)
+	if got := st.GetSetting("webhook_secret"); got != "whsec-0123456789" {
+		t.Errorf("webhook_secret = %q after echo, want it unchanged", got)
+	}
+}
+
+// TestSettingsColdCacheReadsDoNotRace is meant for go test -race: a read
+// that fills the cache must not share the map with a concurrent write.
+func TestSettingsColdCacheReadsDoNotRace(t *testing.T) {
+	st := newTestStore(t)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 200 {
+			st.settingsMu.Lock()
+			st.settings = nil
+			st.settingsMu.Unlock()
+			_ = st.GetSetting("brand_name")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := range 200 {
+			_ = st.SetSetting("brand_name", strconv.Itoa(i))
+		}
+	}()
+	wg.Wait()
+}
+
+func TestExpiryNoticeIsMarkedPerRecipient(t *testing.T) {
+	st := newTestStore(t)
+	s := &Server{store: st}
+	now := time.Now().UTC()
+	lic := &License{ID: "lic", LicenseKey: "NDX-EXP", Status: "active", Plan: "pro", ClientChatID: "42", ExpiresAt: now.Add(72*time.Hour + time.Hour).Format(time.RFC3339)}
+	if err := st.CreateLicense(lic); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SetSetting("telegram_chat_id", "1"); err != nil {
+		t.Fatal(err)
+	}
+	alreadySent := func() bool {
+		t.Helper()
+		got, err := st.GetLicenseByID("lic")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, ok := s.expiringNotice(*got, now, 7)
+		if !ok {
+			t.Fatal("license is not due for a notice")
+		}
+		return n.AlreadySent
+	}
+	bucket := expiryNoticeBucket(*lic, 3)
+
+	// The client got the notice and the webhook fired, the admin send failed.
+	if err := st.MarkLicenseNotified("lic", bucket, noticeMarks{Client: true, Webhook: true}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := st.GetLicenseByID("lic")
+	if got.ClientNotified != bucket || got.NotifiedExpiry != "" {
+		t.Fatalf("marks = admin %q client %q, want only the client marked", got.NotifiedExpiry, got.ClientNotified)
+	}
+	if alreadySent() {
+		t.Error("alreadySent with the admin chat still pending")
+	}
+
+	if err := st.MarkLicenseNotified("lic", bucket, noticeMarks{Admin: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !alreadySent() {
+		t.Error("alreadySent = false after every recipient got the notice")
+	}
+
+	// Without any chat configured only the webhook counts.
+	if err := st.SetSetting("telegram_chat_id", ""); err != nil {
+		t.Fatal(err)
+	}
+	lic2 := &License{ID: "lic2", LicenseKey: "NDX-EXP2", Status: "active", Plan: "pro", ExpiresAt: lic.ExpiresAt}
+	if err := st.CreateLicense(lic2); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.MarkLicenseNotified("lic2", bucket, noticeMarks{Webhook: true}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = st.GetLicenseByID("lic2")
+	if n, _ := s.expiringNotice(*got, now, 7); !n.AlreadySent || got.NotifiedExpiry != "" {
+		t.Errorf("no chats: alreadySent = %v, notifiedExpiry = %q; want true and unset", n.AlreadySent, got.NotifiedExpiry)
+	}
+}
+
+func TestPriceCurrencyIsNotAPrice(t *testing.T) {
+	st := newTestStore(t)
+	s := &Server{store: st}
+	if err := st.SetSetting(settingPriceCurrency, "EUR"); err != nil {
+		t.Fatal(err)
+	}
+	if s.pricesConfigured() {
+		t.Error("pricesConfigured = true with only the currency set")
+	}
+	if got := s.planPrice("currency"); got != 0 {
+		t.Errorf("planPrice(currency) = %v, want 0", got)
+	}
+	if err := st.SetSetting(settingPricePrefix+"pro", "4200"); err != nil {
+		t.Fatal(err)
+	}
+	if !s.pricesConfigured() || s.planPrice("pro") != 4200 {
+		t.Errorf("pricesConfigured = %v, planPrice(pro) = %v; want true and 4200", s.pricesConfigured(), s.planPrice("pro"))
+	}
+}
+
+func TestImportRetriesGeneratedKeyCollision(t *testing.T) {
+	st := newTestStore(t)
+	for _, key := range []string{"NDX-TAKEN", "NDX-KEEP"} {
+		if err := st.CreateLicense(&License{ID: key, LicenseKey: key, Status: "active"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	calls := 0
+	s := &Server{store: st, keyGen: seqKeyGen(&calls, "NDX-TAKEN", "NDX-FRESH")}
+	exp := time.Now().UTC().AddDate(1, 0, 0).Format(time.RFC3339)
+	csvBody := "Ключ,Клиент,Тариф,Истекает\n" +
+		",A,pro," + exp + "\n" +
+		"NDX-KEEP,B,pro," + exp + "\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/licenses/import", strings.NewReader(csvBody))
+	rec := httptest.NewRecorder()
+	s.handleLicensesImport(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Created int               `json:"created"`
+		Skipped int               `json:"skipped"`
+		Results []importRowResult `json:"results"`
+		Errors  []importRowError  `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Created != 1 || resp.Skipped != 1 {
+		t.Fatalf("created = %d, skipped = %d; want 1 and 1 (body %s)", resp.Created, resp.Skipped, rec.Body)
+	}
+	if _, err := st.GetLicenseByKey("NDX-FRESH"); err != nil {
+		t.Errorf("regenerated key not stored: %v", err)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Row != 3 {
+		t.Errorf("errors = %+v, want the skipped row 3", resp.Errors)
+	}
+}
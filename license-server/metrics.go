@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// handleMetrics exposes counters in the Prometheus text format. It sits
+// behind withAdmin, so scrapers authenticate with a readonly API key.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	var b strings.Builder
+	s.writeLicenseMetrics(&b)
+
+	validates := s.ops.validateCounts()
+	reasons := make([]string, 0, len(validates))
+	for reason := range validates {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	b.WriteString("# HELP nodax_license_validate_requests_total Validate responses by reason, \"ok\" for a valid license\n")
+	b.WriteString("# TYPE nodax_license_validate_requests_total counter\n")
+	for _, reason := range reasons {
+		b.WriteString(fmt.Sprintf("nodax_license_validate_requests_total{reason=\"%s\"} %d\n", escapeLabel(reason), validates[reason]))
+	}
+
+	byKind, _, _ := s.ops.telegramSends()
+	kinds := make([]string, 0, len(byKind))
+	for kind := range byKind {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	b.WriteString("# HELP nodax_license_telegram_messages_total Telegram sendMessage calls by message kind and result\n")
+	b.WriteString("# TYPE nodax_license_telegram_messages_total counter\n")
+	for _, kind := range kinds {
+		b.WriteString(fmt.Sprintf("nodax_license_telegram_messages_total{kind=\"%s\",result=\"ok\"} %d\n", escapeLabel(kind), byKind[kind]["ok"]))
+		b.WriteString(fmt.Sprintf("nodax_license_telegram_messages_total{kind=\"%s\",result=\"error\"} %d\n", escapeLabel(kind), byKind[kind]["failed"]))
+	}
+
+	s.ops.mu.Lock()
+	lastErrAt := s.ops.telegramLastErrorAt
+	s.ops.mu.Unlock()
+	b.WriteString("# HELP nodax_license_telegram_last_error_timestamp_seconds Time of the last failed Telegram call, 0 if none\n")
+	b.WriteString("# TYPE nodax_license_telegram_last_error_timestamp_seconds gauge\n")
+	if lastErrAt.IsZero() {
+		b.WriteString("nodax_license_telegram_last_error_timestamp_seconds 0\n")
+	} else {
+		b.WriteString(fmt.Sprintf("nodax_license_telegram_last_error_timestamp_seconds %d\n", lastErrAt.Unix()))
+	}
+
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// writeLicenseMetrics writes the store gauges: licenses by effective status,
+// live sessions by kind and API keys. A store read that fails leaves its
+// gauges out rather than reporting zeros.
+func (s *Server) writeLicenseMetrics(b *strings.Builder) {
+	if list, err := s.store.ListLicenses(); err == nil {
+		now := time.Now().UTC()
+		byStatus := map[string]int{}
+		for i := range list {
+			byStatus[effectiveLicenseStatus(&list[i], now)]++
+		}
+		b.WriteString("# HELP nodax_license_total Stored licenses\n")
+		b.WriteString("# TYPE nodax_license_total gauge\n")
+		b.WriteString(fmt.Sprintf("nodax_license_total %d\n", len(list)))
+		for _, st := range []string{"active", "expired", "revoked", "suspended"} {
+			b.WriteString(fmt.Sprintf("# HELP nodax_license_%s Licenses whose effective status is %s\n", st, st))
+			b.WriteString(fmt.Sprintf("# TYPE nodax_license_%s gauge\n", st))
+			b.WriteString(fmt.Sprintf("nodax_license_%s %d\n", st, byStatus[st]))
+		}
+	}
+
+	if sessions, err := s.store.ListSessions(); err == nil {
+		byKind := map[string]int{"admin": 0, "client": 0}
+		for _, sess := range sessions {
+			byKind[sess.Kind]++
+		}
+		kinds := make([]string, 0, len(byKind))
+		for kind := range byKind {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		b.WriteString("# HELP nodax_license_sessions Unexpired login sessions by kind\n")
+		b.WriteString("# TYPE nodax_license_sessions gauge\n")
+		for _, kind := range kinds {
+			b.WriteString(fmt.Sprintf("nodax_license_sessions{kind=\"%s\"} %d\n", escapeLabel(kind), byKind[kind]))
+		}
+	}
+
+	if keys, err := s.store.ListAPIKeys(); err == nil {
+		byRole := map[string]int{"full": 0, "readonly": 0}
+		for _, k := range keys {
+			byRole[k.Role]++
+		}
+		roles := make([]string, 0, len(byRole))
+		for role := range byRole {
+			roles = append(roles, role)
+		}
+		sort.Strings(roles)
+		b.WriteString("# HELP nodax_license_api_keys API keys by role\n")
+		b.WriteString("# TYPE nodax_license_api_keys gauge\n")
+		for _, role := range roles {
+			b.WriteString(fmt.Sprintf("nodax_license_api_keys{role=\"%s\"} %d\n", escapeLabel(role), byRole[role]))
+		}
+	}
+}
+
+// escapeLabel makes v safe inside a quoted Prometheus label value.
+func escapeLabel(v string) string {
+	v = strings.ReplaceAll(v, "\\", "\\\\")
+	v = strings.ReplaceAll(v, "\"", "\\\"")
+	v = strings.ReplaceAll(v, "\n", "")
+	return v
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// bucketMeta holds store bookkeeping such as the schema version. It is not
+// part of backups, so a restore keeps the version of the running binary.
+const (
+	bucketMeta       = "meta"
+	schemaVersionKey = "schema_version"
+)
+
+// storeMigration is one ordered, idempotent change applied in a single
+// transaction together with the version bump.
+type storeMigration struct {
+	version int
+	name    string
+	apply   func(tx *bbolt.Tx) error
+}
+
+var storeMigrations = []storeMigration{
+	{1, "create buckets", func(tx *bbolt.Tx) error {
+		for _, name := range []string{bucketLicenses, bucketLicenseByKey, bucketAudit, bucketAdmin, bucketSessions, bucketAPIKeys, bucketSettings} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{2, "normalize license plan and status", func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketLicenses))
+		updates := map[string][]byte{}
+		err := b.ForEach(func(k, v []byte) error {
+			var lic License
+			if err := json.Unmarshal(v, &lic); err != nil {
+				return nil
+			}
+			plan := strings.ToLower(strings.TrimSpace(lic.Plan))
+			status := strings.ToLower(strings.TrimSpace(lic.Status))
+			if status == "" {
+				status = "active"
+			}
+			if plan == lic.Plan && status == lic.Status {
+				return nil
+			}
+			lic.Plan, lic.Status = plan, status
+			buf, err := json.Marshal(lic)
+			if err != nil {
+				return err
+			}
+			updates[string(k)] = buf
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for k, v := range updates {
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{3, "rebuild license key index", rebuildLicenseKeyIndex},
+	{4, "build audit time index", rebuildAuditIndex},
+	{5, "key audit events by time", rekeyAudit},
+	{6, "create deployments bucket", func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucketDeployments))
+		return err
+	}},
+	{7, "attribute licenses created with an API key", func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketLicenses))
+		updates := map[string][]byte{}
+		err := b.ForEach(func(k, v []byte) error {
+			var lic License
+			if err := json.Unmarshal(v, &lic); err != nil || lic.CreatedBy != "" || lic.CreatedByKey == "" {
+				return nil
+			}
+			lic.CreatedBy = "apikey:" + lic.CreatedByKey
+			buf, err := json.Marshal(lic)
+			if err != nil {
+				return err
+			}
+			updates[string(k)] = buf
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for k, v := range updates {
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	// notifiedExpiry used to cover the admin and the client chat together;
+	// carry it over to the client so the current notice is not sent twice.
+	{8, "mark expiration notices per Telegram recipient", func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketLicenses))
+		updates := map[string][]byte{}
+		err := b.ForEach(func(k, v []byte) error {
+			var lic License
+			if err := json.Unmarshal(v, &lic); err != nil || lic.NotifiedExpiry == "" || lic.ClientNotified != "" {
+				return nil
+			}
+			lic.ClientNotified = lic.NotifiedExpiry
+			buf, err := json.Marshal(lic)
+			if err != nil {
+				return err
+			}
+			updates[string(k)] = buf
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for k, v := range updates {
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+}
+
+// rebuildLicenseKeyIndex recreates license_by_key from the licenses bucket.
+func rebuildLicenseKeyIndex(tx *bbolt.Tx) error {
+	if err := tx.DeleteBucket([]byte(bucketLicenseByKey)); err != nil && err != bbolt.ErrBucketNotFound {
+		return err
+	}
+	byKey, err := tx.CreateBucket([]byte(bucketLicenseByKey))
+	if err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(bucketLicenses)).ForEach(func(k, v []byte) error {
+		var lic License
+		if err := json.Unmarshal(v, &lic); err != nil || lic.LicenseKey == "" {
+			return nil
+		}
+		return byKey.Put([]byte(lic.LicenseKey), k)
+	})
+}
+
+func storeSchemaVersion(tx *bbolt.Tx) int {
+	b := tx.Bucket([]byte(bucketMeta))
+	if b == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(string(b.Get([]byte(schemaVersionKey))))
+	return n
+}
+
+// SchemaVersion returns the last applied migration version.
+func (s *Store) SchemaVersion() int {
+	v := 0
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		v = storeSchemaVersion(tx)
+		return nil
+	})
+	return v
+}
+
+// Migrate applies pending migrations in order. It is called from NewStore.
+func (s *Store) Migrate() error {
+	for _, m := range storeMigrations {
+		applied := false
+		err := s.db.Update(func(tx *bbolt.Tx) error {
+			if storeSchemaVersion(tx) >= m.version {
+				return nil
+			}
+			if err := m.apply(tx); err != nil {
+				return err
+			}
+			meta, err := tx.CreateBucketIfNotExists([]byte(bucketMeta))
+			if err != nil {
+				return err
+			}
+			applied = true
+			return meta.Put([]byte(schemaVersionKey), []byte(strconv.Itoa(m.version)))
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		if applied {
+			log.Printf("store migration %d applied: %s", m.version, m.name)
+		}
+	}
+	return nil
+}
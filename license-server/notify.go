@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notification kinds rendered by expirationNotifier.
+const (
+	notifyAdminExpiring  = "admin_expiring"
+	notifyClientExpiring = "client_expiring"
+)
+
+const defaultNotifyLanguage = "ru"
+
+// builtinNotifyTemplates holds the default messages per language. Placeholders
+// are replaced by renderNotifyTemplate; values are HTML-escaped because
+// messages are sent to Telegram with parse_mode=HTML.
+var builtinNotifyTemplates = map[string]map[string]string{
+	"ru": {
+		notifyAdminExpiring:  "⚠️ Лицензия <b>{customer}</b> ({plan}) истекает через <b>{daysLeft} дн.</b>\nКлюч: <code>{key}</code>",
+		notifyClientExpiring: "⚠️ Ваша лицензия ({plan}) истекает через <b>{daysLeft} дн.</b>\nКлюч: <code>{key}</code>",
+	},
+	"en": {
+		notifyAdminExpiring:  "⚠️ License <b>{customer}</b> ({plan}) expires in <b>{daysLeft} days</b>\nKey: <code>{key}</code>",
+		notifyClientExpiring: "⚠️ Your license ({plan}) expires in <b>{daysLeft} days</b>\nKey: <code>{key}</code>",
+	},
+}
+
+func isKnownNotifyLanguage(lang string) bool {
+	_, ok := builtinNotifyTemplates[lang]
+	return ok
+}
+
+// normalizeNotifyLanguage lowercases lang and maps unknown values to "".
+func normalizeNotifyLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if !isKnownNotifyLanguage(lang) {
+		return ""
+	}
+	return lang
+}
+
+// notifyLanguage returns the language for admin notifications and the
+// default for clients: the notify_language setting, else Russian.
+func (s *Server) notifyLanguage() string {
+	if lang := normalizeNotifyLanguage(s.store.GetSetting("notify_language")); lang != "" {
+		return lang
+	}
+	return defaultNotifyLanguage
+}
+
+// clientNotifyLanguage prefers the language stored on the license.
+func (s *Server) clientNotifyLanguage(lic License) string {
+	if lang := normalizeNotifyLanguage(lic.Language); lang != "" {
+		return lang
+	}
+	return s.notifyLanguage()
+}
+
+// notifyTemplate returns the custom template from the
+// notify_template_<kind>_<lang> setting, falling back to the built-in one.
+func (s *Server) notifyTemplate(kind, lang string) string {
+	if tpl := strings.TrimSpace(s.store.GetSetting("notify_template_" + kind + "_" + lang)); tpl != "" {
+		return tpl
+	}
+	if tpl, ok := builtinNotifyTemplates[lang][kind]; ok {
+		return tpl
+	}
+	return builtinNotifyTemplates[defaultNotifyLanguage][kind]
+}
+
+// notifyPlaceholders lists the placeholders understood by renderNotifyTemplate.
+var notifyPlaceholders = []string{"{customer}", "{company}", "{plan}", "{key}", "{daysLeft}", "{expiresAt}"}
+
+var placeholderRe = regexp.MustCompile(`\{[A-Za-z_]+\}`)
+
+// validateNotifyTemplate rejects templates that use unknown placeholders,
+// which would otherwise be sent to customers verbatim.
+func validateNotifyTemplate(tpl string) error {
+	for _, ph := range placeholderRe.FindAllString(tpl, -1) {
+		known := false
+		for _, k := range notifyPlaceholders {
+			if ph == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown placeholder %s (allowed: %s)", ph, strings.Join(notifyPlaceholders, " "))
+		}
+	}
+	return nil
+}
+
+// validateNotifyTemplateSetting checks a notify_template_<kind>_<lang> setting.
+func validateNotifyTemplateSetting(key, value string) error {
+	rest := strings.TrimPrefix(key, "notify_template_")
+	i := strings.LastIndex(rest, "_")
+	if i < 0 {
+		return fmt.Errorf("%s: expected notify_template_<kind>_<lang>", key)
+	}
+	kind, lang := rest[:i], rest[i+1:]
+	if _, ok := builtinNotifyTemplates[defaultNotifyLanguage][kind]; !ok {
+		return fmt.Errorf("%s: unknown template kind %q", key, kind)
+	}
+	if !isKnownNotifyLanguage(lang) {
+		return fmt.Errorf("%s: unsupported language %q", key, lang)
+	}
+	if err := validateNotifyTemplate(value); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// licenseDaysLeft returns whole days until expiry, or 0 when unparseable.
+func licenseDaysLeft(lic License, now time.Time) int {
+	exp, err := time.Parse(time.RFC3339, lic.ExpiresAt)
+	if err != nil {
+		return 0
+	}
+	return int(exp.Sub(now).Hours() / 24)
+}
+
+// renderNotifyTemplate substitutes the license placeholders in tpl.
+func renderNotifyTemplate(tpl string, lic License, daysLeft int) string {
+	expires := lic.ExpiresAt
+	if t, err := time.Parse(time.RFC3339, lic.ExpiresAt); err == nil {
+		expires = t.Format("2006-01-02")
+	}
+	return strings.NewReplacer(
+		"{customer}", html.EscapeString(lic.CustomerName),
+		"{company}", html.EscapeString(lic.CustomerCompany),
+		"{plan}", html.EscapeString(lic.Plan),
+		"{key}", html.EscapeString(lic.LicenseKey),
+		"{daysLeft}", strconv.Itoa(daysLeft),
+		"{expiresAt}", html.EscapeString(expires),
+	).Replace(tpl)
+}
+
+// handleNotifyPreview renders a template (or the effective one for kind and
+// language) against a license or sample data without sending anything.
+func (s *Server) handleNotifyPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	var req struct {
+		Template  string `json:"template"`
+		Kind      string `json:"kind"`
+		Language  string `json:"language"`
+		LicenseID string `json:"licenseId"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		httpErr(w, fmt.Errorf("invalid body"), 400)
+		return
+	}
+
+	lic := License{
+		CustomerName:    "ООО Пример",
+		CustomerCompany: "Пример",
+		Plan:            "pro",
+		LicenseKey:      "NDX-0A1B2C-3D4E5F-6A7B8C-9D0E1F",
+		ExpiresAt:       time.Now().UTC().AddDate(0, 0, 7).Format(time.RFC3339),
+	}
+	if id := strings.TrimSpace(req.LicenseID); id != "" {
+		found, err := s.store.GetLicenseByID(id)
+		if err != nil {
+			if errors.Is(err, errLicenseNotFound) {
+				httpErr(w, err, 404)
+				return
+			}
+			httpErr(w, err, 500)
+			return
+		}
+		lic = *found
+	}
+
+	tpl := req.Template
+	if strings.TrimSpace(tpl) == "" {
+		kind := strings.TrimSpace(req.Kind)
+		if kind == "" {
+			kind = notifyClientExpiring
+		}
+		if _, ok := builtinNotifyTemplates[defaultNotifyLanguage][kind]; !ok {
+			httpErr(w, fmt.Errorf("kind: unknown %q", req.Kind), 400)
+			return
+		}
+		lang := normalizeNotifyLanguage(req.Language)
+		if lang == "" {
+			lang = s.clientNotifyLanguage(lic)
+			if kind == notifyAdminExpiring {
+				lang = s.notifyLanguage()
+			}
+		}
+		tpl = s.notifyTemplate(kind, lang)
+	}
+	if err := validateNotifyTemplate(tpl); err != nil {
+		httpErr(w, err, 400)
+		return
+	}
+	respondJSON(w, 200, map[string]any{
+		"text":         renderNotifyTemplate(tpl, lic, licenseDaysLeft(lic, time.Now().UTC())),
+		"template":     tpl,
+		"placeholders": notifyPlaceholders,
+	})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Offline tokens let central run without reaching the license server. One
+// is valid for defaultOfflineTokenDays unless the request asks otherwise,
+// and never past the license expiry.
+const (
+	defaultOfflineTokenDays = 365
+	maxOfflineTokenDays     = 3650
+)
+
+// offlineToken encodes the payload and its signature in the same envelope as
+// a validate response, base64 so it can be pasted into central's config.
+func offlineToken(payload signedValidatePayload, priv ed25519.PrivateKey) (string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	envelope, err := json.Marshal(map[string]any{
+		"payload":   json.RawMessage(body),
+		"signature": signBytes(priv, body),
+		"algorithm": "ed25519",
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(envelope), nil
+}
+
+// handleLicenseOfflineToken issues a signed token for an air-gapped central.
+// The body is optional: validDays shortens or lengthens the window and
+// instanceId binds the token to one central installation.
+func (s *Server) handleLicenseOfflineToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	id := strings.TrimSpace(r.PathValue("id"))
+	if id == "" {
+		httpErr(w, fmt.Errorf("license id required"), 400)
+		return
+	}
+	var req struct {
+		ValidDays  int    `json:"validDays"`
+		InstanceID string `json:"instanceId"`
+	}
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		httpErr(w, fmt.Errorf("invalid body: %w", err), 400)
+		return
+	}
+	if req.ValidDays == 0 {
+		req.ValidDays = defaultOfflineTokenDays
+	}
+	if req.ValidDays < 1 || req.ValidDays > maxOfflineTokenDays {
+		httpErr(w, fmt.Errorf("validDays must be between 1 and %d", maxOfflineTokenDays), 400)
+		return
+	}
+	lic, err := s.store.GetLicenseByID(id)
+	if err != nil {
+		if errors.Is(err, errLicenseNotFound) {
+			httpErr(w, err, 404)
+			return
+		}
+		httpErr(w, err, 500)
+		return
+	}
+	now := time.Now().UTC()
+	if status := effectiveLicenseStatus(lic, now); status != "active" {
+		httpErr(w, fmt.Errorf("license is %s, offline tokens are issued for active licenses only", status), 409)
+		return
+	}
+	expiresAt, err := time.Parse(time.RFC3339, lic.ExpiresAt)
+	if err != nil {
+		httpErr(w, fmt.Errorf("license has an invalid expiration date"), 409)
+		return
+	}
+	validUntil := now.AddDate(0, 0, req.ValidDays)
+	if expiresAt.Before(validUntil) {
+		validUntil = expiresAt
+	}
+
+	payload := signedValidatePayload{
+		LicenseID:    lic.ID,
+		Status:       "active",
+		Valid:        true,
+		Plan:         lic.Plan,
+		MaxAgents:    lic.MaxAgents,
+		ExpiresAt:    lic.ExpiresAt,
+		ServerTime:   now.Format(time.RFC3339),
+		InstanceID:   strings.TrimSpace(req.InstanceID),
+		LicenseKey:   lic.LicenseKey,
+		CustomerName: lic.CustomerName,
+		IssuedAt:     now.Format(time.RFC3339),
+		ValidUntil:   validUntil.Format(time.RFC3339),
+		Offline:      true,
+	}
+	token, err := offlineToken(payload, s.signKey)
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	_ = s.store.AddAudit(AuditEvent{
+		ID:        randomHex(16),
+		LicenseID: lic.ID,
+		Action:    "offline_token_issue",
+		Actor:     requestIdentity(r).label(),
+		Details:   fmt.Sprintf("validUntil=%s instance=%s", payload.ValidUntil, payload.InstanceID),
+		CreatedAt: now.Format(time.RFC3339),
+	})
+	respondJSON(w, 200, map[string]any{
+		"token":      token,
+		"licenseKey": lic.LicenseKey,
+		"instanceId": payload.InstanceID,
+		"issuedAt":   payload.IssuedAt,
+		"validUntil": payload.ValidUntil,
+	})
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The PDF export is a plain A4 landscape table in the built-in Helvetica
+// font, so it needs no embedded fonts. Helvetica has no Cyrillic glyphs:
+// headers are in English and Russian text is transliterated.
+const (
+	pdfPageWidth   = 842.0
+	pdfPageHeight  = 595.0
+	pdfMargin      = 28.0
+	pdfFontSize    = 7.0
+	pdfRowHeight   = 11.0
+	pdfCharWidth   = 0.5 * pdfFontSize // average Helvetica advance
+	pdfHeaderSpace = 46.0
+)
+
+// pdfColumn picks one column of the export rows for the PDF table.
+type pdfColumn struct {
+	title string
+	index int
+	width float64
+}
+
+var pdfLicenseColumns = []pdfColumn{
+	{"Key", 1, 150},
+	{"Customer", 2, 105},
+	{"Company", 3, 85},
+	{"Email", 4, 100},
+	{"Plan", 7, 50},
+	{"Limit", 8, 30},
+	{"Expires", 9, 52},
+	{"Status", 10, 45},
+	{"Host", 12, 90},
+	{"Last check", 14, 79},
+}
+
+var pdfTranslit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z", 'и': "i", 'й': "y",
+	'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f",
+	'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// pdfText makes s safe for a PDF string literal in WinAnsi Helvetica:
+// Cyrillic is transliterated, other non-ASCII runes become '?'.
+func pdfText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r == '\t' || r == '\n' || r == '\r':
+			b.WriteByte(' ')
+		default:
+			lower := []rune(strings.ToLower(string(r)))[0]
+			if t, ok := pdfTranslit[lower]; ok {
+				if lower != r && t != "" {
+					t = strings.ToUpper(t[:1]) + t[1:]
+				}
+				b.WriteString(t)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
+
+// pdfFit cuts s to about width points, marking the cut with "..".
+func pdfFit(s string, width float64) string {
+	n := int((width - 4) / pdfCharWidth)
+	if len(s) <= n || n < 3 {
+		return s
+	}
+	s = s[:n-2]
+	if strings.HasSuffix(s, "\\") && !strings.HasSuffix(s, "\\\\") {
+		s = s[:len(s)-1]
+	}
+	return s + ".."
+}
+
+// pdfColor turns "#rrggbb" into PDF fill operands, teal when unreadable.
+func pdfColor(hex string) string {
+	if v, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32); err == nil && len(hex) == 7 {
+		return fmt.Sprintf("%.3f %.3f %.3f", float64(v>>16&0xff)/255, float64(v>>8&0xff)/255, float64(v&0xff)/255)
+	}
+	return "0.059 0.463 0.431"
+}
+
+// renderLicensesPDF lays rows out as a paginated table and returns the PDF.
+func renderLicensesPDF(brand exportBranding, rows [][]string, now time.Time) []byte {
+	usable := pdfPageHeight - 2*pdfMargin - pdfHeaderSpace
+	perPage := int(usable / pdfRowHeight)
+	pages := (len(rows) + perPage - 1) / perPage
+	if pages == 0 {
+		pages = 1
+	}
+	accent := pdfColor(brand.Accent)
+
+	var streams []string
+	for p := 0; p < pages; p++ {
+		var c strings.Builder
+		top := pdfPageHeight - pdfMargin
+		fmt.Fprintf(&c, "BT /F2 13 Tf %.1f %.1f Td (%s) Tj ET\n", pdfMargin, top-12, pdfText(brand.Name+" - Licenses"))
+		fmt.Fprintf(&c, "BT /F1 8 Tf %.1f %.1f Td (%s) Tj ET\n", pdfMargin, top-25, pdfText(fmt.Sprintf("Exported %s UTC | Total: %d", now.Format("2006-01-02 15:04"), len(rows))))
+
+		y := top - pdfHeaderSpace + pdfRowHeight
+		fmt.Fprintf(&c, "%s rg %.1f %.1f %.1f %.1f re f\n", accent, pdfMargin, y-3, pdfPageWidth-2*pdfMargin, pdfRowHeight)
+		x := pdfMargin
+		for _, col := range pdfLicenseColumns {
+			fmt.Fprintf(&c, "1 1 1 rg BT /F2 %.1f Tf %.1f %.1f Td (%s) Tj ET\n", pdfFontSize, x+2, y, pdfText(col.title))
+			x += col.width
+		}
+		end := (p + 1) * perPage
+		if end > len(rows) {
+			end = len(rows)
+		}
+		for i, row := range rows[min(p*perPage, end):end] {
+			y -= pdfRowHeight
+			if i%2 == 1 {
+				fmt.Fprintf(&c, "0.973 0.980 0.988 rg %.1f %.1f %.1f %.1f re f\n", pdfMargin, y-3, pdfPageWidth-2*pdfMargin, pdfRowHeight)
+			}
+			c.WriteString("0.059 0.090 0.165 rg\n")
+			x = pdfMargin
+			for _, col := range pdfLicenseColumns {
+				cell := ""
+				if col.index < len(row) {
+					cell = row[col.index]
+				}
+				if col.index == 9 || col.index == 14 {
+					cell = strings.Replace(strings.TrimSuffix(cell, "Z"), "T", " ", 1)
+					if col.index == 9 && len(cell) > 10 {
+						cell = cell[:10]
+					}
+				}
+				fmt.Fprintf(&c, "BT /F1 %.1f Tf %.1f %.1f Td (%s) Tj ET\n", pdfFontSize, x+2, y, pdfFit(pdfText(cell), col.width))
+				x += col.width
+			}
+		}
+		fmt.Fprintf(&c, "0.580 0.639 0.722 rg BT /F1 7 Tf %.1f %.1f Td (%s) Tj ET\n", pdfMargin, pdfMargin-12, pdfText(fmt.Sprintf("%s | page %d/%d", brand.Footer, p+1, pages)))
+		streams = append(streams, c.String())
+	}
+
+	// Objects: 1 catalog, 2 page tree, 3-4 fonts, then a page and its content
+	// stream for every page.
+	var buf bytes.Buffer
+	offsets := []int{0}
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets)-1, body)
+	}
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	kids := make([]string, pages)
+	for i := range kids {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pages))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range streams {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 6+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets))
+	for _, off := range offsets[1:] {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets), xref)
+	return buf.Bytes()
+}
+
+func (s *Server) exportPDF(w http.ResponseWriter, rows [][]string) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "attachment; filename=licenses.pdf")
+	_, _ = w.Write(renderLicensesPDF(s.exportBrand(), rows, time.Now().UTC()))
+}
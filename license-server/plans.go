@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// settingPlanConfig holds the plan table as JSON; empty means defaultPlans.
+const settingPlanConfig = "plan_config"
+
+// maxPlanGraceDays bounds a plan's grace period.
+const maxPlanGraceDays = 365
+
+// planConfig describes one plan. A nil GraceDays falls back to
+// LICENSE_GRACE_DAYS; MaxAgents 0 is unlimited.
+type planConfig struct {
+	MaxAgents   int     `json:"maxAgents"`
+	GraceDays   *int    `json:"graceDays,omitempty"`
+	PriceYearly float64 `json:"priceYearly,omitempty"`
+}
+
+// defaultPlans is the table used until plan_config is set.
+var defaultPlans = map[string]planConfig{
+	"basic":      {MaxAgents: 10},
+	"pro":        {MaxAgents: 30},
+	"enterprise": {MaxAgents: 0},
+}
+
+var planNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// parsePlanConfig decodes and checks a plan table.
+func parsePlanConfig(raw string) (map[string]planConfig, error) {
+	var plans map[string]planConfig
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&plans); err != nil {
+		return nil, fmt.Errorf("%s: %w", settingPlanConfig, err)
+	}
+	return plans, validatePlans(plans)
+}
+
+func validatePlans(plans map[string]planConfig) error {
+	if len(plans) == 0 {
+		return fmt.Errorf("%s: at least one plan is required", settingPlanConfig)
+	}
+	for name, p := range plans {
+		if !planNameRe.MatchString(name) {
+			return fmt.Errorf("%s: invalid plan name %q (a-z, 0-9, _ and -, up to 32 characters)", settingPlanConfig, name)
+		}
+		if p.MaxAgents < 0 {
+			return fmt.Errorf("%s: %s.maxAgents must not be negative", settingPlanConfig, name)
+		}
+		if p.GraceDays != nil && (*p.GraceDays < 0 || *p.GraceDays > maxPlanGraceDays) {
+			return fmt.Errorf("%s: %s.graceDays must be between 0 and %d", settingPlanConfig, name, maxPlanGraceDays)
+		}
+		if p.PriceYearly < 0 {
+			return fmt.Errorf("%s: %s.priceYearly must not be negative", settingPlanConfig, name)
+		}
+	}
+	return nil
+}
+
+// plans returns the configured plan table, or defaultPlans when plan_config
+// is empty or unreadable.
+func (s *Server) plans() map[string]planConfig {
+	if raw := strings.TrimSpace(s.store.GetSetting(settingPlanConfig)); raw != "" {
+		if plans, err := parsePlanConfig(raw); err == nil {
+			return plans
+		}
+	}
+	return defaultPlans
+}
+
+func (s *Server) isKnownPlan(plan string) bool {
+	_, ok := s.plans()[strings.ToLower(strings.TrimSpace(plan))]
+	return ok
+}
+
+// planMaxAgents is the agent limit for new licenses of plan; a plan missing
+// from the table gets the default plan's limit.
+func (s *Server) planMaxAgents(plan string) int {
+	plans := s.plans()
+	if p, ok := plans[strings.ToLower(strings.TrimSpace(plan))]; ok {
+		return p.MaxAgents
+	}
+	return plans[s.defaultPlan()].MaxAgents
+}
+
+// planGraceDays is the grace period sent to central for a license of plan.
+func (s *Server) planGraceDays(plan string) int {
+	if p, ok := s.plans()[strings.ToLower(strings.TrimSpace(plan))]; ok && p.GraceDays != nil {
+		return *p.GraceDays
+	}
+	return s.graceDays
+}
+
+// sortedPlanNames lists plan names alphabetically.
+func sortedPlanNames(plans map[string]planConfig) []string {
+	names := make([]string, 0, len(plans))
+	for name := range plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handlePlans reads (GET), replaces (PUT) or resets to the defaults (DELETE)
+// the plan table. Licenses keep their plan name when it is removed from the
+// table; they then validate with LICENSE_GRACE_DAYS.
+func (s *Server) handlePlans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		var plans map[string]planConfig
+		if err := decodeJSON(r, &plans); err != nil {
+			httpErr(w, fmt.Errorf("invalid body: %w", err), 400)
+			return
+		}
+		if err := validatePlans(plans); err != nil {
+			httpErr(w, err, 400)
+			return
+		}
+		raw, _ := json.Marshal(plans)
+		if err := s.store.SetSetting(settingPlanConfig, string(raw)); err != nil {
+			httpErr(w, err, 500)
+			return
+		}
+		_ = s.store.AddAudit(AuditEvent{ID: randomHex(16), Action: "plans_update", Actor: requestIdentity(r).label(), Details: strings.Join(sortedPlanNames(plans), ","), CreatedAt: time.Now().UTC().Format(time.RFC3339)})
+	case http.MethodDelete:
+		if err := s.store.SetSetting(settingPlanConfig, ""); err != nil {
+			httpErr(w, err, 500)
+			return
+		}
+		_ = s.store.AddAudit(AuditEvent{ID: randomHex(16), Action: "plans_reset", Actor: requestIdentity(r).label(), CreatedAt: time.Now().UTC().Format(time.RFC3339)})
+	default:
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	respondJSON(w, 200, map[string]any{
+		"plans":            s.plans(),
+		"defaultPlan":      s.defaultPlan(),
+		"defaultGraceDays": s.graceDays,
+		"custom":           strings.TrimSpace(s.store.GetSetting(settingPlanConfig)) != "",
+	})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// defaultTrustedProxies matches the shipped deployment, where Caddy proxies
+// to the server over loopback.
+const defaultTrustedProxies = "127.0.0.0/8,::1/128"
+
+// parseTrustedProxies parses LICENSE_TRUSTED_PROXIES: a comma-separated list
+// of IPs and CIDRs. "none" trusts no proxy.
+func parseTrustedProxies(spec string) ([]*net.IPNet, error) {
+	if strings.EqualFold(strings.TrimSpace(spec), "none") {
+		return nil, nil
+	}
+	var out []*net.IPNet
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", part)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", part)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func (s *Server) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return false
+	}
+	for _, n := range s.trustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteHost is the address of the direct peer, without port.
+func remoteHost(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return strings.TrimSpace(r.RemoteAddr)
+}
+
+// fromTrustedProxy reports whether forwarded headers on r may be believed.
+func (s *Server) fromTrustedProxy(r *http.Request) bool {
+	return s.isTrustedProxy(remoteHost(r))
+}
+
+// requestClientIP returns the client address. X-Forwarded-For is read right
+// to left and only through trusted proxies, so a client cannot pick its own
+// address for rate limits and audit.
+func (s *Server) requestClientIP(r *http.Request) string {
+	ip := remoteHost(r)
+	if !s.isTrustedProxy(ip) {
+		return ip
+	}
+	if xff := strings.TrimSpace(r.Header.Get("X-Forwarded-For")); xff != "" {
+		parts := strings.Split(xff, ",")
+		for i := len(parts) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(parts[i])
+			if hop == "" {
+				continue
+			}
+			ip = hop
+			if !s.isTrustedProxy(hop) {
+				break
+			}
+		}
+		return ip
+	}
+	if xrip := strings.TrimSpace(r.Header.Get("X-Real-IP")); xrip != "" {
+		return xrip
+	}
+	return ip
+}
+
+// requestIsHTTPS reports whether the client reached us over HTTPS, either
+// directly or through a trusted proxy sending X-Forwarded-Proto.
+func (s *Server) requestIsHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if !s.fromTrustedProxy(r) {
+		return false
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// requestBaseURL is the scheme and host the client used, for absolute links.
+// X-Forwarded-Host is honored from trusted proxies only.
+func (s *Server) requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if s.requestIsHTTPS(r) {
+		scheme = "https"
+	}
+	host := r.Host
+	if s.fromTrustedProxy(r) {
+		if fh, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ","); strings.TrimSpace(fh) != "" {
+			host = strings.TrimSpace(fh)
+		}
+	}
+	return scheme + "://" + host
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestSchemeTrustedProxy(t *testing.T) {
+	trusted, err := parseTrustedProxies(defaultTrustedProxies + ",10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{trustedProxies: trusted}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		tls        bool
+		headers    map[string]string
+		wantHTTPS  bool
+		wantBase   string
+	}{
+		{
+			name:       "forwarded https from trusted loopback",
+			remoteAddr: "127.0.0.1:40000",
+			headers:    map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "lic.example.com"},
+			wantHTTPS:  true,
+			wantBase:   "https://lic.example.com",
+		},
+		{
+			name:       "first proto of a list from trusted CIDR",
+			remoteAddr: "10.1.2.3:40000",
+			headers:    map[string]string{"X-Forwarded-Proto": "HTTPS, http"},
+			wantHTTPS:  true,
+			wantBase:   "https://backend:8080",
+		},
+		{
+			name:       "forwarded headers from untrusted peer are ignored",
+			remoteAddr: "203.0.113.7:40000",
+			headers:    map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.example.com"},
+			wantBase:   "http://backend:8080",
+		},
+		{
+			name:       "trusted proxy forwarding plain http",
+			remoteAddr: "[::1]:40000",
+			headers:    map[string]string{"X-Forwarded-Proto": "http"},
+			wantBase:   "http://backend:8080",
+		},
+		{
+			name:       "direct TLS from untrusted peer",
+			remoteAddr: "203.0.113.7:40000",
+			tls:        true,
+			wantHTTPS:  true,
+			wantBase:   "https://backend:8080",
+		},
+		{
+			name:       "direct TLS wins over forwarded http",
+			remoteAddr: "127.0.0.1:40000",
+			tls:        true,
+			headers:    map[string]string{"X-Forwarded-Proto": "http"},
+			wantHTTPS:  true,
+			wantBase:   "https://backend:8080",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://backend:8080/api/v1/auth/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			} else {
+				r.TLS = nil
+			}
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := s.requestIsHTTPS(r); got != tt.wantHTTPS {
+				t.Errorf("requestIsHTTPS = %v, want %v", got, tt.wantHTTPS)
+			}
+			if got := s.requestBaseURL(r); got != tt.wantBase {
+				t.Errorf("requestBaseURL = %q, want %q", got, tt.wantBase)
+			}
+		})
+	}
+}
+
+func TestRequestSchemeNoTrustedProxies(t *testing.T) {
+	trusted, err := parseTrustedProxies("none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{trustedProxies: trusted}
+	r := httptest.NewRequest("GET", "http://backend:8080/", nil)
+	r.RemoteAddr = "127.0.0.1:40000"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	if s.requestIsHTTPS(r) {
+		t.Error("X-Forwarded-Proto honored with LICENSE_TRUSTED_PROXIES=none")
+	}
+}
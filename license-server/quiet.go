@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // notify_timezone must resolve on hosts without a zoneinfo database
+)
+
+// Quiet hours for expiration notices: notify_quiet_hours is "HH:MM-HH:MM"
+// (empty disables it) and may wrap midnight; notify_timezone is an IANA name,
+// UTC by default.
+const (
+	settingNotifyQuietHours = "notify_quiet_hours"
+	settingNotifyTimezone   = "notify_timezone"
+)
+
+// quietWindow holds the start and end of the quiet hours in minutes after
+// midnight.
+type quietWindow struct {
+	start, end int
+}
+
+func parseClock(v string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(v))
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM, got %q", v)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseQuietHours parses "HH:MM-HH:MM"; ok is false for an empty value.
+func parseQuietHours(v string) (q quietWindow, ok bool, err error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return quietWindow{}, false, nil
+	}
+	from, to, found := strings.Cut(v, "-")
+	if !found {
+		return quietWindow{}, false, fmt.Errorf("%s: expected HH:MM-HH:MM, got %q", settingNotifyQuietHours, v)
+	}
+	if q.start, err = parseClock(from); err != nil {
+		return quietWindow{}, false, fmt.Errorf("%s: %w", settingNotifyQuietHours, err)
+	}
+	if q.end, err = parseClock(to); err != nil {
+		return quietWindow{}, false, fmt.Errorf("%s: %w", settingNotifyQuietHours, err)
+	}
+	if q.start == q.end {
+		return quietWindow{}, false, fmt.Errorf("%s: start and end are the same", settingNotifyQuietHours)
+	}
+	return q, true, nil
+}
+
+// until returns when the window that contains t closes, or the zero time
+// when t is outside the quiet hours. t must be in the window's time zone.
+func (q quietWindow) until(t time.Time) time.Time {
+	m := t.Hour()*60 + t.Minute()
+	inside := q.start <= m && m < q.end
+	if q.start > q.end {
+		inside = m >= q.start || m < q.end
+	}
+	if !inside {
+		return time.Time{}
+	}
+	end := time.Date(t.Year(), t.Month(), t.Day(), q.end/60, q.end%60, 0, 0, t.Location())
+	if !end.After(t) {
+		end = time.Date(t.Year(), t.Month(), t.Day()+1, q.end/60, q.end%60, 0, 0, t.Location())
+	}
+	return end
+}
+
+// notifyLocation is notify_timezone, or UTC when unset or unknown.
+func (s *Server) notifyLocation() *time.Location {
+	if name := strings.TrimSpace(s.store.GetSetting(settingNotifyTimezone)); name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// quietUntil returns when the current quiet hours end, or the zero time when
+// now is outside them or they are off.
+func (s *Server) quietUntil(now time.Time) time.Time {
+	q, ok, err := parseQuietHours(s.store.GetSetting(settingNotifyQuietHours))
+	if err != nil || !ok {
+		return time.Time{}
+	}
+	return q.until(now.In(s.notifyLocation()))
+}
+
+// validateQuietHoursSettings checks the quiet hours and timezone in a
+// settings update.
+func validateQuietHoursSettings(req map[string]string) error {
+	if v, ok := req[settingNotifyQuietHours]; ok {
+		if _, _, err := parseQuietHours(v); err != nil {
+			return err
+		}
+		req[settingNotifyQuietHours] = strings.ReplaceAll(strings.TrimSpace(v), " ", "")
+	}
+	if v, ok := req[settingNotifyTimezone]; ok {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			if _, err := time.LoadLocation(v); err != nil {
+				return fmt.Errorf("%s: unknown time zone %q", settingNotifyTimezone, v)
+			}
+		}
+		req[settingNotifyTimezone] = v
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// errAPIKeyQuota rejects a license an API key may not create any more.
+var errAPIKeyQuota = errors.New("api key license quota reached")
+
+// apiKeyView is an API key as listed to admins, with its quota usage.
+type apiKeyView struct {
+	APIKey
+	ActiveLicenses int `json:"activeLicenses"`
+}
+
+// activeLicensesByKey counts the active licenses each API key created.
+func (s *Server) activeLicensesByKey() (map[string]int, error) {
+	list, err := s.store.ListLicenses()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	out := map[string]int{}
+	for i := range list {
+		if list[i].CreatedByKey != "" && effectiveLicenseStatus(&list[i], now) == "active" {
+			out[list[i].CreatedByKey]++
+		}
+	}
+	return out, nil
+}
+
+// apiKeyQuotaLeft is how many more licenses ak may create, or -1 without a
+// quota. Callers hold s.quotaMu until the licenses are stored, so parallel
+// requests cannot both take the last slot.
+func (s *Server) apiKeyQuotaLeft(ak *APIKey) (int, error) {
+	if ak == nil || ak.MaxLicenses <= 0 {
+		return -1, nil
+	}
+	used, err := s.activeLicensesByKey()
+	if err != nil {
+		return 0, err
+	}
+	return max(ak.MaxLicenses-used[ak.ID], 0), nil
+}
+
+// updateLicenseWithinQuota stores next, the edited prev. If the edit makes a
+// license created by an API key active again (unsuspend, restore, extending
+// an expired one), the creating key's quota is checked first, so a key
+// cannot park licenses outside the count and bring them back later.
+func (s *Server) updateLicenseWithinQuota(prev, next *License) error {
+	now := time.Now().UTC()
+	if next.CreatedByKey == "" || effectiveLicenseStatus(prev, now) == "active" || effectiveLicenseStatus(next, now) != "active" {
+		return s.store.UpdateLicense(next)
+	}
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+	if ak, ok := s.store.GetAPIKey(next.CreatedByKey); ok {
+		left, err := s.apiKeyQuotaLeft(ak)
+		if err != nil {
+			return err
+		}
+		if left == 0 {
+			return apiKeyQuotaError(ak)
+		}
+	}
+	return s.store.UpdateLicense(next)
+}
+
+func apiKeyQuotaError(ak *APIKey) error {
+	return fmt.Errorf("%w: key %q may hold %d active licenses", errAPIKeyQuota, ak.Name, ak.MaxLicenses)
+}
+
+func (s *Server) apiKeyViews(keys []APIKey) ([]apiKeyView, error) {
+	used, err := s.activeLicensesByKey()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]apiKeyView, len(keys))
+	for i, k := range keys {
+		out[i] = apiKeyView{APIKey: k, ActiveLicenses: used[k.ID]}
+	}
+	return out, nil
+}
+
+// createdByDetails tags audit details of a license created with an API key.
+func createdByDetails(ak *APIKey) string {
+	if ak == nil {
+		return ""
+	}
+	return " apiKey=" + ak.Name
+}
+
+func (s *Server) updateAPIKeyQuota(w http.ResponseWriter, r *http.Request, id string) {
+	var req struct {
+		MaxLicenses *int `json:"maxLicenses"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		httpErr(w, fmt.Errorf("invalid body: %w", err), 400)
+		return
+	}
+	if req.MaxLicenses == nil || *req.MaxLicenses < 0 {
+		httpErr(w, fmt.Errorf("maxLicenses must be a non-negative integer"), 400)
+		return
+	}
+	s.quotaMu.Lock()
+	ak, ok := s.store.GetAPIKey(id)
+	if !ok {
+		s.quotaMu.Unlock()
+		httpErr(w, fmt.Errorf("api key not found"), 404)
+		return
+	}
+	ak.MaxLicenses = *req.MaxLicenses
+	err := s.store.CreateAPIKey(ak)
+	s.quotaMu.Unlock()
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	_ = s.store.AddAudit(AuditEvent{
+		ID:        randomHex(16),
+		Action:    "api_key_quota",
+		Actor:     requestIdentity(r).label(),
+		Details:   fmt.Sprintf("%s maxLicenses=%d", ak.Name, ak.MaxLicenses),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	views, err := s.apiKeyViews([]APIKey{*ak})
+	if err != nil {
+		httpErr(w, err, 500)
+		return
+	}
+	respondJSON(w, 200, views[0])
+}
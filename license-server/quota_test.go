@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUnsuspendRechecksAPIKeyQuota(t *testing.T) {
+	st := newTestStore(t)
+	ak := &APIKey{ID: "reseller", Name: "reseller", Key: "ak", Role: "full", MaxLicenses: 1}
+	if err := st.CreateAPIKey(ak); err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().UTC().Add(24 * time.Hour).Format(time.RFC3339)
+	for _, lic := range []*License{
+		{ID: "paused", LicenseKey: "NDX-PAUSED", Status: "suspended", ExpiresAt: exp, CreatedByKey: ak.ID},
+		{ID: "live", LicenseKey: "NDX-LIVE", Status: "active", ExpiresAt: exp, CreatedByKey: ak.ID},
+	} {
+		if err := st.CreateLicense(lic); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &Server{store: st}
+
+	// The admin token is held to the creating key's quota as well.
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/licenses/paused/unsuspend", nil)
+	req.SetPathValue("id", "paused")
+	rec := httptest.NewRecorder()
+	s.handleLicenseUnsuspend(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403; body %s", rec.Code, rec.Body)
+	}
+	if lic, _ := st.GetLicenseByID("paused"); lic.Status != "suspended" {
+		t.Errorf("status = %q after refused unsuspend, want suspended", lic.Status)
+	}
+
+	// Freeing the slot lets the unsuspend through.
+	live, _ := st.GetLicenseByID("live")
+	live.Status = "revoked"
+	if err := st.UpdateLicense(live); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	s.handleLicenseUnsuspend(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestUpdateLicenseWithinQuotaSkipsActiveLicenses(t *testing.T) {
+	st := newTestStore(t)
+	ak := &APIKey{ID: "reseller", Name: "reseller", Key: "ak", Role: "full", MaxLicenses: 1}
+	if err := st.CreateAPIKey(ak); err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().UTC().Add(24 * time.Hour).Format(time.RFC3339)
+	lic := &License{ID: "live", LicenseKey: "NDX-LIVE", Status: "active", ExpiresAt: exp, CreatedByKey: ak.ID}
+	if err := st.CreateLicense(lic); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{store: st}
+
+	// Extending a license that already holds its slot must not count it twice.
+	prev := *lic
+	lic.ExpiresAt = time.Now().UTC().Add(48 * time.Hour).Format(time.RFC3339)
+	if err := s.updateLicenseWithinQuota(&prev, lic); err != nil {
+		t.Fatalf("extend active license: %v", err)
+	}
+
+	// Extending an expired one back to life needs a free slot.
+	other := &License{ID: "old", LicenseKey: "NDX-OLD", Status: "active", ExpiresAt: "2000-01-01T00:00:00Z", CreatedByKey: ak.ID}
+	if err := st.CreateLicense(other); err != nil {
+		t.Fatal(err)
+	}
+	prev = *other
+	other.ExpiresAt = exp
+	if err := s.updateLicenseWithinQuota(&prev, other); !errors.Is(err, errAPIKeyQuota) {
+		t.Fatalf("err = %v, want errAPIKeyQuota", err)
+	}
+}
+
+func TestBackupIsAdminOnly(t *testing.T) {
+	s := &Server{store: newTestStore(t)}
+	ak := &APIKey{ID: "k", Name: "k", Key: "ak", Role: "full"}
+	for path, h := range map[string]http.HandlerFunc{
+		"/api/v1/backup":  s.handleBackup,
+		"/api/v1/restore": s.handleRestore,
+	} {
+		method := http.MethodGet
+		if path == "/api/v1/restore" {
+			method = http.MethodPost
+		}
+		req := withIdentity(httptest.NewRequest(method, path, nil), adminIdentity{Via: "apikey", APIKey: ak})
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s with API key: status = %d, want 403", path, rec.Code)
+		}
+	}
+}
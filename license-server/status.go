@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// opStatus collects signals from background loops for /api/v1/system/status
+// and /metrics.
+type opStatus struct {
+	mu                  sync.Mutex
+	telegramLastError   string
+	telegramLastErrorAt time.Time
+	telegramSent        map[string]uint64 // successful sendMessage calls by kind
+	telegramFailed      map[string]uint64 // failed sendMessage calls by kind
+	validates           map[string]uint64 // validate responses by reason, "ok" when valid
+}
+
+// validateReasons are the reasons handleValidate answers with, reported
+// even before they occur so alerts on their rate have a series to watch.
+var validateReasons = []string{"ok", "license_not_found", "invalid_expiration", "suspended", "revoked", "expired", "agent_limit"}
+
+// validateResult counts one validate response by its reason.
+func (o *opStatus) validateResult(reason string) {
+	if reason == "" {
+		reason = "ok"
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.validates == nil {
+		o.validates = map[string]uint64{}
+	}
+	o.validates[reason]++
+}
+
+// validateCounts returns validate responses by reason, every known reason
+// included.
+func (o *opStatus) validateCounts() map[string]uint64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := make(map[string]uint64, len(validateReasons))
+	for _, reason := range validateReasons {
+		out[reason] = 0
+	}
+	for reason, n := range o.validates {
+		out[reason] = n
+	}
+	return out
+}
+
+// Kinds of Telegram messages, counted separately.
+const (
+	telegramKindNotify     = "notify"     // expiration notifier
+	telegramKindActivation = "activation" // first activation of a license
+	telegramKindBroadcast  = "broadcast"  // admin broadcast to clients
+	telegramKindBind       = "bind"       // chat binding confirmations
+	telegramKindBot        = "bot"        // other replies to bot commands
+	telegramKindTest       = "test"       // test message from the settings
+)
+
+// telegramSendResult counts one sendMessage outcome by kind.
+func (o *opStatus) telegramSendResult(kind string, ok bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.telegramSent == nil {
+		o.telegramSent, o.telegramFailed = map[string]uint64{}, map[string]uint64{}
+	}
+	if ok {
+		o.telegramSent[kind]++
+	} else {
+		o.telegramFailed[kind]++
+	}
+}
+
+// telegramSends returns per-kind {ok, failed} counts and their totals.
+func (o *opStatus) telegramSends() (byKind map[string]map[string]uint64, sent, failed uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	byKind = map[string]map[string]uint64{}
+	for kind, n := range o.telegramSent {
+		if byKind[kind] == nil {
+			byKind[kind] = map[string]uint64{"ok": 0, "failed": 0}
+		}
+		byKind[kind]["ok"] = n
+		sent += n
+	}
+	for kind, n := range o.telegramFailed {
+		if byKind[kind] == nil {
+			byKind[kind] = map[string]uint64{"ok": 0, "failed": 0}
+		}
+		byKind[kind]["failed"] = n
+		failed += n
+	}
+	return byKind, sent, failed
+}
+
+// telegramSend sends a Telegram message and records the outcome under kind.
+// Failures are logged and kept as the last Telegram error, so callers that
+// ignore the result still leave a trace.
+func (s *Server) telegramSend(kind, token, chatID, text string) error {
+	err := sendTelegram(token, chatID, text)
+	s.ops.telegramSendResult(kind, err == nil)
+	if err != nil {
+		s.ops.telegramError(token, err)
+		log.Printf("[WARN] telegram: не удалось отправить сообщение (%s) в чат %s: %s", kind, chatID, maskTelegramToken(token, err))
+	}
+	return err
+}
+
+// maskTelegramToken renders err with the bot token blanked out.
+func maskTelegramToken(token string, err error) string {
+	msg := err.Error()
+	if token != "" {
+		msg = strings.ReplaceAll(msg, token, "***")
+	}
+	return msg
+}
+
+// telegramError records a failed Telegram call. The bot token is part of
+// every API URL, so it is blanked out of the message.
+func (o *opStatus) telegramError(token string, err error) {
+	if err == nil {
+		return
+	}
+	msg := maskTelegramToken(token, err)
+	o.mu.Lock()
+	o.telegramLastError, o.telegramLastErrorAt = msg, time.Now().UTC()
+	o.mu.Unlock()
+}
+
+// formatOptionalTime renders t as RFC3339, or "" when it was never set.
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// LicenseCount returns the number of stored licenses without decoding them.
+func (s *Store) LicenseCount() (int, error) {
+	n := 0
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		n = tx.Bucket([]byte(bucketLicenses)).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+// handleSystemStatus reports the state of the store, signing key, Telegram
+// integration and expiration notifier in one read-only response. Notifier
+// stamps are settings, so they survive restarts.
+func (s *Server) handleSystemStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	count, err := s.store.LicenseCount()
+	resp := map[string]any{
+		"dbOk":                err == nil,
+		"licenseCount":        count,
+		"signingKeyLoaded":    len(s.signKey) == ed25519.PrivateKeySize && len(s.pubKey) == ed25519.PublicKeySize,
+		"telegramConfigured":  strings.TrimSpace(s.store.GetSetting("telegram_bot_token")) != "",
+		"botUsername":         strings.TrimSpace(s.store.GetSetting("telegram_bot_username")),
+		"notifierLastRun":     s.store.GetSetting(settingNotifierLastRun),
+		"notifierLastError":   s.store.GetSetting(settingNotifierLastError),
+		"notifierLastErrorAt": s.store.GetSetting(settingNotifierLastErrorAt),
+	}
+	if err != nil {
+		resp["dbError"] = err.Error()
+	}
+	s.ops.mu.Lock()
+	resp["telegramLastError"] = s.ops.telegramLastError
+	resp["telegramLastErrorAt"] = formatOptionalTime(s.ops.telegramLastErrorAt)
+	s.ops.mu.Unlock()
+	resp["telegramSends"], resp["telegramSentTotal"], resp["telegramFailedTotal"] = s.ops.telegramSends()
+	respondJSON(w, 200, resp)
+}
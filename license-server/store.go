@@ -2,13 +2,18 @@ package main
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"go.etcd.io/bbolt"
@@ -23,11 +28,13 @@ const (
 	bucketSessions     = "sessions"
 	bucketAPIKeys      = "api_keys"
 	bucketSettings     = "settings"
+	bucketDeployments  = "deployments"
 	adminUserKey       = "admin_user"
 )
 
 var (
 	errLicenseNotFound = errors.New("license not found")
+	errLicenseKeyTaken = errors.New("license key already exists")
 	errUnauthorized    = errors.New("unauthorized")
 )
 
@@ -51,7 +58,14 @@ type License struct {
 	LastIP           string `json:"lastIP,omitempty"`
 	ClientChatID     string `json:"clientChatId,omitempty"`
 	LastCheckAt      string `json:"lastCheckAt,omitempty"`
+	FirstActivatedAt string `json:"firstActivatedAt,omitempty"`
 	IsTrial          bool   `json:"isTrial,omitempty"`
+	Language         string `json:"language,omitempty"`             // client notification language (ru/en); empty uses notify_language
+	CreatedByKey     string `json:"createdByKey,omitempty"`         // ID of the API key that created the license
+	CreatedBy        string `json:"createdBy,omitempty"`            // "admin" or "apikey:<id>"; empty for licenses older than the field
+	NotifiedExpiry   string `json:"notifiedExpiry,omitempty"`       // expiryNoticeBucket of the last expiration notice sent to the admin chat
+	ClientNotified   string `json:"clientNotifiedExpiry,omitempty"` // expiryNoticeBucket of the last expiration notice sent to the client chat
+	WebhookExpiry    string `json:"webhookExpiry,omitempty"`        // expiryNoticeBucket of the last license.expiring webhook
 }
 
 type APIKey struct {
@@ -60,6 +74,9 @@ type APIKey struct {
 	Key       string `json:"key"`
 	Role      string `json:"role"`
 	CreatedAt string `json:"createdAt"`
+	// MaxLicenses caps the active licenses created with this key; 0 is
+	// unlimited.
+	MaxLicenses int `json:"maxLicenses,omitempty"`
 }
 
 type AdminUser struct {
@@ -86,15 +103,28 @@ type AuditEvent struct {
 
 type Store struct {
 	db *bbolt.DB
+
+	// settings caches the settings bucket; nil until first loaded.
+	settingsMu sync.RWMutex
+	settings   map[string]string
+}
+
+// defaultStorePath is license-server.db next to the executable, used when no
+// path is configured.
+func defaultStorePath() (string, error) {
+	ex, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("resolve executable path: %w", err)
+	}
+	return filepath.Join(filepath.Dir(ex), "license-server.db"), nil
 }
 
 func NewStore(path string) (*Store, error) {
 	if path == "" {
-		ex, err := os.Executable()
-		if err != nil {
-			return nil, fmt.Errorf("resolve executable path: %w", err)
+		var err error
+		if path, err = defaultStorePath(); err != nil {
+			return nil, err
 		}
-		path = filepath.Join(filepath.Dir(ex), "license-server.db")
 	}
 	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return nil, fmt.Errorf("create data dir: %w", err)
@@ -127,6 +157,9 @@ func NewStore(path string) (*Store, error) {
 		if _, err := tx.CreateBucketIfNotExists([]byte(bucketSettings)); err != nil {
 			return err
 		}
+		if _, err := tx.CreateBucketIfNotExists([]byte(bucketDeployments)); err != nil {
+			return err
+		}
 		return nil
 	})
 	if err != nil {
@@ -134,6 +167,30 @@ func NewStore(path string) (*Store, error) {
 		return nil, fmt.Errorf("init buckets: %w", err)
 	}
 
+	s := &Store{db: db}
+	if err := s.Migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// openStoreReadOnly opens an existing database for --check: the file must
+// exist, bbolt is opened read-only and no buckets or migrations are applied.
+func openStoreReadOnly(path string) (*Store, error) {
+	if path == "" {
+		var err error
+		if path, err = defaultStorePath(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("open db: %w", err)
+	}
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 2 * time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("open db: %w", err)
+	}
 	return &Store{db: db}, nil
 }
 
@@ -146,7 +203,7 @@ func (s *Store) CreateLicense(lic *License) error {
 	return s.db.Update(func(tx *bbolt.Tx) error {
 		byKey := tx.Bucket([]byte(bucketLicenseByKey))
 		if byKey.Get([]byte(lic.LicenseKey)) != nil {
-			return fmt.Errorf("license key already exists")
+			return errLicenseKeyTaken
 		}
 		buf, err := json.Marshal(lic)
 		if err != nil {
@@ -159,6 +216,35 @@ func (s *Store) CreateLicense(lic *License) error {
 	})
 }
 
+// ImportLicenses creates the given licenses in a single transaction. A
+// license whose key already exists is skipped; its error is returned at the
+// same index. The other licenses are still written.
+func (s *Store) ImportLicenses(list []*License) ([]error, error) {
+	errs := make([]error, len(list))
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		licenses := tx.Bucket([]byte(bucketLicenses))
+		byKey := tx.Bucket([]byte(bucketLicenseByKey))
+		for i, lic := range list {
+			if byKey.Get([]byte(lic.LicenseKey)) != nil {
+				errs[i] = errLicenseKeyTaken
+				continue
+			}
+			buf, err := json.Marshal(lic)
+			if err != nil {
+				return err
+			}
+			if err := licenses.Put([]byte(lic.ID), buf); err != nil {
+				return err
+			}
+			if err := byKey.Put([]byte(lic.LicenseKey), []byte(lic.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errs, err
+}
+
 func (s *Store) DeleteLicense(id string) error {
 	return s.db.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket([]byte(bucketLicenses))
@@ -173,6 +259,9 @@ func (s *Store) DeleteLicense(id string) error {
 		if err := b.Delete([]byte(id)); err != nil {
 			return err
 		}
+		if err := deleteDeployments(tx, id); err != nil {
+			return err
+		}
 		return tx.Bucket([]byte(bucketLicenseByKey)).Delete([]byte(lic.LicenseKey))
 	})
 }
@@ -204,7 +293,7 @@ func (s *Store) UpdateLicense(lic *License) error {
 		if prev.LicenseKey != lic.LicenseKey {
 			byKey := tx.Bucket([]byte(bucketLicenseByKey))
 			if byKey.Get([]byte(lic.LicenseKey)) != nil {
-				return fmt.Errorf("license key already exists")
+				return errLicenseKeyTaken
 			}
 			if err := byKey.Delete([]byte(prev.LicenseKey)); err != nil {
 				return err
@@ -217,6 +306,76 @@ func (s *Store) UpdateLicense(lic *License) error {
 	})
 }
 
+// MarkLicenseActivated stamps FirstActivatedAt on a license that has never
+// been validated before. The check and the write happen in one transaction so
+// concurrent validations report the first activation exactly once. It returns
+// the stored FirstActivatedAt and whether this call performed the transition.
+func (s *Store) MarkLicenseActivated(id, at string) (string, bool, error) {
+	var stamped string
+	var first bool
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketLicenses))
+		raw := b.Get([]byte(id))
+		if raw == nil {
+			return errLicenseNotFound
+		}
+		var lic License
+		if err := json.Unmarshal(raw, &lic); err != nil {
+			return err
+		}
+		stamped = lic.FirstActivatedAt
+		if lic.FirstActivatedAt != "" || lic.LastCheckAt != "" {
+			return nil
+		}
+		lic.FirstActivatedAt = at
+		buf, err := json.Marshal(lic)
+		if err != nil {
+			return err
+		}
+		stamped = at
+		first = true
+		return b.Put([]byte(id), buf)
+	})
+	return stamped, first, err
+}
+
+// noticeMarks says which recipients of an expiration notice got it.
+type noticeMarks struct {
+	Admin, Client, Webhook bool
+}
+
+// MarkLicenseNotified records bucket as the expiration notice last sent for a
+// license to each recipient in marks. It only touches NotifiedExpiry,
+// ClientNotified and WebhookExpiry, so it cannot undo an edit made while the
+// notifier was sending.
+func (s *Store) MarkLicenseNotified(id, bucket string, marks noticeMarks) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketLicenses))
+		raw := b.Get([]byte(id))
+		if raw == nil {
+			return errLicenseNotFound
+		}
+		var lic License
+		if err := json.Unmarshal(raw, &lic); err != nil {
+			return err
+		}
+		if marks.Admin {
+			lic.NotifiedExpiry = bucket
+		}
+		if marks.Client {
+			lic.ClientNotified = bucket
+		}
+		if marks.Webhook {
+			lic.WebhookExpiry = bucket
+		}
+		buf, err := json.Marshal(lic)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), buf)
+	})
+}
+
 func (s *Store) GetLicenseByID(id string) (*License, error) {
 	var lic License
 	err := s.db.View(func(tx *bbolt.Tx) error {
@@ -273,6 +432,60 @@ func (s *Store) ListLicenses() ([]License, error) {
 	return out, nil
 }
 
+// LicenseFilter narrows QueryLicenses. Status is compared with the effective
+// status; Query matches customerName, licenseKey and notes case-insensitively.
+type LicenseFilter struct {
+	Status    string
+	Plan      string
+	Query     string
+	CreatedBy string // exact License.CreatedBy
+}
+
+func (f LicenseFilter) match(lic *License, now time.Time) bool {
+	if f.Status != "" && effectiveLicenseStatus(lic, now) != f.Status {
+		return false
+	}
+	if f.Plan != "" && strings.ToLower(lic.Plan) != f.Plan {
+		return false
+	}
+	if f.CreatedBy != "" && lic.CreatedBy != f.CreatedBy {
+		return false
+	}
+	if f.Query != "" {
+		q := strings.ToLower(f.Query)
+		if !strings.Contains(strings.ToLower(lic.CustomerName), q) &&
+			!strings.Contains(strings.ToLower(lic.LicenseKey), q) &&
+			!strings.Contains(strings.ToLower(lic.Notes), q) {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryLicenses returns page (1-based) of the licenses matching f, newest
+// first, and the number of matches.
+func (s *Store) QueryLicenses(f LicenseFilter, page, pageSize int, now time.Time) ([]License, int, error) {
+	all, err := s.ListLicenses()
+	if err != nil {
+		return nil, 0, err
+	}
+	matched := all[:0]
+	for i := range all {
+		if f.match(&all[i], now) {
+			matched = append(matched, all[i])
+		}
+	}
+	start := (page - 1) * pageSize
+	if start > len(matched) || start < 0 {
+		start = len(matched)
+	}
+	end := len(matched)
+	if pageSize < end-start {
+		end = start + pageSize
+	}
+	return matched[start:end], len(matched), nil
+}
+
 func (s *Store) GetAdmin() (*AdminUser, error) {
 	var u AdminUser
 	err := s.db.View(func(tx *bbolt.Tx) error {
@@ -331,7 +544,7 @@ func (s *Store) ChangePassword(newPassword string) error {
 	return s.SetAdmin(u)
 }
 
-func (s *Store) createSession(kind, licenseID string) (*Session, error) {
+func (s *Store) createSession(kind, licenseID string, ttl time.Duration) (*Session, error) {
 	var sess Session
 	err := s.db.Update(func(tx *bbolt.Tx) error {
 		now := time.Now().UTC()
@@ -340,7 +553,7 @@ func (s *Store) createSession(kind, licenseID string) (*Session, error) {
 			Kind:      kind,
 			LicenseID: licenseID,
 			CreatedAt: now.Format(time.RFC3339),
-			ExpiresAt: now.Add(24 * time.Hour).Format(time.RFC3339),
+			ExpiresAt: now.Add(ttl).Format(time.RFC3339),
 		}
 		buf, err := json.Marshal(sess)
 		if err != nil {
@@ -354,15 +567,53 @@ func (s *Store) createSession(kind, licenseID string) (*Session, error) {
 	return &sess, nil
 }
 
-func (s *Store) CreateAdminSession() (*Session, error) {
-	return s.createSession("admin", "")
+func (s *Store) CreateAdminSession(ttl time.Duration) (*Session, error) {
+	return s.createSession("admin", "", ttl)
+}
+
+func (s *Store) CreateClientSession(licenseID string, ttl time.Duration) (*Session, error) {
+	if strings.TrimSpace(licenseID) == "" {
+		return nil, fmt.Errorf("license id required")
+	}
+	return s.createSession("client", strings.TrimSpace(licenseID), ttl)
 }
 
-func (s *Store) CreateClientSession(licenseID string) (*Session, error) {
+// CreateClientLoginLink issues a single-use token that logs the customer of
+// licenseID into the client portal without the email check. It lives in the
+// sessions bucket under kind client_link, which no session validator accepts.
+func (s *Store) CreateClientLoginLink(licenseID string, ttl time.Duration) (*Session, error) {
 	if strings.TrimSpace(licenseID) == "" {
 		return nil, fmt.Errorf("license id required")
 	}
-	return s.createSession("client", strings.TrimSpace(licenseID))
+	return s.createSession("client_link", strings.TrimSpace(licenseID), ttl)
+}
+
+// ConsumeClientLoginLink deletes the login link token and returns its license
+// ID if it was valid. A token works at most once, expired or not.
+func (s *Store) ConsumeClientLoginLink(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	var licenseID string
+	_ = s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketSessions))
+		v := b.Get([]byte(token))
+		if v == nil {
+			return nil
+		}
+		var sess Session
+		if err := json.Unmarshal(v, &sess); err != nil || sess.Kind != "client_link" {
+			return nil
+		}
+		if err := b.Delete([]byte(token)); err != nil {
+			return err
+		}
+		if exp, err := time.Parse(time.RFC3339, sess.ExpiresAt); err == nil && time.Now().UTC().Before(exp) {
+			licenseID = sess.LicenseID
+		}
+		return nil
+	})
+	return licenseID, licenseID != ""
 }
 
 func (s *Store) ValidateSession(id string) bool {
@@ -429,6 +680,122 @@ func (s *Store) DeleteSession(id string) error {
 	})
 }
 
+// DeleteAdminSessionsExcept removes every admin session other than keep and
+// returns how many were removed. Client portal sessions are left alone.
+func (s *Store) DeleteAdminSessionsExcept(keep string) (int, error) {
+	n := 0
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketSessions))
+		var stale [][]byte
+		_ = b.ForEach(func(k, v []byte) error {
+			var sess Session
+			if err := json.Unmarshal(v, &sess); err != nil {
+				return nil
+			}
+			if (sess.Kind == "" || sess.Kind == "admin") && string(k) != keep {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(stale)
+		return nil
+	})
+	return n, err
+}
+
+// PurgeExpiredSessions deletes sessions and login links past their expiry.
+// Rows that cannot be decoded or lack a valid ExpiresAt can never validate,
+// so they go too; legacy rows without Kind are judged by expiry alone.
+func (s *Store) PurgeExpiredSessions() (int, error) {
+	n := 0
+	now := time.Now().UTC()
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketSessions))
+		var stale [][]byte
+		_ = b.ForEach(func(k, v []byte) error {
+			var sess Session
+			if err := json.Unmarshal(v, &sess); err == nil {
+				if exp, err := time.Parse(time.RFC3339, sess.ExpiresAt); err == nil && now.Before(exp) {
+					return nil
+				}
+			}
+			stale = append(stale, append([]byte(nil), k...))
+			return nil
+		})
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(stale)
+		return nil
+	})
+	return n, err
+}
+
+// SessionHandle is the public identifier of a session: a digest of its secret
+// ID, safe to list and to revoke by without exposing the cookie value.
+func SessionHandle(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ListSessions returns unexpired sessions, newest first.
+func (s *Store) ListSessions() ([]Session, error) {
+	out := make([]Session, 0)
+	now := time.Now().UTC()
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucketSessions)).ForEach(func(k, v []byte) error {
+			var sess Session
+			if err := json.Unmarshal(v, &sess); err != nil {
+				return nil
+			}
+			if exp, err := time.Parse(time.RFC3339, sess.ExpiresAt); err != nil || !now.Before(exp) {
+				return nil
+			}
+			if sess.Kind == "" {
+				sess.Kind = "admin"
+			}
+			out = append(out, sess)
+			return nil
+		})
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt > out[j].CreatedAt })
+	return out, err
+}
+
+// DeleteSessionByHandle removes the session whose SessionHandle is handle and
+// returns it, or nil when none matches.
+func (s *Store) DeleteSessionByHandle(handle string) (*Session, error) {
+	var found *Session
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketSessions))
+		var key []byte
+		_ = b.ForEach(func(k, v []byte) error {
+			if key == nil && SessionHandle(string(k)) == handle {
+				key = append([]byte(nil), k...)
+				var sess Session
+				if json.Unmarshal(v, &sess) == nil {
+					found = &sess
+				} else {
+					found = &Session{ID: string(k)}
+				}
+			}
+			return nil
+		})
+		if key == nil {
+			return nil
+		}
+		return b.Delete(key)
+	})
+	return found, err
+}
+
 func randomStoreHex(n int) string {
 	const hex = "0123456789abcdef"
 	raw := make([]byte, n)
@@ -446,60 +813,242 @@ func (s *Store) AddAudit(ev AuditEvent) error {
 		if err != nil {
 			return err
 		}
-		return tx.Bucket([]byte(bucketAudit)).Put([]byte(ev.ID), buf)
+		return tx.Bucket([]byte(bucketAudit)).Put(auditKey(auditEventTime(&ev), ev.ID), buf)
 	})
 }
 
+// ListAudit returns every audit event, newest first.
 func (s *Store) ListAudit() ([]AuditEvent, error) {
-	out := make([]AuditEvent, 0)
+	out, _, err := s.QueryAudit(0, math.MaxInt, AuditFilter{})
+	return out, err
+}
+
+// ListAuditByLicense returns the audit events of one license, newest first.
+func (s *Store) ListAuditByLicense(licenseID string) ([]AuditEvent, error) {
+	out, _, err := s.QueryAudit(0, math.MaxInt, AuditFilter{LicenseID: licenseID})
+	return out, err
+}
+
+// Deployment is the last validate seen from one central instance of a
+// license. Records are keyed by license ID and instance, so every instance
+// sharing a key shows up separately.
+type Deployment struct {
+	LicenseID   string `json:"licenseId"`
+	Instance    string `json:"instance"`
+	InstanceID  string `json:"instanceId,omitempty"`
+	Hostname    string `json:"hostname,omitempty"`
+	IP          string `json:"ip,omitempty"`
+	Version     string `json:"version,omitempty"`
+	AgentCount  int    `json:"agentCount"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason,omitempty"`
+	FirstSeenAt string `json:"firstSeenAt"`
+	LastSeenAt  string `json:"lastSeenAt"`
+}
+
+func deploymentKey(licenseID, instance string) []byte {
+	return []byte(licenseID + "/" + instance)
+}
+
+// GetDeployment returns one deployment, or nil when the instance has not
+// been seen.
+func (s *Store) GetDeployment(licenseID, instance string) (*Deployment, error) {
+	var out *Deployment
 	err := s.db.View(func(tx *bbolt.Tx) error {
-		c := tx.Bucket([]byte(bucketAudit)).Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			var ev AuditEvent
-			if err := json.Unmarshal(v, &ev); err != nil {
-				continue
-			}
-			out = append(out, ev)
+		v := tx.Bucket([]byte(bucketDeployments)).Get(deploymentKey(licenseID, instance))
+		if v == nil {
+			return nil
+		}
+		var d Deployment
+		if err := json.Unmarshal(v, &d); err != nil {
+			return err
 		}
+		out = &d
 		return nil
 	})
+	return out, err
+}
+
+// SaveDeployment stores d. When d is a new instance and the license already
+// has limit deployments, the least recently seen ones are evicted first; the
+// evicted records are returned. limit <= 0 disables the cap.
+func (s *Store) SaveDeployment(d *Deployment, limit int) ([]Deployment, error) {
+	buf, err := json.Marshal(d)
 	if err != nil {
 		return nil, err
 	}
-	sort.Slice(out, func(i, j int) bool {
-		return out[i].CreatedAt > out[j].CreatedAt
+	var evicted []Deployment
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketDeployments))
+		key := deploymentKey(d.LicenseID, d.Instance)
+		if limit > 0 && b.Get(key) == nil {
+			type row struct {
+				key []byte
+				d   Deployment
+			}
+			var rows []row
+			prefix := d.LicenseID + "/"
+			c := b.Cursor()
+			for k, v := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, v = c.Next() {
+				var old Deployment
+				_ = json.Unmarshal(v, &old) // undecodable rows sort first and go first
+				rows = append(rows, row{append([]byte(nil), k...), old})
+			}
+			sort.Slice(rows, func(i, j int) bool { return rows[i].d.LastSeenAt < rows[j].d.LastSeenAt })
+			for i := 0; i <= len(rows)-limit; i++ {
+				if err := b.Delete(rows[i].key); err != nil {
+					return err
+				}
+				evicted = append(evicted, rows[i].d)
+			}
+		}
+		return b.Put(key, buf)
 	})
-	return out, nil
+	if err != nil {
+		return nil, err
+	}
+	return evicted, nil
 }
 
-func (s *Store) GetSetting(key string) string {
-	var val string
-	_ = s.db.View(func(tx *bbolt.Tx) error {
-		v := tx.Bucket([]byte(bucketSettings)).Get([]byte(key))
-		if v != nil {
-			val = string(v)
+// ListDeployments returns the deployments of a license, most recently seen
+// first.
+func (s *Store) ListDeployments(licenseID string) ([]Deployment, error) {
+	out := make([]Deployment, 0)
+	prefix := []byte(licenseID + "/")
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket([]byte(bucketDeployments)).Cursor()
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			var d Deployment
+			if err := json.Unmarshal(v, &d); err != nil {
+				continue
+			}
+			out = append(out, d)
 		}
 		return nil
 	})
-	return val
+	sort.Slice(out, func(i, j int) bool { return out[i].LastSeenAt > out[j].LastSeenAt })
+	return out, err
+}
+
+// PruneDeployments deletes deployments last seen before cutoff, and rows
+// that cannot be decoded.
+func (s *Store) PruneDeployments(cutoff time.Time) (int, error) {
+	n := 0
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(bucketDeployments))
+		var stale [][]byte
+		_ = b.ForEach(func(k, v []byte) error {
+			var d Deployment
+			if err := json.Unmarshal(v, &d); err == nil {
+				if seen, err := time.Parse(time.RFC3339, d.LastSeenAt); err == nil && !seen.Before(cutoff) {
+					return nil
+				}
+			}
+			stale = append(stale, append([]byte(nil), k...))
+			return nil
+		})
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(stale)
+		return nil
+	})
+	return n, err
 }
 
+// deleteDeployments drops every deployment of a license inside tx.
+func deleteDeployments(tx *bbolt.Tx, licenseID string) error {
+	b := tx.Bucket([]byte(bucketDeployments))
+	if b == nil {
+		return nil
+	}
+	prefix := licenseID + "/"
+	var keys [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSetting returns a setting from the in-memory cache.
+func (s *Store) GetSetting(key string) string {
+	s.settingsMu.RLock()
+	if s.settings != nil {
+		v := s.settings[key]
+		s.settingsMu.RUnlock()
+		return v
+	}
+	s.settingsMu.RUnlock()
+	return s.loadSettings()[key]
+}
+
+// SetSetting writes a setting through to the database and the cache.
 func (s *Store) SetSetting(key, value string) error {
-	return s.db.Update(func(tx *bbolt.Tx) error {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	err := s.db.Update(func(tx *bbolt.Tx) error {
 		return tx.Bucket([]byte(bucketSettings)).Put([]byte(key), []byte(value))
 	})
+	if err != nil {
+		return err
+	}
+	if s.settings != nil {
+		s.settings[key] = value
+	}
+	return nil
 }
 
+// GetAllSettings returns a copy of all settings.
 func (s *Store) GetAllSettings() map[string]string {
+	s.settingsMu.RLock()
+	if s.settings != nil {
+		out := maps.Clone(s.settings)
+		s.settingsMu.RUnlock()
+		return out
+	}
+	s.settingsMu.RUnlock()
+	return s.loadSettings()
+}
+
+// ReloadSettings discards the settings cache and reads the bucket again.
+func (s *Store) ReloadSettings() {
+	s.settingsMu.Lock()
+	s.settings = nil
+	s.settingsMu.Unlock()
+	s.loadSettings()
+}
+
+// loadSettings fills the cache from the database unless another caller
+// already did, and returns a copy of it: the cache itself may only be read
+// under settingsMu.
+func (s *Store) loadSettings() map[string]string {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+	if s.settings != nil {
+		return maps.Clone(s.settings)
+	}
 	out := make(map[string]string)
-	_ = s.db.View(func(tx *bbolt.Tx) error {
+	err := s.db.View(func(tx *bbolt.Tx) error {
 		c := tx.Bucket([]byte(bucketSettings)).Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			out[string(k)] = string(v)
 		}
 		return nil
 	})
-	return out
+	if err != nil {
+		// Leave the cache empty so the next read retries.
+		return out
+	}
+	s.settings = out
+	return maps.Clone(out)
 }
 
 func (s *Store) CreateAPIKey(ak *APIKey) error {
@@ -512,6 +1061,20 @@ func (s *Store) CreateAPIKey(ak *APIKey) error {
 	})
 }
 
+// GetAPIKey returns the API key with the given ID.
+func (s *Store) GetAPIKey(id string) (*APIKey, bool) {
+	var found *APIKey
+	_ = s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket([]byte(bucketAPIKeys)).Get([]byte(id))
+		var ak APIKey
+		if v != nil && json.Unmarshal(v, &ak) == nil {
+			found = &ak
+		}
+		return nil
+	})
+	return found, found != nil
+}
+
 func (s *Store) ListAPIKeys() ([]APIKey, error) {
 	out := make([]APIKey, 0)
 	err := s.db.View(func(tx *bbolt.Tx) error {
@@ -534,9 +1097,9 @@ func (s *Store) DeleteAPIKey(id string) error {
 	})
 }
 
-func (s *Store) ValidateAPIKey(key string) (string, bool) {
-	var role string
-	var found bool
+// FindAPIKey returns the API key record matching the secret key value.
+func (s *Store) FindAPIKey(key string) (*APIKey, bool) {
+	var found *APIKey
 	_ = s.db.View(func(tx *bbolt.Tx) error {
 		c := tx.Bucket([]byte(bucketAPIKeys)).Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
@@ -545,21 +1108,20 @@ func (s *Store) ValidateAPIKey(key string) (string, bool) {
 				continue
 			}
 			if ak.Key == key {
-				role = ak.Role
-				found = true
+				found = &ak
 				return nil
 			}
 		}
 		return nil
 	})
-	return role, found
+	return found, found != nil
 }
 
 func (s *Store) BackupDB() ([]byte, error) {
 	var buf []byte
 	err := s.db.View(func(tx *bbolt.Tx) error {
 		data := make(map[string]map[string]json.RawMessage)
-		for _, name := range []string{bucketLicenses, bucketLicenseByKey, bucketAudit, bucketAdmin, bucketSessions, bucketAPIKeys, bucketSettings} {
+		for _, name := range []string{bucketLicenses, bucketLicenseByKey, bucketAudit, bucketAdmin, bucketSessions, bucketAPIKeys, bucketSettings, bucketDeployments} {
 			b := tx.Bucket([]byte(name))
 			if b == nil {
 				continue
@@ -589,6 +1151,8 @@ func (s *Store) RestoreDB(data []byte) error {
 	if err := json.Unmarshal(data, &parsed); err != nil {
 		return fmt.Errorf("invalid backup format: %w", err)
 	}
+	// Settings are written straight to the bucket; drop the cache afterwards.
+	defer s.ReloadSettings()
 	return s.db.Update(func(tx *bbolt.Tx) error {
 		for name, entries := range parsed {
 			b := tx.Bucket([]byte(name))
@@ -608,6 +1172,6 @@ func (s *Store) RestoreDB(data []byte) error {
 				}
 			}
 		}
-		return nil
+		return rekeyAudit(tx)
 	})
 }
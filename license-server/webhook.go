@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// settingWebhookRetries is how many times a failed webhook delivery is
+// retried; empty means defaultWebhookRetries.
+const settingWebhookRetries = "webhook_retries"
+
+const (
+	defaultWebhookRetries = 3
+	maxWebhookRetries     = 5
+
+	// webhookRetryBase is the first backoff; each retry waits four times
+	// longer (1s, 4s, 16s, ...).
+	webhookRetryBase = time.Second
+
+	// webhookDeliveryDeadline bounds one event's delivery, retries included.
+	webhookDeliveryDeadline = 5 * time.Minute
+)
+
+// webhookRetries returns the configured retry count.
+func (s *Server) webhookRetries() int {
+	if n, err := strconv.Atoi(strings.TrimSpace(s.store.GetSetting(settingWebhookRetries))); err == nil && n >= 0 && n <= maxWebhookRetries {
+		return n
+	}
+	return defaultWebhookRetries
+}
+
+// validateWebhookSettings checks webhook_retries in a settings update.
+func validateWebhookSettings(req map[string]string) error {
+	v, ok := req[settingWebhookRetries]
+	if !ok {
+		return nil
+	}
+	v = strings.TrimSpace(v)
+	if v != "" {
+		if n, err := strconv.Atoi(v); err != nil || n < 0 || n > maxWebhookRetries {
+			return fmt.Errorf("%s: expected 0..%d, got %q", settingWebhookRetries, maxWebhookRetries, v)
+		}
+	}
+	req[settingWebhookRetries] = v
+	return nil
+}
+
+// webhookRetryDelay is the backoff before retry n (0-based).
+func webhookRetryDelay(n int) time.Duration {
+	return webhookRetryBase << (2 * n)
+}
+
+// webhookRetryable reports whether a failed attempt may succeed later:
+// network errors and 5xx answers are retried, other answers are final.
+func webhookRetryable(err error) bool {
+	var se *webhookStatusError
+	if errors.As(err, &se) {
+		return se.code >= 500
+	}
+	return true
+}
+
+// fireWebhook delivers the event in the background, retrying transient
+// failures with exponential backoff. A delivery that finally fails is logged
+// and recorded in the audit log as webhook_failed.
+func (s *Server) fireWebhook(event, licenseID string, data any) {
+	url := s.store.GetSetting("webhook_url")
+	if url == "" {
+		return
+	}
+	secret := s.store.GetSetting("webhook_secret")
+	retries := s.webhookRetries()
+	go s.deliverWebhook(url, secret, event, licenseID, webhookBody(event, data), retries)
+}
+
+func (s *Server) deliverWebhook(url, secret, event, licenseID string, body []byte, retries int) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookDeliveryDeadline)
+	defer cancel()
+	attempts := 0
+	var err error
+	for {
+		attempts++
+		if err = postWebhook(ctx, url, secret, body); err == nil {
+			return
+		}
+		if attempts > retries || !webhookRetryable(err) {
+			break
+		}
+		delay := webhookRetryDelay(attempts - 1)
+		if deadline, _ := ctx.Deadline(); time.Until(deadline) < delay {
+			break
+		}
+		time.Sleep(delay)
+	}
+	log.Printf("[WARN] webhook %s не доставлен после %d попыток: %v", event, attempts, err)
+	_ = s.store.AddAudit(AuditEvent{
+		ID:        randomHex(16),
+		LicenseID: licenseID,
+		Action:    "webhook_failed",
+		Actor:     "system",
+		Details:   fmt.Sprintf("event=%s attempts=%d error=%s", event, attempts, err),
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+}
@@ -4,14 +4,19 @@ import (
 	"context"
 	"embed"
 	"errors"
+	"flag"
 	"fmt"
 	"io/fs"
 	"log"
 	"net/http"
 	"nodax-central/internal/api"
+	"nodax-central/internal/logx"
+	"nodax-central/internal/netutil"
 	"nodax-central/internal/poller"
 	"nodax-central/internal/store"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -35,6 +40,7 @@ func runServer(stop <-chan struct{}) error {
 	if port == "" {
 		port = "8080"
 	}
+	netutil.SetDefaultAgentPort(cfg.AgentPort)
 
 	// Initialize poller (poll every 15 seconds)
 	p := poller.New(db, 15*time.Second)
@@ -53,9 +59,10 @@ func runServer(stop <-chan struct{}) error {
 
 	// API routes
 	handler := api.NewHandler(db, p)
-	licenseStop := make(chan struct{})
-	defer close(licenseStop)
-	handler.StartLicenseLoop(licenseStop)
+	bgStop := make(chan struct{})
+	defer close(bgStop)
+	handler.StartLicenseLoop(bgStop)
+	handler.StartReportLoop(bgStop)
 	handler.RegisterAuthRoutes(mux)
 	handler.RegisterRoutes(mux)
 
@@ -77,10 +84,12 @@ func runServer(stop <-chan struct{}) error {
 		f, err := distFS.Open(path[1:]) // strip leading /
 		if err == nil {
 			f.Close()
+			setAssetCacheHeaders(w, path)
 			fileServer.ServeHTTP(w, r)
 			return
 		}
 		// Fallback to index.html for SPA routing
+		setAssetCacheHeaders(w, "/index.html")
 		r.URL.Path = "/"
 		fileServer.ServeHTTP(w, r)
 	})
@@ -88,11 +97,15 @@ func runServer(stop <-chan struct{}) error {
 	// CORS + Auth middleware
 	corsHandler := corsMiddleware(handler.AuthMiddleware(mux))
 
-	fmt.Printf("=== NODAX Central Server ===\n")
-	fmt.Printf("Dashboard: http://localhost:%s\n", port)
-	fmt.Printf("API:       http://localhost:%s/api/\n", port)
-	fmt.Printf("Polling agents every 15s\n")
-	fmt.Println("Press Ctrl+C to stop")
+	if logx.JSON() {
+		logx.Info("server starting", "port", port, "pollInterval", "15s")
+	} else {
+		fmt.Printf("=== NODAX Central Server ===\n")
+		fmt.Printf("Dashboard: http://localhost:%s\n", port)
+		fmt.Printf("API:       http://localhost:%s/api/\n", port)
+		fmt.Printf("Polling agents every 15s\n")
+		fmt.Println("Press Ctrl+C to stop")
+	}
 
 	srv := &http.Server{
 		Addr:    ":" + port,
@@ -118,6 +131,7 @@ func runServer(stop <-chan struct{}) error {
 		}
 		return err
 	case <-stop:
+		logx.Info("server stopping")
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 		_ = srv.Shutdown(ctx)
@@ -125,7 +139,37 @@ func runServer(stop <-chan struct{}) error {
 	}
 }
 
+// runCheck opens the store read-only without serving, prints integrity
+// problems and returns the process exit code.
+func runCheck() int {
+	db, err := store.OpenReadOnly()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open store: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	if v, latest := db.SchemaVersion(), store.LatestSchemaVersion(); v < latest {
+		fmt.Printf("schema version %d, migrations up to %d will run on next start\n", v, latest)
+	}
+	problems := db.Check()
+	for _, p := range problems {
+		fmt.Println("PROBLEM:", p)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d problem(s) found\n", len(problems))
+		return 1
+	}
+	fmt.Println("store OK")
+	return 0
+}
+
 func main() {
+	logx.Init()
+	check := flag.Bool("check", false, "check store integrity and exit without serving")
+	flag.Parse()
+	if *check {
+		os.Exit(runCheck())
+	}
 	isSvc, err := isWindowsService()
 	if err != nil {
 		log.Fatalf("Failed to detect Windows service mode: %v", err)
@@ -142,6 +186,30 @@ func main() {
 	}
 }
 
+// hashedAssetRe matches Vite build output such as assets/index-B3x9kLq2.js,
+// whose content hash changes on every rebuild.
+var hashedAssetRe = regexp.MustCompile(`[-.][A-Za-z0-9_]{8,}\.(js|css|woff2?|ttf|svg|png|jpe?g|webp|gif|ico)$`)
+
+// assetMaxAge is the Cache-Control max-age for hashed assets, overridable via
+// NODAX_ASSET_MAX_AGE (seconds; 0 disables long-term caching).
+var assetMaxAge = func() int {
+	if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("NODAX_ASSET_MAX_AGE"))); err == nil && v >= 0 {
+		return v
+	}
+	return 31536000
+}()
+
+// setAssetCacheHeaders lets browsers keep hashed assets forever while always
+// revalidating index.html so new deployments are picked up.
+func setAssetCacheHeaders(w http.ResponseWriter, path string) {
+	switch {
+	case path == "/index.html":
+		w.Header().Set("Cache-Control", "no-cache")
+	case assetMaxAge > 0 && hashedAssetRe.MatchString(path):
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", assetMaxAge))
+	}
+}
+
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")